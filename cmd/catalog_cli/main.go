@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+	"ufut/internal/catalog_service"
+	sqliteRepoCatalog "ufut/internal/sqlite/catalog_service"
+	funcsUFUT "ufut/lib/funcs"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/segmentio/kafka-go"
+)
+
+const usage = `usage:
+	catalog_cli import -seller <sellerID> [-format csv|jsonl] [-dry-run] <file|->
+	catalog_cli export [-seller <sellerID>] [-format csv|jsonl] [-o <file>]
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	ctx := context.Background()
+	db_, err := sql.Open(
+		funcsUFUT.GetEnvDefault("SQLDATABASE", "sqlite3"),
+		funcsUFUT.GetEnvDefault("SQLCONNECT", "data.db"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db_.Close()
+	repo := sqliteRepoCatalog.NewSQLiteRepo(db_)
+	if err := repo.CreateTables(ctx); err != nil {
+		log.Fatal(err)
+	}
+	// item events are published only if Kafka is configured
+	var kafkaCatalogWriter catalog_service.Writer
+	if addr := funcsUFUT.GetEnvDefault("KAFKA_ADDR", ""); addr != "" {
+		writer := kafka.NewWriter(kafka.WriterConfig{
+			Brokers:      []string{addr},
+			Topic:        funcsUFUT.GetEnvDefault("KAFKA_CATALOG_TOPIC", "catalog_events"),
+			BatchTimeout: 10 * time.Millisecond,
+		})
+		defer writer.Close()
+		kafkaCatalogWriter = writer
+	}
+	// images are not touched by import/export, so no blob storage is needed
+	service := catalog_service.NewService(repo, nil, kafkaCatalogWriter, nil)
+	moderationCfg, err := catalog_service.LoadModerationConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	service.SetModerationConfig(moderationCfg)
+
+	switch os.Args[1] {
+	case "import":
+		os.Exit(runImport(ctx, service, os.Args[2:]))
+	case "export":
+		os.Exit(runExport(ctx, service, os.Args[2:]))
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func runImport(ctx context.Context, service *catalog_service.Service, args []string) int {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	seller := fs.String("seller", "", "sellerID the items belong to")
+	format := fs.String("format", catalog_service.FormatCSV, "csv or jsonl")
+	dryRun := fs.Bool("dry-run", false, "validate without writing")
+	fs.Parse(args)
+	if *seller == "" || fs.NArg() != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	var in io.Reader = os.Stdin
+	if fs.Arg(0) != "-" {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			log.Println(err)
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+	report, err := service.ImportItems(ctx, *seller, *format, in, *dryRun)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+	if len(report.Errors) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func runExport(ctx context.Context, service *catalog_service.Service, args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	seller := fs.String("seller", "", "export only this seller's items")
+	format := fs.String("format", catalog_service.FormatCSV, "csv or jsonl")
+	outPath := fs.String("o", "-", "output file")
+	fs.Parse(args)
+	var out io.Writer = os.Stdout
+	if *outPath != "-" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			log.Println(err)
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := service.ExportItems(ctx, *seller, *format, out); err != nil {
+		log.Println(err)
+		return 1
+	}
+	return 0
+}
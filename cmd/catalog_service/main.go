@@ -5,18 +5,79 @@ import (
 	"database/sql"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"time"
+	blobStorage "ufut/internal/blob_storage"
+	cacheRepoCatalog "ufut/internal/cache/catalog_service"
+	cacheStore "ufut/internal/cache/store"
 	"ufut/internal/catalog_service"
+	searchCatalog "ufut/internal/search"
 	sqliteRepoCatalog "ufut/internal/sqlite/catalog_service"
 	funcsUFUT "ufut/lib/funcs"
+	structsUFUT "ufut/lib/structs"
 
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/segmentio/kafka-go"
 )
 
 var (
-	_PORT string = funcsUFUT.GetEnvDefault("PORT", "8080")
+	_PORT      string               = funcsUFUT.GetEnvDefault("PORT", "8080")
+	_S3_CONFIG blobStorage.S3Config = blobStorage.S3Config{
+		Endpoint:  funcsUFUT.GetEnvDefault("S3_ENDPOINT", ""),
+		Bucket:    funcsUFUT.GetEnvDefault("S3_BUCKET", "ufut"),
+		Region:    funcsUFUT.GetEnvDefault("S3_REGION", "us-east-1"),
+		AccessKey: funcsUFUT.GetEnvDefault("S3_ACCESS_KEY", ""),
+		SecretKey: funcsUFUT.GetEnvDefault("S3_SECRET_KEY", ""),
+	}
 )
 
+/*
+Selects blob storage for item images: S3-compatible storage if S3_ENDPOINT is set,
+local directory BLOB_DIR otherwise
+*/
+func newBlobStore() (catalog_service.BlobStore, error) {
+	if _S3_CONFIG.Endpoint != "" {
+		return blobStorage.NewS3Store(_S3_CONFIG), nil
+	}
+	return blobStorage.NewLocalStore(funcsUFUT.GetEnvDefault("BLOB_DIR", "blobs"))
+}
+
+/*
+Selects cache backend for catalog reads: Redis if REDIS_ADDR is set and reachable,
+in-process LRU of CACHE_LRU_SIZE keys otherwise
+*/
+func newCacheStore(ctx context.Context) cacheStore.Store {
+	if addr := funcsUFUT.GetEnvDefault("REDIS_ADDR", ""); addr != "" {
+		redisClient, err := funcsUFUT.NewRedisClient(ctx, &structsUFUT.RedisConfig{
+			Addr:        addr,
+			Password:    funcsUFUT.GetEnvDefault("REDIS_PASSWORD", ""),
+			User:        funcsUFUT.GetEnvDefault("REDIS_USERNAME", ""),
+			MaxRetries:  3,
+			DialTimeout: 5 * time.Second,
+			Timeout:     100 * time.Millisecond,
+		})
+		if err == nil {
+			return cacheStore.NewRedisStore(redisClient)
+		}
+		log.Printf("redis is unavailable, falling back to in-process cache: %v\n", err)
+	}
+	size, err := strconv.Atoi(funcsUFUT.GetEnvDefault("CACHE_LRU_SIZE", "10000"))
+	if err != nil {
+		size = 10000
+	}
+	return cacheStore.NewLRUStore(size)
+}
+
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "local"
+	}
+	return name
+}
+
 func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -38,7 +99,100 @@ func main() {
 	if err := repo.CreateTables(ctx); err != nil {
 		log.Fatal(err)
 	}
-	service := catalog_service.NewService(repo)
+	var catalogRepo catalog_service.Repository = repo
+	if funcsUFUT.GetEnvDefault("CATALOG_CACHE", "on") != "off" {
+		cachedRepo := cacheRepoCatalog.NewCachedRepo(repo, newCacheStore(ctx), cacheRepoCatalog.DefaultCacheConfig)
+		kafkaCacheReader := kafka.NewReader(kafka.ReaderConfig{
+			Brokers: []string{funcsUFUT.GetEnvDefault("KAFKA_ADDR", "localhost:9090")},
+			Topic:   funcsUFUT.GetEnvDefault("KAFKA_CATALOG_TOPIC", "catalog_events"),
+			GroupID: "catalog_cache_" + hostname(),
+		})
+		defer kafkaCacheReader.Close()
+		go cachedRepo.ServeKafka(ctx, kafkaCacheReader)
+		catalogRepo = cachedRepo
+	}
+	blobs, err := newBlobStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if v, err := strconv.ParseInt(funcsUFUT.GetEnvDefault("IMAGE_MAX_SIZE", ""), 10, 64); err == nil {
+		catalog_service.MaxImageSize = v
+	}
+	catalog_service.ImagesBaseURL = funcsUFUT.GetEnvDefault("IMAGES_BASE_URL", catalog_service.ImagesBaseURL)
+	kafkaCatalogWriter := kafka.NewWriter(kafka.WriterConfig{
+		Brokers:      []string{funcsUFUT.GetEnvDefault("KAFKA_ADDR", "localhost:9090")},
+		Topic:        funcsUFUT.GetEnvDefault("KAFKA_CATALOG_TOPIC", "catalog_events"),
+		BatchTimeout: 10 * time.Millisecond,
+	})
+	defer kafkaCatalogWriter.Close()
+	kafkaNotificationsWriter := kafka.NewWriter(kafka.WriterConfig{
+		Brokers:      []string{funcsUFUT.GetEnvDefault("KAFKA_ADDR", "localhost:9090")},
+		Topic:        funcsUFUT.GetEnvDefault("KAFKA_NOTIFICATIONS_TOPIC", "notifications"),
+		BatchTimeout: 10 * time.Millisecond,
+	})
+	defer kafkaNotificationsWriter.Close()
+	service := catalog_service.NewService(catalogRepo, blobs, kafkaCatalogWriter, kafkaNotificationsWriter)
+	if err := service.SetCurrency(funcsUFUT.GetEnvDefault("CATALOG_CURRENCY", catalog_service.DefaultCurrency)); err != nil {
+		log.Fatal(err)
+	}
+	if err := service.SetLocale(funcsUFUT.GetEnvDefault("CATALOG_LOCALE", catalog_service.DefaultLocale)); err != nil {
+		log.Fatal(err)
+	}
+	if err := service.LoadExchangeRates(ctx); err != nil {
+		log.Fatal(err)
+	}
+	kafkaRatesWriter := kafka.NewWriter(kafka.WriterConfig{
+		Brokers:      []string{funcsUFUT.GetEnvDefault("KAFKA_ADDR", "localhost:9090")},
+		Topic:        funcsUFUT.GetEnvDefault("KAFKA_RATES_TOPIC", "exchange_rates"),
+		BatchTimeout: 10 * time.Millisecond,
+	})
+	defer kafkaRatesWriter.Close()
+	service.SetRatesWriter(kafkaRatesWriter)
+	service.SetRatesAdmins(strings.FieldsFunc(funcsUFUT.GetEnvDefault("EXCHANGE_RATES_ADMINS", ""), func(r rune) bool {
+		return r == ',' || r == ' '
+	}))
+	ratesInterval, err := time.ParseDuration(funcsUFUT.GetEnvDefault("EXCHANGE_RATES_RELOAD_INTERVAL", "1m"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	go service.RunExchangeRates(ctx, ratesInterval)
+	priceTransitionsInterval, err := time.ParseDuration(funcsUFUT.GetEnvDefault("PRICE_TRANSITIONS_INTERVAL", "1m"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	go service.RunPriceTransitions(ctx, priceTransitionsInterval)
+	kafkaOrdersReader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: []string{funcsUFUT.GetEnvDefault("KAFKA_ADDR", "localhost:9090")},
+		Topic:   funcsUFUT.GetEnvDefault("KAFKA_ORDER_EVENTS_TOPIC", "order_events"),
+		GroupID: "catalog_service",
+	})
+	defer kafkaOrdersReader.Close()
+	go service.ServeOrdersKafka(ctx, kafkaOrdersReader)
+	moderationCfg, err := catalog_service.LoadModerationConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(moderationCfg.Moderators) == 0 {
+		log.Println("MODERATORS is empty, nobody can moderate items")
+	}
+	service.SetModerationConfig(moderationCfg)
+	if funcsUFUT.GetEnvDefault("SEARCH_SUGGEST", "on") != "off" {
+		suggestCfg := searchCatalog.DefaultSuggestConfig
+		suggestCfg.DefaultLocale, _ = funcsUFUT.NormalizeLocale(funcsUFUT.GetEnvDefault("CATALOG_LOCALE", catalog_service.DefaultLocale))
+		suggester := searchCatalog.NewSuggester(suggestCfg)
+		if err := suggester.Load(ctx, repo); err != nil {
+			log.Fatal(err)
+		}
+		kafkaSuggestReader := kafka.NewReader(kafka.ReaderConfig{
+			Brokers: []string{funcsUFUT.GetEnvDefault("KAFKA_ADDR", "localhost:9090")},
+			Topic:   funcsUFUT.GetEnvDefault("KAFKA_CATALOG_TOPIC", "catalog_events"),
+			GroupID: "catalog_suggest_" + hostname(),
+		})
+		defer kafkaSuggestReader.Close()
+		go suggester.ServeKafka(ctx, kafkaSuggestReader)
+		go suggester.Run(ctx)
+		service.SetSuggester(suggester)
+	}
 	handler := catalog_service.NewHandler(service)
 	catalog_service.RegisterRoutes(srvMx, handler)
 	if err := server.ListenAndServe(); err != nil {
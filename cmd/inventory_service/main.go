@@ -8,8 +8,8 @@ import (
 	"time"
 	"ufut/internal/inventory_service"
 	sqliteRepoInventory "ufut/internal/sqlite/inventory_service"
+	sqliteOutbox "ufut/internal/sqlite/outbox"
 	funcsUFUT "ufut/lib/funcs"
-	structsUFUT "ufut/lib/structs"
 
 	// "ufut/internal/inventory_service"
 	// sqliteRepoInventory "ufut/internal/sqlite/inventory_service"
@@ -19,16 +19,7 @@ import (
 )
 
 var (
-	_PORT         string                  = funcsUFUT.GetEnvDefault("PORT", "8080")
-	_REDIS_CONFIG structsUFUT.RedisConfig = structsUFUT.RedisConfig{
-		Addr:        funcsUFUT.GetEnvDefault("REDIS_ADDR", "9091"),
-		Password:    funcsUFUT.GetEnvDefault("REDIS_PASSWORD", ""),
-		User:        funcsUFUT.GetEnvDefault("REDIS_USERNAME", ""),
-		DB:          0,
-		MaxRetries:  5,
-		DialTimeout: 10 * time.Second,
-		Timeout:     5 * time.Second,
-	}
+	_PORT string = funcsUFUT.GetEnvDefault("PORT", "8080")
 )
 
 func main() {
@@ -56,18 +47,28 @@ func main() {
 		Brokers: []string{funcsUFUT.GetEnvDefault("KAFKA_ADDR", "localhost:9090")},
 		Topic:   funcsUFUT.GetEnvDefault("KAFKA_ORDERS_TOPIC", "order_process"),
 	})
+	kafkaCatalogReader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: []string{funcsUFUT.GetEnvDefault("KAFKA_ADDR", "localhost:9090")},
+		Topic:   funcsUFUT.GetEnvDefault("KAFKA_CATALOG_TOPIC", "catalog_events"),
+		GroupID: funcsUFUT.GetEnvDefault("KAFKA_GROUP_ID", "inventory_service"),
+	})
 	kafkaNotificationsWriter := kafka.NewWriter(kafka.WriterConfig{
 		Brokers: []string{funcsUFUT.GetEnvDefault("KAFKA_ADDR", "localhost:9090")},
 		Topic:   funcsUFUT.GetEnvDefault("KAFKA_NOTIFICATIONS_TOPIC", "notifications"),
 	})
-	redisClient, err := inventory_service.NewRedisClient(ctx, &_REDIS_CONFIG)
+	outboxInterval, err := time.ParseDuration(funcsUFUT.GetEnvDefault("OUTBOX_RELAY_INTERVAL", "1s"))
 	if err != nil {
 		log.Panicln(err)
 	}
-	service := inventory_service.NewService(repo, kafkaOrdersReader, kafkaNotificationsWriter, redisClient)
+	relay := sqliteOutbox.NewRelay(db_, map[string]sqliteOutbox.Writer{
+		inventory_service.NotificationsTopic: kafkaNotificationsWriter,
+	})
+	go relay.Run(ctx, outboxInterval)
+	service := inventory_service.NewService(repo, kafkaOrdersReader, kafkaCatalogReader)
 	handler := inventory_service.NewHandler(service)
 	inventory_service.RegisterRoutes(srvMx, handler)
 	go service.ServeKafka(ctx)
+	go service.ServeCatalogKafka(ctx)
 	if err := server.ListenAndServe(); err != nil {
 		log.Fatal(err)
 	}
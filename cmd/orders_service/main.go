@@ -5,9 +5,13 @@ import (
 	"database/sql"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 	"ufut/internal/orders_service"
 	sqliteRepoOrders "ufut/internal/sqlite/orders_service"
+	sqliteOutbox "ufut/internal/sqlite/outbox"
 	funcsUFUT "ufut/lib/funcs"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -18,6 +22,14 @@ var (
 	_PORT string = funcsUFUT.GetEnvDefault("PORT", "8080")
 )
 
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "local"
+	}
+	return name
+}
+
 func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -44,7 +56,109 @@ func main() {
 		Topic:   funcsUFUT.GetEnvDefault("KAFKA_ORDERS_TOPIC", "order_process"),
 	})
 	defer kafkaWriter.Close()
-	service := orders_service.NewService(repo, kafkaWriter)
+	outboxInterval, err := time.ParseDuration(funcsUFUT.GetEnvDefault("OUTBOX_RELAY_INTERVAL", "1s"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	kafkaPaymentsWriter := kafka.NewWriter(kafka.WriterConfig{
+		Brokers: []string{funcsUFUT.GetEnvDefault("KAFKA_ADDR", "localhost:9090")},
+		Topic:   funcsUFUT.GetEnvDefault("KAFKA_PAYMENTS_TOPIC", "payments"),
+	})
+	defer kafkaPaymentsWriter.Close()
+	kafkaOrderEventsWriter := kafka.NewWriter(kafka.WriterConfig{
+		Brokers: []string{funcsUFUT.GetEnvDefault("KAFKA_ADDR", "localhost:9090")},
+		Topic:   funcsUFUT.GetEnvDefault("KAFKA_ORDER_EVENTS_TOPIC", "order_events"),
+	})
+	defer kafkaOrderEventsWriter.Close()
+	relay := sqliteOutbox.NewRelay(db_, map[string]sqliteOutbox.Writer{
+		orders_service.OrdersTopic:      kafkaWriter,
+		orders_service.PaymentsTopic:    kafkaPaymentsWriter,
+		orders_service.OrderEventsTopic: kafkaOrderEventsWriter,
+	})
+	go relay.Run(ctx, outboxInterval)
+	service := orders_service.NewService(repo)
+	payments, err := strconv.ParseBool(funcsUFUT.GetEnvDefault("PAYMENTS_ENABLED", "false"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	service.SetPayments(payments)
+	var timeouts orders_service.SagaTimeouts
+	for env, dst := range map[string]*time.Duration{
+		"SAGA_RESERVE_TIMEOUT": &timeouts.Reserve,
+		"SAGA_PAYMENT_TIMEOUT": &timeouts.Payment,
+		"SAGA_RELEASE_TIMEOUT": &timeouts.Release,
+	} {
+		if *dst, err = time.ParseDuration(funcsUFUT.GetEnvDefault(env, "0s")); err != nil {
+			log.Fatal(err)
+		}
+	}
+	service.SetSagaTimeouts(timeouts)
+	operators := strings.FieldsFunc(funcsUFUT.GetEnvDefault("ORDERS_OPERATORS", ""), func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+	if len(operators) == 0 {
+		log.Println("ORDERS_OPERATORS is empty, nobody can fulfil orders or manage sagas and coupons")
+	}
+	service.SetOperators(operators)
+	idempotencyRetention, err := time.ParseDuration(funcsUFUT.GetEnvDefault("IDEMPOTENCY_RETENTION", "24h"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	service.SetIdempotencyRetention(idempotencyRetention)
+	if path := funcsUFUT.GetEnvDefault("PRICING_RULES_FILE", ""); path != "" {
+		rules, err := orders_service.LoadPricingRules(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := service.SetPricingRules(rules); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := service.SetCurrency(funcsUFUT.GetEnvDefault("ORDERS_CURRENCY", orders_service.DefaultCurrency)); err != nil {
+		log.Fatal(err)
+	}
+	if err := service.LoadExchangeRates(ctx); err != nil {
+		log.Fatal(err)
+	}
+	// every instance keeps its own copy of the rates, so each one reads all snapshots
+	kafkaRatesReader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: []string{funcsUFUT.GetEnvDefault("KAFKA_ADDR", "localhost:9090")},
+		Topic:   funcsUFUT.GetEnvDefault("KAFKA_RATES_TOPIC", "exchange_rates"),
+		GroupID: "orders_rates_" + hostname(),
+	})
+	defer kafkaRatesReader.Close()
+	go service.ServeRatesKafka(ctx, kafkaRatesReader)
+	kafkaCatalogReader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: []string{funcsUFUT.GetEnvDefault("KAFKA_ADDR", "localhost:9090")},
+		Topic:   funcsUFUT.GetEnvDefault("KAFKA_CATALOG_TOPIC", "catalog_events"),
+		GroupID: "orders_service",
+	})
+	defer kafkaCatalogReader.Close()
+	go service.ServeCatalogKafka(ctx, kafkaCatalogReader)
+	kafkaInventoryReader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: []string{funcsUFUT.GetEnvDefault("KAFKA_ADDR", "localhost:9090")},
+		Topic:   funcsUFUT.GetEnvDefault("KAFKA_NOTIFICATIONS_TOPIC", "notifications"),
+		GroupID: "orders_service_inventory",
+	})
+	defer kafkaInventoryReader.Close()
+	go service.ServeInventoryKafka(ctx, kafkaInventoryReader)
+	kafkaPaymentsReader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: []string{funcsUFUT.GetEnvDefault("KAFKA_ADDR", "localhost:9090")},
+		Topic:   funcsUFUT.GetEnvDefault("KAFKA_PAYMENT_RESULTS_TOPIC", "payment_results"),
+		GroupID: "orders_service_payments",
+	})
+	defer kafkaPaymentsReader.Close()
+	go service.ServePaymentsKafka(ctx, kafkaPaymentsReader)
+	sagaInterval, err := time.ParseDuration(funcsUFUT.GetEnvDefault("SAGA_EXPIRE_INTERVAL", "10s"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	go service.RunSagas(ctx, sagaInterval)
+	recommendationsInterval, err := time.ParseDuration(funcsUFUT.GetEnvDefault("RECOMMENDATIONS_INTERVAL", "1h"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	go service.RunRecommendations(ctx, recommendationsInterval)
 	handler := orders_service.NewHandler(service)
 	orders_service.RegisterRoutes(srvMx, handler)
 	if err := server.ListenAndServe(); err != nil {
@@ -0,0 +1,11 @@
+package blobStorage
+
+import "errors"
+
+/*
+Defines possible errors during blob storage operations
+*/
+var (
+	ErrBlobNotFound = errors.New("blob not found")
+	ErrInvalidKey   = errors.New("invalid blob key")
+)
@@ -0,0 +1,93 @@
+package blobStorage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type LocalStore struct {
+	Root string
+}
+
+/*
+Creates new LocalStore instance
+root - directory where blobs are stored, created if it does not exist
+Returns pointer to LocalStore
+*/
+func NewLocalStore(root string) (*LocalStore, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalStore{Root: root}, nil
+}
+
+/*
+Maps blob key to the file path inside Root.
+Keys which escape Root are rejected
+*/
+func (s *LocalStore) path(key string) (string, error) {
+	if key == "" || strings.Contains(key, "..") {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.Root, filepath.FromSlash(key)), nil
+}
+
+/*
+Writes blob atomically: data goes to a temporary file first,
+which is renamed to the final path afterwards
+*/
+func (s *LocalStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, bytes.NewReader(data)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,70 @@
+package blobStorage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readBlob(t *testing.T, rc io.ReadCloser) string {
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	assert.NoError(t, err)
+	return string(data)
+}
+
+func TestLocalStore_RoundTrip(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "blobs")
+	store, err := NewLocalStore(root)
+	assert.NoError(t, err)
+
+	// nested keys create their directories, a second put replaces the blob
+	assert.NoError(t, store.Put(t.Context(), "items/i1/a.png", []byte("first"), "image/png"))
+	assert.NoError(t, store.Put(t.Context(), "items/i1/a.png", []byte("second"), "image/png"))
+	rc, err := store.Get(t.Context(), "items/i1/a.png")
+	assert.NoError(t, err)
+	assert.Equal(t, "second", readBlob(t, rc))
+
+	// temporary files don't stay behind
+	entries, err := os.ReadDir(filepath.Join(root, "items", "i1"))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	assert.NoError(t, store.Delete(t.Context(), "items/i1/a.png"))
+	_, err = store.Get(t.Context(), "items/i1/a.png")
+	assert.ErrorIs(t, err, ErrBlobNotFound)
+	// deleting a missing blob is not an error
+	assert.NoError(t, store.Delete(t.Context(), "items/i1/a.png"))
+}
+
+func TestLocalStore_Errors(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewLocalStore(root)
+	assert.NoError(t, err)
+
+	// keys must stay inside the root
+	for _, key := range []string{"", "../outside", "items/../../outside"} {
+		assert.ErrorIs(t, store.Put(t.Context(), key, []byte("x"), ""), ErrInvalidKey)
+		_, err := store.Get(t.Context(), key)
+		assert.ErrorIs(t, err, ErrInvalidKey)
+		assert.ErrorIs(t, store.Delete(t.Context(), key), ErrInvalidKey)
+	}
+	_, err = os.Stat(filepath.Join(filepath.Dir(root), "outside"))
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = store.Get(t.Context(), "missing.png")
+	assert.ErrorIs(t, err, ErrBlobNotFound)
+
+	// a blob can't be stored under another blob
+	assert.NoError(t, store.Put(t.Context(), "file", []byte("x"), ""))
+	err = store.Put(t.Context(), "file/nested", []byte("y"), "")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrInvalidKey)
+
+	// the root can't be created over a file
+	_, err = NewLocalStore(filepath.Join(root, "file"))
+	assert.Error(t, err)
+}
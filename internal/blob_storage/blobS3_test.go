@@ -0,0 +1,112 @@
+package blobStorage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/*
+Fake S3 keeping objects in memory by request path.
+Requests without a well-formed SigV4 header or with a mismatching payload hash are refused
+*/
+type fakeS3 struct {
+	mu           sync.Mutex
+	objects      map[string]string
+	contentTypes map[string]string
+	fail         int
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	sum := sha256.Sum256(body)
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=access/") ||
+		!strings.Contains(auth, "/eu-west-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=") ||
+		r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) || r.Header.Get("X-Amz-Date") == "" {
+		http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+		return
+	}
+	if f.fail != 0 {
+		http.Error(w, "InternalError", f.fail)
+		return
+	}
+	key := r.URL.EscapedPath()
+	switch r.Method {
+	case http.MethodPut:
+		f.objects[key] = string(body)
+		f.contentTypes[key] = r.Header.Get("Content-Type")
+	case http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, data)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func createTestS3Store(t *testing.T) (*S3Store, *fakeS3) {
+	fake := &fakeS3{objects: map[string]string{}, contentTypes: map[string]string{}}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	store := NewS3Store(S3Config{Endpoint: srv.URL + "/", Bucket: "images", Region: "eu-west-1",
+		AccessKey: "access", SecretKey: "secret"})
+	return store, fake
+}
+
+func TestS3Store_RoundTrip(t *testing.T) {
+	store, fake := createTestS3Store(t)
+
+	assert.NoError(t, store.Put(t.Context(), "items/i1/a b.png", []byte("image"), "image/png"))
+	// keys are percent-encoded except for slashes
+	assert.Equal(t, "image", fake.objects["/images/items/i1/a%20b.png"])
+	assert.Equal(t, "image/png", fake.contentTypes["/images/items/i1/a%20b.png"])
+
+	rc, err := store.Get(t.Context(), "items/i1/a b.png")
+	assert.NoError(t, err)
+	assert.Equal(t, "image", readBlob(t, rc))
+
+	assert.NoError(t, store.Delete(t.Context(), "items/i1/a b.png"))
+	assert.Empty(t, fake.objects)
+	_, err = store.Get(t.Context(), "items/i1/a b.png")
+	assert.ErrorIs(t, err, ErrBlobNotFound)
+}
+
+func TestS3Store_Errors(t *testing.T) {
+	store, fake := createTestS3Store(t)
+
+	assert.ErrorIs(t, store.Put(t.Context(), "", []byte("x"), ""), ErrInvalidKey)
+	_, err := store.Get(t.Context(), "")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+	assert.ErrorIs(t, store.Delete(t.Context(), ""), ErrInvalidKey)
+
+	// other statuses are reported with the start of the response body
+	fake.fail = http.StatusInternalServerError
+	err = store.Put(t.Context(), "a.png", []byte("x"), "")
+	assert.ErrorContains(t, err, "s3: unexpected status 500: InternalError")
+	_, err = store.Get(t.Context(), "a.png")
+	assert.ErrorContains(t, err, "s3: unexpected status 500")
+	assert.ErrorContains(t, store.Delete(t.Context(), "a.png"), "s3: unexpected status 500")
+
+	// a wrong region is refused by the storage
+	fake.fail = 0
+	other := NewS3Store(S3Config{Endpoint: store.cfg.Endpoint, Bucket: "images", AccessKey: "access", SecretKey: "secret"})
+	assert.ErrorContains(t, other.Put(t.Context(), "a.png", []byte("x"), ""), "s3: unexpected status 403")
+
+	// unreachable storage
+	down := NewS3Store(S3Config{Endpoint: "http://127.0.0.1:1", Bucket: "images"})
+	assert.Error(t, down.Put(t.Context(), "a.png", []byte("x"), ""))
+}
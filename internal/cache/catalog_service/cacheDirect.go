@@ -0,0 +1,76 @@
+package cacheRepoCatalog
+
+import (
+	"context"
+	structsUFUT "ufut/lib/structs"
+)
+
+// Reads which aren't cached and writes which change nothing cached go straight to the repository
+
+func (r *CachedRepo) ItemsByItemIDs(ctx context.Context, itemsIDs []string) ([]structsUFUT.ItemDataRSC, error) {
+	return r.repo.ItemsByItemIDs(ctx, itemsIDs)
+}
+
+func (r *CachedRepo) ItemIDsBySKUs(ctx context.Context, sellerID string, skus []string) (map[string]string, error) {
+	return r.repo.ItemIDsBySKUs(ctx, sellerID, skus)
+}
+
+func (r *CachedRepo) ExportItems(ctx context.Context, sellerID string, fn func(item *structsUFUT.ItemDataRSC) error) error {
+	return r.repo.ExportItems(ctx, sellerID, fn)
+}
+
+func (r *CachedRepo) ItemStatusHistory(ctx context.Context, itemID string) ([]structsUFUT.ItemStatusChangeRSC, error) {
+	return r.repo.ItemStatusHistory(ctx, itemID)
+}
+
+func (r *CachedRepo) ItemPriceHistory(ctx context.Context, itemID string, withScheduled bool) ([]structsUFUT.ItemPriceRSC, error) {
+	return r.repo.ItemPriceHistory(ctx, itemID, withScheduled)
+}
+
+func (r *CachedRepo) ItemTranslations(ctx context.Context, itemsIDs []string) (map[string][]structsUFUT.ItemTranslationRSC, error) {
+	return r.repo.ItemTranslations(ctx, itemsIDs)
+}
+
+func (r *CachedRepo) ExportItemTranslations(ctx context.Context, fn func(tr *structsUFUT.ItemTranslationRSC) error) error {
+	return r.repo.ExportItemTranslations(ctx, fn)
+}
+
+func (r *CachedRepo) CategoryTranslations(ctx context.Context) ([]structsUFUT.CategoryTranslationRSC, error) {
+	return r.repo.CategoryTranslations(ctx)
+}
+
+func (r *CachedRepo) ExchangeRates(ctx context.Context) (*structsUFUT.ExchangeRatesRSC, error) {
+	return r.repo.ExchangeRates(ctx)
+}
+
+func (r *CachedRepo) SellerProfile(ctx context.Context, req *structsUFUT.SellerProfileRSC) error {
+	return r.repo.SellerProfile(ctx, req)
+}
+
+func (r *CachedRepo) UpsertSellerProfile(ctx context.Context, profile *structsUFUT.SellerProfileRSC) error {
+	return r.repo.UpsertSellerProfile(ctx, profile)
+}
+
+func (r *CachedRepo) RateSeller(ctx context.Context, rating *structsUFUT.SellerRatingRSC) error {
+	return r.repo.RateSeller(ctx, rating)
+}
+
+func (r *CachedRepo) AddSellerCustomer(ctx context.Context, userID string, sellerIDs []string) error {
+	return r.repo.AddSellerCustomer(ctx, userID, sellerIDs)
+}
+
+func (r *CachedRepo) IsSellerCustomer(ctx context.Context, sellerID, userID string) (bool, error) {
+	return r.repo.IsSellerCustomer(ctx, sellerID, userID)
+}
+
+func (r *CachedRepo) ModerationQueue(ctx context.Context, req *structsUFUT.ModerationQueueRequestRSC) (*structsUFUT.ModerationQueueResponseRSC, error) {
+	return r.repo.ModerationQueue(ctx, req)
+}
+
+func (r *CachedRepo) ImagesByItemIDs(ctx context.Context, itemsIDs []string) (map[string][]structsUFUT.ItemImageRSC, error) {
+	return r.repo.ImagesByItemIDs(ctx, itemsIDs)
+}
+
+func (r *CachedRepo) ItemImage(ctx context.Context, img *structsUFUT.ItemImageRSC) error {
+	return r.repo.ItemImage(ctx, img)
+}
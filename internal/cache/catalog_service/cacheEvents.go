@@ -0,0 +1,50 @@
+package cacheRepoCatalog
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+	eventsUFUT "ufut/lib/events"
+	structsUFUT "ufut/lib/structs"
+
+	"github.com/segmentio/kafka-go"
+)
+
+/*
+Invalidates cache on item events, so changes made through other
+catalog_service instances are seen by this one
+*/
+func (r *CachedRepo) handleItemEvent(ctx context.Context, msg kafka.Message) {
+	event, err := eventsUFUT.Decode[structsUFUT.ItemDataRSC](msg)
+	if err != nil {
+		log.Printf("skip catalog event: %v\n", err)
+		return
+	}
+	switch event.Type {
+	case eventsUFUT.ItemCreated, eventsUFUT.ItemUpdated, eventsUFUT.ItemDeleted:
+		r.InvalidateItems(ctx, event.Payload.ItemID)
+	}
+}
+
+/*
+Consumes catalog events until ctx is cancelled.
+reader must use a consumer group of its own, every instance has to see every event
+*/
+func (r *CachedRepo) ServeKafka(ctx context.Context, reader *kafka.Reader) error {
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				return err
+			}
+			log.Printf("fetch error: %v\n", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		r.handleItemEvent(ctx, msg)
+		if err := reader.CommitMessages(ctx, msg); err != nil {
+			log.Printf("commit error: %v\n", err)
+		}
+	}
+}
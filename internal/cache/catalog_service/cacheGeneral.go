@@ -0,0 +1,138 @@
+package cacheRepoCatalog
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"time"
+	cacheStore "ufut/internal/cache/store"
+	"ufut/internal/catalog_service"
+
+	"github.com/google/uuid"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	keyCategories = "catalog:categories"
+	keyListGen    = "catalog:listgen"
+	keyItem       = "catalog:item:"
+	keyImages     = "catalog:images:"
+	keyList       = "catalog:list:"
+)
+
+type CacheConfig struct {
+	CategoriesTTL time.Duration `yaml:"categories_ttl"`
+	ItemTTL       time.Duration `yaml:"item_ttl"`
+	ListTTL       time.Duration `yaml:"list_ttl"`
+}
+
+var DefaultCacheConfig = CacheConfig{
+	CategoriesTTL: 10 * time.Minute,
+	ItemTTL:       5 * time.Minute,
+	ListTTL:       time.Minute,
+}
+
+/*
+CachedRepo is a read-through cache in front of catalog_service.Repository.
+Categories, items, item images and listings are cached; concurrent misses
+of one key are collapsed into a single repository call.
+Prices are resolved when an item is read, so a scheduled price shows up
+in cached items and listings within ItemTTL and ListTTL.
+Every write of the repository is wrapped and drops the cached data it changes
+*/
+type CachedRepo struct {
+	repo  catalog_service.Repository
+	store cacheStore.Store
+	cfg   CacheConfig
+	group singleflight.Group
+	// bumped by every invalidation, a load that saw it change doesn't cache its result
+	gen atomic.Uint64
+}
+
+var _ catalog_service.Repository = (*CachedRepo)(nil)
+
+/*
+Creates new CachedRepo instance
+repo - repository to wrap
+store - cache backend (Redis or in-process LRU)
+Returns pointer to CachedRepo
+*/
+func NewCachedRepo(repo catalog_service.Repository, store cacheStore.Store, cfg CacheConfig) *CachedRepo {
+	return &CachedRepo{repo: repo, store: store, cfg: cfg}
+}
+
+/*
+Decodes cached value of key into dst. On a miss calls fetch once for all
+concurrent callers and caches its result for ttl, unless the cache was invalidated
+while fetch ran and the result may predate the write. Cache failures are treated
+as misses, the repository stays the source of truth
+*/
+func (r *CachedRepo) load(ctx context.Context, key string, ttl time.Duration, dst any, fetch func(ctx context.Context) (any, error)) error {
+	if data, ok, err := r.store.Get(ctx, key); err == nil && ok {
+		if err := json.Unmarshal(data, dst); err == nil {
+			return nil
+		}
+	}
+	v, err, _ := r.group.Do(key, func() (any, error) {
+		// the result is shared, so one caller's cancellation must not fail the others
+		fetchCtx := context.WithoutCancel(ctx)
+		gen := r.gen.Load()
+		val, err := fetch(fetchCtx)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(val)
+		if err != nil {
+			return nil, err
+		}
+		if r.gen.Load() == gen {
+			r.store.Set(fetchCtx, key, data, ttl)
+		}
+		return data, nil
+	})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(v.([]byte), dst)
+}
+
+/*
+Returns current generation of listing keys. Listings are invalidated all at once
+by switching to a new generation, old entries just expire
+*/
+func (r *CachedRepo) listGen(ctx context.Context) string {
+	if data, ok, err := r.store.Get(ctx, keyListGen); err == nil && ok {
+		return string(data)
+	}
+	return r.bumpListGen(ctx)
+}
+
+func (r *CachedRepo) bumpListGen(ctx context.Context) string {
+	gen := uuid.NewString()
+	r.store.Set(ctx, keyListGen, []byte(gen), 0)
+	return gen
+}
+
+/*
+Drops the cached category list and all listings, for writes that change names or ordering of the whole catalog
+*/
+func (r *CachedRepo) invalidateCatalog(ctx context.Context) {
+	r.gen.Add(1)
+	r.group.Forget(keyCategories)
+	r.store.Delete(ctx, keyCategories)
+	r.bumpListGen(ctx)
+}
+
+/*
+Drops cached data of the items and all listings
+*/
+func (r *CachedRepo) InvalidateItems(ctx context.Context, itemsIDs ...string) {
+	r.gen.Add(1)
+	keys := make([]string, 0, len(itemsIDs))
+	for _, id := range itemsIDs {
+		keys = append(keys, keyItem+id)
+		r.group.Forget(keyItem + id)
+	}
+	r.store.Delete(ctx, keys...)
+	r.bumpListGen(ctx)
+}
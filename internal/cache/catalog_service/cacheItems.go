@@ -0,0 +1,180 @@
+package cacheRepoCatalog
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+	structsUFUT "ufut/lib/structs"
+)
+
+func (r *CachedRepo) Categories(ctx context.Context) ([]string, error) {
+	var categories []string
+	err := r.load(ctx, keyCategories, r.cfg.CategoriesTTL, &categories, func(ctx context.Context) (any, error) {
+		return r.repo.Categories(ctx)
+	})
+	return categories, err
+}
+
+/*
+Staff listings filtered by status are never cached
+*/
+func (r *CachedRepo) ItemsByParams(ctx context.Context, req *structsUFUT.ItemsRequestRSC) (structsUFUT.ItemsResponseRSC, error) {
+	if len(req.Statuses) > 0 {
+		return r.repo.ItemsByParams(ctx, req)
+	}
+	key := keyList + r.listGen(ctx) + ":" + req.Category + ":" + req.SellerID + ":" + req.OrderBy + ":" +
+		strconv.Itoa(req.Price) + ":" + strconv.Itoa(req.StartIndex) + ":" + strconv.Itoa(req.Count) + ":" + req.Cursor
+	var resp structsUFUT.ItemsResponseRSC
+	err := r.load(ctx, key, r.cfg.ListTTL, &resp, func(ctx context.Context) (any, error) {
+		return r.repo.ItemsByParams(ctx, req)
+	})
+	return resp, err
+}
+
+/*
+Items are cached by itemID alone, the category filter is applied to the cached item
+*/
+func (r *CachedRepo) ItemByItemID(ctx context.Context, req *structsUFUT.ItemDataRSC) error {
+	var item structsUFUT.ItemDataRSC
+	err := r.load(ctx, keyItem+req.ItemID, r.cfg.ItemTTL, &item, func(ctx context.Context) (any, error) {
+		item := structsUFUT.ItemDataRSC{ItemID: req.ItemID}
+		err := r.repo.ItemByItemID(ctx, &item)
+		return item, err
+	})
+	if err != nil {
+		return err
+	}
+	if req.Category != "" && req.Category != item.Category {
+		return sql.ErrNoRows
+	}
+	*req = item
+	return nil
+}
+
+func (r *CachedRepo) ItemImages(ctx context.Context, itemID string) ([]structsUFUT.ItemImageRSC, error) {
+	var images []structsUFUT.ItemImageRSC
+	err := r.load(ctx, keyImages+itemID, r.cfg.ItemTTL, &images, func(ctx context.Context) (any, error) {
+		return r.repo.ItemImages(ctx, itemID)
+	})
+	return images, err
+}
+
+func (r *CachedRepo) CreateItem(ctx context.Context, item *structsUFUT.ItemDataRSC) error {
+	if err := r.repo.CreateItem(ctx, item); err != nil {
+		return err
+	}
+	r.InvalidateItems(ctx, item.ItemID)
+	return nil
+}
+
+func (r *CachedRepo) ChangeItemStatus(ctx context.Context, change *structsUFUT.ItemStatusChangeRSC) error {
+	if err := r.repo.ChangeItemStatus(ctx, change); err != nil {
+		return err
+	}
+	r.InvalidateItems(ctx, change.ItemID)
+	return nil
+}
+
+func (r *CachedRepo) UpsertItemsBySKU(ctx context.Context, items []structsUFUT.ItemDataRSC) error {
+	if err := r.repo.UpsertItemsBySKU(ctx, items); err != nil {
+		return err
+	}
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ItemID)
+	}
+	r.InvalidateItems(ctx, ids...)
+	return nil
+}
+
+func (r *CachedRepo) AddItemImage(ctx context.Context, img *structsUFUT.ItemImageRSC) error {
+	if err := r.repo.AddItemImage(ctx, img); err != nil {
+		return err
+	}
+	r.InvalidateItems(ctx, img.ItemID)
+	r.group.Forget(keyImages + img.ItemID)
+	r.store.Delete(ctx, keyImages+img.ItemID)
+	return nil
+}
+
+func (r *CachedRepo) ModerateItem(ctx context.Context, decision *structsUFUT.ModerationDecisionRSC) error {
+	if err := r.repo.ModerateItem(ctx, decision); err != nil {
+		return err
+	}
+	r.InvalidateItems(ctx, decision.ItemID)
+	return nil
+}
+
+func (r *CachedRepo) AddItemPrice(ctx context.Context, entry *structsUFUT.ItemPriceRSC) error {
+	if err := r.repo.AddItemPrice(ctx, entry); err != nil {
+		return err
+	}
+	r.InvalidateItems(ctx, entry.ItemID)
+	return nil
+}
+
+func (r *CachedRepo) CancelItemPrice(ctx context.Context, itemID string, priceID int64, sellerID string) error {
+	if err := r.repo.CancelItemPrice(ctx, itemID, priceID, sellerID); err != nil {
+		return err
+	}
+	r.InvalidateItems(ctx, itemID)
+	return nil
+}
+
+func (r *CachedRepo) UpsertItemTranslation(ctx context.Context, tr *structsUFUT.ItemTranslationRSC) error {
+	if err := r.repo.UpsertItemTranslation(ctx, tr); err != nil {
+		return err
+	}
+	r.InvalidateItems(ctx, tr.ItemID)
+	return nil
+}
+
+func (r *CachedRepo) DeleteItemTranslation(ctx context.Context, itemID, locale, sellerID string) error {
+	if err := r.repo.DeleteItemTranslation(ctx, itemID, locale, sellerID); err != nil {
+		return err
+	}
+	r.InvalidateItems(ctx, itemID)
+	return nil
+}
+
+func (r *CachedRepo) UpsertCategoryTranslation(ctx context.Context, tr *structsUFUT.CategoryTranslationRSC) error {
+	if err := r.repo.UpsertCategoryTranslation(ctx, tr); err != nil {
+		return err
+	}
+	r.invalidateCatalog(ctx)
+	return nil
+}
+
+func (r *CachedRepo) DeleteCategoryTranslation(ctx context.Context, category, locale string) error {
+	if err := r.repo.DeleteCategoryTranslation(ctx, category, locale); err != nil {
+		return err
+	}
+	r.invalidateCatalog(ctx)
+	return nil
+}
+
+/*
+Items whose scheduled prices started or ended are moved in listings ordered by price
+*/
+func (r *CachedRepo) ClaimPriceTransitions(ctx context.Context, until time.Time) ([]string, error) {
+	ids, err := r.repo.ClaimPriceTransitions(ctx, until)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) > 0 {
+		r.InvalidateItems(ctx, ids...)
+	}
+	return ids, nil
+}
+
+/*
+Listings ordered by price compare converted prices, so new rates reorder them
+*/
+func (r *CachedRepo) SetExchangeRates(ctx context.Context, table *structsUFUT.ExchangeRatesRSC) error {
+	if err := r.repo.SetExchangeRates(ctx, table); err != nil {
+		return err
+	}
+	r.invalidateCatalog(ctx)
+	return nil
+}
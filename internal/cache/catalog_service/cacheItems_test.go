@@ -0,0 +1,206 @@
+package cacheRepoCatalog
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	cacheStore "ufut/internal/cache/store"
+	"ufut/internal/catalog_service"
+	structsUFUT "ufut/lib/structs"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingRepo serves a fixed set of items and counts reads
+type countingRepo struct {
+	catalog_service.Repository
+	mu            sync.Mutex
+	items         map[string]structsUFUT.ItemDataRSC
+	itemReads     atomic.Int32
+	listReads     atomic.Int32
+	categoryReads atomic.Int32
+	releaseRead   chan struct{}
+	// blocks an item read after it has copied the item
+	afterRead chan struct{}
+}
+
+func (r *countingRepo) ItemByItemID(ctx context.Context, req *structsUFUT.ItemDataRSC) error {
+	r.itemReads.Add(1)
+	if r.releaseRead != nil {
+		<-r.releaseRead
+	}
+	r.mu.Lock()
+	item, ok := r.items[req.ItemID]
+	r.mu.Unlock()
+	if r.afterRead != nil {
+		<-r.afterRead
+	}
+	if !ok {
+		return sql.ErrNoRows
+	}
+	*req = item
+	return nil
+}
+
+func (r *countingRepo) ItemsByParams(ctx context.Context, req *structsUFUT.ItemsRequestRSC) (structsUFUT.ItemsResponseRSC, error) {
+	r.listReads.Add(1)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var resp structsUFUT.ItemsResponseRSC
+	for id, item := range r.items {
+		if item.Category == req.Category {
+			resp.ItemsIDs = append(resp.ItemsIDs, id)
+		}
+	}
+	return resp, nil
+}
+
+func (r *countingRepo) ChangeItemStatus(ctx context.Context, change *structsUFUT.ItemStatusChangeRSC) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := r.items[change.ItemID]
+	stored.Status = change.ToStatus
+	r.items[change.ItemID] = stored
+	return nil
+}
+
+func (r *countingRepo) Categories(ctx context.Context) ([]string, error) {
+	r.categoryReads.Add(1)
+	return []string{"books"}, nil
+}
+
+func (r *countingRepo) UpsertCategoryTranslation(ctx context.Context, tr *structsUFUT.CategoryTranslationRSC) error {
+	return nil
+}
+
+func (r *countingRepo) SetExchangeRates(ctx context.Context, table *structsUFUT.ExchangeRatesRSC) error {
+	return nil
+}
+
+func (r *countingRepo) CreateItem(ctx context.Context, item *structsUFUT.ItemDataRSC) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.items[item.ItemID] = *item
+	return nil
+}
+
+func newCountingRepo() *countingRepo {
+	return &countingRepo{items: map[string]structsUFUT.ItemDataRSC{
+		"1": {ItemID: "1", Name: "book", Category: "books", Status: "available"},
+	}}
+}
+
+func TestCachedRepo_ItemByItemID(t *testing.T) {
+	inner := newCountingRepo()
+	repo := NewCachedRepo(inner, cacheStore.NewLRUStore(100), DefaultCacheConfig)
+
+	for range 3 {
+		item := structsUFUT.ItemDataRSC{ItemID: "1"}
+		assert.NoError(t, repo.ItemByItemID(t.Context(), &item))
+		assert.Equal(t, "book", item.Name)
+	}
+	assert.Equal(t, int32(1), inner.itemReads.Load())
+
+	wrongCategory := structsUFUT.ItemDataRSC{ItemID: "1", Category: "home"}
+	assert.ErrorIs(t, repo.ItemByItemID(t.Context(), &wrongCategory), sql.ErrNoRows)
+
+	assert.NoError(t, repo.ChangeItemStatus(t.Context(), &structsUFUT.ItemStatusChangeRSC{ItemID: "1", ToStatus: "deleted"}))
+	item := structsUFUT.ItemDataRSC{ItemID: "1"}
+	assert.NoError(t, repo.ItemByItemID(t.Context(), &item))
+	assert.Equal(t, "deleted", item.Status)
+	assert.Equal(t, int32(2), inner.itemReads.Load())
+
+	missing := structsUFUT.ItemDataRSC{ItemID: "2"}
+	assert.ErrorIs(t, repo.ItemByItemID(t.Context(), &missing), sql.ErrNoRows)
+}
+
+func TestCachedRepo_Singleflight(t *testing.T) {
+	inner := newCountingRepo()
+	inner.releaseRead = make(chan struct{})
+	repo := NewCachedRepo(inner, cacheStore.NewLRUStore(100), DefaultCacheConfig)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			item := structsUFUT.ItemDataRSC{ItemID: "1"}
+			assert.NoError(t, repo.ItemByItemID(context.Background(), &item))
+		})
+	}
+	// let all goroutines pile up behind the first read
+	time.Sleep(50 * time.Millisecond)
+	close(inner.releaseRead)
+	wg.Wait()
+	assert.Equal(t, int32(1), inner.itemReads.Load())
+}
+
+func TestCachedRepo_LoadRacingInvalidation(t *testing.T) {
+	inner := newCountingRepo()
+	inner.afterRead = make(chan struct{})
+	repo := NewCachedRepo(inner, cacheStore.NewLRUStore(100), DefaultCacheConfig)
+
+	// the read has the item before the change, its result must not outlive the change in the cache
+	done := make(chan structsUFUT.ItemDataRSC)
+	go func() {
+		item := structsUFUT.ItemDataRSC{ItemID: "1"}
+		assert.NoError(t, repo.ItemByItemID(context.Background(), &item))
+		done <- item
+	}()
+	assert.Eventually(t, func() bool { return inner.itemReads.Load() == 1 }, time.Second, time.Millisecond)
+	assert.NoError(t, repo.ChangeItemStatus(t.Context(), &structsUFUT.ItemStatusChangeRSC{ItemID: "1", ToStatus: "deleted"}))
+	close(inner.afterRead)
+	assert.Equal(t, "available", (<-done).Status)
+
+	item := structsUFUT.ItemDataRSC{ItemID: "1"}
+	assert.NoError(t, repo.ItemByItemID(t.Context(), &item))
+	assert.Equal(t, "deleted", item.Status)
+	assert.Equal(t, int32(2), inner.itemReads.Load())
+}
+
+func TestCachedRepo_ItemsByParamsInvalidation(t *testing.T) {
+	inner := newCountingRepo()
+	repo := NewCachedRepo(inner, cacheStore.NewLRUStore(100), DefaultCacheConfig)
+	req := structsUFUT.ItemsRequestRSC{Category: "books", Count: 10}
+
+	resp, err := repo.ItemsByParams(t.Context(), &req)
+	assert.NoError(t, err)
+	assert.Len(t, resp.ItemsIDs, 1)
+	_, err = repo.ItemsByParams(t.Context(), &req)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), inner.listReads.Load())
+
+	assert.NoError(t, repo.CreateItem(t.Context(), &structsUFUT.ItemDataRSC{ItemID: "2", Category: "books"}))
+	resp, err = repo.ItemsByParams(t.Context(), &req)
+	assert.NoError(t, err)
+	assert.Len(t, resp.ItemsIDs, 2)
+	assert.Equal(t, int32(2), inner.listReads.Load())
+}
+
+func TestCachedRepo_CatalogWideInvalidation(t *testing.T) {
+	inner := newCountingRepo()
+	repo := NewCachedRepo(inner, cacheStore.NewLRUStore(100), DefaultCacheConfig)
+	req := structsUFUT.ItemsRequestRSC{Category: "books", Count: 10}
+	read := func() {
+		_, err := repo.Categories(t.Context())
+		assert.NoError(t, err)
+		_, err = repo.ItemsByParams(t.Context(), &req)
+		assert.NoError(t, err)
+	}
+
+	read()
+	read()
+	assert.Equal(t, int32(1), inner.categoryReads.Load())
+	assert.Equal(t, int32(1), inner.listReads.Load())
+
+	// renamed categories and new rates are visible without waiting for the TTL
+	assert.NoError(t, repo.UpsertCategoryTranslation(t.Context(), &structsUFUT.CategoryTranslationRSC{}))
+	read()
+	assert.Equal(t, int32(2), inner.categoryReads.Load())
+	assert.Equal(t, int32(2), inner.listReads.Load())
+	assert.NoError(t, repo.SetExchangeRates(t.Context(), &structsUFUT.ExchangeRatesRSC{}))
+	read()
+	assert.Equal(t, int32(3), inner.categoryReads.Load())
+	assert.Equal(t, int32(3), inner.listReads.Load())
+}
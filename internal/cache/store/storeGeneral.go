@@ -0,0 +1,16 @@
+package cacheStore
+
+import (
+	"context"
+	"time"
+)
+
+/*
+Store is a key-value cache with per-key expiration.
+A zero ttl means the key never expires (but may still be evicted)
+*/
+type Store interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
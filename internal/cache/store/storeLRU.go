@@ -0,0 +1,93 @@
+package cacheStore
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+type lruEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+/*
+LRUStore is an in-process Store which keeps at most Capacity keys,
+evicting the least recently used ones
+*/
+type LRUStore struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+	now      func() time.Time
+}
+
+/*
+Creates new LRUStore instance
+capacity - maximum number of keys, must be positive
+Returns pointer to LRUStore
+*/
+func NewLRUStore(capacity int) *LRUStore {
+	return &LRUStore{
+		capacity: max(capacity, 1),
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+		now:      time.Now,
+	}
+}
+
+func (s *LRUStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	e := el.Value.(*lruEntry)
+	if !e.expiresAt.IsZero() && s.now().After(e.expiresAt) {
+		s.removeElement(el)
+		return nil, false, nil
+	}
+	s.ll.MoveToFront(el)
+	return e.value, true, nil
+}
+
+func (s *LRUStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = s.now().Add(ttl)
+	}
+	if el, ok := s.items[key]; ok {
+		e := el.Value.(*lruEntry)
+		e.value = value
+		e.expiresAt = expiresAt
+		s.ll.MoveToFront(el)
+		return nil
+	}
+	s.items[key] = s.ll.PushFront(&lruEntry{key: key, value: value, expiresAt: expiresAt})
+	for s.ll.Len() > s.capacity {
+		s.removeElement(s.ll.Back())
+	}
+	return nil
+}
+
+func (s *LRUStore) Delete(ctx context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		if el, ok := s.items[key]; ok {
+			s.removeElement(el)
+		}
+	}
+	return nil
+}
+
+func (s *LRUStore) removeElement(el *list.Element) {
+	s.ll.Remove(el)
+	delete(s.items, el.Value.(*lruEntry).key)
+}
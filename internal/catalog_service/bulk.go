@@ -0,0 +1,210 @@
+package catalog_service
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	structsUFUT "ufut/lib/structs"
+)
+
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+
+	// MaxImportRows limits the number of rows in a single import
+	MaxImportRows = 10000
+	// MaxImportSize limits the size of an import file in bytes
+	MaxImportSize = 32 << 20
+)
+
+var (
+	ErrUnknownFormat   = errors.New("unknown format, expected csv or jsonl")
+	ErrTooManyRows     = errors.New("too many rows in import")
+	ErrMissingCSVField = errors.New("csv header misses required column")
+)
+
+// csvColumns is the column order of exported CSV files; import accepts any order
+var csvColumns = []string{"sku", "name", "description", "price", "currency", "category", "status"}
+
+/*
+Maps Content-Type of the request to import format
+*/
+func FormatFromContentType(contentType string) string {
+	switch {
+	case strings.HasPrefix(contentType, "text/csv"):
+		return FormatCSV
+	case strings.HasPrefix(contentType, "application/x-ndjson"),
+		strings.HasPrefix(contentType, "application/jsonl"):
+		return FormatJSONL
+	}
+	return ""
+}
+
+/*
+Parses import file. Rows which can't be parsed are reported in rowErrs
+with 1-based row numbers (CSV header is not counted)
+*/
+func readItems(format string, r io.Reader) ([]structsUFUT.ItemDataRSC, []int, []structsUFUT.ImportRowErrorRSC, error) {
+	switch format {
+	case FormatCSV:
+		return readItemsCSV(r)
+	case FormatJSONL:
+		return readItemsJSONL(r)
+	}
+	return nil, nil, nil, ErrUnknownFormat
+}
+
+func readItemsCSV(r io.Reader) ([]structsUFUT.ItemDataRSC, []int, []structsUFUT.ImportRowErrorRSC, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cols := make(map[string]int, len(header))
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"sku", "name", "price", "category"} {
+		if _, ok := cols[name]; !ok {
+			return nil, nil, nil, fmt.Errorf("%w: %s", ErrMissingCSVField, name)
+		}
+	}
+	var (
+		items   []structsUFUT.ItemDataRSC
+		rows    []int
+		rowErrs []structsUFUT.ImportRowErrorRSC
+	)
+	for row := 1; ; row++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if row > MaxImportRows {
+			return nil, nil, nil, ErrTooManyRows
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				rowErrs = append(rowErrs, structsUFUT.ImportRowErrorRSC{Row: row, Error: parseErr.Err.Error()})
+				continue
+			}
+			return nil, nil, nil, err
+		}
+		field := func(name string) string {
+			i, ok := cols[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		item := structsUFUT.ItemDataRSC{
+			SKU:         field("sku"),
+			Name:        field("name"),
+			Description: field("description"),
+			Currency:    field("currency"),
+			Category:    field("category"),
+			Status:      field("status"),
+		}
+		price, err := strconv.Atoi(field("price"))
+		if err != nil {
+			rowErrs = append(rowErrs, structsUFUT.ImportRowErrorRSC{Row: row, SKU: item.SKU, Error: "invalid price"})
+			continue
+		}
+		item.Price = price
+		items = append(items, item)
+		rows = append(rows, row)
+	}
+	return items, rows, rowErrs, nil
+}
+
+func readItemsJSONL(r io.Reader) ([]structsUFUT.ItemDataRSC, []int, []structsUFUT.ImportRowErrorRSC, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	var (
+		items   []structsUFUT.ItemDataRSC
+		rows    []int
+		rowErrs []structsUFUT.ImportRowErrorRSC
+	)
+	for row := 1; sc.Scan(); row++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			row--
+			continue
+		}
+		if row > MaxImportRows {
+			return nil, nil, nil, ErrTooManyRows
+		}
+		var item structsUFUT.ItemDataRSC
+		if err := json.Unmarshal([]byte(line), &item); err != nil {
+			rowErrs = append(rowErrs, structsUFUT.ImportRowErrorRSC{Row: row, Error: "invalid json"})
+			continue
+		}
+		items = append(items, item)
+		rows = append(rows, row)
+	}
+	return items, rows, rowErrs, sc.Err()
+}
+
+type itemsEncoder interface {
+	Encode(item *structsUFUT.ItemDataRSC) error
+	Flush() error
+}
+
+func newItemsEncoder(format string, w io.Writer) (itemsEncoder, error) {
+	switch format {
+	case FormatCSV:
+		return &csvItemsEncoder{w: csv.NewWriter(w)}, nil
+	case FormatJSONL:
+		bw := bufio.NewWriter(w)
+		return &jsonlItemsEncoder{w: bw, enc: json.NewEncoder(bw)}, nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+type csvItemsEncoder struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+func (e *csvItemsEncoder) Encode(item *structsUFUT.ItemDataRSC) error {
+	if !e.headerWritten {
+		e.headerWritten = true
+		if err := e.w.Write(csvColumns); err != nil {
+			return err
+		}
+	}
+	return e.w.Write([]string{
+		item.SKU, item.Name, item.Description, strconv.Itoa(item.Price), item.Currency, item.Category, item.Status,
+	})
+}
+
+func (e *csvItemsEncoder) Flush() error {
+	if !e.headerWritten {
+		e.headerWritten = true
+		if err := e.w.Write(csvColumns); err != nil {
+			return err
+		}
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type jsonlItemsEncoder struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (e *jsonlItemsEncoder) Encode(item *structsUFUT.ItemDataRSC) error {
+	return e.enc.Encode(item)
+}
+
+func (e *jsonlItemsEncoder) Flush() error {
+	return e.w.Flush()
+}
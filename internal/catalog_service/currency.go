@@ -0,0 +1,263 @@
+package catalog_service
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"log"
+	"slices"
+	"strings"
+	"time"
+	eventsUFUT "ufut/lib/events"
+	funcsUFUT "ufut/lib/funcs"
+	structsUFUT "ufut/lib/structs"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	// DefaultCurrency is the catalog currency unless SetCurrency is called
+	DefaultCurrency = "USD"
+	// MaxRatesSize limits the size of an uploaded exchange rate table in bytes
+	MaxRatesSize = 1 << 20
+)
+
+var (
+	ErrReferenceCurrency = errors.New("reference currency of exchange rates must be the catalog currency")
+	ErrNotRatesAdmin     = errors.New("not allowed to set exchange rates")
+)
+
+/*
+Sets the catalog currency: new items without a currency are priced in it
+and exchange rates are relative to it
+*/
+func (s *Service) SetCurrency(code string) error {
+	code, err := funcsUFUT.NormalizeCurrency(code)
+	if err != nil {
+		return err
+	}
+	s.currency = code
+	return nil
+}
+
+/*
+Enables publishing of exchange rate snapshots, so other services convert with the same rates
+*/
+func (s *Service) SetRatesWriter(w *kafka.Writer) {
+	s.ratesWriter = w
+}
+
+/*
+Sets staff IDs allowed to replace the exchange rate table; empty allows nobody
+*/
+func (s *Service) SetRatesAdmins(ids []string) {
+	s.ratesAdmins = ids
+}
+
+func (s *Service) catalogCurrency() string {
+	if s.currency == "" {
+		return DefaultCurrency
+	}
+	return s.currency
+}
+
+/*
+Loads stored exchange rates, an empty table leaves conversions disabled
+*/
+func (s *Service) LoadExchangeRates(ctx context.Context) error {
+	table, err := s.repo.ExchangeRates(ctx)
+	if err != nil {
+		return err
+	}
+	if table.Reference == "" {
+		return nil
+	}
+	rates, err := funcsUFUT.NewExchangeRates(table)
+	if err != nil {
+		return err
+	}
+	s.rates.Store(rates)
+	return nil
+}
+
+/*
+Reloads exchange rates every interval until ctx is cancelled,
+picks up rates set through other instances
+*/
+func (s *Service) RunExchangeRates(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := s.LoadExchangeRates(ctx); err != nil {
+			log.Printf("reload exchange rates: %v\n", err)
+		}
+	}
+}
+
+func (s *Service) ExchangeRates(ctx context.Context) (*structsUFUT.ExchangeRatesRSC, error) {
+	table, err := s.repo.ExchangeRates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if table.Reference == "" {
+		table.Reference = s.catalogCurrency()
+	}
+	return table, nil
+}
+
+/*
+Validates and replaces the whole exchange rate table on behalf of a rates admin;
+Reference defaults to the catalog currency
+*/
+func (s *Service) SetExchangeRates(ctx context.Context, staffID string, table *structsUFUT.ExchangeRatesRSC) error {
+	if !slices.Contains(s.ratesAdmins, staffID) {
+		return ErrNotRatesAdmin
+	}
+	if table.Reference == "" {
+		table.Reference = s.catalogCurrency()
+	}
+	rates, err := funcsUFUT.NewExchangeRates(table)
+	if err != nil {
+		return err
+	}
+	if rates.Reference() != s.catalogCurrency() {
+		return ErrReferenceCurrency
+	}
+	if err := s.repo.SetExchangeRates(ctx, table); err != nil {
+		return err
+	}
+	s.rates.Store(rates)
+	stored, err := s.repo.ExchangeRates(ctx)
+	if err != nil {
+		log.Printf("failed load exchange rates for publishing: %v\n", err)
+		return nil
+	}
+	s.publishExchangeRates(ctx, stored)
+	return nil
+}
+
+/*
+Publishes the snapshot of the exchange rate table, a failed publish is only logged
+*/
+func (s *Service) publishExchangeRates(ctx context.Context, table *structsUFUT.ExchangeRatesRSC) {
+	if s.ratesWriter == nil {
+		return
+	}
+	msg, err := eventsUFUT.NewMessage(eventsUFUT.ExchangeRatesUpdated, eventsProducer, "", table.Reference, table)
+	if err != nil {
+		log.Printf("failed marshal exchange rates: %v\n", err)
+		return
+	}
+	if err := s.ratesWriter.WriteMessages(ctx, msg); err != nil {
+		log.Printf("failed send exchange rates to kafka: %v\n", err)
+	}
+}
+
+/*
+Normalizes the currency of a written item, empty currency becomes the catalog currency
+*/
+func (s *Service) itemCurrency(item *structsUFUT.ItemDataRSC) error {
+	if item.Currency == "" {
+		item.Currency = s.catalogCurrency()
+		return nil
+	}
+	code, err := funcsUFUT.NormalizeCurrency(item.Currency)
+	if err != nil {
+		return err
+	}
+	item.Currency = code
+	return nil
+}
+
+/*
+Parses "currency,rate" rows, a header row naming the columns is skipped
+*/
+func readExchangeRatesCSV(r io.Reader) ([]structsUFUT.ExchangeRateRSC, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 2
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) > 0 && strings.EqualFold(strings.TrimSpace(records[0][0]), "currency") {
+		records = records[1:]
+	}
+	rates := make([]structsUFUT.ExchangeRateRSC, 0, len(records))
+	for _, record := range records {
+		rates = append(rates, structsUFUT.ExchangeRateRSC{
+			Currency: strings.TrimSpace(record[0]),
+			Rate:     strings.TrimSpace(record[1]),
+		})
+	}
+	return rates, nil
+}
+
+/*
+Returns the normalized currency the response is requested in,
+empty code keeps prices in the currencies they are stored in
+*/
+func (s *Service) responseCurrency(code string) (string, error) {
+	if code == "" {
+		return "", nil
+	}
+	code, err := funcsUFUT.NormalizeCurrency(code)
+	if err != nil {
+		return "", err
+	}
+	if code != s.catalogCurrency() && s.rates.Load() == nil {
+		return "", funcsUFUT.ErrNoExchangeRate
+	}
+	return code, nil
+}
+
+/*
+Converts prices of the item into currency, see funcsUFUT.ExchangeRates.Convert for rounding
+*/
+func (s *Service) convertItem(item *structsUFUT.ItemDataRSC, currency string) error {
+	if currency == "" || item.Currency == currency {
+		return nil
+	}
+	rates := s.rates.Load()
+	if rates == nil {
+		return funcsUFUT.ErrNoExchangeRate
+	}
+	price, err := rates.Convert(int64(item.Price), item.Currency, currency)
+	if err != nil {
+		return err
+	}
+	regularPrice, err := rates.Convert(int64(item.RegularPrice), item.Currency, currency)
+	if err != nil {
+		return err
+	}
+	item.Price, item.RegularPrice, item.Currency = int(price), int(regularPrice), currency
+	return nil
+}
+
+func (s *Service) convertPriceEntries(entries []structsUFUT.ItemPriceRSC, currency string) error {
+	if currency == "" {
+		return nil
+	}
+	rates := s.rates.Load()
+	for i := range entries {
+		entry := &entries[i]
+		if entry.Currency == currency {
+			continue
+		}
+		if rates == nil {
+			return funcsUFUT.ErrNoExchangeRate
+		}
+		price, err := rates.Convert(int64(entry.Price), entry.Currency, currency)
+		if err != nil {
+			return err
+		}
+		entry.Price, entry.Currency = int(price), currency
+	}
+	return nil
+}
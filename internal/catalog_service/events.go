@@ -0,0 +1,46 @@
+package catalog_service
+
+import (
+	"context"
+	"log"
+	eventsUFUT "ufut/lib/events"
+	structsUFUT "ufut/lib/structs"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// eventsProducer names the service in the metadata of published events
+const eventsProducer = "catalog_service"
+
+/*
+Publishes item change events. The change is already stored,
+so a failed publish is only logged and doesn't fail the request
+*/
+func (s *Service) publishItemEvents(ctx context.Context, eventType string, items ...structsUFUT.ItemDataRSC) {
+	if s.kafkaWriter == nil || len(items) == 0 {
+		return
+	}
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ItemID)
+	}
+	// consumers indexing text in every locale get translations with the item
+	translations, err := s.repo.ItemTranslations(ctx, ids)
+	if err != nil {
+		log.Printf("failed load translations for %s events: %v\n", eventType, err)
+	}
+	msgs := make([]kafka.Message, 0, len(items))
+	for i := range items {
+		items[i].Translations = translations[items[i].ItemID]
+		// keyed by itemID, so events of one item keep their order
+		msg, err := eventsUFUT.NewMessage(eventType, eventsProducer, "", items[i].ItemID, items[i])
+		if err != nil {
+			log.Printf("failed marshal %s event: %v\n", eventType, err)
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	if err := s.kafkaWriter.WriteMessages(ctx, msgs...); err != nil {
+		log.Printf("failed send %s events to kafka: %v\n", eventType, err)
+	}
+}
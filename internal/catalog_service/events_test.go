@@ -0,0 +1,95 @@
+package catalog_service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	eventsUFUT "ufut/lib/events"
+	structsUFUT "ufut/lib/structs"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+type testWriter struct {
+	fail error
+	msgs []kafka.Message
+}
+
+func (w *testWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if w.fail != nil {
+		return w.fail
+	}
+	w.msgs = append(w.msgs, msgs...)
+	return nil
+}
+
+func TestHandler_ItemEvents(t *testing.T) {
+	srvc, cleanUp := CreateCatalogService(t)
+	defer cleanUp()
+	writer := &testWriter{}
+	srvc.kafkaWriter = writer
+	h := NewHandler(srvc)
+	do := func(handle http.HandlerFunc, getterID string, body any) int {
+		data, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		handle(w, withGetterID(httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data)), getterID))
+		return w.Code
+	}
+	decode := func(msg kafka.Message) *eventsUFUT.Envelope[structsUFUT.ItemDataRSC] {
+		event, err := eventsUFUT.Decode[structsUFUT.ItemDataRSC](msg)
+		assert.NoError(t, err)
+		assert.Equal(t, event.Payload.ItemID, string(msg.Key))
+		assert.Equal(t, "catalog_service", event.Producer)
+		return event
+	}
+
+	// created for review, then updated once approved
+	itemID := createTestItems(t, h, "seller", structsUFUT.ItemDataRSC{Name: "book", Price: 10, Category: "books"})[0]
+	assert.Len(t, writer.msgs, 2)
+	created := decode(writer.msgs[0])
+	assert.Equal(t, eventsUFUT.ItemCreated, created.Type)
+	assert.Equal(t, itemID, created.Payload.ItemID)
+	assert.Equal(t, "seller", created.Payload.SellerID)
+	assert.Equal(t, "book", created.Payload.Name)
+	approved := decode(writer.msgs[1])
+	assert.Equal(t, eventsUFUT.ItemUpdated, approved.Type)
+	assert.Equal(t, structsUFUT.ItemStatusAvailable, approved.Payload.Status)
+
+	// a translation sends the item back to review, events carry the item's translations
+	writer.msgs = nil
+	assert.Equal(t, http.StatusOK, do(h.SetItemTranslation, "seller",
+		structsUFUT.ItemTranslationRSC{ItemID: itemID, Locale: "de", Name: "Buch"}))
+	assert.Len(t, writer.msgs, 1)
+	updated := decode(writer.msgs[0])
+	assert.Equal(t, eventsUFUT.ItemUpdated, updated.Type)
+	assert.Equal(t, structsUFUT.ItemStatusPendingReview, updated.Payload.Status)
+	if assert.Len(t, updated.Payload.Translations, 1) {
+		assert.Equal(t, "Buch", updated.Payload.Translations[0].Name)
+	}
+	assert.Equal(t, http.StatusOK, moderateTestItem(h, "approve", itemID, ""))
+
+	// the change is stored even if it can't be published
+	writer.msgs = nil
+	writer.fail = errors.New("kafka is down")
+	assert.Equal(t, http.StatusOK, do(h.ChangeItemStatus, "seller",
+		structsUFUT.ItemStatusChangeRSC{ItemID: itemID, ToStatus: structsUFUT.ItemStatusOutOfStock}))
+	assert.Empty(t, writer.msgs)
+	writer.fail = nil
+	item := structsUFUT.ItemDataRSC{ItemID: itemID}
+	assert.NoError(t, srvc.repo.ItemByItemID(t.Context(), &item))
+	assert.Equal(t, structsUFUT.ItemStatusOutOfStock, item.Status)
+
+	// rejected changes publish nothing
+	assert.Equal(t, http.StatusForbidden, do(h.DeleteItem, "other", structsUFUT.ItemDataRSC{ItemID: itemID, Category: "books"}))
+	assert.Empty(t, writer.msgs)
+	assert.Equal(t, http.StatusOK, do(h.DeleteItem, "seller", structsUFUT.ItemDataRSC{ItemID: itemID, Category: "books"}))
+	assert.Len(t, writer.msgs, 1)
+	deleted := decode(writer.msgs[0])
+	assert.Equal(t, eventsUFUT.ItemDeleted, deleted.Type)
+	assert.Equal(t, structsUFUT.ItemStatusDeleted, deleted.Payload.Status)
+}
@@ -2,8 +2,12 @@ package catalog_service
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"slices"
 	"strconv"
+	"time"
 	funcsUFUT "ufut/lib/funcs"
 	structsUFUT "ufut/lib/structs"
 
@@ -20,11 +24,45 @@ func NewHandler(srvc *Service) *Handler {
 
 func RegisterRoutes(mux *http.ServeMux, h *Handler) {
 	handledFuncs := map[string]http.HandlerFunc{
-		"GET /api/user/categories":    h.Categories,
-		"GET /api/user/itemsByParams": h.ItemsByParams,
-		"GET /api/user/itemByItemID":  h.ItemByItemID,
-		"POST /api/staff/createItem":  h.CreateItem,
-		"POST /api/staff/deleteItem":  h.DeleteItem,
+		"GET /api/user/categories":      h.Categories,
+		"GET /api/user/itemsByParams":   h.ItemsByParams,
+		"GET /api/user/itemByItemID":    h.ItemByItemID,
+		"POST /api/user/items:batchGet": h.ItemsBatchGet,
+		"POST /api/staff/createItem":    h.CreateItem,
+		"POST /api/staff/deleteItem":    h.DeleteItem,
+
+		"GET /api/user/search/suggest":  h.Suggest,
+		"POST /api/user/search/queries": h.RecordSearchQuery,
+
+		"GET /api/user/sellers/{id}":        h.SellerProfile,
+		"GET /api/user/sellers/{id}/items":  h.SellerItems,
+		"POST /api/user/sellers/{id}/rate":  h.RateSeller,
+		"POST /api/staff/sellerProfile":     h.UpdateSellerProfile,
+		"GET /api/staff/myItems":            h.MyItems,
+		"POST /api/staff/scheduleItemPrice": h.ScheduleItemPrice,
+		"POST /api/staff/cancelItemPrice":   h.CancelItemPrice,
+		"GET /api/staff/itemPriceHistory":   h.StaffItemPriceHistory,
+		"GET /api/user/itemPriceHistory":    h.ItemPriceHistory,
+		"POST /api/staff/changeItemStatus":  h.ChangeItemStatus,
+		"POST /api/staff/restoreItem":       h.RestoreItem,
+		"GET /api/staff/itemStatusHistory":  h.ItemStatusHistory,
+		"GET /api/user/exchangeRates":       h.ExchangeRates,
+		"POST /api/staff/exchangeRates":     h.SetExchangeRates,
+
+		"GET /api/staff/itemTranslations":           h.ItemTranslations,
+		"POST /api/staff/itemTranslation":           h.SetItemTranslation,
+		"POST /api/staff/deleteItemTranslation":     h.DeleteItemTranslation,
+		"GET /api/staff/categoryTranslations":       h.CategoryTranslations,
+		"POST /api/staff/categoryTranslation":       h.SetCategoryTranslation,
+		"POST /api/staff/deleteCategoryTranslation": h.DeleteCategoryTranslation,
+
+		"POST /api/staff/uploadItemImage": h.UploadItemImage,
+		"POST /api/staff/importItems":     h.ImportItems,
+		"GET /api/staff/exportItems":      h.ExportItems,
+
+		"GET /api/staff/moderation/queue":    h.ModerationQueue,
+		"POST /api/staff/moderation/approve": h.ApproveItem,
+		"POST /api/staff/moderation/reject":  h.RejectItem,
 
 		// "POST /api/showcase/reserveItem":           h.ReserveItem,
 		// "POST /api/showcase/cancelItemReservation": h.CancelItemReservation,
@@ -34,6 +72,8 @@ func RegisterRoutes(mux *http.ServeMux, h *Handler) {
 		mux.HandleFunc(key, funcsUFUT.AuthMiddleware(val))
 	}
 
+	// images are referenced from <img> tags, which can't carry a bearer token
+	mux.HandleFunc("GET /api/user/images/{imageID}", h.ItemImage)
 }
 
 /*
@@ -41,20 +81,33 @@ Query args:
 
 	None
 
+Headers:
+
+	Accept-Language: optional (locales of display names, catalog locale if none is translated)
+	ETag, Cache-Control, Vary; answers If-None-Match with 304
+
 Response:
 
 	"categories": []string
+	"displayNames": []string (parallel to categories, localized names to show)
 */
 func (h *Handler) Categories(w http.ResponseWriter, r *http.Request) {
 	var resp struct {
-		Categories []string `json:"categories"`
+		Categories   []string `json:"categories"`
+		DisplayNames []string `json:"displayNames"`
 	}
-	res, err := h.service.Categories(r.Context())
+	res, names, err := h.service.LocalizedCategories(r.Context(), h.service.LocaleChain(r.Header.Get("Accept-Language")))
 	if err != nil {
 		http.Error(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
 	resp.Categories = res
+	resp.DisplayNames = names
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Header().Set("Vary", "Accept-Language")
+	if funcsUFUT.CheckNotModified(w, r, funcsUFUT.ETagOf(append(slices.Clip(res), names...)...), time.Time{}) {
+		return
+	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	json.NewEncoder(w).Encode(resp)
 }
@@ -62,17 +115,32 @@ func (h *Handler) Categories(w http.ResponseWriter, r *http.Request) {
 /*
 Query args:
 
-	category: always (specifies which category to search in)
+	category: optional (specifies which category to search in, all categories if not provided)
 	price: TODO
-	startindex: optional, 0 if not provided (offset from begging)
-	count: optional, 10 if not provided (number of items in response)
+	startindex: optional, 0 if not provided (offset from begging; deprecated, use cursor)
+	count: optional, 10 if not provided, at most 100 (number of items in response)
 	orderby: "asc" or "desc". optional, "desc" if not provided. (specifies order)
+	cursor: optional, "next_cursor" of the previous page (must be used with the same orderby)
+
+Headers:
+
+	ETag, Cache-Control; answers If-None-Match with 304. No Last-Modified, items leaving the listing
+	don't change the date of the items left in it
 
 resp:
 
 	itemsID: array of <string>ItemID
+	versions: array of <int>item version (parallel to itemsID)
+	lastModified: time (latest update of the listed items)
+	next_cursor: string (token of the next page, empty on the last page)
 */
 func (h *Handler) ItemsByParams(w http.ResponseWriter, r *http.Request) {
+	params := listingParams(r)
+	res, err := h.service.ItemsByParams(r.Context(), &params)
+	h.writeListing(w, r, res, err)
+}
+
+func listingParams(r *http.Request) structsUFUT.ItemsRequestRSC {
 	q_vals := r.URL.Query()
 	var params structsUFUT.ItemsRequestRSC
 	params.Category = q_vals.Get("category")
@@ -80,11 +148,211 @@ func (h *Handler) ItemsByParams(w http.ResponseWriter, r *http.Request) {
 	params.StartIndex, _ = strconv.Atoi(q_vals.Get("startindex"))
 	params.Count, _ = strconv.Atoi(q_vals.Get("count"))
 	params.OrderBy = q_vals.Get("orderby")
-	res, err := h.service.ItemsByParams(r.Context(), &params)
+	params.Cursor = q_vals.Get("cursor")
+	return params
+}
+
+func (h *Handler) writeListing(w http.ResponseWriter, r *http.Request, res structsUFUT.ItemsResponseRSC, err error) {
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=10")
+	if funcsUFUT.CheckNotModified(w, r, listingETag(&res), time.Time{}) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(res)
+}
+
+/*
+Query args:
+
+	q: always (text typed so far)
+	limit: optional, at most 10 suggestions of each kind if not provided
+
+Headers:
+
+	Accept-Language: optional (suggestions come from the index of the first indexed locale)
+
+resp:
+
+	"query": string (normalized q)
+	"suggestions": array of {"text": string, "type": "item" or "category"}
+	"popular": []string (past queries starting with q, most popular first)
+*/
+func (h *Handler) Suggest(w http.ResponseWriter, r *http.Request) {
+	q_vals := r.URL.Query()
+	limit, _ := strconv.Atoi(q_vals.Get("limit"))
+	resp, err := h.service.Suggest(q_vals.Get("q"), limit, h.service.LocaleChain(r.Header.Get("Accept-Language")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=30")
+	w.Header().Set("Vary", "Accept-Language")
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(resp)
+}
+
+/*
+Headers:
+
+	Accept-Language: optional (the query is suggested to users of the first locale)
+
+JSON args:
+
+	"query": string (always, submitted search text; repeats and too many queries of the getter aren't counted)
+
+resp:
+
+	"status": "ok"
+*/
+func (h *Handler) RecordSearchQuery(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Query string `json:"query"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	locales := h.service.LocaleChain(r.Header.Get("Accept-Language"))
+	if err := h.service.RecordSearchQuery(req.Query, locales, funcsUFUT.GetterIDFromContext(r.Context())); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+/*
+Path args:
+
+	id: sellerID
+
+resp:
+
+	"sellerID", "name", "description": string
+	"rating": float (average of users' ratings, 0 if not rated)
+	"ratingCount": int
+	"updatedAt": time
+*/
+func (h *Handler) SellerProfile(w http.ResponseWriter, r *http.Request) {
+	profile := structsUFUT.SellerProfileRSC{SellerID: r.PathValue("id")}
+	if err := h.service.SellerProfile(r.Context(), &profile); err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(profile)
+}
+
+/*
+Path args:
+
+	id: sellerID
+
+Query args:
+
+	same as ItemsByParams (category is optional)
+
+resp:
+
+	same as ItemsByParams, only the seller's available items are listed
+*/
+func (h *Handler) SellerItems(w http.ResponseWriter, r *http.Request) {
+	params := listingParams(r)
+	params.SellerID = r.PathValue("id")
+	res, err := h.service.SellerItems(r.Context(), &params)
+	h.writeListing(w, r, res, err)
+}
+
+/*
+Path args:
+
+	id: sellerID
+
+JSON args:
+
+	"rating": int (always, from 1 to 5; replaces the user's previous rating)
+
+403 unless the user has a finished order from the seller
+
+resp:
+
+	"status": "ok"
+*/
+func (h *Handler) RateSeller(w http.ResponseWriter, r *http.Request) {
+	var rating structsUFUT.SellerRatingRSC
+	if err := json.NewDecoder(r.Body).Decode(&rating); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	rating.SellerID = r.PathValue("id")
+	rating.UserID = funcsUFUT.GetterIDFromContext(r.Context())
+	if err := h.service.RateSeller(r.Context(), &rating); err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidRating):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrSelfRating), errors.Is(err, ErrNotSellerCustomer):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+/*
+JSON args:
+
+	"name": string (always)
+	"description": string (optional)
+
+resp:
+
+	"status": "ok"
+*/
+func (h *Handler) UpdateSellerProfile(w http.ResponseWriter, r *http.Request) {
+	var profile structsUFUT.SellerProfileRSC
+	if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	profile.SellerID = funcsUFUT.GetterIDFromContext(r.Context())
+	if err := h.service.UpdateSellerProfile(r.Context(), &profile); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+/*
+Query args:
+
+	same as ItemsByParams (category is optional)
+	status: optional, comma-separated statuses; items of every status, drafts and deleted included, if not provided
+
+resp:
+
+	same as ItemsByParams, only the getter's items are listed
+*/
+func (h *Handler) MyItems(w http.ResponseWriter, r *http.Request) {
+	params := listingParams(r)
+	params.SellerID = funcsUFUT.GetterIDFromContext(r.Context())
+	params.Statuses = splitList(r.URL.Query().Get("status"), ",")
+	res, err := h.service.MyItems(r.Context(), &params)
 	if err != nil {
 		http.Error(w, "bad request", http.StatusBadRequest)
 		return
 	}
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if funcsUFUT.CheckNotModified(w, r, listingETag(&res), time.Time{}) {
+		return
+	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	json.NewEncoder(w).Encode(res)
 }
@@ -93,7 +361,12 @@ func (h *Handler) ItemsByParams(w http.ResponseWriter, r *http.Request) {
 Query args:
 
 	itemID: always (identifies the exact item)
-	category: always (specifies which category to select in)
+	category: optional (if provided, item must belong to this category)
+	currency: optional, ISO 4217 code (prices are converted into it, item's own currency if not provided)
+
+Headers:
+
+	Accept-Language: optional (locales of name, description and category name, catalog locale if none is translated)
 
 resp:
 
@@ -101,23 +374,97 @@ resp:
 	"sellerID": string
 	"name": string
 	"description": string
-	"price": int
+	"price": int (effective price in minor units, sale price while a sale is in effect)
+	"currency": string (ISO 4217 code of the prices)
+	"regularPrice": int (only while a sale is in effect, "was" price)
+	"saleEndsAt": time (only while a sale is in effect)
 	"category": string
+	"categoryName": string (localized display name of category)
+	"locale": string (locale of name and description)
 	"status": string
+	"images": []string (ordered image URLs)
+	"version": int (bumped on every change of the item, translations included)
+	"updatedAt": time
+
+Headers:
+
+	ETag, Last-Modified, Cache-Control, Content-Language, Vary; answers If-None-Match/If-Modified-Since with 304.
+	No Last-Modified with currency, exchange rates change converted prices without changing the item
+
+Items that aren't for sale are found by their seller and moderators only
 */
 func (h *Handler) ItemByItemID(w http.ResponseWriter, r *http.Request) {
 	q_vals := r.URL.Query()
 	var item structsUFUT.ItemDataRSC
 	item.ItemID = q_vals.Get("itemid")
 	item.Category = q_vals.Get("category")
-	if err := h.service.ItemByItemID(r.Context(), &item); err != nil {
+	view := h.viewOptions(r)
+	if err := h.service.ItemByItemID(r.Context(), funcsUFUT.GetterIDFromContext(r.Context()), &item, view); err != nil {
+		if isCurrencyError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "bad request", http.StatusBadRequest)
 		return
 	}
+	if slices.Contains(publicItemStatuses, item.Status) {
+		w.Header().Set("Cache-Control", "public, max-age=60")
+	} else {
+		w.Header().Set("Cache-Control", "private, no-cache")
+	}
+	w.Header().Set("Content-Language", item.Locale)
+	w.Header().Set("Vary", "Accept-Language")
+	// price is part of the tag, scheduled prices and exchange rates change it without a new version
+	etag := funcsUFUT.ETagOf(item.ItemID, strconv.FormatInt(item.Version, 10),
+		strconv.Itoa(item.Price), item.Currency, item.Locale, item.CategoryName)
+	lastModified := item.UpdatedAt
+	if view.Currency != "" {
+		lastModified = time.Time{}
+	}
+	if funcsUFUT.CheckNotModified(w, r, etag, lastModified) {
+		return
+	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	json.NewEncoder(w).Encode(item)
 }
 
+/*
+Query args:
+
+	currency: optional, same as ItemByItemID
+
+Headers:
+
+	Accept-Language: optional, same as ItemByItemID
+
+JSON args:
+
+	"itemsID": []string (always; up to MaxBatchItems IDs)
+
+resp:
+
+	"items": array of items in request order (same fields as ItemByItemID)
+	"notFound": []string (requested IDs that don't exist or aren't for sale, unless the getter is their seller or a moderator)
+*/
+func (h *Handler) ItemsBatchGet(w http.ResponseWriter, r *http.Request) {
+	var req structsUFUT.ItemsBatchRequestRSC
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	resp, err := h.service.ItemsByItemIDs(r.Context(), funcsUFUT.GetterIDFromContext(r.Context()), req.ItemsIDs, h.viewOptions(r))
+	if err != nil {
+		if errors.Is(err, ErrTooManyItems) || isCurrencyError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(resp)
+}
+
 /*
 JSON args:
 
@@ -125,13 +472,15 @@ JSON args:
 	"sellerID": string (ignored)
 	"name": string
 	"description": string
-	"price": int
+	"price": int (minor units of currency)
+	"currency": string (optional, ISO 4217 code; catalog currency if not provided)
 	"category": string
-	"status": string
+	"status": string (ignored, new items are always "pending_review")
 
 resp:
 
 	"status": "ok"
+	"itemID": string (ID of the created item)
 */
 func (h *Handler) CreateItem(w http.ResponseWriter, r *http.Request) {
 	var item structsUFUT.ItemDataRSC
@@ -148,18 +497,22 @@ func (h *Handler) CreateItem(w http.ResponseWriter, r *http.Request) {
 	item.ItemID = uid.String()
 	item.SellerID = funcsUFUT.GetterIDFromContext(r.Context())
 	if err := h.service.CreateItem(r.Context(), &item); err != nil {
+		if errors.Is(err, ErrBannedWords) || isCurrencyError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	item.SellerID = t
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok", "itemID": item.ItemID})
 }
 
 /*
 JSON args:
 
-	"itemID": string (always)
+	"itemID": string (always, item of the getter unless the getter is a moderator)
 	"category": string (always)
 
 resp:
@@ -172,14 +525,682 @@ func (h *Handler) DeleteItem(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "bad request", http.StatusBadRequest)
 		return
 	}
-	if err := h.service.DeleteItem(r.Context(), &item); err != nil {
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+	err := h.service.DeleteItem(r.Context(), &item, funcsUFUT.GetterIDFromContext(r.Context()))
+	if err != nil {
+		statusError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+/*
+JSON args:
+
+	"itemID": string (always, item of the getter unless the getter is a moderator)
+	"toStatus": string (always, one of "draft", "pending_review", "available", "out_of_stock", "archived", "deleted")
+	"reason": string (optional)
+
+resp:
+
+	"status": "ok"
+*/
+func (h *Handler) ChangeItemStatus(w http.ResponseWriter, r *http.Request) {
+	var change structsUFUT.ItemStatusChangeRSC
+	if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	change.ActorID = funcsUFUT.GetterIDFromContext(r.Context())
+	if err := h.service.ChangeItemStatus(r.Context(), &change); err != nil {
+		statusError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+/*
+JSON args:
+
+	"itemID": string (always, deleted item of the getter unless the getter is a moderator)
+
+resp:
+
+	"status": "ok" (item is a draft again)
+*/
+func (h *Handler) RestoreItem(w http.ResponseWriter, r *http.Request) {
+	var item structsUFUT.ItemDataRSC
+	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	err := h.service.RestoreItem(r.Context(), item.ItemID, funcsUFUT.GetterIDFromContext(r.Context()))
+	if err != nil {
+		statusError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+/*
+Query args:
+
+	itemid: string (always, item of the getter unless the getter is a moderator)
+
+resp:
+
+	array of {"itemID", "fromStatus", "toStatus", "actorID", "reason", "changedAt"}, oldest first;
+	"fromStatus" is empty for the item's creation
+*/
+func (h *Handler) ItemStatusHistory(w http.ResponseWriter, r *http.Request) {
+	history, err := h.service.ItemStatusHistory(r.Context(), funcsUFUT.GetterIDFromContext(r.Context()), r.URL.Query().Get("itemid"))
+	if err != nil {
+		statusError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(history)
+}
+
+/*
+JSON args:
+
+	"itemID": string (always, item of the getter)
+	"kind": "regular" or "sale" (always)
+	"price": int (always)
+	"startsAt": time (optional, now if not provided)
+	"endsAt": time (always for "sale"; the regular price applies again afterwards)
+
+resp:
+
+	"priceID": int
+*/
+func (h *Handler) ScheduleItemPrice(w http.ResponseWriter, r *http.Request) {
+	var entry structsUFUT.ItemPriceRSC
+	if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	entry.CreatedBy = funcsUFUT.GetterIDFromContext(r.Context())
+	if err := h.service.ScheduleItemPrice(r.Context(), &entry); err != nil {
+		switch {
+		case errors.Is(err, ErrUnknownPriceKind), errors.Is(err, ErrInvalidPrice),
+			errors.Is(err, ErrPriceInPast), errors.Is(err, ErrInvalidSaleRange):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]int64{"priceID": entry.PriceID})
+}
+
+/*
+JSON args:
+
+	"itemID": string (always, item of the getter)
+	"priceID": int (always, entry that hasn't started yet)
+
+resp:
+
+	"status": "ok"
+*/
+func (h *Handler) CancelItemPrice(w http.ResponseWriter, r *http.Request) {
+	var entry structsUFUT.ItemPriceRSC
+	if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	err := h.service.CancelItemPrice(r.Context(), entry.ItemID, entry.PriceID, funcsUFUT.GetterIDFromContext(r.Context()))
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
+/*
+Query args:
+
+	itemid: string (always)
+	currency: optional, same as ItemByItemID
+
+resp:
+
+	array of {"priceID", "itemID", "kind", "price", "currency", "startsAt", "endsAt", "createdBy", "createdAt"}
+	ordered by "startsAt"; entries that haven't started yet are left out
+*/
+func (h *Handler) ItemPriceHistory(w http.ResponseWriter, r *http.Request) {
+	h.itemPriceHistory(w, r, false)
+}
+
+/*
+Query args:
+
+	itemid: string (always, item of the getter unless the getter is a moderator)
+	currency: optional, same as ItemByItemID
+
+resp:
+
+	same as ItemPriceHistory, scheduled entries included
+*/
+func (h *Handler) StaffItemPriceHistory(w http.ResponseWriter, r *http.Request) {
+	h.itemPriceHistory(w, r, true)
+}
+
+func (h *Handler) itemPriceHistory(w http.ResponseWriter, r *http.Request, withScheduled bool) {
+	q_vals := r.URL.Query()
+	history, err := h.service.ItemPriceHistory(r.Context(), funcsUFUT.GetterIDFromContext(r.Context()),
+		q_vals.Get("itemid"), withScheduled, q_vals.Get("currency"))
+	if err != nil {
+		if isCurrencyError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, ErrNotItemOwner) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(history)
+}
+
+/*
+resp:
+
+	"reference": string (ISO 4217 code, the catalog currency)
+	"rates": array of {"currency": string, "rate": string (decimal, units of currency per one unit of reference)}
+	"updatedAt": time (zero if rates were never set)
+*/
+func (h *Handler) ExchangeRates(w http.ResponseWriter, r *http.Request) {
+	table, err := h.service.ExchangeRates(r.Context())
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(table)
+}
+
+/*
+Replaces the whole exchange rate table, the getter must be a rates admin.
+
+Body (by Content-Type):
+
+	application/json: {"reference": string (optional, must be the catalog currency), "rates": [{"currency", "rate"}]}
+	text/csv: rows of currency,rate; optional header row "currency,rate"
+
+resp:
+
+	same as ExchangeRates
+*/
+func (h *Handler) SetExchangeRates(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, MaxRatesSize)
+	var table structsUFUT.ExchangeRatesRSC
+	if FormatFromContentType(r.Header.Get("Content-Type")) == FormatCSV {
+		rates, err := readExchangeRatesCSV(r.Body)
+		if err != nil {
+			http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		table.Rates = rates
+	} else if err := json.NewDecoder(r.Body).Decode(&table); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if err := h.service.SetExchangeRates(r.Context(), funcsUFUT.GetterIDFromContext(r.Context()), &table); err != nil {
+		if errors.Is(err, ErrNotRatesAdmin) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if isCurrencyError(err) || errors.Is(err, ErrReferenceCurrency) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	h.ExchangeRates(w, r)
+}
+
+func (h *Handler) viewOptions(r *http.Request) ViewOptions {
+	return ViewOptions{
+		Currency: r.URL.Query().Get("currency"),
+		Locales:  h.service.LocaleChain(r.Header.Get("Accept-Language")),
+	}
+}
+
+/*
+Query args:
+
+	itemid: string (always)
+
+resp:
+
+	array of {"itemID", "locale", "name", "description", "updatedBy", "updatedAt"} ordered by "locale"
+*/
+func (h *Handler) ItemTranslations(w http.ResponseWriter, r *http.Request) {
+	translations, err := h.service.ItemTranslations(r.Context(), r.URL.Query().Get("itemid"))
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(translations)
+}
+
+/*
+JSON args:
+
+	"itemID": string (always, item of the getter)
+	"locale": string (always, language tag other than the catalog locale)
+	"name": string (always)
+	"description": string (optional)
+
+resp:
+
+	"status": "ok"
+*/
+func (h *Handler) SetItemTranslation(w http.ResponseWriter, r *http.Request) {
+	var tr structsUFUT.ItemTranslationRSC
+	if err := json.NewDecoder(r.Body).Decode(&tr); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	tr.UpdatedBy = funcsUFUT.GetterIDFromContext(r.Context())
+	if err := h.service.SetItemTranslation(r.Context(), &tr); err != nil {
+		translationError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+/*
+JSON args:
+
+	"itemID": string (always, item of the getter)
+	"locale": string (always)
+
+resp:
+
+	"status": "ok"
+*/
+func (h *Handler) DeleteItemTranslation(w http.ResponseWriter, r *http.Request) {
+	var tr structsUFUT.ItemTranslationRSC
+	if err := json.NewDecoder(r.Body).Decode(&tr); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	err := h.service.DeleteItemTranslation(r.Context(), tr.ItemID, tr.Locale, funcsUFUT.GetterIDFromContext(r.Context()))
+	if err != nil {
+		translationError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+/*
+resp:
+
+	array of {"category", "locale", "displayName", "updatedAt"} ordered by "category" and "locale"
+*/
+func (h *Handler) CategoryTranslations(w http.ResponseWriter, r *http.Request) {
+	translations, err := h.service.CategoryTranslations(r.Context())
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(translations)
+}
+
+/*
+JSON args:
+
+	"category": string (always, existing category)
+	"locale": string (always, language tag other than the catalog locale)
+	"displayName": string (always)
+
+resp:
+
+	"status": "ok"
+*/
+func (h *Handler) SetCategoryTranslation(w http.ResponseWriter, r *http.Request) {
+	var tr structsUFUT.CategoryTranslationRSC
+	if err := json.NewDecoder(r.Body).Decode(&tr); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if err := h.service.SetCategoryTranslation(r.Context(), &tr, funcsUFUT.GetterIDFromContext(r.Context())); err != nil {
+		translationError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+/*
+JSON args:
+
+	"category": string (always)
+	"locale": string (always)
+
+resp:
+
+	"status": "ok"
+*/
+func (h *Handler) DeleteCategoryTranslation(w http.ResponseWriter, r *http.Request) {
+	var tr structsUFUT.CategoryTranslationRSC
+	if err := json.NewDecoder(r.Body).Decode(&tr); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	err := h.service.DeleteCategoryTranslation(r.Context(), tr.Category, tr.Locale, funcsUFUT.GetterIDFromContext(r.Context()))
+	if err != nil {
+		translationError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+func translationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, funcsUFUT.ErrInvalidLocale), errors.Is(err, ErrDefaultLocale),
+		errors.Is(err, ErrMissingName), errors.Is(err, ErrBannedWords):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrNotCategoryAdmin):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+func isCurrencyError(err error) bool {
+	return errors.Is(err, funcsUFUT.ErrUnknownCurrency) ||
+		errors.Is(err, funcsUFUT.ErrNoExchangeRate) ||
+		errors.Is(err, funcsUFUT.ErrInvalidRate)
+}
+
+func statusError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidTransition):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrNotItemOwner):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, ErrUnknownStatus):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}
+}
+
+/*
+Query args:
+
+	format: optional, "csv" or "jsonl" (taken from Content-Type "text/csv" or "application/x-ndjson" if not provided)
+	dryRun: optional, "true" to validate without writing
+
+Body:
+
+	csv: header row with columns sku, name, price, category (required), description and currency (optional);
+	status column is ignored: new items are "pending_review", existing ones keep their status
+	jsonl: one JSON object per line with fields of ItemDataRSC
+
+resp (200 if imported or dry run succeeded, 422 if any row is invalid and nothing was written):
+
+	"dryRun": bool
+	"rows": int
+	"created": int
+	"updated": int
+	"errors": [{"row": int, "sku": string, "error": string}]
+*/
+func (h *Handler) ImportItems(w http.ResponseWriter, r *http.Request) {
+	q_vals := r.URL.Query()
+	format := q_vals.Get("format")
+	if format == "" {
+		format = FormatFromContentType(r.Header.Get("Content-Type"))
+	}
+	dryRun, _ := strconv.ParseBool(q_vals.Get("dryRun"))
+	r.Body = http.MaxBytesReader(w, r.Body, MaxImportSize)
+	sellerID := funcsUFUT.GetterIDFromContext(r.Context())
+	report, err := h.service.ImportItems(r.Context(), sellerID, format, r.Body, dryRun)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			http.Error(w, "request body is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if len(report.Errors) > 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+/*
+Query args:
+
+	format: optional, "csv" or "jsonl" ("csv" if not provided)
+	sellerID: optional, exports only the seller's items if provided
+
+resp:
+
+	items streamed in the requested format
+*/
+func (h *Handler) ExportItems(w http.ResponseWriter, r *http.Request) {
+	q_vals := r.URL.Query()
+	format := q_vals.Get("format")
+	switch format {
+	case "", FormatCSV:
+		format = FormatCSV
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	case FormatJSONL:
+		w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+	default:
+		http.Error(w, ErrUnknownFormat.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="items.`+format+`"`)
+	// the status is already sent once streaming starts, so a failure can only cut the body short
+	h.service.ExportItems(r.Context(), q_vals.Get("sellerID"), format, w)
+}
+
+/*
+Query args:
+
+	count: optional, 10 if not provided, at most 100
+	cursor: optional, "next_cursor" of the previous page
+
+resp (403 unless the getter is a moderator):
+
+	"items": array of items pending review (oldest change first)
+	"next_cursor": string (empty on the last page)
+*/
+func (h *Handler) ModerationQueue(w http.ResponseWriter, r *http.Request) {
+	q_vals := r.URL.Query()
+	var req structsUFUT.ModerationQueueRequestRSC
+	req.Count, _ = strconv.Atoi(q_vals.Get("count"))
+	req.Cursor = q_vals.Get("cursor")
+	resp, err := h.service.ModerationQueue(r.Context(), funcsUFUT.GetterIDFromContext(r.Context()), &req)
+	if err != nil {
+		if errors.Is(err, ErrNotModerator) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(resp)
+}
+
+/*
+JSON args:
+
+	"itemID": string (always)
+	"reason": string (optional)
+
+resp:
+
+	"status": "ok"
+*/
+func (h *Handler) ApproveItem(w http.ResponseWriter, r *http.Request) {
+	h.moderateItem(w, r, structsUFUT.ModerationApproved)
+}
+
+/*
+JSON args:
+
+	"itemID": string (always)
+	"reason": string (always, sent to the seller)
+
+resp:
+
+	"status": "ok"
+*/
+func (h *Handler) RejectItem(w http.ResponseWriter, r *http.Request) {
+	h.moderateItem(w, r, structsUFUT.ModerationRejected)
+}
+
+func (h *Handler) moderateItem(w http.ResponseWriter, r *http.Request, decision string) {
+	var req structsUFUT.ModerationDecisionRSC
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	req.Decision = decision
+	req.ModeratorID = funcsUFUT.GetterIDFromContext(r.Context())
+	if err := h.service.ModerateItem(r.Context(), &req); err != nil {
+		switch {
+		case errors.Is(err, ErrNotModerator), errors.Is(err, ErrSelfModeration):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, ErrMissingReason):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, "bad request", http.StatusBadRequest)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+/*
+Multipart form args:
+
+	"itemID": string (always)
+	"image": file (always; JPEG, PNG or GIF, up to MaxImageSize bytes)
+
+resp:
+
+	"imageID": string
+	"itemID": string
+	"sellerID": string
+	"position": int
+	"contentType": string
+*/
+func (h *Handler) UploadItemImage(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, MaxImageSize+(1<<20))
+	if err := r.ParseMultipartForm(MaxImageSize); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			http.Error(w, ErrImageTooLarge.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, MaxImageSize+1))
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	img := structsUFUT.ItemImageRSC{
+		ItemID:   r.FormValue("itemID"),
+		SellerID: funcsUFUT.GetterIDFromContext(r.Context()),
+	}
+	if err := h.service.UploadItemImage(r.Context(), &img, data); err != nil {
+		switch {
+		case errors.Is(err, ErrImageTooLarge):
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		case errors.Is(err, ErrUnsupportedImageType):
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		default:
+			http.Error(w, "bad request", http.StatusBadRequest)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(img)
+}
+
+/*
+Path args:
+
+	imageID: always
+
+Query args:
+
+	size: optional, one of ThumbnailSizes; original image if not provided
+
+resp:
+
+	image content
+*/
+func (h *Handler) ItemImage(w http.ResponseWriter, r *http.Request) {
+	imageID := r.PathValue("imageID")
+	size := r.URL.Query().Get("size")
+	// image blobs never change once uploaded, so imageID+size identifies the content
+	etag := `"` + imageID + "-" + size + `"`
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	if funcsUFUT.CheckNotModified(w, r, etag, time.Time{}) {
+		return
+	}
+	rc, contentType, err := h.service.ItemImage(r.Context(), imageID, size)
+	if err != nil {
+		w.Header().Del("Cache-Control")
+		w.Header().Del("ETag")
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	defer rc.Close()
+	w.Header().Set("Content-Type", contentType)
+	io.Copy(w, rc)
+}
+
+/*
+ETag of a listing page changes whenever any listed item or the page boundary changes
+*/
+func listingETag(res *structsUFUT.ItemsResponseRSC) string {
+	parts := make([]string, 0, len(res.ItemsIDs)+1)
+	for i, id := range res.ItemsIDs {
+		parts = append(parts, id+"."+strconv.FormatInt(res.Versions[i], 10))
+	}
+	parts = append(parts, res.NextCursor)
+	return funcsUFUT.ETagOf(parts...)
+}
+
 // func (h *Handler) ReserveItem(w http.ResponseWriter, r *http.Request) {
 // 	var req struct {
 // 		ItemID     []string `json:"itemID"`
@@ -0,0 +1,894 @@
+package catalog_service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	blobStorage "ufut/internal/blob_storage"
+	searchCatalog "ufut/internal/search"
+	sqliteRepoCatalog "ufut/internal/sqlite/catalog_service"
+	eventsUFUT "ufut/lib/events"
+	funcsUFUT "ufut/lib/funcs"
+	structsUFUT "ufut/lib/structs"
+
+	"github.com/stretchr/testify/assert"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func CreateCatalogService(t *testing.T) (*Service, func() error) {
+	dbFilePath := "catalog_test.db"
+	db_Catalog, err := sql.Open("sqlite3", dbFilePath)
+	if err != nil {
+		t.Errorf("%v", err.Error())
+	}
+	repo_Catalog := sqliteRepoCatalog.NewSQLiteRepo(db_Catalog)
+	if err := repo_Catalog.CreateTables(t.Context()); err != nil {
+		t.Fatalf("%v", err.Error())
+	}
+	blobs, err := blobStorage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("%v", err.Error())
+	}
+	srvc := NewService(repo_Catalog, blobs, nil, nil)
+	srvc.SetModerationConfig(ModerationConfig{Moderators: []string{"moderator"}})
+	return srvc, func() error {
+		err := db_Catalog.Close()
+		if err != nil {
+			t.Fatalf("%v", err.Error())
+			return err
+		}
+		os.Remove(dbFilePath)
+		return nil
+	}
+}
+
+func withGetterID(r *http.Request, getterID string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), "getterID", getterID))
+}
+
+func createTestItems(t *testing.T, h *Handler, sellerID string, items ...structsUFUT.ItemDataRSC) []string {
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		body, _ := json.Marshal(item)
+		r := withGetterID(httptest.NewRequest(http.MethodPost, "/api/staff/createItem", bytes.NewReader(body)), sellerID)
+		w := httptest.NewRecorder()
+		h.CreateItem(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("createItem: %v %v", w.Code, w.Body.String())
+		}
+		var resp struct {
+			ItemID string `json:"itemID"`
+		}
+		json.NewDecoder(w.Body).Decode(&resp)
+		if code := moderateTestItem(h, "approve", resp.ItemID, ""); code != http.StatusOK {
+			t.Fatalf("approve: %v", code)
+		}
+		ids = append(ids, resp.ItemID)
+	}
+	return ids
+}
+
+func moderateTestItem(h *Handler, action, itemID, reason string) int {
+	body, _ := json.Marshal(structsUFUT.ModerationDecisionRSC{ItemID: itemID, Reason: reason})
+	r := withGetterID(httptest.NewRequest(http.MethodPost, "/api/staff/moderation/"+action, bytes.NewReader(body)), "moderator")
+	w := httptest.NewRecorder()
+	if action == "approve" {
+		h.ApproveItem(w, r)
+	} else {
+		h.RejectItem(w, r)
+	}
+	return w.Code
+}
+
+func manyIDs(n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("id%d", i)
+	}
+	return ids
+}
+
+func TestHandler_ItemsBatchGet(t *testing.T) {
+	srvc, cleanUp := CreateCatalogService(t)
+	defer cleanUp()
+	h := NewHandler(srvc)
+	ids := createTestItems(t, h, "seller",
+		structsUFUT.ItemDataRSC{Name: "book", Price: 10, Category: "books", Status: "available"},
+		structsUFUT.ItemDataRSC{Name: "lamp", Price: 20, Category: "home", Status: "available"},
+	)
+
+	tests := []struct {
+		name         string
+		ids          []string
+		wantCode     int
+		wantItems    []string
+		wantNotFound []string
+	}{
+		{name: "all", ids: []string{ids[1], ids[0]}, wantCode: 200, wantItems: []string{ids[1], ids[0]}, wantNotFound: []string{}},
+		{name: "duplicates", ids: []string{ids[0], ids[0]}, wantCode: 200, wantItems: []string{ids[0]}, wantNotFound: []string{}},
+		{name: "missing", ids: []string{"nope", ids[0]}, wantCode: 200, wantItems: []string{ids[0]}, wantNotFound: []string{"nope"}},
+		{name: "empty", ids: nil, wantCode: 200, wantItems: []string{}, wantNotFound: []string{}},
+		{name: "tooMany", ids: manyIDs(MaxBatchItems + 1), wantCode: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(structsUFUT.ItemsBatchRequestRSC{ItemsIDs: tt.ids})
+			r := httptest.NewRequest(http.MethodPost, "/api/user/items:batchGet", bytes.NewReader(body))
+			w := httptest.NewRecorder()
+			h.ItemsBatchGet(w, r)
+			assert.Equal(t, tt.wantCode, w.Code)
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+			var resp structsUFUT.ItemsBatchResponseRSC
+			assert.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+			got := []string{}
+			for _, item := range resp.Items {
+				got = append(got, item.ItemID)
+			}
+			assert.Equal(t, tt.wantItems, got)
+			assert.Equal(t, tt.wantNotFound, resp.NotFound)
+		})
+	}
+}
+
+func TestHandler_ItemByItemID(t *testing.T) {
+	srvc, cleanUp := CreateCatalogService(t)
+	defer cleanUp()
+	h := NewHandler(srvc)
+	ids := createTestItems(t, h, "seller",
+		structsUFUT.ItemDataRSC{Name: "book", Price: 10, Category: "books", Status: "available"})
+
+	tests := []struct {
+		name     string
+		query    string
+		wantCode int
+	}{
+		{name: "idOnly", query: "?itemid=" + ids[0], wantCode: 200},
+		{name: "idAndCategory", query: "?itemid=" + ids[0] + "&category=books", wantCode: 200},
+		{name: "wrongCategory", query: "?itemid=" + ids[0] + "&category=home", wantCode: 400},
+		{name: "unknown", query: "?itemid=nope", wantCode: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/user/itemByItemID"+tt.query, nil)
+			w := httptest.NewRecorder()
+			h.ItemByItemID(w, r)
+			assert.Equal(t, tt.wantCode, w.Code)
+		})
+	}
+}
+
+func TestHandler_ItemsByParamsCursor(t *testing.T) {
+	srvc, cleanUp := CreateCatalogService(t)
+	defer cleanUp()
+	h := NewHandler(srvc)
+	var items []structsUFUT.ItemDataRSC
+	for _, price := range []int{30, 10, 20, 20, 40} {
+		items = append(items, structsUFUT.ItemDataRSC{Name: "book", Price: price, Category: "books", Status: "available"})
+	}
+	createTestItems(t, h, "seller", items...)
+	createTestItems(t, h, "seller", structsUFUT.ItemDataRSC{Name: "lamp", Price: 15, Category: "home", Status: "available"})
+
+	for _, order := range []string{"asc", "desc"} {
+		t.Run(order, func(t *testing.T) {
+			var pages [][]string
+			cursor := ""
+			for {
+				r := httptest.NewRequest(http.MethodGet,
+					"/api/user/itemsByParams?category=books&count=2&orderby="+order+"&cursor="+cursor, nil)
+				w := httptest.NewRecorder()
+				h.ItemsByParams(w, r)
+				assert.Equal(t, http.StatusOK, w.Code)
+				var resp structsUFUT.ItemsResponseRSC
+				assert.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+				pages = append(pages, resp.ItemsIDs)
+				if resp.NextCursor == "" {
+					break
+				}
+				cursor = resp.NextCursor
+			}
+			assert.Len(t, pages, 3)
+			seen := map[string]bool{}
+			var prices []int
+			for _, page := range pages {
+				batch, err := srvc.ItemsByItemIDs(t.Context(), "", page, ViewOptions{})
+				assert.NoError(t, err)
+				for _, item := range batch.Items {
+					assert.False(t, seen[item.ItemID])
+					seen[item.ItemID] = true
+					prices = append(prices, item.Price)
+				}
+			}
+			if order == "asc" {
+				assert.Equal(t, []int{10, 20, 20, 30, 40}, prices)
+			} else {
+				assert.Equal(t, []int{40, 30, 20, 20, 10}, prices)
+			}
+		})
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/user/itemsByParams?category=books&cursor=garbage", nil)
+	w := httptest.NewRecorder()
+	h.ItemsByParams(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandler_ImportExportItems(t *testing.T) {
+	srvc, cleanUp := CreateCatalogService(t)
+	defer cleanUp()
+	h := NewHandler(srvc)
+
+	importItems := func(query, contentType, body string) (int, structsUFUT.ImportReportRSC) {
+		r := withGetterID(httptest.NewRequest(http.MethodPost, "/api/staff/importItems"+query, strings.NewReader(body)), "seller")
+		r.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		h.ImportItems(w, r)
+		var report structsUFUT.ImportReportRSC
+		json.NewDecoder(w.Body).Decode(&report)
+		return w.Code, report
+	}
+
+	csvBody := "sku,name,price,category,description\n" +
+		"b-1,book,10,books,first\n" +
+		"b-2,lamp,abc,home,\n" +
+		"b-3,,5,books,\n" +
+		"b-1,book again,10,books,\n" +
+		"b-4,car,10,cars,\n"
+	code, report := importItems("", "text/csv", csvBody)
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, 5, report.Rows)
+	rows := []int{}
+	for _, e := range report.Errors {
+		rows = append(rows, e.Row)
+	}
+	assert.Equal(t, []int{2, 3, 4, 5}, rows)
+
+	csvBody = "sku,name,price,category\nb-1,book,10,books\nb-2,lamp,20,home\n"
+	code, report = importItems("?dryRun=true", "text/csv", csvBody)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, report.Created)
+	exported := exportItems(t, h, "?format=csv&sellerID=seller")
+	assert.Equal(t, "sku,name,description,price,currency,category,status\n", exported)
+
+	code, report = importItems("", "text/csv", csvBody)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, report.Created)
+
+	jsonlBody := `{"sku":"b-2","name":"lamp","price":25,"category":"home"}` + "\n" +
+		`{"sku":"b-3","name":"toy","price":5,"category":"toys"}` + "\n"
+	code, report = importItems("?format=jsonl", "", jsonlBody)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, report.Created)
+	assert.Equal(t, 1, report.Updated)
+
+	exported = exportItems(t, h, "?format=jsonl&sellerID=seller")
+	prices, ids := map[string]int{}, map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(exported), "\n") {
+		var item structsUFUT.ItemDataRSC
+		assert.NoError(t, json.Unmarshal([]byte(line), &item))
+		prices[item.SKU], ids[item.SKU] = item.Price, item.ItemID
+	}
+	assert.Equal(t, map[string]int{"b-1": 10, "b-2": 25, "b-3": 5}, prices)
+
+	// approved items keep their status on a price change, a content change sends them back to review
+	assert.Equal(t, http.StatusOK, moderateTestItem(h, "approve", ids["b-1"], ""))
+	assert.Equal(t, http.StatusOK, moderateTestItem(h, "approve", ids["b-2"], ""))
+	jsonlBody = `{"sku":"b-1","name":"book","price":12,"category":"books"}` + "\n" +
+		`{"sku":"b-2","name":"lamp with bulb","price":25,"category":"home"}` + "\n"
+	code, report = importItems("?format=jsonl", "", jsonlBody)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, report.Updated)
+	statuses := map[string]string{}
+	for sku, id := range ids {
+		item := structsUFUT.ItemDataRSC{ItemID: id}
+		assert.NoError(t, srvc.ItemByItemID(t.Context(), "seller", &item, ViewOptions{}))
+		statuses[sku] = item.Status
+	}
+	assert.Equal(t, map[string]string{
+		"b-1": structsUFUT.ItemStatusAvailable,
+		"b-2": structsUFUT.ItemStatusPendingReview,
+		"b-3": structsUFUT.ItemStatusPendingReview,
+	}, statuses)
+	history, err := srvc.ItemStatusHistory(t.Context(), "seller", ids["b-2"])
+	assert.NoError(t, err)
+	assert.Equal(t, structsUFUT.ItemStatusAvailable, history[len(history)-1].FromStatus)
+	assert.Equal(t, structsUFUT.ItemStatusPendingReview, history[len(history)-1].ToStatus)
+	assert.Equal(t, "sku,name,description,price,currency,category,status\n", exportItems(t, h, "?sellerID=nobody"))
+}
+
+func exportItems(t *testing.T, h *Handler, query string) string {
+	r := httptest.NewRequest(http.MethodGet, "/api/staff/exportItems"+query, nil)
+	w := httptest.NewRecorder()
+	h.ExportItems(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	return w.Body.String()
+}
+
+func TestHandler_ConditionalRequests(t *testing.T) {
+	srvc, cleanUp := CreateCatalogService(t)
+	defer cleanUp()
+	h := NewHandler(srvc)
+	ids := createTestItems(t, h, "seller",
+		structsUFUT.ItemDataRSC{Name: "book", Price: 10, Category: "books", Status: "available"})
+
+	get := func(handler http.HandlerFunc, target string, headers map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	targets := map[string]http.HandlerFunc{
+		"/api/user/categories":                     h.Categories,
+		"/api/user/itemByItemID?itemid=" + ids[0]:  h.ItemByItemID,
+		"/api/user/itemsByParams?category=books":   h.ItemsByParams,
+		"/api/user/itemsByParams?category=clothes": h.ItemsByParams,
+	}
+	for target, handler := range targets {
+		t.Run(target, func(t *testing.T) {
+			first := get(handler, target, nil)
+			assert.Equal(t, http.StatusOK, first.Code)
+			etag := first.Header().Get("ETag")
+			assert.NotEmpty(t, etag)
+			assert.NotEmpty(t, first.Header().Get("Cache-Control"))
+
+			again := get(handler, target, map[string]string{"If-None-Match": etag})
+			assert.Equal(t, http.StatusNotModified, again.Code)
+			assert.Empty(t, again.Body.String())
+
+			other := get(handler, target, map[string]string{"If-None-Match": `"other"`})
+			assert.Equal(t, http.StatusOK, other.Code)
+
+			if lm := first.Header().Get("Last-Modified"); lm != "" {
+				since := get(handler, target, map[string]string{"If-Modified-Since": lm})
+				assert.Equal(t, http.StatusNotModified, since.Code)
+			}
+		})
+	}
+
+	// dates that can't follow the response aren't sent, listings lose items and rates change converted prices
+	itemTarget := "/api/user/itemByItemID?itemid=" + ids[0]
+	assert.NotEmpty(t, get(h.ItemByItemID, itemTarget, nil).Header().Get("Last-Modified"))
+	assert.Empty(t, get(h.ItemByItemID, itemTarget+"&currency="+srvc.catalogCurrency(), nil).Header().Get("Last-Modified"))
+	assert.Empty(t, get(h.ItemsByParams, "/api/user/itemsByParams?category=books", nil).Header().Get("Last-Modified"))
+
+	etag := get(h.ItemByItemID, itemTarget, nil).Header().Get("ETag")
+	body, _ := json.Marshal(structsUFUT.ItemDataRSC{ItemID: ids[0], Category: "books"})
+	w := httptest.NewRecorder()
+	h.DeleteItem(w, withGetterID(httptest.NewRequest(http.MethodPost, "/api/staff/deleteItem", bytes.NewReader(body)), "seller"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	// the deleted item is gone for buyers, its seller still sees the change
+	gone := get(h.ItemByItemID, itemTarget, map[string]string{"If-None-Match": etag})
+	assert.Equal(t, http.StatusBadRequest, gone.Code)
+	r := withGetterID(httptest.NewRequest(http.MethodGet, itemTarget, nil), "seller")
+	r.Header.Set("If-None-Match", etag)
+	changed := httptest.NewRecorder()
+	h.ItemByItemID(changed, r)
+	assert.Equal(t, http.StatusOK, changed.Code)
+	assert.NotEqual(t, etag, changed.Header().Get("ETag"))
+	assert.Equal(t, "private, no-cache", changed.Header().Get("Cache-Control"))
+}
+
+func TestHandler_Moderation(t *testing.T) {
+	srvc, cleanUp := CreateCatalogService(t)
+	defer cleanUp()
+	srvc.SetModerationConfig(ModerationConfig{BannedWords: []string{"Fake"}})
+	h := NewHandler(srvc)
+	// nobody moderates until moderators are configured
+	assert.Equal(t, http.StatusForbidden, moderateTestItem(h, "approve", "any", ""))
+	srvc.SetModerationConfig(ModerationConfig{BannedWords: []string{"Fake"}, Moderators: []string{"moderator"}})
+
+	create := func(item structsUFUT.ItemDataRSC) (int, string) {
+		body, _ := json.Marshal(item)
+		r := withGetterID(httptest.NewRequest(http.MethodPost, "/api/staff/createItem", bytes.NewReader(body)), "seller")
+		w := httptest.NewRecorder()
+		h.CreateItem(w, r)
+		var resp struct {
+			ItemID string `json:"itemID"`
+		}
+		json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp.ItemID
+	}
+	queue := func() []string {
+		r := withGetterID(httptest.NewRequest(http.MethodGet, "/api/staff/moderation/queue", nil), "moderator")
+		w := httptest.NewRecorder()
+		h.ModerationQueue(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp structsUFUT.ModerationQueueResponseRSC
+		json.NewDecoder(w.Body).Decode(&resp)
+		ids := []string{}
+		for _, item := range resp.Items {
+			ids = append(ids, item.ItemID)
+		}
+		return ids
+	}
+
+	code, _ := create(structsUFUT.ItemDataRSC{Name: "fake watch", Price: 10, Category: "clothes"})
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, book := create(structsUFUT.ItemDataRSC{Name: "book", Price: 10, Category: "books", Status: "available"})
+	assert.Equal(t, http.StatusOK, code)
+	_, lamp := create(structsUFUT.ItemDataRSC{Name: "lamp", Price: 20, Category: "home"})
+	assert.Equal(t, []string{book, lamp}, queue())
+	w := httptest.NewRecorder()
+	h.ModerationQueue(w, withGetterID(httptest.NewRequest(http.MethodGet, "/api/staff/moderation/queue", nil), "seller"))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// pending items are hidden from buyers until approved
+	batch, err := srvc.ItemsByItemIDs(t.Context(), "buyer", []string{book}, ViewOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, batch.Items)
+	assert.Equal(t, []string{book}, batch.NotFound)
+	batch, err = srvc.ItemsByItemIDs(t.Context(), "moderator", []string{book}, ViewOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, batch.Items, 1)
+	assert.Error(t, srvc.ItemByItemID(t.Context(), "buyer", &structsUFUT.ItemDataRSC{ItemID: book}, ViewOptions{}))
+
+	item := structsUFUT.ItemDataRSC{ItemID: book}
+	assert.NoError(t, srvc.ItemByItemID(t.Context(), "seller", &item, ViewOptions{}))
+	assert.Equal(t, structsUFUT.ItemStatusPendingReview, item.Status)
+
+	body, _ := json.Marshal(structsUFUT.ModerationDecisionRSC{ItemID: book})
+	r := withGetterID(httptest.NewRequest(http.MethodPost, "/api/staff/moderation/approve", bytes.NewReader(body)), "seller")
+	w = httptest.NewRecorder()
+	h.ApproveItem(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	assert.Equal(t, http.StatusBadRequest, moderateTestItem(h, "reject", lamp, ""))
+	assert.Equal(t, http.StatusOK, moderateTestItem(h, "reject", lamp, "blurry photos"))
+	assert.Equal(t, http.StatusOK, moderateTestItem(h, "approve", book, ""))
+	assert.Equal(t, http.StatusBadRequest, moderateTestItem(h, "approve", book, ""))
+	assert.Equal(t, []string{}, queue())
+
+	item = structsUFUT.ItemDataRSC{ItemID: book}
+	assert.NoError(t, srvc.ItemByItemID(t.Context(), "seller", &item, ViewOptions{}))
+	assert.Equal(t, structsUFUT.ItemStatusAvailable, item.Status)
+	item = structsUFUT.ItemDataRSC{ItemID: lamp}
+	assert.NoError(t, srvc.ItemByItemID(t.Context(), "seller", &item, ViewOptions{}))
+	assert.Equal(t, structsUFUT.ItemStatusDraft, item.Status)
+
+	srvc.SetModerationConfig(ModerationConfig{Moderators: []string{"lead"}})
+	_, toy := create(structsUFUT.ItemDataRSC{Name: "toy", Price: 5, Category: "toys"})
+	assert.Equal(t, http.StatusForbidden, moderateTestItem(h, "approve", toy, ""))
+}
+
+func TestHandler_ItemStatusLifecycle(t *testing.T) {
+	srvc, cleanUp := CreateCatalogService(t)
+	defer cleanUp()
+	h := NewHandler(srvc)
+	ids := createTestItems(t, h, "seller",
+		structsUFUT.ItemDataRSC{Name: "book", Price: 10, Category: "books"})
+
+	postAs := func(getterID string, handler http.HandlerFunc, body any) int {
+		data, _ := json.Marshal(body)
+		r := withGetterID(httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data)), getterID)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code
+	}
+	post := func(handler http.HandlerFunc, body any) int {
+		return postAs("seller", handler, body)
+	}
+	change := func(status string) int {
+		return post(h.ChangeItemStatus, structsUFUT.ItemStatusChangeRSC{ItemID: ids[0], ToStatus: status})
+	}
+
+	// other sellers can't touch the item, moderators can
+	archive := structsUFUT.ItemStatusChangeRSC{ItemID: ids[0], ToStatus: structsUFUT.ItemStatusArchived}
+	assert.Equal(t, http.StatusForbidden, postAs("other", h.ChangeItemStatus, archive))
+	assert.Equal(t, http.StatusForbidden, postAs("other", h.DeleteItem, structsUFUT.ItemDataRSC{ItemID: ids[0], Category: "books"}))
+	assert.Equal(t, http.StatusForbidden, postAs("other", h.RestoreItem, structsUFUT.ItemDataRSC{ItemID: ids[0]}))
+	assert.Equal(t, http.StatusOK, postAs("moderator", h.ChangeItemStatus, archive))
+	assert.Equal(t, http.StatusOK, change(structsUFUT.ItemStatusPendingReview))
+	assert.Equal(t, http.StatusOK, moderateTestItem(h, "approve", ids[0], ""))
+
+	assert.Equal(t, http.StatusOK, change(structsUFUT.ItemStatusOutOfStock))
+	assert.Equal(t, http.StatusConflict, change(structsUFUT.ItemStatusPendingReview))
+	assert.Equal(t, http.StatusBadRequest, change("sold"))
+	assert.Equal(t, http.StatusConflict, post(h.RestoreItem, structsUFUT.ItemDataRSC{ItemID: ids[0]}))
+	assert.Equal(t, http.StatusBadRequest, post(h.DeleteItem, structsUFUT.ItemDataRSC{ItemID: ids[0], Category: "home"}))
+	assert.Equal(t, http.StatusOK, post(h.DeleteItem, structsUFUT.ItemDataRSC{ItemID: ids[0], Category: "books"}))
+	assert.Equal(t, http.StatusConflict, change(structsUFUT.ItemStatusAvailable))
+	assert.Equal(t, http.StatusOK, post(h.RestoreItem, structsUFUT.ItemDataRSC{ItemID: ids[0]}))
+
+	getHistory := func(getterID string) *httptest.ResponseRecorder {
+		r := withGetterID(httptest.NewRequest(http.MethodGet, "/api/staff/itemStatusHistory?itemid="+ids[0], nil), getterID)
+		w := httptest.NewRecorder()
+		h.ItemStatusHistory(w, r)
+		return w
+	}
+	assert.Equal(t, http.StatusForbidden, getHistory("other").Code)
+	assert.Equal(t, http.StatusOK, getHistory("moderator").Code)
+	w := getHistory("seller")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var history []structsUFUT.ItemStatusChangeRSC
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&history))
+	transitions := []string{}
+	for _, change := range history {
+		transitions = append(transitions, change.FromStatus+">"+change.ToStatus+" by "+change.ActorID)
+		assert.False(t, change.ChangedAt.IsZero())
+	}
+	assert.Equal(t, []string{
+		">pending_review by seller",
+		"pending_review>available by moderator",
+		"available>archived by moderator",
+		"archived>pending_review by seller",
+		"pending_review>available by moderator",
+		"available>out_of_stock by seller",
+		"out_of_stock>deleted by seller",
+		"deleted>draft by seller",
+	}, transitions)
+}
+
+func TestHandler_Sellers(t *testing.T) {
+	srvc, cleanUp := CreateCatalogService(t)
+	defer cleanUp()
+	h := NewHandler(srvc)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/user/sellers/{id}", h.SellerProfile)
+	mux.HandleFunc("GET /api/user/sellers/{id}/items", h.SellerItems)
+	mux.HandleFunc("POST /api/user/sellers/{id}/rate", h.RateSeller)
+	mux.HandleFunc("POST /api/staff/sellerProfile", h.UpdateSellerProfile)
+	mux.HandleFunc("GET /api/staff/myItems", h.MyItems)
+
+	do := func(method, target, getterID string, body any) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		r := withGetterID(httptest.NewRequest(method, target, bytes.NewReader(data)), getterID)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+	listing := func(w *httptest.ResponseRecorder) []string {
+		assert.Equal(t, http.StatusOK, w.Code)
+		var res structsUFUT.ItemsResponseRSC
+		json.NewDecoder(w.Body).Decode(&res)
+		return res.ItemsIDs
+	}
+
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/api/user/sellers/seller", "user", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/api/staff/sellerProfile", "seller", structsUFUT.SellerProfileRSC{}).Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/staff/sellerProfile", "seller",
+		structsUFUT.SellerProfileRSC{Name: "Book shop", Description: "old books"}).Code)
+
+	// only buyers of a finished order may rate its sellers
+	for _, change := range []structsUFUT.OrderStatusChangeRMP{
+		{UserID: "user1", OrderID: "o1", From: structsUFUT.OrderDelivery, To: structsUFUT.OrderFinished, SellerIDs: []string{"seller", "nobody"}},
+		{UserID: "user2", OrderID: "o2", From: structsUFUT.OrderDelivery, To: structsUFUT.OrderFinished, SellerIDs: []string{"seller"}},
+		{UserID: "user3", OrderID: "o3", From: structsUFUT.OrderDelivery, To: structsUFUT.OrderCancelled},
+	} {
+		msg, err := eventsUFUT.NewMessage(eventsUFUT.OrderStatusChanged, "orders_service", change.OrderID, change.UserID, change)
+		assert.NoError(t, err)
+		assert.NoError(t, srvc.handleOrderMsg(t.Context(), msg))
+	}
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/api/user/sellers/seller/rate", "user3", map[string]int{"rating": 1}).Code)
+
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/user/sellers/seller/rate", "user1", map[string]int{"rating": 5}).Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/user/sellers/seller/rate", "user2", map[string]int{"rating": 2}).Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/user/sellers/seller/rate", "user2", map[string]int{"rating": 4}).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/api/user/sellers/seller/rate", "user1", map[string]int{"rating": 6}).Code)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/api/user/sellers/seller/rate", "seller", map[string]int{"rating": 5}).Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/api/user/sellers/nobody/rate", "user1", map[string]int{"rating": 5}).Code)
+
+	w := do(http.MethodGet, "/api/user/sellers/seller", "user", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var profile structsUFUT.SellerProfileRSC
+	json.NewDecoder(w.Body).Decode(&profile)
+	assert.Equal(t, "Book shop", profile.Name)
+	assert.Equal(t, 4.5, profile.Rating)
+	assert.Equal(t, 2, profile.RatingCount)
+
+	ids := createTestItems(t, h, "seller",
+		structsUFUT.ItemDataRSC{Name: "book", Price: 10, Category: "books"},
+		structsUFUT.ItemDataRSC{Name: "lamp", Price: 20, Category: "home"},
+		structsUFUT.ItemDataRSC{Name: "old book", Price: 5, Category: "books"})
+	createTestItems(t, h, "other", structsUFUT.ItemDataRSC{Name: "toy", Price: 5, Category: "toys"})
+	assert.NoError(t, srvc.DeleteItem(t.Context(), &structsUFUT.ItemDataRSC{ItemID: ids[2], Category: "books"}, "seller"))
+	draft := structsUFUT.ItemDataRSC{Name: "draft", Price: 1, Category: "books", SellerID: "seller", ItemID: "draft-item"}
+	assert.NoError(t, srvc.CreateItem(t.Context(), &draft))
+
+	assert.Equal(t, []string{ids[1], ids[0]}, listing(do(http.MethodGet, "/api/user/sellers/seller/items", "user", nil)))
+	assert.Equal(t, []string{ids[0]}, listing(do(http.MethodGet, "/api/user/sellers/seller/items?category=books", "user", nil)))
+	assert.Equal(t, []string{ids[1], ids[0], ids[2], "draft-item"}, listing(do(http.MethodGet, "/api/staff/myItems", "seller", nil)))
+	assert.Equal(t, []string{ids[2]}, listing(do(http.MethodGet, "/api/staff/myItems?status=deleted", "seller", nil)))
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodGet, "/api/staff/myItems?status=sold", "seller", nil).Code)
+}
+
+func TestHandler_ItemPrices(t *testing.T) {
+	srvc, cleanUp := CreateCatalogService(t)
+	defer cleanUp()
+	h := NewHandler(srvc)
+	ids := createTestItems(t, h, "seller",
+		structsUFUT.ItemDataRSC{Name: "book", Price: 100, Category: "books", SKU: "b-1"})
+
+	schedule := func(getterID string, entry structsUFUT.ItemPriceRSC) (int, int64) {
+		entry.ItemID = ids[0]
+		body, _ := json.Marshal(entry)
+		r := withGetterID(httptest.NewRequest(http.MethodPost, "/api/staff/scheduleItemPrice", bytes.NewReader(body)), getterID)
+		w := httptest.NewRecorder()
+		h.ScheduleItemPrice(w, r)
+		var resp struct {
+			PriceID int64 `json:"priceID"`
+		}
+		json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp.PriceID
+	}
+	getItem := func() (structsUFUT.ItemDataRSC, string) {
+		r := httptest.NewRequest(http.MethodGet, "/api/user/itemByItemID?itemid="+ids[0], nil)
+		w := httptest.NewRecorder()
+		h.ItemByItemID(w, r)
+		var item structsUFUT.ItemDataRSC
+		json.NewDecoder(w.Body).Decode(&item)
+		return item, w.Header().Get("ETag")
+	}
+	history := func(handler http.HandlerFunc) []int {
+		r := withGetterID(httptest.NewRequest(http.MethodGet, "/?itemid="+ids[0], nil), "seller")
+		w := httptest.NewRecorder()
+		handler(w, r)
+		var entries []structsUFUT.ItemPriceRSC
+		json.NewDecoder(w.Body).Decode(&entries)
+		prices := []int{}
+		for _, e := range entries {
+			prices = append(prices, e.Price)
+		}
+		return prices
+	}
+
+	_, etagBefore := getItem()
+	hourLater := time.Now().Add(time.Hour)
+	tomorrow := time.Now().Add(24 * time.Hour)
+
+	code, _ := schedule("seller", structsUFUT.ItemPriceRSC{Kind: structsUFUT.PriceKindSale, Price: 80})
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = schedule("seller", structsUFUT.ItemPriceRSC{Kind: structsUFUT.PriceKindRegular, Price: 90, StartsAt: time.Now().Add(-time.Hour)})
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = schedule("other", structsUFUT.ItemPriceRSC{Kind: structsUFUT.PriceKindSale, Price: 80, EndsAt: &hourLater})
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = schedule("seller", structsUFUT.ItemPriceRSC{Kind: structsUFUT.PriceKindSale, Price: 80, EndsAt: &hourLater})
+	assert.Equal(t, http.StatusOK, code)
+	code, futureID := schedule("seller", structsUFUT.ItemPriceRSC{Kind: structsUFUT.PriceKindRegular, Price: 120, StartsAt: tomorrow})
+	assert.Equal(t, http.StatusOK, code)
+
+	item, etagAfter := getItem()
+	assert.Equal(t, 80, item.Price)
+	assert.Equal(t, 100, item.RegularPrice)
+	assert.WithinDuration(t, hourLater, *item.SaleEndsAt, time.Second)
+	assert.NotEqual(t, etagBefore, etagAfter)
+
+	assert.Equal(t, []int{100, 80}, history(h.ItemPriceHistory))
+	assert.Equal(t, []int{100, 80, 120}, history(h.StaffItemPriceHistory))
+	// other sellers don't see what is scheduled
+	w := httptest.NewRecorder()
+	h.StaffItemPriceHistory(w, withGetterID(httptest.NewRequest(http.MethodGet, "/?itemid="+ids[0], nil), "other"))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, exportItems(t, h, "?format=csv&sellerID=seller"), "b-1,book,,100,USD,books,available")
+
+	cancel := func(priceID int64) int {
+		body, _ := json.Marshal(structsUFUT.ItemPriceRSC{ItemID: ids[0], PriceID: priceID})
+		r := withGetterID(httptest.NewRequest(http.MethodPost, "/api/staff/cancelItemPrice", bytes.NewReader(body)), "seller")
+		w := httptest.NewRecorder()
+		h.CancelItemPrice(w, r)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, cancel(futureID))
+	assert.Equal(t, http.StatusNotFound, cancel(futureID))
+	assert.Equal(t, []int{100, 80}, history(h.StaffItemPriceHistory))
+}
+
+func TestHandler_Currencies(t *testing.T) {
+	srvc, cleanUp := CreateCatalogService(t)
+	defer cleanUp()
+	h := NewHandler(srvc)
+	ids := createTestItems(t, h, "seller",
+		structsUFUT.ItemDataRSC{Name: "book", Price: 1000, Category: "books"},
+		structsUFUT.ItemDataRSC{Name: "livre", Price: 1000, Currency: "eur", Category: "books"})
+
+	setRatesAs := func(getterID, contentType, body string) int {
+		r := withGetterID(httptest.NewRequest(http.MethodPost, "/api/staff/exchangeRates", strings.NewReader(body)), getterID)
+		r.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		h.SetExchangeRates(w, r)
+		return w.Code
+	}
+	setRates := func(contentType, body string) int {
+		return setRatesAs("treasurer", contentType, body)
+	}
+	getItem := func(itemID, currency string) (int, structsUFUT.ItemDataRSC) {
+		r := httptest.NewRequest(http.MethodGet, "/?itemid="+itemID+"&currency="+currency, nil)
+		w := httptest.NewRecorder()
+		h.ItemByItemID(w, r)
+		var item structsUFUT.ItemDataRSC
+		json.NewDecoder(w.Body).Decode(&item)
+		return w.Code, item
+	}
+
+	code, item := getItem(ids[1], "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "EUR", item.Currency)
+	code, _ = getItem(ids[1], "USD")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// nobody sets rates until admins are configured
+	assert.Equal(t, http.StatusForbidden, setRates("text/csv", "EUR,0.9\n"))
+	srvc.SetRatesAdmins([]string{"treasurer"})
+	assert.Equal(t, http.StatusForbidden, setRatesAs("seller", "text/csv", "EUR,0.9\n"))
+	assert.Equal(t, http.StatusBadRequest, setRates("application/json", `{"reference":"EUR","rates":[{"currency":"USD","rate":"1.1"}]}`))
+	assert.Equal(t, http.StatusBadRequest, setRates("text/csv", "currency,rate\nEUR,-1\n"))
+	assert.Equal(t, http.StatusBadRequest, setRates("text/csv", "XXX,2\n"))
+	assert.Equal(t, http.StatusOK, setRates("text/csv", "currency,rate\nEUR,0.9\nJPY,150\n"))
+
+	r := httptest.NewRequest(http.MethodGet, "/api/user/exchangeRates", nil)
+	w := httptest.NewRecorder()
+	h.ExchangeRates(w, r)
+	var table structsUFUT.ExchangeRatesRSC
+	json.NewDecoder(w.Body).Decode(&table)
+	assert.Equal(t, "USD", table.Reference)
+	assert.Len(t, table.Rates, 3)
+
+	// 10.00 EUR / 0.9 = 11.111 USD, rounded to the cent
+	code, item = getItem(ids[1], "usd")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1111, item.Price)
+	assert.Equal(t, "USD", item.Currency)
+	// JPY has no minor units: 10.00 USD * 150 = 1500 JPY
+	_, item = getItem(ids[0], "JPY")
+	assert.Equal(t, 1500, item.Price)
+	code, _ = getItem(ids[0], "GBP")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// listing is ordered by the price in the catalog currency
+	r = httptest.NewRequest(http.MethodGet, "/?category=books&orderby=asc", nil)
+	w = httptest.NewRecorder()
+	h.ItemsByParams(w, r)
+	var listing structsUFUT.ItemsResponseRSC
+	json.NewDecoder(w.Body).Decode(&listing)
+	assert.Equal(t, ids, listing.ItemsIDs)
+
+	batch, err := srvc.ItemsByItemIDs(t.Context(), "", ids, ViewOptions{Currency: "EUR"})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{900, 1000}, []int{batch.Items[0].Price, batch.Items[1].Price})
+}
+
+func TestHandler_Translations(t *testing.T) {
+	srvc, cleanUp := CreateCatalogService(t)
+	defer cleanUp()
+	h := NewHandler(srvc)
+	ids := createTestItems(t, h, "seller",
+		structsUFUT.ItemDataRSC{Name: "lamp", Description: "blue lamp", Price: 100, Category: "books"},
+		structsUFUT.ItemDataRSC{Name: "pen", Price: 10, Category: "books"})
+
+	post := func(handler http.HandlerFunc, getterID string, v any) int {
+		body, _ := json.Marshal(v)
+		r := withGetterID(httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)), getterID)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code
+	}
+	getItem := func(itemID, acceptLanguage string) (structsUFUT.ItemDataRSC, string) {
+		r := httptest.NewRequest(http.MethodGet, "/?itemid="+itemID, nil)
+		r.Header.Set("Accept-Language", acceptLanguage)
+		w := httptest.NewRecorder()
+		h.ItemByItemID(w, r)
+		var item structsUFUT.ItemDataRSC
+		json.NewDecoder(w.Body).Decode(&item)
+		return item, w.Header().Get("Content-Language")
+	}
+
+	lampDE := structsUFUT.ItemTranslationRSC{ItemID: ids[0], Locale: "DE", Name: "Lampe", Description: "blaue Lampe"}
+	assert.Equal(t, http.StatusNotFound, post(h.SetItemTranslation, "other", lampDE))
+	assert.Equal(t, http.StatusBadRequest, post(h.SetItemTranslation, "seller",
+		structsUFUT.ItemTranslationRSC{ItemID: ids[0], Locale: "en", Name: "Lamp"}))
+	assert.Equal(t, http.StatusBadRequest, post(h.SetItemTranslation, "seller",
+		structsUFUT.ItemTranslationRSC{ItemID: ids[0], Locale: "deutsch", Name: "Lampe"}))
+	assert.Equal(t, http.StatusOK, post(h.SetItemTranslation, "seller", lampDE))
+	// a new translation is content the moderators haven't seen, setting the same one again changes nothing
+	status := func(itemID string) string {
+		item := structsUFUT.ItemDataRSC{ItemID: itemID}
+		assert.NoError(t, srvc.ItemByItemID(t.Context(), "seller", &item, ViewOptions{}))
+		return item.Status
+	}
+	assert.Equal(t, structsUFUT.ItemStatusPendingReview, status(ids[0]))
+	assert.Equal(t, http.StatusOK, moderateTestItem(h, "approve", ids[0], ""))
+	assert.Equal(t, http.StatusOK, post(h.SetItemTranslation, "seller", lampDE))
+	assert.Equal(t, structsUFUT.ItemStatusAvailable, status(ids[0]))
+	assert.Equal(t, http.StatusOK, post(h.SetItemTranslation, "seller",
+		structsUFUT.ItemTranslationRSC{ItemID: ids[0], Locale: "pt-BR", Name: "Luminária"}))
+	assert.Equal(t, http.StatusOK, moderateTestItem(h, "approve", ids[0], ""))
+	assert.Equal(t, http.StatusOK, post(h.SetCategoryTranslation, "moderator",
+		structsUFUT.CategoryTranslationRSC{Category: "books", Locale: "de", DisplayName: "Bücher"}))
+	assert.Equal(t, http.StatusNotFound, post(h.SetCategoryTranslation, "moderator",
+		structsUFUT.CategoryTranslationRSC{Category: "unknown", Locale: "de", DisplayName: "X"}))
+
+	item, lang := getItem(ids[0], "de-AT, pt;q=0.5")
+	assert.Equal(t, "Lampe", item.Name)
+	assert.Equal(t, "blaue Lampe", item.Description)
+	assert.Equal(t, "Bücher", item.CategoryName)
+	assert.Equal(t, "de", lang)
+	item, lang = getItem(ids[0], "pt-BR")
+	assert.Equal(t, "Luminária", item.Name)
+	assert.Equal(t, "books", item.CategoryName)
+	assert.Equal(t, "pt-BR", lang)
+	// pt-PT falls back to the catalog locale, not to a sibling region
+	item, lang = getItem(ids[0], "pt-PT")
+	assert.Equal(t, "lamp", item.Name)
+	assert.Equal(t, "en", lang)
+	item, _ = getItem(ids[1], "de")
+	assert.Equal(t, "pen", item.Name)
+	assert.Equal(t, "Bücher", item.CategoryName)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/user/categories", nil)
+	r.Header.Set("Accept-Language", "de")
+	w := httptest.NewRecorder()
+	h.Categories(w, r)
+	var categories struct {
+		Categories   []string `json:"categories"`
+		DisplayNames []string `json:"displayNames"`
+	}
+	json.NewDecoder(w.Body).Decode(&categories)
+	assert.Equal(t, "Bücher", categories.DisplayNames[slices.Index(categories.Categories, "books")])
+
+	assert.Equal(t, http.StatusOK, post(h.DeleteItemTranslation, "seller", structsUFUT.ItemTranslationRSC{ItemID: ids[0], Locale: "de"}))
+	assert.Equal(t, http.StatusNotFound, post(h.DeleteItemTranslation, "seller", structsUFUT.ItemTranslationRSC{ItemID: ids[0], Locale: "de"}))
+	item, _ = getItem(ids[0], "de")
+	assert.Equal(t, "lamp", item.Name)
+	translations, err := srvc.ItemTranslations(t.Context(), ids[0])
+	assert.NoError(t, err)
+	assert.Len(t, translations, 1)
+}
+
+func TestHandler_SearchSuggestRoutes(t *testing.T) {
+	srvc, cleanUp := CreateCatalogService(t)
+	defer cleanUp()
+	h := NewHandler(srvc)
+	createTestItems(t, h, "seller",
+		structsUFUT.ItemDataRSC{Name: "Blue Lamp", Price: 10, Category: "home"},
+		structsUFUT.ItemDataRSC{Name: "Lantern", Price: 20, Category: "home"})
+	mux := http.NewServeMux()
+	RegisterRoutes(mux, h)
+	token, err := funcsUFUT.GenerateJWT(funcsUFUT.JWTCustomFields{GetterID: "u1"})
+	assert.NoError(t, err)
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusServiceUnavailable, do(http.MethodGet, "/api/user/search/suggest?q=la", "").Code)
+
+	suggester := searchCatalog.NewSuggester(searchCatalog.DefaultSuggestConfig)
+	assert.NoError(t, suggester.Load(t.Context(), srvc.repo))
+	srvc.SetSuggester(suggester)
+
+	w := do(http.MethodGet, "/api/user/search/suggest?q=LA", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp structsUFUT.SuggestResponseRSC
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	assert.Equal(t, "la", resp.Query)
+	texts := []string{}
+	for _, s := range resp.Suggestions {
+		texts = append(texts, s.Text)
+	}
+	assert.ElementsMatch(t, []string{"Blue Lamp", "Lantern"}, texts)
+
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/user/search/queries", `{"query": "lamp"}`).Code)
+	r := httptest.NewRequest(http.MethodGet, "/api/user/search/suggest?q=la", nil)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,169 @@
+package catalog_service
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"net/http"
+	"strconv"
+	structsUFUT "ufut/lib/structs"
+
+	_ "image/gif"
+	_ "image/png"
+)
+
+var (
+	ErrImageTooLarge        = errors.New("image is too large")
+	ErrUnsupportedImageType = errors.New("unsupported image type")
+	ErrUnknownImageSize     = errors.New("unknown image size")
+)
+
+var (
+	// MaxImageSize limits the size of an uploaded image in bytes
+	MaxImageSize int64 = 5 << 20
+	// MaxImagePixels limits width times height of an uploaded image, decoding allocates memory for every pixel
+	MaxImagePixels = 40_000_000
+	// ThumbnailSizes lists the longest side of generated thumbnails in pixels
+	ThumbnailSizes = []int{128, 256, 512}
+	// ImagesBaseURL is prepended to imageID to build public image URLs
+	ImagesBaseURL = "/api/user/images/"
+)
+
+const (
+	originalImageSize = "original"
+	thumbnailQuality  = 85
+)
+
+var allowedImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+/*
+Detects content type of the image by its first bytes.
+The type declared by the client is not trusted
+*/
+func sniffImage(data []byte) (string, error) {
+	if int64(len(data)) > MaxImageSize {
+		return "", ErrImageTooLarge
+	}
+	contentType := http.DetectContentType(data)
+	if !allowedImageTypes[contentType] {
+		return "", ErrUnsupportedImageType
+	}
+	return contentType, nil
+}
+
+/*
+Decodes the image and returns JPEG thumbnails keyed by size name.
+Images smaller than the thumbnail size are not upscaled.
+Dimensions are read from the header first, so images over MaxImagePixels are rejected before decoding
+*/
+func makeThumbnails(data []byte) (map[string][]byte, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImageType
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, ErrUnsupportedImageType
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > int64(MaxImagePixels) {
+		return nil, ErrImageTooLarge
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImageType
+	}
+	thumbs := make(map[string][]byte, len(ThumbnailSizes))
+	for _, size := range ThumbnailSizes {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, resizeImage(src, size), &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+			return nil, err
+		}
+		thumbs[strconv.Itoa(size)] = buf.Bytes()
+	}
+	return thumbs, nil
+}
+
+/*
+Scales src so that its longest side equals maxSide, averaging the
+source pixels covered by every destination pixel.
+Transparent areas are flattened onto white background
+*/
+func resizeImage(src image.Image, maxSide int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if w >= h && w > maxSide {
+		dw, dh = maxSide, max(1, h*maxSide/w)
+	} else if h > w && h > maxSide {
+		dw, dh = max(1, w*maxSide/h), maxSide
+	}
+	flat := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), src, b.Min, draw.Over)
+	if dw == w && dh == h {
+		return flat
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*h/dh, max((y+1)*h/dh, y*h/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*w/dw, max((x+1)*w/dw, x*w/dw+1)
+			var r, g, bl, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					o := flat.PixOffset(sx, sy)
+					r += uint32(flat.Pix[o])
+					g += uint32(flat.Pix[o+1])
+					bl += uint32(flat.Pix[o+2])
+					n++
+				}
+			}
+			o := dst.PixOffset(x, y)
+			dst.Pix[o] = uint8(r / n)
+			dst.Pix[o+1] = uint8(g / n)
+			dst.Pix[o+2] = uint8(bl / n)
+			dst.Pix[o+3] = 0xff
+		}
+	}
+	return dst
+}
+
+func isThumbnailSize(size string) bool {
+	for _, s := range ThumbnailSizes {
+		if strconv.Itoa(s) == size {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Returns blob key of the image in the given size
+*/
+func imageBlobKey(imageID, size string) string {
+	return "images/" + imageID + "/" + size
+}
+
+/*
+Returns public URL of the image
+*/
+func imageURL(imageID string) string {
+	return ImagesBaseURL + imageID
+}
+
+/*
+Returns public URLs of the images keeping their order
+*/
+func imageURLs(images []structsUFUT.ItemImageRSC) []string {
+	urls := make([]string, 0, len(images))
+	for _, img := range images {
+		urls = append(urls, imageURL(img.ImageID))
+	}
+	return urls
+}
@@ -0,0 +1,82 @@
+package catalog_service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 0x80, 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("%v", err.Error())
+	}
+	return buf.Bytes()
+}
+
+func TestSniffImage(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		wantType string
+		wantErr  error
+	}{
+		{name: "png", data: encodePNG(t, 4, 4), wantType: "image/png"},
+		{name: "text", data: []byte("definitely not an image"), wantErr: ErrUnsupportedImageType},
+		{name: "html", data: []byte("<html><body></body></html>"), wantErr: ErrUnsupportedImageType},
+		{name: "tooLarge", data: make([]byte, MaxImageSize+1), wantErr: ErrImageTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ct, err := sniffImage(tt.data)
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.wantType, ct)
+		})
+	}
+}
+
+func TestMakeThumbnails(t *testing.T) {
+	thumbs, err := makeThumbnails(encodePNG(t, 1000, 200))
+	assert.NoError(t, err)
+	assert.Len(t, thumbs, len(ThumbnailSizes))
+	want := map[string]image.Point{
+		"128": {128, 25},
+		"256": {256, 51},
+		"512": {512, 102},
+	}
+	for size, dims := range want {
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(thumbs[size]))
+		assert.NoError(t, err)
+		assert.Equal(t, dims, image.Point{cfg.Width, cfg.Height}, size)
+	}
+
+	small, err := makeThumbnails(encodePNG(t, 50, 80))
+	assert.NoError(t, err)
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(small["512"]))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Point{50, 80}, image.Point{cfg.Width, cfg.Height})
+
+	_, err = makeThumbnails([]byte("GIF89a"))
+	assert.Equal(t, ErrUnsupportedImageType, err)
+
+	// a tiny file claiming 50000x50000 pixels is rejected from its header
+	huge := encodePNG(t, 4, 4)
+	binary.BigEndian.PutUint32(huge[16:], 50000)
+	binary.BigEndian.PutUint32(huge[20:], 50000)
+	binary.BigEndian.PutUint32(huge[29:], crc32.ChecksumIEEE(huge[12:29]))
+	_, err = makeThumbnails(huge)
+	assert.Equal(t, ErrImageTooLarge, err)
+}
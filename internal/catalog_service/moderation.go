@@ -0,0 +1,158 @@
+package catalog_service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	eventsUFUT "ufut/lib/events"
+	funcsUFUT "ufut/lib/funcs"
+	structsUFUT "ufut/lib/structs"
+	"unicode"
+)
+
+var (
+	ErrBannedWords     = errors.New("name or description contains banned words")
+	ErrNotModerator    = errors.New("not allowed to moderate items")
+	ErrSelfModeration  = errors.New("sellers can't moderate their own items")
+	ErrUnknownDecision = errors.New("decision must be approved or rejected")
+	ErrMissingReason   = errors.New("rejection requires a reason")
+)
+
+type ModerationConfig struct {
+	// BannedWords are matched case-insensitively against whole words of name and description;
+	// an entry of several words matches the same sequence of words
+	BannedWords []string `yaml:"banned_words"`
+	// Moderators lists staff IDs allowed to moderate; empty allows nobody
+	Moderators []string `yaml:"moderators"`
+}
+
+/*
+Reads banned words from BANNED_WORDS (comma-separated) and BANNED_WORDS_FILE (one per line),
+moderators from MODERATORS (comma-separated staff IDs)
+*/
+func LoadModerationConfig() (ModerationConfig, error) {
+	var cfg ModerationConfig
+	cfg.BannedWords = splitList(funcsUFUT.GetEnvDefault("BANNED_WORDS", ""), ",")
+	if path := funcsUFUT.GetEnvDefault("BANNED_WORDS_FILE", ""); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.BannedWords = append(cfg.BannedWords, splitList(string(data), "\n")...)
+	}
+	cfg.Moderators = splitList(funcsUFUT.GetEnvDefault("MODERATORS", ""), ",")
+	return cfg, nil
+}
+
+func splitList(s, sep string) []string {
+	var res []string
+	for _, v := range strings.Split(s, sep) {
+		if v = strings.TrimSpace(v); v != "" {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+/*
+Lowercases text and joins its words with single spaces,
+surrounded by spaces so whole-word matching is a substring check
+*/
+func normalizeWords(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	return " " + strings.Join(words, " ") + " "
+}
+
+/*
+Returns banned words found in the item's name and description
+*/
+func (s *Service) bannedWordsIn(item *structsUFUT.ItemDataRSC) []string {
+	text := normalizeWords(item.Name + " " + item.Description)
+	var found []string
+	for _, word := range s.moderation.BannedWords {
+		w := normalizeWords(word)
+		if w != "  " && strings.Contains(text, w) {
+			found = append(found, strings.TrimSpace(w))
+		}
+	}
+	return found
+}
+
+func (s *Service) checkBannedWords(item *structsUFUT.ItemDataRSC) error {
+	if found := s.bannedWordsIn(item); len(found) > 0 {
+		return errors.Join(ErrBannedWords, errors.New(strings.Join(found, ", ")))
+	}
+	return nil
+}
+
+/*
+Lists items pending review for the moderator
+*/
+func (s *Service) ModerationQueue(ctx context.Context, moderatorID string, req *structsUFUT.ModerationQueueRequestRSC) (*structsUFUT.ModerationQueueResponseRSC, error) {
+	if !s.isModerator(moderatorID) {
+		return nil, ErrNotModerator
+	}
+	if req.Count <= 0 {
+		req.Count = DefaultItemsPerPage
+	}
+	req.Count = min(req.Count, MaxItemsPerPage)
+	return s.repo.ModerationQueue(ctx, req)
+}
+
+/*
+Approves or rejects the pending item and notifies its seller.
+decision.ItemID, ModeratorID and Decision must be set; Reason is required for rejections
+*/
+func (s *Service) ModerateItem(ctx context.Context, decision *structsUFUT.ModerationDecisionRSC) error {
+	switch decision.Decision {
+	case structsUFUT.ModerationApproved:
+	case structsUFUT.ModerationRejected:
+		if strings.TrimSpace(decision.Reason) == "" {
+			return ErrMissingReason
+		}
+	default:
+		return ErrUnknownDecision
+	}
+	if !s.isModerator(decision.ModeratorID) {
+		return ErrNotModerator
+	}
+	item := structsUFUT.ItemDataRSC{ItemID: decision.ItemID}
+	if err := s.repo.ItemByItemID(ctx, &item); err != nil {
+		return err
+	}
+	if item.SellerID == decision.ModeratorID {
+		return ErrSelfModeration
+	}
+	if err := s.repo.ModerateItem(ctx, decision); err != nil {
+		return err
+	}
+	if err := s.repo.ItemByItemID(ctx, &item); err == nil {
+		s.publishItemEvents(ctx, eventsUFUT.ItemUpdated, item)
+	}
+	s.notifySeller(ctx, &structsUFUT.ModerationNotification{
+		Action:   "itemModerated",
+		SellerID: item.SellerID,
+		ItemID:   item.ItemID,
+		Decision: decision.Decision,
+		Reason:   decision.Reason,
+	})
+	return nil
+}
+
+func (s *Service) notifySeller(ctx context.Context, notification *structsUFUT.ModerationNotification) {
+	if s.kafkaNotificationsWriter == nil {
+		return
+	}
+	msg, err := eventsUFUT.NewMessage(eventsUFUT.ItemModerated, eventsProducer, "", notification.SellerID, notification)
+	if err != nil {
+		log.Printf("%v%v\n", "failed marshal notification: ", err)
+		return
+	}
+	if err := s.kafkaNotificationsWriter.WriteMessages(ctx, msg); err != nil {
+		log.Println("failed send msg to kafka notification topic")
+	}
+}
@@ -0,0 +1,132 @@
+package catalog_service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+	eventsUFUT "ufut/lib/events"
+	structsUFUT "ufut/lib/structs"
+)
+
+var (
+	ErrUnknownPriceKind = errors.New("price kind must be regular or sale")
+	ErrInvalidPrice     = errors.New("price must not be negative")
+	ErrPriceInPast      = errors.New("price entry can't start in the past")
+	ErrInvalidSaleRange = errors.New("sale must end after it starts and in the future")
+)
+
+/*
+entry.ItemID, Kind, Price and CreatedBy must be set; StartsAt defaults to now,
+EndsAt is required for sales. The entry takes effect at StartsAt, prices are resolved at read time
+*/
+func (s *Service) ScheduleItemPrice(ctx context.Context, entry *structsUFUT.ItemPriceRSC) error {
+	now := time.Now()
+	if entry.StartsAt.IsZero() {
+		entry.StartsAt = now
+	}
+	switch {
+	case entry.Kind != structsUFUT.PriceKindRegular && entry.Kind != structsUFUT.PriceKindSale:
+		return ErrUnknownPriceKind
+	case entry.Price < 0:
+		return ErrInvalidPrice
+	// a minute of clock skew between client and server is tolerated
+	case entry.StartsAt.Before(now.Add(-time.Minute)):
+		return ErrPriceInPast
+	case entry.Kind == structsUFUT.PriceKindSale &&
+		(entry.EndsAt == nil || !entry.EndsAt.After(entry.StartsAt) || !entry.EndsAt.After(now)):
+		return ErrInvalidSaleRange
+	}
+	if entry.Kind == structsUFUT.PriceKindRegular {
+		entry.EndsAt = nil
+	}
+	if err := s.repo.AddItemPrice(ctx, entry); err != nil {
+		return err
+	}
+	s.publishItemChange(ctx, entry.ItemID)
+	return nil
+}
+
+/*
+Removes a price entry of the seller's item that hasn't started yet
+*/
+func (s *Service) CancelItemPrice(ctx context.Context, itemID string, priceID int64, sellerID string) error {
+	if err := s.repo.CancelItemPrice(ctx, itemID, priceID, sellerID); err != nil {
+		return err
+	}
+	s.publishItemChange(ctx, itemID)
+	return nil
+}
+
+/*
+Returns price entries of the item ordered by start; entries scheduled for the future are included if withScheduled,
+only for the item's seller and moderators. Prices are converted into currency unless it is empty
+*/
+func (s *Service) ItemPriceHistory(ctx context.Context, getterID, itemID string, withScheduled bool, currency string) ([]structsUFUT.ItemPriceRSC, error) {
+	currency, err := s.responseCurrency(currency)
+	if err != nil {
+		return nil, err
+	}
+	item := structsUFUT.ItemDataRSC{ItemID: itemID}
+	if err := s.repo.ItemByItemID(ctx, &item); err != nil {
+		return nil, err
+	}
+	if withScheduled && !s.canManageItem(&item, getterID) {
+		return nil, ErrNotItemOwner
+	}
+	if !s.canViewItem(&item, getterID) {
+		return nil, sql.ErrNoRows
+	}
+	history, err := s.repo.ItemPriceHistory(ctx, itemID, withScheduled)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.convertPriceEntries(history, currency); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+func (s *Service) publishItemChange(ctx context.Context, itemID string) {
+	item := structsUFUT.ItemDataRSC{ItemID: itemID}
+	if err := s.repo.ItemByItemID(ctx, &item); err == nil {
+		s.publishItemEvents(ctx, eventsUFUT.ItemUpdated, item)
+	}
+}
+
+/*
+Publishes item.updated for items whose effective price changed because a scheduled price
+started or a sale ended, so consumers keeping prices stay current, and moves them in the listing order.
+Transitions are claimed in the repository, so each is published once by one of the running instances
+*/
+func (s *Service) PublishPriceTransitions(ctx context.Context, until time.Time) error {
+	ids, err := s.repo.ClaimPriceTransitions(ctx, until)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	items, err := s.repo.ItemsByItemIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	s.publishItemEvents(ctx, eventsUFUT.ItemUpdated, items...)
+	return nil
+}
+
+/*
+Publishes price transitions every interval until ctx is cancelled, see PublishPriceTransitions
+*/
+func (s *Service) RunPriceTransitions(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := s.PublishPriceTransitions(ctx, time.Now()); err != nil {
+			log.Printf("publish price transitions: %v\n", err)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package catalog_service
 
 import (
 	"context"
+	"io"
+	"time"
 	structsUFUT "ufut/lib/structs"
 )
 
@@ -9,9 +11,51 @@ type Repository interface {
 	Categories(ctx context.Context) ([]string, error)
 	ItemsByParams(ctx context.Context, req *structsUFUT.ItemsRequestRSC) (structsUFUT.ItemsResponseRSC, error)
 	ItemByItemID(ctx context.Context, req *structsUFUT.ItemDataRSC) error
+	ItemsByItemIDs(ctx context.Context, itemsIDs []string) ([]structsUFUT.ItemDataRSC, error)
 	// ReserveItem(ctx context.Context, itemID []string) []bool
 	// CancelItemReservation(ctx context.Context, itemID []string) error
 
 	CreateItem(ctx context.Context, item *structsUFUT.ItemDataRSC) error
-	DeleteItem(ctx context.Context, item *structsUFUT.ItemDataRSC) error
+	ItemIDsBySKUs(ctx context.Context, sellerID string, skus []string) (map[string]string, error)
+	UpsertItemsBySKU(ctx context.Context, items []structsUFUT.ItemDataRSC) error
+	ExportItems(ctx context.Context, sellerID string, fn func(item *structsUFUT.ItemDataRSC) error) error
+
+	ChangeItemStatus(ctx context.Context, change *structsUFUT.ItemStatusChangeRSC) error
+	ItemStatusHistory(ctx context.Context, itemID string) ([]structsUFUT.ItemStatusChangeRSC, error)
+
+	AddItemPrice(ctx context.Context, entry *structsUFUT.ItemPriceRSC) error
+	CancelItemPrice(ctx context.Context, itemID string, priceID int64, sellerID string) error
+	ItemPriceHistory(ctx context.Context, itemID string, withScheduled bool) ([]structsUFUT.ItemPriceRSC, error)
+	ClaimPriceTransitions(ctx context.Context, until time.Time) ([]string, error)
+
+	ItemTranslations(ctx context.Context, itemsIDs []string) (map[string][]structsUFUT.ItemTranslationRSC, error)
+	ExportItemTranslations(ctx context.Context, fn func(tr *structsUFUT.ItemTranslationRSC) error) error
+	UpsertItemTranslation(ctx context.Context, tr *structsUFUT.ItemTranslationRSC) error
+	DeleteItemTranslation(ctx context.Context, itemID, locale, sellerID string) error
+	CategoryTranslations(ctx context.Context) ([]structsUFUT.CategoryTranslationRSC, error)
+	UpsertCategoryTranslation(ctx context.Context, tr *structsUFUT.CategoryTranslationRSC) error
+	DeleteCategoryTranslation(ctx context.Context, category, locale string) error
+
+	ExchangeRates(ctx context.Context) (*structsUFUT.ExchangeRatesRSC, error)
+	SetExchangeRates(ctx context.Context, table *structsUFUT.ExchangeRatesRSC) error
+
+	SellerProfile(ctx context.Context, req *structsUFUT.SellerProfileRSC) error
+	UpsertSellerProfile(ctx context.Context, profile *structsUFUT.SellerProfileRSC) error
+	RateSeller(ctx context.Context, rating *structsUFUT.SellerRatingRSC) error
+	AddSellerCustomer(ctx context.Context, userID string, sellerIDs []string) error
+	IsSellerCustomer(ctx context.Context, sellerID, userID string) (bool, error)
+
+	ModerationQueue(ctx context.Context, req *structsUFUT.ModerationQueueRequestRSC) (*structsUFUT.ModerationQueueResponseRSC, error)
+	ModerateItem(ctx context.Context, decision *structsUFUT.ModerationDecisionRSC) error
+
+	AddItemImage(ctx context.Context, img *structsUFUT.ItemImageRSC) error
+	ItemImages(ctx context.Context, itemID string) ([]structsUFUT.ItemImageRSC, error)
+	ImagesByItemIDs(ctx context.Context, itemsIDs []string) (map[string][]structsUFUT.ItemImageRSC, error)
+	ItemImage(ctx context.Context, img *structsUFUT.ItemImageRSC) error
+}
+
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
 }
@@ -0,0 +1,148 @@
+package catalog_service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+	eventsUFUT "ufut/lib/events"
+	structsUFUT "ufut/lib/structs"
+
+	"github.com/segmentio/kafka-go"
+)
+
+var (
+	ErrMissingSellerName = errors.New("seller name is required")
+	ErrInvalidRating     = errors.New("rating must be from 1 to 5")
+	ErrSelfRating        = errors.New("sellers can't rate themselves")
+	ErrSellerTextTooLong = errors.New("seller name or description is too long")
+	ErrNotSellerCustomer = errors.New("only customers with a finished order can rate the seller")
+)
+
+const (
+	MaxSellerNameLen        = 100
+	MaxSellerDescriptionLen = 2000
+)
+
+func (s *Service) SellerProfile(ctx context.Context, req *structsUFUT.SellerProfileRSC) error {
+	return s.repo.SellerProfile(ctx, req)
+}
+
+/*
+profile.SellerID, Name and Description must be set
+*/
+func (s *Service) UpdateSellerProfile(ctx context.Context, profile *structsUFUT.SellerProfileRSC) error {
+	profile.Name = strings.TrimSpace(profile.Name)
+	if profile.Name == "" {
+		return ErrMissingSellerName
+	}
+	if len(profile.Name) > MaxSellerNameLen || len(profile.Description) > MaxSellerDescriptionLen {
+		return ErrSellerTextTooLong
+	}
+	return s.repo.UpsertSellerProfile(ctx, profile)
+}
+
+/*
+The user must have a finished order from the seller, a new rating replaces the user's previous one
+*/
+func (s *Service) RateSeller(ctx context.Context, rating *structsUFUT.SellerRatingRSC) error {
+	if rating.Rating < 1 || rating.Rating > 5 {
+		return ErrInvalidRating
+	}
+	if rating.UserID == rating.SellerID {
+		return ErrSelfRating
+	}
+	customer, err := s.repo.IsSellerCustomer(ctx, rating.SellerID, rating.UserID)
+	if err != nil {
+		return err
+	}
+	if !customer {
+		return ErrNotSellerCustomer
+	}
+	return s.repo.RateSeller(ctx, rating)
+}
+
+// records the buyer of a finished order as a customer of its sellers
+func (s *Service) handleOrderMsg(ctx context.Context, msg kafka.Message) error {
+	meta, err := eventsUFUT.ReadMetadata(msg)
+	if err != nil || meta.Type != eventsUFUT.OrderStatusChanged {
+		return nil
+	}
+	event, err := eventsUFUT.Decode[structsUFUT.OrderStatusChangeRMP](msg)
+	if err != nil {
+		log.Printf("skip order status change: %v\n", err)
+		return nil
+	}
+	if event.Payload.To != structsUFUT.OrderFinished || len(event.Payload.SellerIDs) == 0 {
+		return nil
+	}
+	return s.repo.AddSellerCustomer(ctx, event.Payload.UserID, event.Payload.SellerIDs)
+}
+
+/*
+Consumes order status changes until ctx is cancelled. A message that fails is retried until it's handled,
+committing later messages would commit it too
+*/
+func (s *Service) ServeOrdersKafka(ctx context.Context, reader *kafka.Reader) error {
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				return err
+			}
+			log.Printf("fetch error: %v\n", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		backoff := time.Second
+		for {
+			err := s.handleOrderMsg(ctx, msg)
+			if err == nil {
+				break
+			}
+			log.Printf("handle error, retry in %v: %v\n", backoff, err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, time.Minute)
+		}
+
+		if err := reader.CommitMessages(ctx, msg); err != nil {
+			log.Printf("commit error: %v\n", err)
+		}
+	}
+}
+
+/*
+Lists the seller's available items, req.SellerID must be set
+*/
+func (s *Service) SellerItems(ctx context.Context, req *structsUFUT.ItemsRequestRSC) (structsUFUT.ItemsResponseRSC, error) {
+	req.Statuses = nil
+	return s.ItemsByParams(ctx, req)
+}
+
+/*
+Lists the seller's items of the given statuses, of every status (drafts and deleted included) if none given
+*/
+func (s *Service) MyItems(ctx context.Context, req *structsUFUT.ItemsRequestRSC) (structsUFUT.ItemsResponseRSC, error) {
+	if len(req.Statuses) == 0 {
+		req.Statuses = []string{
+			structsUFUT.ItemStatusDraft,
+			structsUFUT.ItemStatusPendingReview,
+			structsUFUT.ItemStatusAvailable,
+			structsUFUT.ItemStatusOutOfStock,
+			structsUFUT.ItemStatusArchived,
+			structsUFUT.ItemStatusDeleted,
+		}
+	}
+	for _, status := range req.Statuses {
+		if _, ok := itemStatusTransitions[status]; !ok {
+			return structsUFUT.ItemsResponseRSC{}, ErrUnknownStatus
+		}
+	}
+	return s.ItemsByParams(ctx, req)
+}
@@ -2,15 +2,77 @@ package catalog_service
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	searchCatalog "ufut/internal/search"
+	eventsUFUT "ufut/lib/events"
+	funcsUFUT "ufut/lib/funcs"
 	structsUFUT "ufut/lib/structs"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	// MaxBatchItems limits the number of IDs accepted by ItemsByItemIDs
+	MaxBatchItems = 100
+	// DefaultItemsPerPage is used when listing request doesn't specify count
+	DefaultItemsPerPage = 10
+	// MaxItemsPerPage limits count of a listing request
+	MaxItemsPerPage = 100
 )
 
+var (
+	ErrTooManyItems = errors.New("too many items requested")
+)
+
+// Writer publishes messages, *kafka.Writer in production
+type Writer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
 type Service struct {
-	repo Repository
+	repo                     Repository
+	blobs                    BlobStore
+	kafkaWriter              Writer
+	kafkaNotificationsWriter Writer
+	moderation               ModerationConfig
+	suggester                *searchCatalog.Suggester
+	currency                 string
+	locale                   string
+	rates                    atomic.Pointer[funcsUFUT.ExchangeRates]
+	ratesWriter              *kafka.Writer
+	ratesAdmins              []string
+}
+
+/*
+kafkaWriter receives item change events, kafkaNotificationsWriter receives
+notifications for sellers; nil disables publishing
+*/
+func NewService(repo Repository, blobs BlobStore, kafkaWriter Writer, kafkaNotificationsWriter Writer) *Service {
+	return &Service{
+		repo:                     repo,
+		blobs:                    blobs,
+		kafkaWriter:              kafkaWriter,
+		kafkaNotificationsWriter: kafkaNotificationsWriter,
+	}
 }
 
-func NewService(repo Repository) *Service {
-	return &Service{repo: repo}
+func (s *Service) SetModerationConfig(cfg ModerationConfig) {
+	s.moderation = cfg
+}
+
+/*
+Enables search suggestions; the suggester is kept up to date by its owner
+*/
+func (s *Service) SetSuggester(suggester *searchCatalog.Suggester) {
+	s.suggester = suggester
 }
 
 func (s *Service) Categories(ctx context.Context) ([]string, error) {
@@ -18,19 +80,312 @@ func (s *Service) Categories(ctx context.Context) ([]string, error) {
 }
 
 func (s *Service) ItemsByParams(ctx context.Context, req *structsUFUT.ItemsRequestRSC) (structsUFUT.ItemsResponseRSC, error) {
+	if req.Count <= 0 {
+		req.Count = DefaultItemsPerPage
+	}
+	req.Count = min(req.Count, MaxItemsPerPage)
 	return s.repo.ItemsByParams(ctx, req)
 }
 
-func (s *Service) ItemByItemID(ctx context.Context, req *structsUFUT.ItemDataRSC) error {
-	return s.repo.ItemByItemID(ctx, req)
+/*
+Prices are converted and text is localized as view asks.
+Items that aren't approved for sale are found only by their seller and moderators
+*/
+func (s *Service) ItemByItemID(ctx context.Context, getterID string, req *structsUFUT.ItemDataRSC, view ViewOptions) error {
+	currency, err := s.responseCurrency(view.Currency)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.ItemByItemID(ctx, req); err != nil {
+		return err
+	}
+	if !s.canViewItem(req, getterID) {
+		return sql.ErrNoRows
+	}
+	if err := s.convertItem(req, currency); err != nil {
+		return err
+	}
+	localized := []structsUFUT.ItemDataRSC{*req}
+	if err := s.localizeItems(ctx, localized, view.Locales); err != nil {
+		return err
+	}
+	*req = localized[0]
+	images, err := s.repo.ItemImages(ctx, req.ItemID)
+	if err != nil {
+		return err
+	}
+	req.Images = imageURLs(images)
+	return nil
 }
 
+/*
+Returns items in the order of itemsIDs; duplicate IDs are collapsed,
+unknown IDs and items getterID can't see (see ItemByItemID) are reported in NotFound;
+prices are converted and text is localized as view asks
+*/
+func (s *Service) ItemsByItemIDs(ctx context.Context, getterID string, itemsIDs []string, view ViewOptions) (*structsUFUT.ItemsBatchResponseRSC, error) {
+	currency, err := s.responseCurrency(view.Currency)
+	if err != nil {
+		return nil, err
+	}
+	unique := make([]string, 0, len(itemsIDs))
+	seen := make(map[string]bool, len(itemsIDs))
+	for _, id := range itemsIDs {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	if len(unique) > MaxBatchItems {
+		return nil, ErrTooManyItems
+	}
+	items, err := s.repo.ItemsByItemIDs(ctx, unique)
+	if err != nil {
+		return nil, err
+	}
+	images, err := s.repo.ImagesByItemIDs(ctx, unique)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]structsUFUT.ItemDataRSC, len(items))
+	for _, item := range items {
+		byID[item.ItemID] = item
+	}
+	resp := &structsUFUT.ItemsBatchResponseRSC{
+		Items:    make([]structsUFUT.ItemDataRSC, 0, len(items)),
+		NotFound: []string{},
+	}
+	for _, id := range unique {
+		item, ok := byID[id]
+		if !ok || !s.canViewItem(&item, getterID) {
+			resp.NotFound = append(resp.NotFound, id)
+			continue
+		}
+		if err := s.convertItem(&item, currency); err != nil {
+			return nil, err
+		}
+		item.Images = imageURLs(images[id])
+		resp.Items = append(resp.Items, item)
+	}
+	if err := s.localizeItems(ctx, resp.Items, view.Locales); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+/*
+New items always wait for moderation, whatever status the client sent;
+items without a currency are priced in the catalog currency
+*/
 func (s *Service) CreateItem(ctx context.Context, item *structsUFUT.ItemDataRSC) error {
-	return s.repo.CreateItem(ctx, item)
+	if err := s.checkBannedWords(item); err != nil {
+		return err
+	}
+	if err := s.itemCurrency(item); err != nil {
+		return err
+	}
+	item.Status = structsUFUT.ItemStatusPendingReview
+	if err := s.repo.CreateItem(ctx, item); err != nil {
+		return err
+	}
+	s.publishItemEvents(ctx, eventsUFUT.ItemCreated, *item)
+	return nil
+}
+
+func (s *Service) DeleteItem(ctx context.Context, item *structsUFUT.ItemDataRSC, actorID string) error {
+	// category is checked to guard against deleting a wrong item
+	if err := s.repo.ItemByItemID(ctx, &structsUFUT.ItemDataRSC{ItemID: item.ItemID, Category: item.Category}); err != nil {
+		return err
+	}
+	return s.ChangeItemStatus(ctx, &structsUFUT.ItemStatusChangeRSC{
+		ItemID:   item.ItemID,
+		ToStatus: structsUFUT.ItemStatusDeleted,
+		ActorID:  actorID,
+	})
+}
+
+/*
+Parses and validates every row of the import file, then upserts items by the seller's SKU.
+Nothing is written if any row is invalid or dryRun is set
+*/
+func (s *Service) ImportItems(ctx context.Context, sellerID, format string, r io.Reader, dryRun bool) (*structsUFUT.ImportReportRSC, error) {
+	items, rows, rowErrs, err := readItems(format, r)
+	if err != nil {
+		return nil, err
+	}
+	categories, err := s.repo.Categories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	knownCategories := make(map[string]bool, len(categories))
+	for _, c := range categories {
+		knownCategories[c] = true
+	}
+	report := &structsUFUT.ImportReportRSC{
+		DryRun: dryRun,
+		Rows:   len(items) + len(rowErrs),
+		Errors: rowErrs,
+	}
+	skuRows := make(map[string]int, len(items))
+	valid := make([]structsUFUT.ItemDataRSC, 0, len(items))
+	for i := range items {
+		item := &items[i]
+		item.SellerID = sellerID
+		// new items wait for moderation, approved ones go back to it if their content changes
+		item.Status = structsUFUT.ItemStatusPendingReview
+		var problem string
+		switch {
+		case item.SKU == "":
+			problem = "sku is required"
+		case skuRows[item.SKU] != 0:
+			problem = "duplicate sku, first seen at row " + strconv.Itoa(skuRows[item.SKU])
+		case item.Name == "":
+			problem = "name is required"
+		case item.Price < 0:
+			problem = "price must not be negative"
+		case s.itemCurrency(item) != nil:
+			problem = "unknown currency"
+		case !knownCategories[item.Category]:
+			problem = "unknown category"
+		case len(s.bannedWordsIn(item)) > 0:
+			problem = "banned words: " + strings.Join(s.bannedWordsIn(item), ", ")
+		}
+		if problem != "" {
+			report.Errors = append(report.Errors, structsUFUT.ImportRowErrorRSC{Row: rows[i], SKU: item.SKU, Error: problem})
+			continue
+		}
+		skuRows[item.SKU] = rows[i]
+		valid = append(valid, *item)
+	}
+	slices.SortFunc(report.Errors, func(a, b structsUFUT.ImportRowErrorRSC) int {
+		return a.Row - b.Row
+	})
+	skus := make([]string, 0, len(valid))
+	for _, item := range valid {
+		skus = append(skus, item.SKU)
+	}
+	existing, err := s.repo.ItemIDsBySKUs(ctx, sellerID, skus)
+	if err != nil {
+		return nil, err
+	}
+	for i := range valid {
+		if id, ok := existing[valid[i].SKU]; ok {
+			valid[i].ItemID = id
+			report.Updated++
+			continue
+		}
+		uid, err := uuid.NewV7()
+		if err != nil {
+			return nil, err
+		}
+		valid[i].ItemID = uid.String()
+		report.Created++
+	}
+	if dryRun || len(report.Errors) > 0 {
+		return report, nil
+	}
+	if err := s.repo.UpsertItemsBySKU(ctx, valid); err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(valid))
+	for _, item := range valid {
+		ids = append(ids, item.ItemID)
+	}
+	// events carry stored items with the status they ended up in
+	stored, err := s.repo.ItemsByItemIDs(ctx, ids)
+	if err != nil {
+		log.Printf("failed load imported items for events: %v\n", err)
+		return report, nil
+	}
+	var created, updated []structsUFUT.ItemDataRSC
+	for _, item := range stored {
+		if _, ok := existing[item.SKU]; ok {
+			updated = append(updated, item)
+		} else {
+			created = append(created, item)
+		}
+	}
+	s.publishItemEvents(ctx, eventsUFUT.ItemCreated, created...)
+	s.publishItemEvents(ctx, eventsUFUT.ItemUpdated, updated...)
+	return report, nil
+}
+
+/*
+Writes items of the seller (whole catalog if sellerID is empty) to w in the given format
+*/
+func (s *Service) ExportItems(ctx context.Context, sellerID, format string, w io.Writer) error {
+	enc, err := newItemsEncoder(format, w)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.ExportItems(ctx, sellerID, enc.Encode); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+/*
+Validates the image, stores it with its thumbnails and appends it to the item's images.
+img.ItemID and img.SellerID must be set; ImageID, Position and ContentType are filled
+*/
+func (s *Service) UploadItemImage(ctx context.Context, img *structsUFUT.ItemImageRSC, data []byte) error {
+	contentType, err := sniffImage(data)
+	if err != nil {
+		return err
+	}
+	thumbs, err := makeThumbnails(data)
+	if err != nil {
+		return err
+	}
+	uid, err := uuid.NewV7()
+	if err != nil {
+		return err
+	}
+	img.ImageID = uid.String()
+	img.ContentType = contentType
+	keys := []string{imageBlobKey(img.ImageID, originalImageSize)}
+	if err := s.blobs.Put(ctx, keys[0], data, contentType); err != nil {
+		return err
+	}
+	for size, thumb := range thumbs {
+		key := imageBlobKey(img.ImageID, size)
+		keys = append(keys, key)
+		if err := s.blobs.Put(ctx, key, thumb, "image/jpeg"); err != nil {
+			s.deleteBlobs(ctx, keys)
+			return err
+		}
+	}
+	if err := s.repo.AddItemImage(ctx, img); err != nil {
+		s.deleteBlobs(ctx, keys)
+		return err
+	}
+	return nil
+}
+
+/*
+Returns the image content and its content type.
+size is either "" (original) or one of ThumbnailSizes
+*/
+func (s *Service) ItemImage(ctx context.Context, imageID, size string) (io.ReadCloser, string, error) {
+	img := structsUFUT.ItemImageRSC{ImageID: imageID}
+	if err := s.repo.ItemImage(ctx, &img); err != nil {
+		return nil, "", err
+	}
+	if size == "" || size == originalImageSize {
+		rc, err := s.blobs.Get(ctx, imageBlobKey(imageID, originalImageSize))
+		return rc, img.ContentType, err
+	}
+	if !isThumbnailSize(size) {
+		return nil, "", ErrUnknownImageSize
+	}
+	rc, err := s.blobs.Get(ctx, imageBlobKey(imageID, size))
+	return rc, "image/jpeg", err
 }
 
-func (s *Service) DeleteItem(ctx context.Context, item *structsUFUT.ItemDataRSC) error {
-	return s.repo.DeleteItem(ctx, item)
+func (s *Service) deleteBlobs(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		s.blobs.Delete(ctx, key)
+	}
 }
 
 // func (s *Service) ReserveItem(ctx context.Context, itemID []string) []bool {
@@ -0,0 +1,138 @@
+package catalog_service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	eventsUFUT "ufut/lib/events"
+	structsUFUT "ufut/lib/structs"
+)
+
+var (
+	ErrUnknownStatus     = errors.New("unknown item status")
+	ErrInvalidTransition = errors.New("item status transition not allowed")
+	ErrNotItemOwner      = errors.New("item belongs to another seller")
+)
+
+/*
+Statuses an item may be moved to from each status by staff.
+pending_review -> available and the rejection back to draft are made by ModerateItem only,
+deleted items are restored to draft and go through review again
+*/
+var itemStatusTransitions = map[string][]string{
+	structsUFUT.ItemStatusDraft: {
+		structsUFUT.ItemStatusPendingReview,
+		structsUFUT.ItemStatusArchived,
+		structsUFUT.ItemStatusDeleted,
+	},
+	structsUFUT.ItemStatusPendingReview: {
+		structsUFUT.ItemStatusDraft,
+		structsUFUT.ItemStatusDeleted,
+	},
+	structsUFUT.ItemStatusAvailable: {
+		structsUFUT.ItemStatusOutOfStock,
+		structsUFUT.ItemStatusArchived,
+		structsUFUT.ItemStatusDeleted,
+	},
+	structsUFUT.ItemStatusOutOfStock: {
+		structsUFUT.ItemStatusAvailable,
+		structsUFUT.ItemStatusArchived,
+		structsUFUT.ItemStatusDeleted,
+	},
+	structsUFUT.ItemStatusArchived: {
+		structsUFUT.ItemStatusPendingReview,
+		structsUFUT.ItemStatusDeleted,
+	},
+	structsUFUT.ItemStatusDeleted: {
+		structsUFUT.ItemStatusDraft,
+	},
+}
+
+func validateTransition(from, to string) error {
+	if _, ok := itemStatusTransitions[to]; !ok {
+		return ErrUnknownStatus
+	}
+	if !slices.Contains(itemStatusTransitions[from], to) {
+		return ErrInvalidTransition
+	}
+	return nil
+}
+
+// statuses of items approved for sale, items in other statuses are hidden from buyers
+var publicItemStatuses = []string{structsUFUT.ItemStatusAvailable, structsUFUT.ItemStatusOutOfStock}
+
+// canManageItem tells whether the staff member may change the status of the item
+func (s *Service) canManageItem(item *structsUFUT.ItemDataRSC, staffID string) bool {
+	return item.SellerID == staffID || s.isModerator(staffID)
+}
+
+// canViewItem tells whether the user may see the item, its seller and moderators see it in any status
+func (s *Service) canViewItem(item *structsUFUT.ItemDataRSC, getterID string) bool {
+	return slices.Contains(publicItemStatuses, item.Status) || s.canManageItem(item, getterID)
+}
+
+/*
+change.ItemID, ToStatus and ActorID (the item's seller or a moderator) must be set, Reason is optional.
+Moves the item to change.ToStatus if the transition table allows it,
+FromStatus and ChangedAt are filled
+*/
+func (s *Service) ChangeItemStatus(ctx context.Context, change *structsUFUT.ItemStatusChangeRSC) error {
+	item := structsUFUT.ItemDataRSC{ItemID: change.ItemID}
+	if err := s.repo.ItemByItemID(ctx, &item); err != nil {
+		return err
+	}
+	if !s.canManageItem(&item, change.ActorID) {
+		return ErrNotItemOwner
+	}
+	change.FromStatus = item.Status
+	if err := validateTransition(change.FromStatus, change.ToStatus); err != nil {
+		return err
+	}
+	if err := s.repo.ChangeItemStatus(ctx, change); err != nil {
+		return err
+	}
+	eventType := eventsUFUT.ItemUpdated
+	if change.ToStatus == structsUFUT.ItemStatusDeleted {
+		eventType = eventsUFUT.ItemDeleted
+	}
+	if err := s.repo.ItemByItemID(ctx, &item); err == nil {
+		s.publishItemEvents(ctx, eventType, item)
+	}
+	return nil
+}
+
+/*
+Moves a deleted item back to draft
+*/
+func (s *Service) RestoreItem(ctx context.Context, itemID, actorID string) error {
+	item := structsUFUT.ItemDataRSC{ItemID: itemID}
+	if err := s.repo.ItemByItemID(ctx, &item); err != nil {
+		return err
+	}
+	if !s.canManageItem(&item, actorID) {
+		return ErrNotItemOwner
+	}
+	if item.Status != structsUFUT.ItemStatusDeleted {
+		return ErrInvalidTransition
+	}
+	return s.ChangeItemStatus(ctx, &structsUFUT.ItemStatusChangeRSC{
+		ItemID:   itemID,
+		ToStatus: structsUFUT.ItemStatusDraft,
+		ActorID:  actorID,
+	})
+}
+
+/*
+Returns the status changes of the item oldest first, moderation notes included;
+only the item's seller and moderators may read them
+*/
+func (s *Service) ItemStatusHistory(ctx context.Context, staffID, itemID string) ([]structsUFUT.ItemStatusChangeRSC, error) {
+	item := structsUFUT.ItemDataRSC{ItemID: itemID}
+	if err := s.repo.ItemByItemID(ctx, &item); err != nil {
+		return nil, err
+	}
+	if !s.canManageItem(&item, staffID) {
+		return nil, ErrNotItemOwner
+	}
+	return s.repo.ItemStatusHistory(ctx, itemID)
+}
@@ -0,0 +1,46 @@
+package catalog_service
+
+import (
+	"context"
+	"errors"
+	"log"
+	structsUFUT "ufut/lib/structs"
+)
+
+var (
+	ErrSuggestDisabled = errors.New("search suggestions are disabled")
+)
+
+/*
+Completes the prefix in the first of locales that is indexed, see LocaleChain
+*/
+func (s *Service) Suggest(prefix string, limit int, locales []string) (structsUFUT.SuggestResponseRSC, error) {
+	if s.suggester == nil {
+		return structsUFUT.SuggestResponseRSC{}, ErrSuggestDisabled
+	}
+	return s.suggester.Suggest(prefix, limit, locales), nil
+}
+
+/*
+Counts the query the user submitted for users of its locale, the first of locales
+*/
+func (s *Service) RecordSearchQuery(query string, locales []string, userID string) error {
+	if s.suggester == nil {
+		return ErrSuggestDisabled
+	}
+	locale := s.catalogLocale()
+	if len(locales) > 0 {
+		locale = locales[0]
+	}
+	s.suggester.RecordQuery(query, locale, userID)
+	return nil
+}
+
+func (s *Service) reloadSuggestCategories(ctx context.Context) {
+	if s.suggester == nil {
+		return
+	}
+	if err := s.suggester.ReloadCategories(ctx); err != nil {
+		log.Printf("reload suggestion categories: %v\n", err)
+	}
+}
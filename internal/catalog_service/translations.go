@@ -0,0 +1,253 @@
+package catalog_service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	funcsUFUT "ufut/lib/funcs"
+	structsUFUT "ufut/lib/structs"
+)
+
+// DefaultLocale is the locale of item and category text unless SetLocale is called
+const DefaultLocale = "en"
+
+var (
+	ErrDefaultLocale    = errors.New("text in the catalog locale is edited on the item itself")
+	ErrMissingName      = errors.New("name is required")
+	ErrNotCategoryAdmin = errors.New("not allowed to edit category names")
+)
+
+/*
+Options of localized and converted item reads
+*/
+type ViewOptions struct {
+	// Currency prices are converted into, prices are kept as stored if empty
+	Currency string
+	// Locales is the lookup order of translations, see LocaleChain; text is kept as stored if empty
+	Locales []string
+}
+
+/*
+Sets the locale item names, descriptions and category names are written in
+*/
+func (s *Service) SetLocale(locale string) error {
+	locale, err := funcsUFUT.NormalizeLocale(locale)
+	if err != nil {
+		return err
+	}
+	s.locale = locale
+	return nil
+}
+
+func (s *Service) catalogLocale() string {
+	if s.locale == "" {
+		return DefaultLocale
+	}
+	return s.locale
+}
+
+/*
+Returns the lookup order of translations for the Accept-Language header, ending with the catalog locale
+*/
+func (s *Service) LocaleChain(acceptLanguage string) []string {
+	return funcsUFUT.LocaleFallbacks(funcsUFUT.ParseAcceptLanguage(acceptLanguage), s.catalogLocale())
+}
+
+/*
+Replaces text of the items with the first translation found along locales
+and sets CategoryName to the category display name found the same way
+*/
+func (s *Service) localizeItems(ctx context.Context, items []structsUFUT.ItemDataRSC, locales []string) error {
+	if len(locales) == 0 || len(items) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ItemID)
+	}
+	translations, err := s.repo.ItemTranslations(ctx, ids)
+	if err != nil {
+		return err
+	}
+	categoryNames, err := s.categoryNames(ctx, locales)
+	if err != nil {
+		return err
+	}
+	for i := range items {
+		item := &items[i]
+		item.Locale = s.catalogLocale()
+		item.CategoryName = item.Category
+		if name, ok := categoryNames[item.Category]; ok {
+			item.CategoryName = name
+		}
+		for _, locale := range locales {
+			if locale == s.catalogLocale() {
+				break
+			}
+			k := slices.IndexFunc(translations[item.ItemID], func(tr structsUFUT.ItemTranslationRSC) bool {
+				return tr.Locale == locale
+			})
+			if k >= 0 {
+				tr := translations[item.ItemID][k]
+				item.Name, item.Description, item.Locale = tr.Name, tr.Description, locale
+				break
+			}
+		}
+	}
+	return nil
+}
+
+/*
+Returns display names of categories found along locales keyed by category,
+categories without a translation are left out
+*/
+func (s *Service) categoryNames(ctx context.Context, locales []string) (map[string]string, error) {
+	translations, err := s.repo.CategoryTranslations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]string{}
+	rank := map[string]int{}
+	for _, tr := range translations {
+		k := slices.Index(locales, tr.Locale)
+		if k < 0 {
+			continue
+		}
+		if r, ok := rank[tr.Category]; !ok || k < r {
+			names[tr.Category], rank[tr.Category] = tr.DisplayName, k
+		}
+	}
+	return names, nil
+}
+
+/*
+Returns categories and their display names along locales, parallel slices
+*/
+func (s *Service) LocalizedCategories(ctx context.Context, locales []string) ([]string, []string, error) {
+	categories, err := s.repo.Categories(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	names, err := s.categoryNames(ctx, locales)
+	if err != nil {
+		return nil, nil, err
+	}
+	displayNames := make([]string, len(categories))
+	for i, category := range categories {
+		displayNames[i] = category
+		if name, ok := names[category]; ok {
+			displayNames[i] = name
+		}
+	}
+	return categories, displayNames, nil
+}
+
+func (s *Service) ItemTranslations(ctx context.Context, itemID string) ([]structsUFUT.ItemTranslationRSC, error) {
+	item := structsUFUT.ItemDataRSC{ItemID: itemID}
+	if err := s.repo.ItemByItemID(ctx, &item); err != nil {
+		return nil, err
+	}
+	translations, err := s.repo.ItemTranslations(ctx, []string{itemID})
+	if err != nil {
+		return nil, err
+	}
+	if translations[itemID] == nil {
+		return []structsUFUT.ItemTranslationRSC{}, nil
+	}
+	return translations[itemID], nil
+}
+
+/*
+tr.ItemID, Locale, Name and UpdatedBy (the item's seller) must be set.
+Translations are checked for banned words like the item itself,
+a changed translation sends an approved item back to review
+*/
+func (s *Service) SetItemTranslation(ctx context.Context, tr *structsUFUT.ItemTranslationRSC) error {
+	locale, err := s.translationLocale(tr.Locale)
+	if err != nil {
+		return err
+	}
+	tr.Locale = locale
+	tr.Name = strings.TrimSpace(tr.Name)
+	if tr.Name == "" {
+		return ErrMissingName
+	}
+	if err := s.checkBannedWords(&structsUFUT.ItemDataRSC{Name: tr.Name, Description: tr.Description}); err != nil {
+		return err
+	}
+	if err := s.repo.UpsertItemTranslation(ctx, tr); err != nil {
+		return err
+	}
+	s.publishItemChange(ctx, tr.ItemID)
+	return nil
+}
+
+func (s *Service) DeleteItemTranslation(ctx context.Context, itemID, locale, sellerID string) error {
+	locale, err := s.translationLocale(locale)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.DeleteItemTranslation(ctx, itemID, locale, sellerID); err != nil {
+		return err
+	}
+	s.publishItemChange(ctx, itemID)
+	return nil
+}
+
+func (s *Service) CategoryTranslations(ctx context.Context) ([]structsUFUT.CategoryTranslationRSC, error) {
+	return s.repo.CategoryTranslations(ctx)
+}
+
+/*
+Category names are shared by all sellers, so only moderators may change them
+*/
+func (s *Service) SetCategoryTranslation(ctx context.Context, tr *structsUFUT.CategoryTranslationRSC, actorID string) error {
+	if !s.isModerator(actorID) {
+		return ErrNotCategoryAdmin
+	}
+	locale, err := s.translationLocale(tr.Locale)
+	if err != nil {
+		return err
+	}
+	tr.Locale = locale
+	tr.DisplayName = strings.TrimSpace(tr.DisplayName)
+	if tr.DisplayName == "" {
+		return ErrMissingName
+	}
+	if err := s.repo.UpsertCategoryTranslation(ctx, tr); err != nil {
+		return err
+	}
+	s.reloadSuggestCategories(ctx)
+	return nil
+}
+
+func (s *Service) DeleteCategoryTranslation(ctx context.Context, category, locale, actorID string) error {
+	if !s.isModerator(actorID) {
+		return ErrNotCategoryAdmin
+	}
+	locale, err := s.translationLocale(locale)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.DeleteCategoryTranslation(ctx, category, locale); err != nil {
+		return err
+	}
+	s.reloadSuggestCategories(ctx)
+	return nil
+}
+
+func (s *Service) translationLocale(locale string) (string, error) {
+	locale, err := funcsUFUT.NormalizeLocale(locale)
+	if err != nil {
+		return "", err
+	}
+	if locale == s.catalogLocale() {
+		return "", ErrDefaultLocale
+	}
+	return locale, nil
+}
+
+func (s *Service) isModerator(staffID string) bool {
+	return slices.Contains(s.moderation.Moderators, staffID)
+}
@@ -1,8 +1,14 @@
 package inventory_service
 
-import "context"
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+)
 
 type Repository interface {
-	ReserveItems(ctx context.Context, itemsIDs []string, quantities []int) ([]bool, error)
-	CancelItemReservation(ctx context.Context, itemsIDs []string, quantities []int) error
+	ReserveItems(ctx context.Context, correlationID string, itemsIDs []string, quantities []int,
+		result func(availability []bool) (kafka.Message, error)) ([]bool, error)
+	CancelItemReservation(ctx context.Context, correlationID string, events ...kafka.Message) error
+	CreateItem(ctx context.Context, itemID string) error
 }
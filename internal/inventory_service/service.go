@@ -2,104 +2,119 @@ package inventory_service
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"log"
-	"strings"
 	"time"
+	eventsUFUT "ufut/lib/events"
 	structsUFUT "ufut/lib/structs"
 
-	"github.com/redis/go-redis/v9"
 	"github.com/segmentio/kafka-go"
 )
 
-func NewRedisClient(ctx context.Context, cfg *structsUFUT.RedisConfig) (*redis.Client, error) {
-	db := redis.NewClient(&redis.Options{
-		Addr:         cfg.Addr,
-		Password:     cfg.Password,
-		DB:           cfg.DB,
-		Username:     cfg.User,
-		MaxRetries:   cfg.MaxRetries,
-		DialTimeout:  cfg.DialTimeout,
-		ReadTimeout:  cfg.Timeout,
-		WriteTimeout: cfg.Timeout,
-	})
-	if err := db.Ping(ctx).Err(); err != nil {
-		return nil, err
-	}
-	return db, nil
-}
+// eventsProducer names the service in the metadata of published events
+const eventsProducer = "inventory_service"
+
+// NotificationsTopic names the outbox relay writer of reservation results
+const NotificationsTopic = "notifications"
 
 type Service struct {
-	Repo                     Repository
-	kafkaOrdersReader        *kafka.Reader
-	kafkaNotificationsWriter *kafka.Writer
-	redisClient              *redis.Client
+	Repo               Repository
+	kafkaOrdersReader  *kafka.Reader
+	kafkaCatalogReader *kafka.Reader
 }
 
+/*
+Creates the service; reservation results are stored in the outbox of repo and published by its relay
+*/
 func NewService(
 	repo Repository,
 	kafkaReader1 *kafka.Reader,
-	kafkaWriter1 *kafka.Writer,
-	redisClient *redis.Client) *Service {
+	kafkaReader2 *kafka.Reader) *Service {
 	return &Service{
-		Repo:                     repo,
-		kafkaOrdersReader:        kafkaReader1,
-		kafkaNotificationsWriter: kafkaWriter1,
-		redisClient:              redisClient,
+		Repo:               repo,
+		kafkaOrdersReader:  kafkaReader1,
+		kafkaCatalogReader: kafkaReader2,
 	}
 }
 
+/*
+Reserves or releases the items of the order. The result is published to notifications
+under the correlation ID of the request, so orders can match it with the placement.
+Reservations are kept per correlation ID, so redelivered and retried requests are handled once
+*/
 func (s *Service) handleOrdersMsg(ctx context.Context, msg kafka.Message) error {
-	var list structsUFUT.ShoppingCartRMP
-	if err := json.Unmarshal(msg.Value, &list); err != nil {
-		return err
+	event, err := eventsUFUT.Decode[structsUFUT.ShoppingCartRMP](msg)
+	if err != nil {
+		log.Printf("skip order event: %v\n", err)
+		return nil
 	}
-	val, err := s.redisClient.Get(ctx, list.UserID).Result()
-	if err != redis.Nil {
+	if event.CorrelationID == "" {
+		log.Printf("skip order event %s without correlation ID\n", event.EventID)
 		return nil
 	}
-	action := strings.Split(val, ".")[1]
-	var itemsAvailability []bool
+	list := event.Payload
+	// the result is stored with the stock change, so it can't be lost once the change is made
+	resultMsg := func(resultType string, availability []bool) (kafka.Message, error) {
+		msg, err := eventsUFUT.NewMessage(resultType, eventsProducer, event.CorrelationID, event.CorrelationID,
+			structsUFUT.InventoryOrderNotification{
+				ItemsAvailability: availability,
+				ItemsIDs:          list.ItemsID,
+			})
+		msg.Topic = NotificationsTopic
+		return msg, err
+	}
 
-	switch action {
-	case "reserve":
-		availability, err := s.Repo.ReserveItems(ctx, list.ItemsID, list.Quantities)
+	switch event.Type {
+	case eventsUFUT.ReservationRequested:
+		_, err := s.Repo.ReserveItems(ctx, event.CorrelationID, list.ItemsID, list.Quantities,
+			func(availability []bool) (kafka.Message, error) {
+				return resultMsg(eventsUFUT.ItemsReserved, availability)
+			})
 		if err != nil {
 			return err
 		}
-		itemsAvailability = availability
-	case "cancelReservation":
-		err := s.Repo.CancelItemReservation(ctx, list.ItemsID, list.Quantities)
+	case eventsUFUT.ReleaseRequested:
+		msg, err := resultMsg(eventsUFUT.ItemsReleased, nil)
 		if err != nil {
 			return err
 		}
+		if err := s.Repo.CancelItemReservation(ctx, event.CorrelationID, msg); err != nil {
+			return err
+		}
 	}
-	notificationMsg := structsUFUT.InventoryOrderNotification{
-		Action:            action,
-		ItemsAvailability: itemsAvailability,
-		ItemsIDs:          list.ItemsID,
-	}
-	jsonData, err := json.Marshal(notificationMsg)
+	return nil
+}
+
+/*
+Creates stock rows for items announced by catalog_service.
+Events of unknown schema versions are skipped
+*/
+func (s *Service) handleCatalogMsg(ctx context.Context, msg kafka.Message) error {
+	event, err := eventsUFUT.Decode[structsUFUT.ItemDataRSC](msg)
 	if err != nil {
-		log.Printf("%v%v\n", "failed marshal notification: ", err)
-	} else {
-		err = s.kafkaNotificationsWriter.WriteMessages(ctx, kafka.Message{
-			Value: jsonData,
-		})
-		if err != nil {
-			log.Println("failed send msg to kafka notification topic")
-		}
+		log.Printf("skip catalog event: %v\n", err)
+		return nil
 	}
-	if err := s.redisClient.Set(ctx, list.UserID, "", 10*time.Second); err != nil {
-		log.Println("failed set trx: " + list.UserID)
+	switch event.Type {
+	case eventsUFUT.ItemCreated, eventsUFUT.ItemUpdated:
+		return s.Repo.CreateItem(ctx, event.Payload.ItemID)
+	case eventsUFUT.ItemDeleted:
+		// stock row is kept, so reservations of placed orders can still be cancelled
 	}
 	return nil
 }
 
 func (s *Service) ServeKafka(ctx context.Context) error {
+	return serveReader(ctx, s.kafkaOrdersReader, s.handleOrdersMsg)
+}
+
+func (s *Service) ServeCatalogKafka(ctx context.Context) error {
+	return serveReader(ctx, s.kafkaCatalogReader, s.handleCatalogMsg)
+}
+
+func serveReader(ctx context.Context, reader *kafka.Reader, handle func(context.Context, kafka.Message) error) error {
 	for {
-		msg, err := s.kafkaOrdersReader.FetchMessage(ctx)
+		msg, err := reader.FetchMessage(ctx)
 		if err != nil {
 			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
 				return err
@@ -109,12 +124,12 @@ func (s *Service) ServeKafka(ctx context.Context) error {
 			continue
 		}
 
-		if err := s.handleOrdersMsg(ctx, msg); err != nil {
+		if err := handle(ctx, msg); err != nil {
 			log.Printf("handle error: %v\n", err)
 			continue
 		}
 
-		if err := s.kafkaOrdersReader.CommitMessages(ctx, msg); err != nil {
+		if err := reader.CommitMessages(ctx, msg); err != nil {
 			log.Printf("commit error: %v\n", err)
 		}
 	}
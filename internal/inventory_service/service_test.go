@@ -0,0 +1,84 @@
+package inventory_service
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	sqliteRepoInventory "ufut/internal/sqlite/inventory_service"
+	eventsUFUT "ufut/lib/events"
+	structsUFUT "ufut/lib/structs"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func CreateInventoryService(t *testing.T) (*Service, *sqliteRepoInventory.SQLiteRepo) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "inventory_test.db"))
+	if err != nil {
+		t.Fatalf("%v", err.Error())
+	}
+	t.Cleanup(func() { db.Close() })
+	repo := sqliteRepoInventory.NewSQLiteRepo(db)
+	if err := repo.CreateTables(t.Context()); err != nil {
+		t.Fatalf("%v", err.Error())
+	}
+	return NewService(repo, nil, nil), repo
+}
+
+func catalogMsg(t *testing.T, eventType string, item structsUFUT.ItemDataRSC) kafka.Message {
+	msg, err := eventsUFUT.NewMessage(eventType, "catalog_service", "", item.ItemID, item)
+	assert.NoError(t, err)
+	return msg
+}
+
+func TestService_HandleCatalogMsg(t *testing.T) {
+	srvc, repo := CreateInventoryService(t)
+	stock := func(itemID string) (int, bool) {
+		var q int
+		err := repo.DB.QueryRowContext(t.Context(), `SELECT quantity FROM itemsQuantities WHERE itemID = ?`, itemID).Scan(&q)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, false
+		}
+		assert.NoError(t, err)
+		return q, true
+	}
+
+	// new items get an empty stock row, created or updated alike
+	assert.NoError(t, srvc.handleCatalogMsg(t.Context(), catalogMsg(t, eventsUFUT.ItemCreated,
+		structsUFUT.ItemDataRSC{ItemID: "book", SellerID: "s1", Status: structsUFUT.ItemStatusPendingReview})))
+	assert.NoError(t, srvc.handleCatalogMsg(t.Context(), catalogMsg(t, eventsUFUT.ItemUpdated,
+		structsUFUT.ItemDataRSC{ItemID: "lamp", SellerID: "s1", Status: structsUFUT.ItemStatusAvailable})))
+	q, ok := stock("book")
+	assert.True(t, ok)
+	assert.Equal(t, 0, q)
+	_, ok = stock("lamp")
+	assert.True(t, ok)
+
+	// later events keep the stock, deleted items keep their row for placed orders
+	_, err := repo.IncreaseItemQuantity(t.Context(), "book", 3)
+	assert.NoError(t, err)
+	assert.NoError(t, srvc.handleCatalogMsg(t.Context(), catalogMsg(t, eventsUFUT.ItemUpdated,
+		structsUFUT.ItemDataRSC{ItemID: "book", SellerID: "s1", Status: structsUFUT.ItemStatusAvailable})))
+	assert.NoError(t, srvc.handleCatalogMsg(t.Context(), catalogMsg(t, eventsUFUT.ItemDeleted,
+		structsUFUT.ItemDataRSC{ItemID: "book", SellerID: "s1", Status: structsUFUT.ItemStatusDeleted})))
+	q, _ = stock("book")
+	assert.Equal(t, 3, q)
+
+	// deleted items never seen before and events of other schema versions create nothing
+	assert.NoError(t, srvc.handleCatalogMsg(t.Context(), catalogMsg(t, eventsUFUT.ItemDeleted,
+		structsUFUT.ItemDataRSC{ItemID: "pen", Status: structsUFUT.ItemStatusDeleted})))
+	old := catalogMsg(t, eventsUFUT.ItemCreated, structsUFUT.ItemDataRSC{ItemID: "mug"})
+	for i, h := range old.Headers {
+		if h.Key == eventsUFUT.HeaderSchemaVersion {
+			old.Headers[i].Value = []byte("1")
+		}
+	}
+	assert.NoError(t, srvc.handleCatalogMsg(t.Context(), old))
+	_, ok = stock("pen")
+	assert.False(t, ok)
+	_, ok = stock("mug")
+	assert.False(t, ok)
+}
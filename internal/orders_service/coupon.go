@@ -0,0 +1,163 @@
+package orders_service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	structsUFUT "ufut/lib/structs"
+)
+
+// MaxCouponCodeLength limits codes of coupons created by staff
+const MaxCouponCodeLength = 64
+
+var (
+	ErrCouponNotFound      = errors.New("coupon not found")
+	ErrCouponExists        = errors.New("coupon code is taken")
+	ErrInvalidCoupon       = errors.New("invalid coupon")
+	ErrCouponNotActive     = errors.New("coupon is not valid at this time")
+	ErrCouponExhausted     = errors.New("coupon usage limit reached")
+	ErrCouponMinSubtotal   = errors.New("basket is below the coupon minimum")
+	ErrCouponNotApplicable = errors.New("coupon doesn't apply to items of the cart")
+)
+
+// reasons a coupon can't be used, quotes report them instead of failing
+var couponRejections = []error{ErrCouponNotFound, ErrCouponNotActive, ErrCouponExhausted}
+
+// normalizeCouponCode makes codes case insensitive
+func normalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func validateCoupon(c *structsUFUT.CouponRMP) error {
+	c.Code = normalizeCouponCode(c.Code)
+	if c.Code == "" || len(c.Code) > MaxCouponCodeLength || strings.ContainsAny(c.Code, " \t\r\n") {
+		return ErrInvalidCoupon
+	}
+	if c.PercentBps < 0 || c.PercentBps > maxBps || c.Amount < 0 || (c.PercentBps == 0 && c.Amount == 0) {
+		return ErrInvalidCoupon
+	}
+	if c.MinSubtotal < 0 || c.PerUserLimit < 0 || c.GlobalLimit < 0 || c.StartsAt < 0 || c.EndsAt < 0 {
+		return ErrInvalidCoupon
+	}
+	if c.EndsAt != 0 && c.EndsAt <= c.StartsAt {
+		return ErrInvalidCoupon
+	}
+	return nil
+}
+
+/*
+Creates the coupon on behalf of the staff member, the code is stored in upper case
+*/
+func (s *Service) CreateCoupon(ctx context.Context, staffID string, c *structsUFUT.CouponRMP) (*structsUFUT.CouponRMP, error) {
+	if !s.isOperator(staffID) {
+		return nil, ErrNotOperator
+	}
+	if err := validateCoupon(c); err != nil {
+		return nil, err
+	}
+	created, err := s.repo.CreateCoupon(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return nil, ErrCouponExists
+	}
+	return c, nil
+}
+
+/*
+Replaces the terms of the coupon of c.Code; orders placed with it keep the discount they were placed with
+*/
+func (s *Service) UpdateCoupon(ctx context.Context, staffID string, c *structsUFUT.CouponRMP) (*structsUFUT.CouponRMP, error) {
+	if !s.isOperator(staffID) {
+		return nil, ErrNotOperator
+	}
+	if err := validateCoupon(c); err != nil {
+		return nil, err
+	}
+	updated, err := s.repo.UpdateCoupon(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return nil, ErrCouponNotFound
+	}
+	return c, nil
+}
+
+/*
+Deletes the coupon and takes it off the carts it is applied to
+*/
+func (s *Service) DeleteCoupon(ctx context.Context, staffID, code string) error {
+	if !s.isOperator(staffID) {
+		return ErrNotOperator
+	}
+	deleted, err := s.repo.DeleteCoupon(ctx, normalizeCouponCode(code))
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrCouponNotFound
+	}
+	return nil
+}
+
+func (s *Service) Coupons(ctx context.Context, staffID string) (*structsUFUT.CouponsRMP, error) {
+	if !s.isOperator(staffID) {
+		return nil, ErrNotOperator
+	}
+	coupons, err := s.repo.Coupons(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &structsUFUT.CouponsRMP{Coupons: coupons}, nil
+}
+
+/*
+Returns the coupon if the user can redeem it now, the redemption of exceptCorrelationID isn't counted.
+Limits are checked again when the order is placed, concurrent checkouts may use up the coupon meanwhile
+*/
+func (s *Service) usableCoupon(ctx context.Context, code, userID, exceptCorrelationID string) (*structsUFUT.CouponRMP, error) {
+	c, err := s.repo.Coupon(ctx, code)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCouponNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	if (c.StartsAt != 0 && now < c.StartsAt) || (c.EndsAt != 0 && now >= c.EndsAt) {
+		return nil, ErrCouponNotActive
+	}
+	if c.GlobalLimit > 0 || c.PerUserLimit > 0 {
+		total, byUser, err := s.repo.CouponUsage(ctx, code, userID, exceptCorrelationID)
+		if err != nil {
+			return nil, err
+		}
+		if (c.GlobalLimit > 0 && total >= c.GlobalLimit) || (c.PerUserLimit > 0 && byUser >= c.PerUserLimit) {
+			return nil, ErrCouponExhausted
+		}
+	}
+	return c, nil
+}
+
+/*
+Applies the coupon to the user's cart in place of the one applied before.
+Whether the cart reaches the minimum of the coupon is up to the quote, the cart may still change
+*/
+func (s *Service) ApplyCoupon(ctx context.Context, userID, code string) error {
+	code = normalizeCouponCode(code)
+	if code == "" {
+		return ErrCouponNotFound
+	}
+	if _, err := s.usableCoupon(ctx, code, userID, ""); err != nil {
+		return err
+	}
+	return s.repo.SetCartCoupon(ctx, userID, code)
+}
+
+func (s *Service) RemoveCoupon(ctx context.Context, userID string) error {
+	return s.repo.RemoveCartCoupon(ctx, userID)
+}
@@ -0,0 +1,154 @@
+package orders_service
+
+import (
+	"strings"
+	"testing"
+	"time"
+	structsUFUT "ufut/lib/structs"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestService_Coupons(t *testing.T) {
+	srvc, repo := CreateOrdersService(t)
+	for _, item := range []structsUFUT.ItemDataRSC{
+		{ItemID: "book", SellerID: "s1", Status: structsUFUT.ItemStatusAvailable, Version: 1, Price: 1000, Currency: "USD", Category: "books"},
+		{ItemID: "lamp", SellerID: "s2", Status: structsUFUT.ItemStatusAvailable, Version: 1, Price: 2500, Currency: "USD", Category: "home"},
+	} {
+		assert.NoError(t, repo.SetCatalogItem(t.Context(), &item))
+	}
+	fill := func(userID string, quantities map[string]int) {
+		for itemID, quantity := range quantities {
+			err := repo.AddToCart(t.Context(), &structsUFUT.ItemRequestRMP{UserID: userID, ItemID: itemID, Quantity: quantity})
+			assert.NoError(t, err)
+		}
+	}
+	place := func(userID string) string {
+		correlationID, err := srvc.PlaceOrder(t.Context(), userID, "")
+		assert.NoError(t, err)
+		return correlationID
+	}
+	reserve := func(userID, correlationID string) *structsUFUT.PlacementRMP {
+		p, err := srvc.PlacementStatus(t.Context(), correlationID, userID)
+		assert.NoError(t, err)
+		availability := make([]bool, len(p.ItemsID))
+		for i := range availability {
+			availability[i] = true
+		}
+		assert.NoError(t, srvc.handleInventoryMsg(t.Context(), inventoryMsg(t, correlationID, structsUFUT.InventoryOrderNotification{
+			ItemsAvailability: availability, ItemsIDs: p.ItemsID})))
+		p, err = srvc.PlacementStatus(t.Context(), correlationID, userID)
+		assert.NoError(t, err)
+		return p
+	}
+	redemptions := func() int {
+		coupons, err := srvc.Coupons(t.Context(), "staff")
+		assert.NoError(t, err)
+		assert.Len(t, coupons.Coupons, 1)
+		return coupons.Coupons[0].Redemptions
+	}
+
+	srvc.SetOperators([]string{"staff"})
+	_, err := srvc.CreateCoupon(t.Context(), "u1", &structsUFUT.CouponRMP{Code: "x", Amount: 100})
+	assert.ErrorIs(t, err, ErrNotOperator)
+	_, err = srvc.CreateCoupon(t.Context(), "staff", &structsUFUT.CouponRMP{Code: "nothing off"})
+	assert.ErrorIs(t, err, ErrInvalidCoupon)
+	coupon := &structsUFUT.CouponRMP{
+		Code: " spring10 ", PercentBps: 1000, MinSubtotal: 2000, PerUserLimit: 1, GlobalLimit: 2,
+		Categories: []string{"books"},
+	}
+	created, err := srvc.CreateCoupon(t.Context(), "staff", coupon)
+	assert.NoError(t, err)
+	assert.Equal(t, "SPRING10", created.Code)
+	_, err = srvc.CreateCoupon(t.Context(), "staff", &structsUFUT.CouponRMP{Code: "Spring10", Amount: 100})
+	assert.ErrorIs(t, err, ErrCouponExists)
+
+	fill("u1", map[string]int{"book": 3, "lamp": 1})
+	assert.ErrorIs(t, srvc.ApplyCoupon(t.Context(), "u1", "winter"), ErrCouponNotFound)
+	assert.NoError(t, srvc.ApplyCoupon(t.Context(), "u1", "spring10"))
+	// only the books are eligible
+	quote, err := srvc.Quote(t.Context(), "u1", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "SPRING10", quote.CouponCode)
+	assert.Empty(t, quote.CouponError)
+	assert.Equal(t, int64(300), quote.Coupon)
+	assert.Equal(t, []int64{300, 0}, []int64{quote.Lines[0].Coupon, quote.Lines[1].Coupon})
+	assert.Equal(t, int64(5200), quote.Total)
+
+	// the coupon is redeemed with the order and taken off the cart
+	p := reserve("u1", place("u1"))
+	assert.Equal(t, structsUFUT.PlacementPlaced, p.Status)
+	assert.Equal(t, "SPRING10", p.CouponCode)
+	assert.Equal(t, quote, p.Quote)
+	assert.Equal(t, 1, redemptions())
+	code, err := repo.CartCoupon(t.Context(), "u1")
+	assert.NoError(t, err)
+	assert.Empty(t, code)
+	assert.ErrorIs(t, srvc.ApplyCoupon(t.Context(), "u1", "SPRING10"), ErrCouponExhausted)
+
+	// cancelling the order gives the redemption back
+	assert.NoError(t, srvc.RemoveOrder(t.Context(), &structsUFUT.OrderRequestRMP{UserID: "u1", OrderID: p.OrderID}))
+	assert.Zero(t, redemptions())
+	assert.NoError(t, srvc.ApplyCoupon(t.Context(), "u1", "SPRING10"))
+
+	// three checkouts were quoted with the coupon, the global limit lets two of them redeem it
+	fill("u1", map[string]int{"book": 2})
+	correlationIDs := map[string]string{}
+	for _, userID := range []string{"u2", "u3"} {
+		fill(userID, map[string]int{"book": 2})
+		assert.NoError(t, srvc.ApplyCoupon(t.Context(), userID, "SPRING10"))
+	}
+	for _, userID := range []string{"u1", "u2", "u3"} {
+		correlationIDs[userID] = place(userID)
+	}
+	assert.Equal(t, structsUFUT.PlacementPlaced, reserve("u2", correlationIDs["u2"]).Status)
+	assert.Equal(t, structsUFUT.PlacementPlaced, reserve("u1", correlationIDs["u1"]).Status)
+	p = reserve("u3", correlationIDs["u3"])
+	assert.Equal(t, structsUFUT.PlacementFailed, p.Status)
+	assert.True(t, strings.HasSuffix(p.LastError, ErrCouponExhausted.Error()))
+	assert.Equal(t, 2, redemptions())
+	// the coupon stays applied, the quote tells why it gives nothing
+	quote, err = srvc.Quote(t.Context(), "u3", "", "")
+	assert.NoError(t, err)
+	assert.Zero(t, quote.Coupon)
+	assert.Equal(t, ErrCouponExhausted.Error(), quote.CouponError)
+
+	// restrictions, minimum and validity window
+	coupon.GlobalLimit = 0
+	updated, err := srvc.UpdateCoupon(t.Context(), "staff", coupon)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, updated.Redemptions)
+	fill("u4", map[string]int{"lamp": 1, "book": 1})
+	assert.NoError(t, srvc.ApplyCoupon(t.Context(), "u4", "SPRING10"))
+	quote, err = srvc.Quote(t.Context(), "u4", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, ErrCouponMinSubtotal.Error(), quote.CouponError)
+	// a coupon that gives nothing isn't kept for the order
+	p = reserve("u4", place("u4"))
+	assert.Equal(t, structsUFUT.PlacementPlaced, p.Status)
+	assert.Empty(t, p.CouponCode)
+	assert.Equal(t, 2, redemptions())
+	coupon.SellerIDs, coupon.Categories, coupon.MinSubtotal = []string{"s2"}, nil, 0
+	coupon.EndsAt = time.Now().Unix() - 1
+	_, err = srvc.UpdateCoupon(t.Context(), "staff", coupon)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, srvc.ApplyCoupon(t.Context(), "u5", "SPRING10"), ErrCouponNotActive)
+	coupon.EndsAt = 0
+	_, err = srvc.UpdateCoupon(t.Context(), "staff", coupon)
+	assert.NoError(t, err)
+	fill("u5", map[string]int{"lamp": 1, "book": 1})
+	assert.NoError(t, srvc.ApplyCoupon(t.Context(), "u5", "SPRING10"))
+	quote, err = srvc.Quote(t.Context(), "u5", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{0, 250}, []int64{quote.Lines[0].Coupon, quote.Lines[1].Coupon})
+
+	assert.NoError(t, srvc.RemoveCoupon(t.Context(), "u5"))
+	quote, err = srvc.Quote(t.Context(), "u5", "", "")
+	assert.NoError(t, err)
+	assert.Empty(t, quote.CouponCode)
+	assert.NoError(t, srvc.DeleteCoupon(t.Context(), "staff", "spring10"))
+	assert.ErrorIs(t, srvc.DeleteCoupon(t.Context(), "staff", "spring10"), ErrCouponNotFound)
+	quote, err = srvc.Quote(t.Context(), "u3", "", "")
+	assert.NoError(t, err)
+	assert.Empty(t, quote.CouponCode)
+}
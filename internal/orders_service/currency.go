@@ -0,0 +1,217 @@
+package orders_service
+
+import (
+	"context"
+	"log"
+	eventsUFUT "ufut/lib/events"
+	funcsUFUT "ufut/lib/funcs"
+	structsUFUT "ufut/lib/structs"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// DefaultCurrency is the currency carts are quoted in unless SetCurrency is called
+const DefaultCurrency = "USD"
+
+/*
+Sets the currency carts are quoted in when the request doesn't specify one
+*/
+func (s *Service) SetCurrency(code string) error {
+	code, err := funcsUFUT.NormalizeCurrency(code)
+	if err != nil {
+		return err
+	}
+	s.currency = code
+	return nil
+}
+
+func (s *Service) defaultCurrency() string {
+	if s.currency == "" {
+		return DefaultCurrency
+	}
+	return s.currency
+}
+
+/*
+Loads exchange rates received earlier, an empty table leaves conversions disabled
+*/
+func (s *Service) LoadExchangeRates(ctx context.Context) error {
+	table, err := s.repo.ExchangeRates(ctx)
+	if err != nil {
+		return err
+	}
+	if table.Reference == "" {
+		return nil
+	}
+	rates, err := funcsUFUT.NewExchangeRates(table)
+	if err != nil {
+		return err
+	}
+	s.rates.Store(rates)
+	return nil
+}
+
+/*
+Stores exchange rate snapshots published by the catalog
+*/
+func (s *Service) handleRatesMsg(ctx context.Context, msg kafka.Message) error {
+	event, err := eventsUFUT.Decode[structsUFUT.ExchangeRatesRSC](msg)
+	if err != nil {
+		log.Printf("skip exchange rates: %v\n", err)
+		return nil
+	}
+	table := event.Payload
+	if _, err := funcsUFUT.NewExchangeRates(&table); err != nil {
+		log.Printf("skip invalid exchange rates: %v\n", err)
+		return nil
+	}
+	if err := s.repo.SetExchangeRates(ctx, &table); err != nil {
+		return err
+	}
+	// the stored table may be newer than the snapshot
+	return s.LoadExchangeRates(ctx)
+}
+
+/*
+Consumes exchange rate snapshots until ctx is cancelled
+*/
+func (s *Service) ServeRatesKafka(ctx context.Context, reader *kafka.Reader) error {
+	return serveReader(ctx, reader, s.handleRatesMsg)
+}
+
+/*
+Returns the user's cart priced in currency (default currency if empty).
+Each unit price is converted and rounded first, then multiplied by the quantity,
+so line totals and the total always add up to the unit prices shown
+*/
+func (s *Service) PricedCart(ctx context.Context, userID, currency string) (*structsUFUT.PricedCartRMP, error) {
+	if currency == "" {
+		currency = s.defaultCurrency()
+	}
+	currency, err := funcsUFUT.NormalizeCurrency(currency)
+	if err != nil {
+		return nil, err
+	}
+	cart, err := s.repo.ListCart(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.priceCart(ctx, cart, currency)
+}
+
+/*
+Prices the cart in currency, which must be normalized
+*/
+func (s *Service) priceCart(ctx context.Context, cart *structsUFUT.ShoppingCartRMP, currency string) (*structsUFUT.PricedCartRMP, error) {
+	prices, err := s.repo.CatalogPrices(ctx, cart.ItemsID)
+	if err != nil {
+		return nil, err
+	}
+	return s.priceLines(cart, prices, currency), nil
+}
+
+func (s *Service) priceLines(cart *structsUFUT.ShoppingCartRMP, prices map[string]structsUFUT.CatalogPriceRMP, currency string) *structsUFUT.PricedCartRMP {
+	resp := &structsUFUT.PricedCartRMP{
+		ItemsID:    cart.ItemsID,
+		Quantities: cart.Quantities,
+		Currency:   currency,
+		UnitPrices: make([]*int64, len(cart.ItemsID)),
+		LineTotals: make([]*int64, len(cart.ItemsID)),
+	}
+	rates := s.rates.Load()
+	for i, itemID := range cart.ItemsID {
+		price, ok := prices[itemID]
+		if !ok {
+			continue
+		}
+		unit := price.Price
+		if price.Currency != currency {
+			if rates == nil {
+				continue
+			}
+			var err error
+			if unit, err = rates.Convert(price.Price, price.Currency, currency); err != nil {
+				continue
+			}
+		}
+		line := unit * int64(cart.Quantities[i])
+		resp.UnitPrices[i], resp.LineTotals[i] = &unit, &line
+		resp.Total += line
+	}
+	return resp
+}
+
+/*
+Returns a copy of the quote with amounts shown in currency, which must be normalized.
+Unit prices and the amounts of each line are converted one by one and the sums are taken again,
+so the converted quote adds up like the original; orders are still charged in the quoted currency
+*/
+func (s *Service) convertQuote(q *structsUFUT.QuoteRMP, currency string) (*structsUFUT.QuoteRMP, error) {
+	if q.Currency == currency {
+		return q, nil
+	}
+	rates := s.rates.Load()
+	if rates == nil {
+		return nil, funcsUFUT.ErrNoExchangeRate
+	}
+	if _, err := rates.Convert(0, q.Currency, currency); err != nil {
+		return nil, err
+	}
+	convert := func(amount int64) int64 {
+		converted, _ := rates.Convert(amount, q.Currency, currency)
+		return converted
+	}
+	res := *q
+	res.Currency = currency
+	res.Lines = make([]structsUFUT.QuoteLineRMP, len(q.Lines))
+	res.Subtotal, res.LineDiscounts, res.Promotion, res.Coupon, res.Tax = 0, 0, 0, 0, 0
+	for i, line := range q.Lines {
+		line.UnitPrice = convert(line.UnitPrice)
+		line.Subtotal = line.UnitPrice * int64(line.Quantity)
+		line.Discount, line.Promotion, line.Coupon = convert(line.Discount), convert(line.Promotion), convert(line.Coupon)
+		line.Tax = convert(line.Tax)
+		line.Total = line.Subtotal - line.Discount - line.Promotion - line.Coupon + line.Tax
+		res.Lines[i] = line
+		res.Subtotal += line.Subtotal
+		res.LineDiscounts += line.Discount
+		res.Promotion += line.Promotion
+		res.Coupon += line.Coupon
+		res.Tax += line.Tax
+	}
+	res.Shipping, res.ShippingTax = convert(q.Shipping), convert(q.ShippingTax)
+	res.Total = res.Subtotal - res.LineDiscounts - res.Promotion - res.Coupon + res.Shipping + res.ShippingTax + res.Tax
+	return &res, nil
+}
+
+/*
+Shows the priced lines of the order in currency, which must be normalized; Totals are replaced by the single
+total in currency. The order keeps the amounts it was placed with, the conversion uses the current rates
+*/
+func (s *Service) convertOrderLines(order *structsUFUT.OrderDetailRMP, currency string) error {
+	rates := s.rates.Load()
+	var total int64
+	for i := range order.Lines {
+		line := &order.Lines[i]
+		if line.UnitPrice == nil {
+			continue
+		}
+		unit := *line.UnitPrice
+		if line.Currency != currency {
+			if rates == nil {
+				return funcsUFUT.ErrNoExchangeRate
+			}
+			var err error
+			if unit, err = rates.Convert(unit, line.Currency, currency); err != nil {
+				return err
+			}
+			// converted like the lines of convertQuote, so both add up the same
+			line.Discount, _ = rates.Convert(line.Discount, line.Currency, currency)
+			line.Tax, _ = rates.Convert(line.Tax, line.Currency, currency)
+		}
+		lineTotal := unit*int64(line.Quantity) - line.Discount + line.Tax
+		line.UnitPrice, line.LineTotal, line.Currency = &unit, &lineTotal, currency
+		total += lineTotal
+	}
+	order.Totals = []structsUFUT.OrderTotalRMP{{Currency: currency, Amount: total}}
+	return nil
+}
@@ -0,0 +1,141 @@
+package orders_service
+
+import (
+	"testing"
+	"time"
+	eventsUFUT "ufut/lib/events"
+	funcsUFUT "ufut/lib/funcs"
+	structsUFUT "ufut/lib/structs"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestService_PricedCart(t *testing.T) {
+	srvc, repo := CreateOrdersService(t)
+	for _, item := range []structsUFUT.ItemDataRSC{
+		{ItemID: "book", Status: structsUFUT.ItemStatusAvailable, Version: 1, Price: 1000, Currency: "USD"},
+		{ItemID: "livre", Status: structsUFUT.ItemStatusAvailable, Version: 1, Price: 333, Currency: "EUR"},
+	} {
+		assert.NoError(t, repo.SetCatalogItem(t.Context(), &item))
+	}
+	for itemID, quantity := range map[string]int{"book": 1, "livre": 3, "unknown": 1} {
+		err := repo.AddToCart(t.Context(), &structsUFUT.ItemRequestRMP{UserID: "u1", ItemID: itemID, Quantity: quantity})
+		assert.NoError(t, err)
+	}
+	lines := func(cart *structsUFUT.PricedCartRMP) map[string][2]int64 {
+		res := map[string][2]int64{}
+		for i, itemID := range cart.ItemsID {
+			if cart.UnitPrices[i] != nil {
+				res[itemID] = [2]int64{*cart.UnitPrices[i], *cart.LineTotals[i]}
+			}
+		}
+		return res
+	}
+
+	// without rates only items in the requested currency are priced
+	cart, err := srvc.PricedCart(t.Context(), "u1", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "USD", cart.Currency)
+	assert.Equal(t, map[string][2]int64{"book": {1000, 1000}}, lines(cart))
+	assert.Equal(t, int64(1000), cart.Total)
+
+	msg, err := eventsUFUT.NewMessage(eventsUFUT.ExchangeRatesUpdated, "catalog_service", "", "USD", structsUFUT.ExchangeRatesRSC{
+		Reference: "USD",
+		Rates: []structsUFUT.ExchangeRateRSC{
+			{Currency: "USD", Rate: "1"}, {Currency: "EUR", Rate: "0.9"}, {Currency: "JPY", Rate: "150"},
+		},
+		UpdatedAt: time.Now(),
+	})
+	assert.NoError(t, err)
+	// snapshots without envelope metadata are skipped
+	assert.NoError(t, srvc.handleRatesMsg(t.Context(), kafka.Message{Value: msg.Value}))
+	cart, err = srvc.PricedCart(t.Context(), "u1", "usd")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1000), cart.Total)
+	assert.NoError(t, srvc.handleRatesMsg(t.Context(), msg))
+
+	// 3.33 EUR / 0.9 = 3.70 USD per unit, the line is 3 rounded units
+	cart, err = srvc.PricedCart(t.Context(), "u1", "usd")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][2]int64{"book": {1000, 1000}, "livre": {370, 1110}}, lines(cart))
+	assert.Equal(t, int64(2110), cart.Total)
+
+	cart, err = srvc.PricedCart(t.Context(), "u1", "JPY")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][2]int64{"book": {1500, 1500}, "livre": {555, 1665}}, lines(cart))
+
+	_, err = srvc.PricedCart(t.Context(), "u1", "XXX")
+	assert.Error(t, err)
+}
+
+func TestService_ConvertedQuoteAndOrder(t *testing.T) {
+	srvc, repo := CreateOrdersService(t)
+	assert.NoError(t, srvc.SetPricingRules(&structsUFUT.PricingRulesRMP{
+		Regions: map[string]structsUFUT.RegionRulesRMP{
+			"EU": {ShippingFee: 500, TaxRates: map[string]int64{"": 2000}},
+		},
+	}))
+	for _, item := range []structsUFUT.ItemDataRSC{
+		{ItemID: "book", Status: structsUFUT.ItemStatusAvailable, Version: 1, Price: 1000, Currency: "USD"},
+		{ItemID: "lamp", Status: structsUFUT.ItemStatusAvailable, Version: 1, Price: 2500, Currency: "USD"},
+	} {
+		assert.NoError(t, repo.SetCatalogItem(t.Context(), &item))
+	}
+	for itemID, quantity := range map[string]int{"book": 2, "lamp": 1} {
+		err := repo.AddToCart(t.Context(), &structsUFUT.ItemRequestRMP{UserID: "u1", ItemID: itemID, Quantity: quantity})
+		assert.NoError(t, err)
+	}
+
+	_, err := srvc.Quote(t.Context(), "u1", "EU", "EUR")
+	assert.ErrorIs(t, err, funcsUFUT.ErrNoExchangeRate)
+	assert.NoError(t, repo.SetExchangeRates(t.Context(), &structsUFUT.ExchangeRatesRSC{
+		Reference: "USD",
+		Rates:     []structsUFUT.ExchangeRateRSC{{Currency: "USD", Rate: "1"}, {Currency: "EUR", Rate: "0.9"}, {Currency: "JPY", Rate: "150"}},
+		UpdatedAt: time.Now(),
+	}))
+	assert.NoError(t, srvc.LoadExchangeRates(t.Context()))
+	_, err = srvc.Quote(t.Context(), "u1", "EU", "XXX")
+	assert.ErrorIs(t, err, funcsUFUT.ErrUnknownCurrency)
+
+	quote, err := srvc.Quote(t.Context(), "u1", "EU", "")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6000), quote.Total)
+	converted, err := srvc.Quote(t.Context(), "u1", "EU", "eur")
+	assert.NoError(t, err)
+	assert.Equal(t, "EUR", converted.Currency)
+	assert.Equal(t, []int64{900, 2250}, []int64{converted.Lines[0].UnitPrice, converted.Lines[1].UnitPrice})
+	assert.Equal(t, []int64{2160, 2700}, []int64{converted.Lines[0].Total, converted.Lines[1].Total})
+	assert.Equal(t, int64(4050), converted.Subtotal)
+	assert.Equal(t, int64(810), converted.Tax)
+	assert.Equal(t, []int64{450, 90}, []int64{converted.Shipping, converted.ShippingTax})
+	assert.Equal(t, int64(5400), converted.Total)
+	assert.Equal(t, "USD", quote.Currency, "the quote of the service currency is left as it is")
+
+	correlationID, err := srvc.PlaceOrder(t.Context(), "u1", "EU")
+	assert.NoError(t, err)
+	cart, err := repo.ListCart(t.Context(), "u1")
+	assert.NoError(t, err)
+	assert.NoError(t, srvc.handleInventoryMsg(t.Context(), inventoryMsg(t, correlationID, structsUFUT.InventoryOrderNotification{
+		ItemsAvailability: []bool{true, true}, ItemsIDs: cart.ItemsID})))
+	p, err := srvc.PlacementStatus(t.Context(), correlationID, "u1")
+	assert.NoError(t, err)
+	assert.Equal(t, structsUFUT.PlacementPlaced, p.Status)
+
+	detail, err := srvc.OrderDetail(t.Context(), &structsUFUT.OrderRequestRMP{UserID: "u1", OrderID: p.OrderID, Currency: "JPY"})
+	assert.NoError(t, err)
+	// the lines add up to the converted quote, 60.00 USD at 150 JPY, the yen has no minor units
+	lines := detail.Quote.Shipping + detail.Quote.ShippingTax
+	for i, line := range detail.Lines {
+		assert.Equal(t, "JPY", line.Currency)
+		assert.Equal(t, detail.Quote.Lines[i].UnitPrice, *line.UnitPrice)
+		assert.Equal(t, detail.Quote.Lines[i].Total, *line.LineTotal)
+		lines += *line.LineTotal
+	}
+	assert.Equal(t, "JPY", detail.Quote.Currency)
+	assert.Equal(t, int64(9000), detail.Quote.Total)
+	assert.Equal(t, int64(9000), lines)
+	assert.Equal(t, []structsUFUT.OrderTotalRMP{{Currency: "JPY", Amount: 9000}}, detail.Totals)
+	_, err = srvc.OrderDetail(t.Context(), &structsUFUT.OrderRequestRMP{UserID: "u1", OrderID: p.OrderID, Currency: "XXX"})
+	assert.ErrorIs(t, err, funcsUFUT.ErrUnknownCurrency)
+}
@@ -1,13 +1,24 @@
 package orders_service
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"io"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
 	// "ufut/internal/showcase"
 	funcsUFUT "ufut/lib/funcs"
 	structsUFUT "ufut/lib/structs"
+
+	"github.com/google/uuid"
 )
 
 type Handler struct {
@@ -25,47 +36,222 @@ func NewHandler(srvc *Service) *Handler {
 
 func RegisterRoutes(mux *http.ServeMux, h *Handler) {
 	handledFuncs := map[string]http.HandlerFunc{
-		"POST /api/order/placeOrder":    h.PlaceOrder,
-		"POST /api/order/removeOrder":   h.RemoveOrder,
-		"GET /api/order/orderStatus":    h.OrderStatus,
-		"GET /api/order/userOrders":     h.UserOrders,
-		"POST /api/cart/addToCart":      h.AddToCart,
-		"POST /api/cart/removeFromCart": h.RemoveFromCart,
-		"POST /api/cart/increaseItems":  h.IncreaseItemQuantity,
-		"POST /api/cart/decreaseItems":  h.DecreaseItemQuantity,
-		"GET /api/cart/listCart":        h.ListCart,
-		"POST /api/cart/clearCart":      h.ClearCart,
+		"POST /api/order/placeOrder":     h.PlaceOrder,
+		"GET /api/order/placementStatus": h.PlacementStatus,
+		"POST /api/order/removeOrder":    h.RemoveOrder,
+		"GET /api/order/orderStatus":     h.OrderStatus,
+		"GET /api/order/userOrders":      h.UserOrders,
+		"GET /api/order/{id}":            h.OrderDetail,
+		"POST /api/cart/addToCart":       h.AddToCart,
+		"POST /api/cart/removeFromCart":  h.RemoveFromCart,
+		"POST /api/cart/increaseItems":   h.IncreaseItemQuantity,
+		"POST /api/cart/decreaseItems":   h.DecreaseItemQuantity,
+		"GET /api/cart/listCart":         h.ListCart,
+		"POST /api/cart/quote":           h.Quote,
+		"POST /api/cart/clearCart":       h.ClearCart,
+		"POST /api/cart/applyCoupon":     h.ApplyCoupon,
+		"POST /api/cart/removeCoupon":    h.RemoveCoupon,
+
+		"GET /api/staff/sagas":         h.Sagas,
+		"POST /api/staff/retrySaga":    h.RetrySaga,
+		"POST /api/staff/advanceOrder": h.AdvanceOrder,
+		"GET /api/staff/orderHistory":  h.OrderHistory,
+		"GET /api/staff/coupons":       h.Coupons,
+		"POST /api/staff/createCoupon": h.CreateCoupon,
+		"POST /api/staff/updateCoupon": h.UpdateCoupon,
+		"POST /api/staff/deleteCoupon": h.DeleteCoupon,
+
+		"GET /api/user/items/{id}/related": h.RelatedItems,
+		"GET /api/user/recommendations":    h.RecommendedItems,
 	}
 
 	for key, val := range handledFuncs {
+		// retries of mutating order and cart requests may carry an Idempotency-Key, quotes change nothing
+		if (strings.HasPrefix(key, "POST /api/order/") || strings.HasPrefix(key, "POST /api/cart/")) &&
+			key != "POST /api/cart/quote" {
+			val = h.idempotent(val)
+		}
 		mux.HandleFunc(key, funcsUFUT.AuthMiddleware(val))
 	}
 }
 
+// parseOrderID accepts order IDs in the canonical form they are issued in
+func parseOrderID(s string) (string, bool) {
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return "", false
+	}
+	return id.String(), true
+}
+
+// maxIdempotentBody limits request bodies fingerprinted for an idempotency key
+const maxIdempotentBody = 1 << 20
+
 /*
-JSON args:
+Handles a request with an Idempotency-Key header once per key of the user, retries with the same key
+replay its response with the Idempotent-Replayed header. Replies 422 if the key was used with another request
+and 409 while the request with the key is being handled, for up to IdempotencyLease;
+requests without the header are handled as usual
+*/
+func (h *Handler) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			next(w, r)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBody))
+		if err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		hash := sha256.New()
+		hash.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+		hash.Write(body)
+		userID := funcsUFUT.GetterIDFromContext(r.Context())
+		stored, err := h.service.BeginIdempotent(r.Context(), userID, key, hex.EncodeToString(hash.Sum(nil)))
+		if err != nil {
+			switch {
+			case errors.Is(err, ErrInvalidIdempotencyKey):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			case errors.Is(err, ErrIdempotencyKeyReused):
+				http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			case errors.Is(err, ErrIdempotencyKeyInProgress):
+				http.Error(w, err.Error(), http.StatusConflict)
+			default:
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+			}
+			return
+		}
+		if stored != nil {
+			if stored.ContentType != "" {
+				w.Header().Set("Content-Type", stored.ContentType)
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(stored.Status)
+			w.Write(stored.Body)
+			return
+		}
+		rec := &responseRecorder{ResponseWriter: w}
+		defer func() {
+			if p := recover(); p != nil {
+				// a handler that panicked frees the key like a server error
+				err := h.service.FinishIdempotent(context.WithoutCancel(r.Context()), &structsUFUT.IdempotencyRecordRMP{
+					UserID: userID, Key: key, Status: http.StatusInternalServerError})
+				if err != nil {
+					log.Printf("release idempotency key: %v\n", err)
+				}
+				panic(p)
+			}
+		}()
+		next(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		// the response is stored even if the client has gone, its retry gets it
+		err = h.service.FinishIdempotent(context.WithoutCancel(r.Context()), &structsUFUT.IdempotencyRecordRMP{
+			UserID: userID, Key: key, Status: rec.status, ContentType: rec.Header().Get("Content-Type"), Body: rec.body.Bytes()})
+		if err != nil {
+			log.Printf("store response of idempotency key: %v\n", err)
+		}
+	}
+}
 
-	None
+// responseRecorder passes the response through and keeps a copy of it
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
 
-response:
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
 
-	"status": "ok"
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+/*
+JSON args (optional body):
+
+	"region": string (optional, region the order is shipped to, see /api/cart/quote)
+
+response (202, the order is placed once inventory has reserved the items):
+
+	"correlationID": string (poll /api/order/placementStatus with it)
 */
 func (h *Handler) PlaceOrder(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Region string `json:"region"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
 	userID := funcsUFUT.GetterIDFromContext(r.Context())
-	err := h.service.PlaceOrder(r.Context(), userID)
+	correlationID, err := h.service.PlaceOrder(r.Context(), userID, req.Region)
 	if err != nil {
-		http.Error(w, "bad request", http.StatusBadRequest)
+		if errors.Is(err, ErrUnknownRegion) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"correlationID": correlationID})
+}
+
+/*
+Query args:
+
+	correlationID=string (returned by placeOrder)
+
+response:
+
+	"correlationID": string
+	"status": any("PENDING", "PLACED", "FAILED")
+	"step": string (step of the checkout saga, see /api/staff/sagas)
+	"orderID": string (once PLACED)
+	"orderNumber": int (once PLACED, the number shown to the user)
+	"itemsID": []string (cart snapshot sent to inventory)
+	"quantities": []int
+	"itemsAvailability": []bool (parallel to itemsID, once inventory has answered;
+	unavailable items are left out of the order and stay in the cart)
+	"region": string
+	"couponCode": string (coupon the order is placed with, redeemed once inventory has answered)
+	"quote": {...} (checkout totals of the available items once inventory has answered, see /api/cart/quote)
+	"createdAt": int (unix seconds)
+	"updatedAt": int (unix seconds)
+*/
+func (h *Handler) PlacementStatus(w http.ResponseWriter, r *http.Request) {
+	userID := funcsUFUT.GetterIDFromContext(r.Context())
+	resp, err := h.service.PlacementStatus(r.Context(), r.URL.Query().Get("correlationID"), userID)
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(resp)
 }
 
 /*
 JSON args:
 
-	"orderID": int
+	"orderID": string (404 unless it's an order of the getter)
+
+Orders can be cancelled until they are out for delivery,
+afterwards the response is 409 and only operators can cancel them
 
 response:
 
@@ -73,16 +259,28 @@ response:
 */
 func (h *Handler) RemoveOrder(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		OrderID int `json:"orderID"`
+		OrderID string `json:"orderID"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
 		return
 	}
+	orderID, ok := parseOrderID(req.OrderID)
+	if !ok {
+		http.Error(w, "incorrect orderID", http.StatusBadRequest)
+		return
+	}
 	userID := funcsUFUT.GetterIDFromContext(r.Context())
-	err := h.service.RemoveOrder(r.Context(), &structsUFUT.OrderRequestRMP{UserID: userID, OrderID: req.OrderID})
+	err := h.service.RemoveOrder(r.Context(), &structsUFUT.OrderRequestRMP{UserID: userID, OrderID: orderID})
 	if err != nil {
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, ErrInvalidTransition):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, "not found", http.StatusNotFound)
+		default:
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
 		return
 	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -92,16 +290,15 @@ func (h *Handler) RemoveOrder(w http.ResponseWriter, r *http.Request) {
 /*
 Query args:
 
-	orderID=int
+	orderID=string
 
 response:
 
 	"status": any("CREATED", "PREPARING", "DELIVERY", "FINISHED", "CANCELLED")
 */
 func (h *Handler) OrderStatus(w http.ResponseWriter, r *http.Request) {
-	q_vals := r.URL.Query()
-	orderID, err := strconv.Atoi(q_vals.Get("orderID"))
-	if err != nil {
+	orderID, ok := parseOrderID(r.URL.Query().Get("orderID"))
+	if !ok {
 		http.Error(w, "incorrect orderID", http.StatusBadRequest)
 		return
 	}
@@ -118,24 +315,89 @@ func (h *Handler) OrderStatus(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": req.Status})
 }
 
+/*
+Path args:
+
+	id: orderID
+
+Query args:
+
+	currency: optional, ISO 4217 code to show the amounts in at the current exchange rates
+	(amounts stay in the currencies the order was placed in if not provided)
+
+response:
+
+	"orderID": string
+	"orderNumber": int
+	"status": any("CREATED", "PREPARING", "DELIVERY", "FINISHED", "CANCELLED")
+	"lines": [
+		{
+			"itemID": string
+			"name": string (when the order was placed)
+			"sellerID": string
+			"quantity": int
+			"unitPrice": int (minor units of currency when the order was placed, null if unknown)
+			"discount": int (line discount, promotion and coupon of the line)
+			"tax": int
+			"lineTotal": int (unit price times quantity less discount plus tax, null if unknown)
+			"currency": string
+		}
+	]
+	"totals": [{"currency": string, "amount": int}] (total of the quote; sum of the priced lines per currency for older orders)
+	"quote": {...} (checkout totals the order was placed with, see /api/cart/quote; missing for older orders)
+	"history": [...] (status changes oldest first, see /api/staff/orderHistory)
+	"createdAt": int (unix seconds)
+	"updatedAt": int (unix seconds of the last status change)
+*/
+func (h *Handler) OrderDetail(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := parseOrderID(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "incorrect orderID", http.StatusBadRequest)
+		return
+	}
+	userID := funcsUFUT.GetterIDFromContext(r.Context())
+	resp, err := h.service.OrderDetail(r.Context(), &structsUFUT.OrderRequestRMP{
+		UserID: userID, OrderID: orderID, Currency: r.URL.Query().Get("currency")})
+	if err != nil {
+		if errors.Is(err, funcsUFUT.ErrUnknownCurrency) || errors.Is(err, funcsUFUT.ErrNoExchangeRate) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(resp)
+}
+
 /*
 Query args:
 
 	status=string(optional)
+	count=int(optional, 20 if not provided, at most 100)
+	cursor=string(optional, "next_cursor" of the previous page)
 
 resonse:
 
 	{
-		"ordersID": [<ints>]
+		"ordersID": [<strings>] (newest first)
+		"orderNumbers": [<ints>]
 		"statuses": [<strings>]
+		"next_cursor": string (empty on the last page)
 	}
 */
 func (h *Handler) UserOrders(w http.ResponseWriter, r *http.Request) {
 	q_vals := r.URL.Query()
 	status := q_vals.Get("status")
+	count, _ := strconv.Atoi(q_vals.Get("count"))
 	userID := funcsUFUT.GetterIDFromContext(r.Context())
-	resp, err := h.service.UserOrders(r.Context(), &structsUFUT.OrderRequestRMP{UserID: userID, Status: status})
+	resp, err := h.service.UserOrders(r.Context(), &structsUFUT.OrderRequestRMP{
+		UserID: userID, Status: status, Cursor: q_vals.Get("cursor"), Count: count})
 	if err != nil {
+		if errors.Is(err, funcsUFUT.ErrInvalidCursor) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -147,7 +409,7 @@ func (h *Handler) UserOrders(w http.ResponseWriter, r *http.Request) {
 JSON args:
 
 	"itemID": string
-	"quantity":int
+	"quantity": int (positive)
 
 response:
 
@@ -165,7 +427,7 @@ func (h *Handler) AddToCart(w http.ResponseWriter, r *http.Request) {
 	userID := funcsUFUT.GetterIDFromContext(r.Context())
 	if err := h.service.AddToCart(r.Context(), &structsUFUT.ItemRequestRMP{
 		UserID: userID, ItemID: req.ItemID, Quantity: req.Quantity}); err != nil {
-		http.Error(w, "bad request", http.StatusBadRequest)
+		writeCartError(w, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -175,7 +437,7 @@ func (h *Handler) AddToCart(w http.ResponseWriter, r *http.Request) {
 /*
 JSON args:
 
-	"itemID":string
+	"itemID": string (404 unless the item is in the cart)
 
 response:
 
@@ -192,7 +454,7 @@ func (h *Handler) RemoveFromCart(w http.ResponseWriter, r *http.Request) {
 	userID := funcsUFUT.GetterIDFromContext(r.Context())
 	if err := h.service.RemoveFromCart(r.Context(), &structsUFUT.ItemRequestRMP{
 		UserID: userID, ItemID: req.ItemID}); err != nil {
-		http.Error(w, "bad request", http.StatusBadRequest)
+		writeCartError(w, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -202,8 +464,8 @@ func (h *Handler) RemoveFromCart(w http.ResponseWriter, r *http.Request) {
 /*
 JSON args:
 
-	"itemID": string
-	"quantity":int
+	"itemID": string (404 unless the item is in the cart)
+	"quantity": int (positive)
 
 response:
 
@@ -221,7 +483,7 @@ func (h *Handler) IncreaseItemQuantity(w http.ResponseWriter, r *http.Request) {
 	userID := funcsUFUT.GetterIDFromContext(r.Context())
 	if err := h.service.IncreaseItemQuantity(r.Context(), &structsUFUT.ItemRequestRMP{
 		UserID: userID, ItemID: req.ItemID, Quantity: req.Quantity}); err != nil {
-		http.Error(w, "bad request", http.StatusBadRequest)
+		writeCartError(w, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -231,8 +493,8 @@ func (h *Handler) IncreaseItemQuantity(w http.ResponseWriter, r *http.Request) {
 /*
 JSON args:
 
-	"itemID": string
-	"quantity":int
+	"itemID": string (404 unless the item is in the cart)
+	"quantity": int (positive)
 
 response:
 
@@ -250,35 +512,120 @@ func (h *Handler) DecreaseItemQuantity(w http.ResponseWriter, r *http.Request) {
 	userID := funcsUFUT.GetterIDFromContext(r.Context())
 	if err := h.service.DecreaseItemQuantity(r.Context(), &structsUFUT.ItemRequestRMP{
 		UserID: userID, ItemID: req.ItemID, Quantity: req.Quantity}); err != nil {
-		http.Error(w, "bad request", http.StatusBadRequest)
+		writeCartError(w, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
+// writeCartError maps errors of cart changes, items missing from the cart are 404
+func writeCartError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidCartItem):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "item is not in the cart", http.StatusNotFound)
+	default:
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
 /*
 Query args:
 
-	None
+	currency: optional, ISO 4217 code (service default currency if not provided)
 
-response
+response:
+
+	"itemsID": []string
+	"quantities": []int
+	"currency": string
+	"unitPrices": []int (minor units of currency, null for items without a known price)
+	"lineTotals": []int (unit price times quantity, null for items without a known price)
+	"total": int (sum of the priced lines)
 */
 func (h *Handler) ListCart(w http.ResponseWriter, r *http.Request) {
 	userID := funcsUFUT.GetterIDFromContext(r.Context())
-	resp, err := h.service.ListCart(r.Context(), userID)
+	resp, err := h.service.PricedCart(r.Context(), userID, r.URL.Query().Get("currency"))
 	if err != nil {
+		if errors.Is(err, funcsUFUT.ErrUnknownCurrency) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
-	var t_strct struct {
-		T1 []string `json:"itemsID"`
-		T2 []int    `json:"quantities"`
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(resp)
+}
+
+/*
+JSON args:
+
+	"region": string (optional, region the order is shipped to)
+
+Query args:
+
+	currency: optional, ISO 4217 code to show the amounts in (service currency if not provided)
+
+Amounts are in minor units of currency, tax rates in basis points. The order is charged in the service currency,
+converted amounts are taken one by one at the current exchange rates and summed again.
+Placing the order for the same cart and region keeps the same breakdown, see /api/order/{id}
+
+response:
+
+	"region": string
+	"currency": string
+	"lines": [
+		{
+			"itemID": string
+			"category": string
+			"quantity": int
+			"unitPrice": int
+			"subtotal": int (unit price times quantity)
+			"discount": int (line discount)
+			"discountName": string
+			"promotion": int (share of the order promotion)
+			"coupon": int (share of the coupon discount)
+			"taxRateBps": int
+			"tax": int
+			"total": int (subtotal - discount - promotion + tax)
+		}
+	]
+	"unpricedItems": []string (items without a known price, left out)
+	"subtotal": int
+	"lineDiscounts": int
+	"promotion": int
+	"promotionName": string
+	"couponCode": string (coupon applied to the cart, see /api/cart/applyCoupon)
+	"coupon": int (discount of the coupon)
+	"couponError": string (why the coupon gives no discount, e.g. the basket is below its minimum)
+	"shipping": int
+	"shippingTax": int
+	"tax": int (taxes of the lines)
+	"total": int (subtotal - lineDiscounts - promotion - coupon + shipping + shippingTax + tax)
+*/
+func (h *Handler) Quote(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Region string `json:"region"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	userID := funcsUFUT.GetterIDFromContext(r.Context())
+	resp, err := h.service.Quote(r.Context(), userID, req.Region, r.URL.Query().Get("currency"))
+	if err != nil {
+		if errors.Is(err, ErrUnknownRegion) || errors.Is(err, funcsUFUT.ErrUnknownCurrency) || errors.Is(err, funcsUFUT.ErrNoExchangeRate) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
 	}
-	t_strct.T1 = resp.ItemsID
-	t_strct.T2 = resp.Quantities
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	json.NewEncoder(w).Encode(t_strct)
+	json.NewEncoder(w).Encode(resp)
 }
 
 /*
@@ -299,3 +646,383 @@ func (h *Handler) ClearCart(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
+
+/*
+JSON args:
+
+	"code": string (case insensitive)
+
+Replaces the coupon applied before. The discount shows in /api/cart/quote and is kept
+for the order if the cart still qualifies when it is placed
+
+response:
+
+	"status": "ok"
+*/
+func (h *Handler) ApplyCoupon(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	userID := funcsUFUT.GetterIDFromContext(r.Context())
+	if err := h.service.ApplyCoupon(r.Context(), userID, req.Code); err != nil {
+		switch {
+		case errors.Is(err, ErrCouponNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, ErrCouponNotActive), errors.Is(err, ErrCouponExhausted):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		default:
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+/*
+JSON args:
+
+	None
+
+response:
+
+	"status": "ok"
+*/
+func (h *Handler) RemoveCoupon(w http.ResponseWriter, r *http.Request) {
+	userID := funcsUFUT.GetterIDFromContext(r.Context())
+	if err := h.service.RemoveCoupon(r.Context(), userID); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+/*
+Query args:
+
+	stuck=bool(optional; STUCK sagas and sagas that missed their deadline)
+	count=int(optional, 50 if not provided, at most 200)
+
+response:
+
+	"sagas": [
+		{
+			"correlationID": string
+			"userID": string
+			"status": any("PENDING", "PLACED", "FAILED")
+			"step": any("RESERVING", "PAYING", "RELEASING", "STUCK", "DONE", "COMPENSATED")
+			"deadlineAt": int (unix seconds, while waiting for a reply)
+			"retries": int
+			"lastError": string
+			"total": int (minor units of currency, once the payment is requested)
+			"currency": string
+			...placement fields
+		}
+	] (oldest deadline first)
+*/
+func (h *Handler) Sagas(w http.ResponseWriter, r *http.Request) {
+	q_vals := r.URL.Query()
+	stuck, _ := strconv.ParseBool(q_vals.Get("stuck"))
+	count, _ := strconv.Atoi(q_vals.Get("count"))
+	resp, err := h.service.Sagas(r.Context(), funcsUFUT.GetterIDFromContext(r.Context()), stuck, count)
+	if err != nil {
+		if errors.Is(err, ErrNotOperator) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(resp)
+}
+
+/*
+JSON args:
+
+	"correlationID": string (saga that isn't DONE or COMPENSATED)
+
+response:
+
+	saga with its new deadline, see Sagas
+*/
+func (h *Handler) RetrySaga(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		CorrelationID string `json:"correlationID"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	resp, err := h.service.RetrySaga(r.Context(), funcsUFUT.GetterIDFromContext(r.Context()), req.CorrelationID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrNotOperator):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, ErrSagaFinished):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(resp)
+}
+
+/*
+JSON args:
+
+	"orderID": string
+	"status": any("PREPARING", "DELIVERY", "FINISHED", "CANCELLED")
+
+Orders go CREATED -> PREPARING -> DELIVERY -> FINISHED, each step once, and can be cancelled until finished.
+Items of an order cancelled in delivery aren't released, they are restocked once back
+
+response:
+
+	"status": string (new status of the order)
+*/
+func (h *Handler) AdvanceOrder(w http.ResponseWriter, r *http.Request) {
+	var req structsUFUT.OrderRequestRMP
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if err := h.service.AdvanceOrder(r.Context(), funcsUFUT.GetterIDFromContext(r.Context()), &req); err != nil {
+		switch {
+		case errors.Is(err, ErrNotOperator):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, ErrUnknownOrderStatus):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrInvalidTransition):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]string{"status": req.Status})
+}
+
+/*
+Query args:
+
+	orderID=string
+
+response:
+
+	"history": [
+		{
+			"userID": string (owner of the order)
+			"orderID": string
+			"from": string (empty for the created order)
+			"to": any("CREATED", "PREPARING", "DELIVERY", "FINISHED", "CANCELLED")
+			"changedBy": string (user or staff member)
+			"changedAt": int (unix seconds)
+		}
+	] (oldest first)
+*/
+func (h *Handler) OrderHistory(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := parseOrderID(r.URL.Query().Get("orderID"))
+	if !ok {
+		http.Error(w, "incorrect orderID", http.StatusBadRequest)
+		return
+	}
+	resp, err := h.service.OrderHistory(r.Context(), funcsUFUT.GetterIDFromContext(r.Context()), orderID)
+	if err != nil {
+		if errors.Is(err, ErrNotOperator) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(resp)
+}
+
+/*
+Query args:
+
+	None
+
+response:
+
+	"coupons": [
+		{
+			"code": string
+			"percentBps": int (percent off in basis points)
+			"amount": int (fixed off, minor units of the service currency)
+			"minSubtotal": int (eligible merchandise the cart must reach)
+			"perUserLimit": int (0 for unlimited)
+			"globalLimit": int (0 for unlimited)
+			"startsAt": int (unix seconds, 0 for no bound)
+			"endsAt": int (unix seconds, 0 for no bound)
+			"categories": []string (empty for any)
+			"sellerIDs": []string (empty for any)
+			"redemptions": int (orders placed with it that aren't cancelled)
+			"createdAt": int (unix seconds)
+			"updatedAt": int (unix seconds)
+		}
+	] (ordered by code)
+*/
+func (h *Handler) Coupons(w http.ResponseWriter, r *http.Request) {
+	resp, err := h.service.Coupons(r.Context(), funcsUFUT.GetterIDFromContext(r.Context()))
+	if err != nil {
+		if errors.Is(err, ErrNotOperator) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// writeCouponError maps errors of the staff coupon endpoints
+func writeCouponError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotOperator):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, ErrInvalidCoupon):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrCouponNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrCouponExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+/*
+JSON args:
+
+	coupon fields without "redemptions", "createdAt", "updatedAt", see Coupons.
+	"percentBps" or "amount" must be positive
+
+response:
+
+	the created coupon, see Coupons
+*/
+func (h *Handler) CreateCoupon(w http.ResponseWriter, r *http.Request) {
+	var req structsUFUT.CouponRMP
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	resp, err := h.service.CreateCoupon(r.Context(), funcsUFUT.GetterIDFromContext(r.Context()), &req)
+	if err != nil {
+		writeCouponError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(resp)
+}
+
+/*
+JSON args:
+
+	same as CreateCoupon, "code" picks the coupon whose terms are replaced
+
+response:
+
+	the updated coupon, see Coupons
+*/
+func (h *Handler) UpdateCoupon(w http.ResponseWriter, r *http.Request) {
+	var req structsUFUT.CouponRMP
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	resp, err := h.service.UpdateCoupon(r.Context(), funcsUFUT.GetterIDFromContext(r.Context()), &req)
+	if err != nil {
+		writeCouponError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(resp)
+}
+
+/*
+JSON args:
+
+	"code": string
+
+# Orders placed with the coupon keep their discount
+
+response:
+
+	"status": "ok"
+*/
+func (h *Handler) DeleteCoupon(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	if err := h.service.DeleteCoupon(r.Context(), funcsUFUT.GetterIDFromContext(r.Context()), req.Code); err != nil {
+		writeCouponError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+/*
+Path args:
+
+	id: itemID
+
+Query args:
+
+	count=int(optional, 10 if not provided, at most 50)
+
+response:
+
+	"itemsID": [<strings>] (items most often bought together with the item, best first;
+	deleted and out of stock items are skipped)
+*/
+func (h *Handler) RelatedItems(w http.ResponseWriter, r *http.Request) {
+	count, _ := strconv.Atoi(r.URL.Query().Get("count"))
+	resp, err := h.service.RelatedItems(r.Context(), r.PathValue("id"), count)
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(resp)
+}
+
+/*
+Query args:
+
+	count=int(optional, 10 if not provided, at most 50)
+
+response:
+
+	"itemsID": [<strings>] (items bought together with the user's past orders and cart items, best first;
+	items the user already ordered or has in the cart, deleted and out of stock items are skipped)
+*/
+func (h *Handler) RecommendedItems(w http.ResponseWriter, r *http.Request) {
+	count, _ := strconv.Atoi(r.URL.Query().Get("count"))
+	userID := funcsUFUT.GetterIDFromContext(r.Context())
+	resp, err := h.service.RecommendedItems(r.Context(), userID, count)
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(resp)
+}
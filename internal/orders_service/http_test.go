@@ -0,0 +1,151 @@
+package orders_service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	funcsUFUT "ufut/lib/funcs"
+	structsUFUT "ufut/lib/structs"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler_IdempotencyKey(t *testing.T) {
+	srvc, repo := CreateOrdersService(t)
+	mux := http.NewServeMux()
+	RegisterRoutes(mux, NewHandler(srvc))
+	token := func(userID string) string {
+		jwt, err := funcsUFUT.GenerateJWT(funcsUFUT.JWTCustomFields{GetterID: userID})
+		assert.NoError(t, err)
+		return "Bearer " + jwt
+	}
+	do := func(userID, path, key, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		r.Header.Set("Authorization", token(userID))
+		if key != "" {
+			r.Header.Set(IdempotencyKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+	quantity := func(userID string) int {
+		cart, err := repo.ListCart(t.Context(), userID)
+		assert.NoError(t, err)
+		if len(cart.Quantities) == 0 {
+			return 0
+		}
+		return cart.Quantities[0]
+	}
+	add := `{"itemID": "book", "quantity": 2}`
+
+	// a retried request is handled once and gets the original response
+	w := do("u1", "/api/cart/addToCart", "k1", add)
+	assert.Equal(t, http.StatusOK, w.Code)
+	retry := do("u1", "/api/cart/addToCart", "k1", add)
+	assert.Equal(t, http.StatusOK, retry.Code)
+	assert.Equal(t, w.Body.String(), retry.Body.String())
+	assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, w.Header().Get("Content-Type"), retry.Header().Get("Content-Type"))
+	assert.Equal(t, 2, quantity("u1"))
+
+	// the key can't be reused for another request
+	assert.Equal(t, http.StatusUnprocessableEntity, do("u1", "/api/cart/addToCart", "k1", `{"itemID": "book", "quantity": 3}`).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, do("u1", "/api/cart/increaseItems", "k1", add).Code)
+	assert.Equal(t, 2, quantity("u1"))
+
+	// keys are per user, requests without a key are handled every time
+	assert.Equal(t, http.StatusOK, do("u2", "/api/cart/addToCart", "k1", add).Code)
+	assert.Equal(t, 2, quantity("u2"))
+	assert.Equal(t, http.StatusOK, do("u1", "/api/cart/increaseItems", "", `{"itemID": "book", "quantity": 1}`).Code)
+	assert.Equal(t, http.StatusOK, do("u1", "/api/cart/increaseItems", "", `{"itemID": "book", "quantity": 1}`).Code)
+	assert.Equal(t, 4, quantity("u1"))
+
+	// server errors free the key for a retry, client errors are replayed
+	orderID := placeTestOrder(t, repo, "u1", "lamp")
+	_, err := repo.DB.ExecContext(t.Context(), `ALTER TABLE user_orders RENAME TO user_orders_away`)
+	assert.NoError(t, err)
+	w = do("u1", "/api/order/removeOrder", "k2", `{"orderID": "`+orderID+`"}`)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	_, err = repo.DB.ExecContext(t.Context(), `ALTER TABLE user_orders_away RENAME TO user_orders`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, do("u1", "/api/order/removeOrder", "k2", `{"orderID": "`+orderID+`"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do("u1", "/api/order/removeOrder", "", `{"orderID": "missing"}`).Code)
+	assert.Equal(t, http.StatusNotFound, do("u1", "/api/order/removeOrder", "", `{"orderID": "`+uuid.NewString()+`"}`).Code)
+	assert.Equal(t, http.StatusNotFound, do("u2", "/api/order/removeOrder", "", `{"orderID": "`+orderID+`"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do("u1", "/api/cart/addToCart", "k3", `{`).Code)
+	assert.Equal(t, http.StatusBadRequest, do("u1", "/api/cart/addToCart", "k3", `{`).Code)
+
+	// placing the order twice starts one checkout saga
+	w = do("u1", "/api/order/placeOrder", "k4", "")
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	retry = do("u1", "/api/order/placeOrder", "k4", "")
+	assert.Equal(t, http.StatusAccepted, retry.Code)
+	assert.Equal(t, w.Body.String(), retry.Body.String())
+	sagas, err := repo.Sagas(t.Context(), &structsUFUT.SagasRequestRMP{Steps: []string{structsUFUT.SagaReserving}, Count: 10})
+	assert.NoError(t, err)
+	assert.Len(t, sagas, 1)
+
+	// a request still being handled can't be run again
+	_, err = srvc.BeginIdempotent(t.Context(), "u1", "k5", "hash")
+	assert.NoError(t, err)
+	_, err = srvc.BeginIdempotent(t.Context(), "u1", "k5", "hash")
+	assert.ErrorIs(t, err, ErrIdempotencyKeyInProgress)
+	// until its lease is over, then the handler is taken for dead
+	_, err = repo.DB.ExecContext(t.Context(), `UPDATE idempotency_keys SET createdAt=createdAt-? WHERE idemKey='k5'`,
+		int64(IdempotencyLease/time.Second)+1)
+	assert.NoError(t, err)
+	stored, err := srvc.BeginIdempotent(t.Context(), "u1", "k5", "hash")
+	assert.NoError(t, err)
+	assert.Nil(t, stored)
+
+	// a panicking handler frees the key
+	panicking := NewHandler(srvc).idempotent(func(w http.ResponseWriter, r *http.Request) { panic("boom") })
+	r := httptest.NewRequest(http.MethodPost, "/api/cart/clearCart", nil)
+	r = r.WithContext(context.WithValue(r.Context(), "getterID", "u1"))
+	r.Header.Set(IdempotencyKeyHeader, "k6")
+	assert.Panics(t, func() { panicking(httptest.NewRecorder(), r) })
+	assert.Equal(t, http.StatusOK, do("u1", "/api/cart/clearCart", "k6", "").Code)
+
+	// quotes change nothing and aren't stored under keys
+	assert.Equal(t, http.StatusOK, do("u1", "/api/cart/quote", "k7", "").Code)
+	assert.Empty(t, do("u1", "/api/cart/quote", "k7", "").Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, http.StatusBadRequest, do("u1", "/api/cart/clearCart", strings.Repeat("k", MaxIdempotencyKeyLength+1), "").Code)
+}
+
+func TestHandler_CartErrors(t *testing.T) {
+	srvc, repo := CreateOrdersService(t)
+	mux := http.NewServeMux()
+	RegisterRoutes(mux, NewHandler(srvc))
+	do := func(path, key, body string) *httptest.ResponseRecorder {
+		jwt, err := funcsUFUT.GenerateJWT(funcsUFUT.JWTCustomFields{GetterID: "u1"})
+		assert.NoError(t, err)
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+jwt)
+		if key != "" {
+			r.Header.Set(IdempotencyKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	// invalid quantities and items missing from the cart are client errors, replayed on retry
+	assert.Equal(t, http.StatusBadRequest, do("/api/cart/addToCart", "", `{"itemID": "book", "quantity": 0}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do("/api/cart/decreaseItems", "", `{"itemID": "book", "quantity": -1}`).Code)
+	assert.Equal(t, http.StatusNotFound, do("/api/cart/increaseItems", "k1", `{"itemID": "book", "quantity": 1}`).Code)
+	assert.Equal(t, http.StatusOK, do("/api/cart/addToCart", "", `{"itemID": "book", "quantity": 1}`).Code)
+	w := do("/api/cart/increaseItems", "k1", `{"itemID": "book", "quantity": 1}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, http.StatusNotFound, do("/api/cart/removeFromCart", "", `{"itemID": "lamp"}`).Code)
+
+	// failures of the service are server errors
+	assert.NoError(t, repo.DB.Close())
+	assert.Equal(t, http.StatusInternalServerError, do("/api/cart/addToCart", "", `{"itemID": "book", "quantity": 1}`).Code)
+	assert.Equal(t, http.StatusInternalServerError, do("/api/order/placeOrder", "", "").Code)
+}
@@ -0,0 +1,74 @@
+package orders_service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+	structsUFUT "ufut/lib/structs"
+)
+
+const (
+	// IdempotencyKeyHeader names the request header of mutating order and cart endpoints
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// DefaultIdempotencyRetention is how long responses are replayed for their keys
+	DefaultIdempotencyRetention = 24 * time.Hour
+	// IdempotencyLease is how long a key is held by a request without a response,
+	// after it the handler is taken for dead and the key can be retried
+	IdempotencyLease = time.Minute
+	// MaxIdempotencyKeyLength limits the length of idempotency keys
+	MaxIdempotencyKeyLength = 255
+)
+
+var (
+	ErrInvalidIdempotencyKey    = errors.New("idempotency key must be 1 to 255 characters")
+	ErrIdempotencyKeyReused     = errors.New("idempotency key was used with a different request")
+	ErrIdempotencyKeyInProgress = errors.New("request with this idempotency key is in progress")
+)
+
+/*
+Sets how long responses are replayed for their keys, zero uses the default
+*/
+func (s *Service) SetIdempotencyRetention(retention time.Duration) {
+	s.idempotencyRetention = retention
+}
+
+/*
+Takes the key of the user for the request fingerprinted by requestHash.
+Returns nil if the request has to be handled and its response finished with FinishIdempotent,
+or the stored response of the request the key was used with. A key without a response is held
+for IdempotencyLease
+*/
+func (s *Service) BeginIdempotent(ctx context.Context, userID, key, requestHash string) (*structsUFUT.IdempotencyRecordRMP, error) {
+	if key == "" || len(key) > MaxIdempotencyKeyLength {
+		return nil, ErrInvalidIdempotencyKey
+	}
+	retention := s.idempotencyRetention
+	if retention == 0 {
+		retention = DefaultIdempotencyRetention
+	}
+	now := time.Now()
+	stored, err := s.repo.ReserveIdempotencyKey(ctx, &structsUFUT.IdempotencyRecordRMP{
+		UserID: userID, Key: key, RequestHash: requestHash}, now.Add(-retention).Unix(), now.Add(-IdempotencyLease).Unix())
+	if err != nil || stored == nil {
+		return nil, err
+	}
+	if stored.RequestHash != requestHash {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if stored.Status == 0 {
+		return nil, ErrIdempotencyKeyInProgress
+	}
+	return stored, nil
+}
+
+/*
+Stores the response of the request begun with BeginIdempotent.
+Server errors aren't stored, the key is freed so the request can be retried with it
+*/
+func (s *Service) FinishIdempotent(ctx context.Context, rec *structsUFUT.IdempotencyRecordRMP) error {
+	if rec.Status >= http.StatusInternalServerError {
+		return s.repo.ReleaseIdempotencyKey(ctx, rec.UserID, rec.Key)
+	}
+	return s.repo.StoreIdempotentResponse(ctx, rec)
+}
@@ -0,0 +1,181 @@
+package orders_service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+	eventsUFUT "ufut/lib/events"
+	structsUFUT "ufut/lib/structs"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+)
+
+/*
+Starts the checkout saga for the user's cart shipped to region and returns the correlation ID
+the placement status can be polled with. The order is placed and the cart is cleared
+once inventory has reserved the items (and the payment is made, if payments are enabled).
+The coupon applied to the cart is kept for the order if it gives a discount now
+*/
+func (s *Service) PlaceOrder(ctx context.Context, userID, region string) (string, error) {
+	region = strings.TrimSpace(region)
+	if _, err := regionRules(s.pricing, region); err != nil {
+		return "", err
+	}
+	cart, err := s.ListCart(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	code, err := s.repo.CartCoupon(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if code != "" && len(cart.ItemsID) > 0 {
+		q, err := s.quoteCart(ctx, cart, region, code, "")
+		if err != nil {
+			return "", err
+		}
+		if q.Coupon == 0 {
+			code = ""
+		}
+	}
+	trx, err := uuid.NewUUID()
+	if err != nil {
+		return "", err
+	}
+	correlationID := trx.String()
+	msg, err := s.reserveMessage(correlationID, cart)
+	if err != nil {
+		return "", err
+	}
+	err = s.repo.CreatePlacement(ctx, &structsUFUT.PlacementRMP{
+		CorrelationID: correlationID,
+		UserID:        userID,
+		ItemsID:       cart.ItemsID,
+		Quantities:    cart.Quantities,
+		DeadlineAt:    s.deadline(s.sagaTimeouts().Reserve),
+		Region:        region,
+		CouponCode:    code,
+	}, msg)
+	if err != nil {
+		return "", err
+	}
+	return correlationID, nil
+}
+
+/*
+Returns the placement of the user's order
+*/
+func (s *Service) PlacementStatus(ctx context.Context, correlationID, userID string) (*structsUFUT.PlacementRMP, error) {
+	return s.repo.Placement(ctx, correlationID, userID)
+}
+
+/*
+Moves checkout sagas on reservation results published by inventory.
+Other notifications sharing the topic are skipped
+*/
+func (s *Service) handleInventoryMsg(ctx context.Context, msg kafka.Message) error {
+	meta, err := eventsUFUT.ReadMetadata(msg)
+	if err != nil || (meta.Type != eventsUFUT.ItemsReserved && meta.Type != eventsUFUT.ItemsReleased) {
+		return nil
+	}
+	event, err := eventsUFUT.Decode[structsUFUT.InventoryOrderNotification](msg)
+	if err != nil {
+		log.Printf("skip inventory result: %v\n", err)
+		return nil
+	}
+	var p *structsUFUT.PlacementRMP
+	switch event.Type {
+	case eventsUFUT.ItemsReserved:
+		p, err = s.itemsReserved(ctx, event.CorrelationID, event.Payload.ItemsAvailability)
+	case eventsUFUT.ItemsReleased:
+		p, err = s.repo.TransitSaga(ctx, event.CorrelationID, &structsUFUT.SagaTransitionRMP{
+			From: []string{structsUFUT.SagaReleasing, structsUFUT.SagaStuck},
+			Step: structsUFUT.SagaCompensated,
+		})
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("checkout saga %s: %s %s\n", p.CorrelationID, p.Status, p.Step)
+	return nil
+}
+
+/*
+Quotes the available items and places the order right away, or requests the payment of the quote first
+if payments are enabled. Nothing is reserved if none of the items is available, so the saga fails without compensation.
+Items can't be sold without a price, the saga fails if the price of a reserved item is unknown.
+The coupon of the placement is redeemed before; the saga fails if it no longer gives a discount
+or its limits are used up, rather than charging more than the user was quoted
+*/
+func (s *Service) itemsReserved(ctx context.Context, correlationID string, availability []bool) (*structsUFUT.PlacementRMP, error) {
+	from := []string{structsUFUT.SagaReserving}
+	p, err := s.repo.Saga(ctx, correlationID)
+	if err != nil {
+		return nil, err
+	}
+	reserved := &structsUFUT.ShoppingCartRMP{UserID: p.UserID}
+	for i, itemID := range p.ItemsID {
+		if i < len(availability) && availability[i] {
+			reserved.ItemsID = append(reserved.ItemsID, itemID)
+			reserved.Quantities = append(reserved.Quantities, p.Quantities[i])
+		}
+	}
+	if len(reserved.ItemsID) == 0 {
+		return s.repo.PlaceOrder(ctx, correlationID, from, availability, nil)
+	}
+	quote, err := s.quoteCart(ctx, reserved, p.Region, p.CouponCode, correlationID)
+	if errors.Is(err, ErrUnknownRegion) {
+		// the rules have changed since the saga started
+		return s.compensate(ctx, correlationID, from, availability, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(quote.UnpricedItems) > 0 {
+		return s.compensate(ctx, correlationID, from, availability, "price of a reserved item is unknown")
+	}
+	if p.CouponCode != "" {
+		if quote.CouponError != "" {
+			return s.compensate(ctx, correlationID, from, availability, "coupon "+p.CouponCode+": "+quote.CouponError)
+		}
+		redeemed, err := s.repo.RedeemCoupon(ctx, &structsUFUT.CouponRedemptionRMP{
+			CorrelationID: correlationID, UserID: p.UserID, Code: p.CouponCode})
+		if err != nil {
+			return nil, err
+		}
+		if !redeemed {
+			return s.compensate(ctx, correlationID, from, availability, "coupon "+p.CouponCode+": "+ErrCouponExhausted.Error())
+		}
+	}
+	if !s.payments {
+		return s.repo.PlaceOrder(ctx, correlationID, from, availability, quote)
+	}
+	p.Total, p.Currency = quote.Total, quote.Currency
+	msg, err := s.paymentMessage(p)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.TransitSaga(ctx, correlationID, &structsUFUT.SagaTransitionRMP{
+		From:              from,
+		Step:              structsUFUT.SagaPaying,
+		DeadlineAt:        s.deadline(s.sagaTimeouts().Payment),
+		ItemsAvailability: availability,
+		Total:             quote.Total,
+		Currency:          quote.Currency,
+		Quote:             quote,
+	}, msg)
+}
+
+func (s *Service) deadline(timeout time.Duration) int64 {
+	return time.Now().Add(timeout).Unix()
+}
+
+/*
+Consumes reservation results until ctx is cancelled
+*/
+func (s *Service) ServeInventoryKafka(ctx context.Context, reader *kafka.Reader) error {
+	return serveReader(ctx, reader, s.handleInventoryMsg)
+}
@@ -0,0 +1,139 @@
+package orders_service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	sqliteOutbox "ufut/internal/sqlite/outbox"
+	eventsUFUT "ufut/lib/events"
+	structsUFUT "ufut/lib/structs"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+type testWriter struct {
+	fail error
+	msgs []kafka.Message
+}
+
+func (w *testWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if w.fail != nil {
+		return w.fail
+	}
+	w.msgs = append(w.msgs, msgs...)
+	return nil
+}
+
+func inventoryMsg(t *testing.T, correlationID string, notification structsUFUT.InventoryOrderNotification) kafka.Message {
+	msg, err := eventsUFUT.NewMessage(eventsUFUT.ItemsReserved, "inventory_service", correlationID, correlationID, notification)
+	assert.NoError(t, err)
+	return msg
+}
+
+func TestService_Placement(t *testing.T) {
+	srvc, repo := CreateOrdersService(t)
+	for _, item := range []structsUFUT.ItemDataRSC{
+		{ItemID: "book", Status: structsUFUT.ItemStatusAvailable, Version: 1, Price: 1000, Currency: "USD"},
+		{ItemID: "lamp", Status: structsUFUT.ItemStatusAvailable, Version: 1, Price: 2500, Currency: "USD"},
+	} {
+		assert.NoError(t, repo.SetCatalogItem(t.Context(), &item))
+	}
+	for _, item := range []structsUFUT.ItemRequestRMP{
+		{UserID: "u1", ItemID: "book", Quantity: 2},
+		{UserID: "u1", ItemID: "lamp", Quantity: 1},
+	} {
+		assert.NoError(t, repo.AddToCart(t.Context(), &item))
+	}
+	c1, err := srvc.PlaceOrder(t.Context(), "u1", "")
+	assert.NoError(t, err)
+	_, err = srvc.PlaceOrder(t.Context(), "u2", "")
+	assert.Error(t, err)
+
+	// the reservation request is published from the outbox once the broker accepts it
+	writer := &testWriter{fail: errors.New("broker unavailable")}
+	relay := sqliteOutbox.NewRelay(repo.DB, map[string]sqliteOutbox.Writer{OrdersTopic: writer})
+	relay.MaxBackoff = 0
+	sent, err := relay.RelayPending(t.Context())
+	assert.NoError(t, err)
+	assert.Zero(t, sent)
+	writer.fail = nil
+	sent, err = relay.RelayPending(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	sent, err = relay.RelayPending(t.Context())
+	assert.NoError(t, err)
+	assert.Zero(t, sent)
+	assert.Len(t, writer.msgs, 1)
+	request, err := eventsUFUT.Decode[structsUFUT.ShoppingCartRMP](writer.msgs[0])
+	assert.NoError(t, err)
+	assert.Equal(t, eventsUFUT.ReservationRequested, request.Type)
+	assert.Equal(t, c1, request.CorrelationID)
+	assert.Equal(t, "u1", request.Payload.UserID)
+	assert.Equal(t, []int{2, 1}, request.Payload.Quantities)
+
+	p, err := srvc.PlacementStatus(t.Context(), c1, "u1")
+	assert.NoError(t, err)
+	assert.Equal(t, structsUFUT.PlacementPending, p.Status)
+	assert.Equal(t, structsUFUT.SagaReserving, p.Step)
+	assert.Equal(t, []string{"book", "lamp"}, p.ItemsID)
+	_, err = srvc.PlacementStatus(t.Context(), c1, "u2")
+	assert.Error(t, err)
+
+	// added while inventory was reserving, must stay in the cart
+	assert.NoError(t, repo.AddToCart(t.Context(), &structsUFUT.ItemRequestRMP{UserID: "u1", ItemID: "book", Quantity: 1}))
+	// notifications of other kinds share the topic
+	moderated, err := eventsUFUT.NewMessage(eventsUFUT.ItemModerated, "catalog_service", "", "s1",
+		structsUFUT.ModerationNotification{Action: "itemModerated", SellerID: "s1"})
+	assert.NoError(t, err)
+	assert.NoError(t, srvc.handleInventoryMsg(t.Context(), moderated))
+	msg := inventoryMsg(t, c1, structsUFUT.InventoryOrderNotification{
+		ItemsAvailability: []bool{true, false}, ItemsIDs: []string{"book", "lamp"}})
+	assert.NoError(t, srvc.handleInventoryMsg(t.Context(), msg))
+	// redelivered result doesn't place the order twice
+	assert.NoError(t, srvc.handleInventoryMsg(t.Context(), msg))
+
+	p, err = srvc.PlacementStatus(t.Context(), c1, "u1")
+	assert.NoError(t, err)
+	assert.Equal(t, structsUFUT.PlacementPlaced, p.Status)
+	assert.Equal(t, structsUFUT.SagaDone, p.Step)
+	assert.NotEmpty(t, p.OrderID)
+	assert.Equal(t, int64(1), p.OrderNumber)
+	assert.Equal(t, []bool{true, false}, p.ItemsAvailability)
+	orders, err := srvc.UserOrders(t.Context(), &structsUFUT.OrderRequestRMP{UserID: "u1"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{p.OrderID}, orders.OrderID)
+	assert.Equal(t, []int64{1}, orders.OrderNumbers)
+	assert.Equal(t, []string{"CREATED"}, orders.Status)
+	cart, err := repo.ListCart(t.Context(), "u1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"book", "lamp"}, cart.ItemsID)
+	assert.Equal(t, []int{1, 1}, cart.Quantities)
+
+	c2, err := srvc.PlaceOrder(t.Context(), "u1", "")
+	assert.NoError(t, err)
+	assert.NoError(t, srvc.handleInventoryMsg(t.Context(), inventoryMsg(t, c2, structsUFUT.InventoryOrderNotification{
+		ItemsAvailability: []bool{false, false}, ItemsIDs: cart.ItemsID})))
+	p, err = srvc.PlacementStatus(t.Context(), c2, "u1")
+	assert.NoError(t, err)
+	assert.Equal(t, structsUFUT.PlacementFailed, p.Status)
+	// nothing was reserved, so there is nothing to release
+	assert.Equal(t, structsUFUT.SagaCompensated, p.Step)
+	assert.Zero(t, p.OrderID)
+	cart, err = repo.ListCart(t.Context(), "u1")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 1}, cart.Quantities)
+
+	// an item without a price isn't sold for nothing, its reservation is released
+	assert.NoError(t, repo.AddToCart(t.Context(), &structsUFUT.ItemRequestRMP{UserID: "u1", ItemID: "pen", Quantity: 1}))
+	c3, err := srvc.PlaceOrder(t.Context(), "u1", "")
+	assert.NoError(t, err)
+	assert.NoError(t, srvc.handleInventoryMsg(t.Context(), inventoryMsg(t, c3, structsUFUT.InventoryOrderNotification{
+		ItemsAvailability: []bool{true, true, true}, ItemsIDs: []string{"book", "lamp", "pen"}})))
+	p, err = srvc.PlacementStatus(t.Context(), c3, "u1")
+	assert.NoError(t, err)
+	assert.Equal(t, structsUFUT.PlacementFailed, p.Status)
+	assert.Equal(t, structsUFUT.SagaReleasing, p.Step)
+	assert.Equal(t, "price of a reserved item is unknown", p.LastError)
+	assert.Zero(t, p.OrderID)
+}
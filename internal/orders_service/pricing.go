@@ -0,0 +1,290 @@
+package orders_service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	funcsUFUT "ufut/lib/funcs"
+	structsUFUT "ufut/lib/structs"
+)
+
+var (
+	ErrInvalidPricingRules = errors.New("invalid pricing rules")
+	ErrUnknownRegion       = errors.New("no pricing rules for the region")
+)
+
+// maxBps is 100% in basis points
+const maxBps = 10000
+
+/*
+Reads pricing rules from the JSON file at path
+*/
+func LoadPricingRules(path string) (*structsUFUT.PricingRulesRMP, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules structsUFUT.PricingRulesRMP
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, errors.Join(ErrInvalidPricingRules, err)
+	}
+	return &rules, nil
+}
+
+/*
+Sets the rules quotes are computed with; nil charges neither shipping nor taxes and gives no discounts
+*/
+func (s *Service) SetPricingRules(rules *structsUFUT.PricingRulesRMP) error {
+	if rules != nil {
+		if err := validatePricingRules(rules); err != nil {
+			return err
+		}
+	}
+	s.pricing = rules
+	return nil
+}
+
+func validatePricingRules(rules *structsUFUT.PricingRulesRMP) error {
+	for _, region := range rules.Regions {
+		if region.ShippingFee < 0 || region.FreeShippingFrom < 0 {
+			return ErrInvalidPricingRules
+		}
+		for _, rate := range region.TaxRates {
+			if rate < 0 || rate > maxBps {
+				return ErrInvalidPricingRules
+			}
+		}
+	}
+	for _, d := range rules.LineDiscounts {
+		if d.PercentBps < 0 || d.PercentBps > maxBps || d.MinQuantity < 0 {
+			return ErrInvalidPricingRules
+		}
+	}
+	for _, p := range rules.Promotions {
+		if p.PercentBps < 0 || p.PercentBps > maxBps || p.Amount < 0 || p.MinSubtotal < 0 {
+			return ErrInvalidPricingRules
+		}
+	}
+	return nil
+}
+
+/*
+Returns the rules of the region, regions that aren't listed use the "" region.
+Without rules for regions every region is charged nothing
+*/
+func regionRules(rules *structsUFUT.PricingRulesRMP, region string) (structsUFUT.RegionRulesRMP, error) {
+	if rules == nil || len(rules.Regions) == 0 {
+		return structsUFUT.RegionRulesRMP{}, nil
+	}
+	if r, ok := rules.Regions[region]; ok {
+		return r, nil
+	}
+	if r, ok := rules.Regions[""]; ok {
+		return r, nil
+	}
+	return structsUFUT.RegionRulesRMP{}, ErrUnknownRegion
+}
+
+func taxRate(r structsUFUT.RegionRulesRMP, category string) int64 {
+	if rate, ok := r.TaxRates[category]; ok {
+		return rate
+	}
+	return r.TaxRates[""]
+}
+
+// applyBps returns rate of amount rounded half up
+func applyBps(amount, rate int64) int64 {
+	return (amount*rate + maxBps/2) / maxBps
+}
+
+// allocate spreads amount over weights in proportion to them, the rounding remainder goes to the last positive weight
+func allocate(amount int64, weights []int64) []int64 {
+	shares := make([]int64, len(weights))
+	var total int64
+	last := -1
+	for i, w := range weights {
+		total += w
+		if w > 0 {
+			last = i
+		}
+	}
+	if last < 0 {
+		return shares
+	}
+	left := amount
+	for i, w := range weights {
+		if i != last {
+			shares[i] = amount * w / total
+			left -= shares[i]
+		}
+	}
+	shares[last] = left
+	return shares
+}
+
+/*
+Computes the checkout totals of the priced cart for the region; prices give category and seller of the items.
+Line discounts come first, the order promotion and then the coupon (nil for none) are spread over the lines
+in proportion to what is left of them, so each line is taxed on what is actually paid for it.
+Every amount is rounded once, totals add up exactly
+*/
+func computeQuote(rules *structsUFUT.PricingRulesRMP, region string, priced *structsUFUT.PricedCartRMP, prices map[string]structsUFUT.CatalogPriceRMP, coupon *structsUFUT.CouponRMP) (*structsUFUT.QuoteRMP, error) {
+	regional, err := regionRules(rules, region)
+	if err != nil {
+		return nil, err
+	}
+	if rules == nil {
+		rules = &structsUFUT.PricingRulesRMP{}
+	}
+	q := &structsUFUT.QuoteRMP{
+		Region:        region,
+		Currency:      priced.Currency,
+		Lines:         []structsUFUT.QuoteLineRMP{},
+		UnpricedItems: []string{},
+	}
+	for i, itemID := range priced.ItemsID {
+		if priced.UnitPrices[i] == nil {
+			q.UnpricedItems = append(q.UnpricedItems, itemID)
+			continue
+		}
+		line := structsUFUT.QuoteLineRMP{
+			ItemID:    itemID,
+			Category:  prices[itemID].Category,
+			SellerID:  prices[itemID].SellerID,
+			Quantity:  priced.Quantities[i],
+			UnitPrice: *priced.UnitPrices[i],
+		}
+		line.Subtotal = line.UnitPrice * int64(line.Quantity)
+		for _, d := range rules.LineDiscounts {
+			if (d.Category != "" && d.Category != line.Category) || (d.Region != "" && d.Region != region) ||
+				line.Quantity < d.MinQuantity {
+				continue
+			}
+			if amount := applyBps(line.Subtotal, d.PercentBps); amount > line.Discount {
+				line.Discount, line.DiscountName = amount, d.Name
+			}
+		}
+		q.Subtotal += line.Subtotal
+		q.LineDiscounts += line.Discount
+		q.Lines = append(q.Lines, line)
+	}
+	merchandise := q.Subtotal - q.LineDiscounts
+	for _, p := range rules.Promotions {
+		if (p.Region != "" && p.Region != region) || merchandise <= 0 || merchandise < p.MinSubtotal {
+			continue
+		}
+		if amount := min(applyBps(merchandise, p.PercentBps)+p.Amount, merchandise); amount > q.Promotion {
+			q.Promotion, q.PromotionName = amount, p.Name
+		}
+	}
+	weights := make([]int64, len(q.Lines))
+	for i, line := range q.Lines {
+		weights[i] = line.Subtotal - line.Discount
+	}
+	for i, share := range allocate(q.Promotion, weights) {
+		q.Lines[i].Promotion = share
+	}
+	if coupon != nil {
+		applyCoupon(q, coupon)
+	}
+	for i := range q.Lines {
+		line := &q.Lines[i]
+		paid := line.Subtotal - line.Discount - line.Promotion - line.Coupon
+		line.TaxRateBps = taxRate(regional, line.Category)
+		line.Tax = applyBps(paid, line.TaxRateBps)
+		line.Total = paid + line.Tax
+		q.Tax += line.Tax
+	}
+	if len(q.Lines) > 0 && !(regional.FreeShippingFrom > 0 && merchandise >= regional.FreeShippingFrom) {
+		q.Shipping = regional.ShippingFee
+		q.ShippingTax = applyBps(q.Shipping, regional.TaxRates[""])
+	}
+	q.Total = merchandise - q.Promotion - q.Coupon + q.Shipping + q.ShippingTax + q.Tax
+	return q, nil
+}
+
+/*
+Spreads the coupon discount over the lines it applies to, what is left of them after the promotion must reach
+the coupon minimum. A coupon that gives no discount is kept in the quote with the reason in CouponError
+*/
+func applyCoupon(q *structsUFUT.QuoteRMP, coupon *structsUFUT.CouponRMP) {
+	q.CouponCode = coupon.Code
+	weights := make([]int64, len(q.Lines))
+	var eligible, base int64
+	for i, line := range q.Lines {
+		if (len(coupon.Categories) > 0 && !slices.Contains(coupon.Categories, line.Category)) ||
+			(len(coupon.SellerIDs) > 0 && !slices.Contains(coupon.SellerIDs, line.SellerID)) {
+			continue
+		}
+		weights[i] = line.Subtotal - line.Discount - line.Promotion
+		base += weights[i]
+		eligible++
+	}
+	switch {
+	case eligible == 0:
+		q.CouponError = ErrCouponNotApplicable.Error()
+		return
+	case base <= 0 || base < coupon.MinSubtotal:
+		q.CouponError = ErrCouponMinSubtotal.Error()
+		return
+	}
+	q.Coupon = min(applyBps(base, coupon.PercentBps)+coupon.Amount, base)
+	for i, share := range allocate(q.Coupon, weights) {
+		q.Lines[i].Coupon = share
+	}
+}
+
+/*
+Quotes the cart in the default currency for the region with the coupon of code (empty for none);
+the redemption of correlationID doesn't count against the limits of the coupon
+*/
+func (s *Service) quoteCart(ctx context.Context, cart *structsUFUT.ShoppingCartRMP, region, code, correlationID string) (*structsUFUT.QuoteRMP, error) {
+	prices, err := s.repo.CatalogPrices(ctx, cart.ItemsID)
+	if err != nil {
+		return nil, err
+	}
+	var coupon *structsUFUT.CouponRMP
+	var rejection error
+	if code != "" {
+		coupon, err = s.usableCoupon(ctx, code, cart.UserID, correlationID)
+		if err != nil && !slices.Contains(couponRejections, err) {
+			return nil, err
+		}
+		rejection = err
+	}
+	q, err := computeQuote(s.pricing, region, s.priceLines(cart, prices, s.defaultCurrency()), prices, coupon)
+	if err != nil {
+		return nil, err
+	}
+	if rejection != nil {
+		q.CouponCode, q.CouponError = code, rejection.Error()
+	}
+	return q, nil
+}
+
+/*
+Returns the checkout totals of the user's cart shipped to region with the coupon applied to the cart,
+placing the order for the same cart and region persists the same breakdown as long as prices and rules don't change.
+A currency other than the service one (empty for it) converts the breakdown for display, see convertQuote
+*/
+func (s *Service) Quote(ctx context.Context, userID, region, currency string) (*structsUFUT.QuoteRMP, error) {
+	cart, err := s.repo.ListCart(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	code, err := s.repo.CartCoupon(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	q, err := s.quoteCart(ctx, cart, strings.TrimSpace(region), code, "")
+	if err != nil || currency == "" {
+		return q, err
+	}
+	if currency, err = funcsUFUT.NormalizeCurrency(currency); err != nil {
+		return nil, err
+	}
+	return s.convertQuote(q, currency)
+}
@@ -0,0 +1,99 @@
+package orders_service
+
+import (
+	"testing"
+	structsUFUT "ufut/lib/structs"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestService_Quote(t *testing.T) {
+	srvc, repo := CreateOrdersService(t)
+	assert.ErrorIs(t, srvc.SetPricingRules(&structsUFUT.PricingRulesRMP{
+		Promotions: []structsUFUT.PromotionRuleRMP{{Name: "too much", PercentBps: 12000}},
+	}), ErrInvalidPricingRules)
+	assert.NoError(t, srvc.SetPricingRules(&structsUFUT.PricingRulesRMP{
+		Regions: map[string]structsUFUT.RegionRulesRMP{
+			"EU": {ShippingFee: 500, FreeShippingFrom: 10000, TaxRates: map[string]int64{"": 2000, "books": 500}},
+		},
+		LineDiscounts: []structsUFUT.LineDiscountRuleRMP{
+			{Name: "bulk books", Category: "books", MinQuantity: 3, PercentBps: 1000},
+			{Name: "bulk", MinQuantity: 5, PercentBps: 500},
+		},
+		Promotions: []structsUFUT.PromotionRuleRMP{
+			{Name: "eu welcome", Region: "EU", MinSubtotal: 2000, Amount: 300},
+			{Name: "us welcome", Region: "US", MinSubtotal: 2000, PercentBps: 5000},
+		},
+	}))
+	for _, item := range []structsUFUT.ItemDataRSC{
+		{ItemID: "book", Status: structsUFUT.ItemStatusAvailable, Version: 1, Price: 1000, Currency: "USD", Category: "books"},
+		{ItemID: "lamp", Status: structsUFUT.ItemStatusAvailable, Version: 1, Price: 2500, Currency: "USD", Category: "home"},
+	} {
+		assert.NoError(t, repo.SetCatalogItem(t.Context(), &item))
+	}
+	for itemID, quantity := range map[string]int{"book": 3, "lamp": 1, "unknown": 1} {
+		err := repo.AddToCart(t.Context(), &structsUFUT.ItemRequestRMP{UserID: "u1", ItemID: itemID, Quantity: quantity})
+		assert.NoError(t, err)
+	}
+
+	_, err := srvc.Quote(t.Context(), "u1", "US", "")
+	assert.ErrorIs(t, err, ErrUnknownRegion)
+	_, err = srvc.PlaceOrder(t.Context(), "u1", "US")
+	assert.ErrorIs(t, err, ErrUnknownRegion)
+
+	quote, err := srvc.Quote(t.Context(), "u1", " EU ", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "EU", quote.Region)
+	assert.Equal(t, "USD", quote.Currency)
+	assert.Equal(t, []string{"unknown"}, quote.UnpricedItems)
+	assert.Equal(t, []structsUFUT.QuoteLineRMP{
+		// 10% off 3000, 2700/5200 of the promotion, 5% tax on the rest
+		{ItemID: "book", Category: "books", Quantity: 3, UnitPrice: 1000, Subtotal: 3000, Discount: 300, DiscountName: "bulk books",
+			Promotion: 155, TaxRateBps: 500, Tax: 127, Total: 2672},
+		{ItemID: "lamp", Category: "home", Quantity: 1, UnitPrice: 2500, Subtotal: 2500,
+			Promotion: 145, TaxRateBps: 2000, Tax: 471, Total: 2826},
+	}, quote.Lines)
+	assert.Equal(t, int64(5500), quote.Subtotal)
+	assert.Equal(t, int64(300), quote.LineDiscounts)
+	assert.Equal(t, int64(300), quote.Promotion)
+	assert.Equal(t, "eu welcome", quote.PromotionName)
+	assert.Equal(t, int64(500), quote.Shipping)
+	assert.Equal(t, int64(100), quote.ShippingTax)
+	assert.Equal(t, int64(598), quote.Tax)
+	assert.Equal(t, int64(6098), quote.Total)
+
+	// the order keeps exactly the quoted breakdown, items without a price can't be ordered
+	assert.NoError(t, srvc.RemoveFromCart(t.Context(), &structsUFUT.ItemRequestRMP{UserID: "u1", ItemID: "unknown"}))
+	quote, err = srvc.Quote(t.Context(), "u1", "EU", "")
+	assert.NoError(t, err)
+	assert.Empty(t, quote.UnpricedItems)
+	assert.Equal(t, int64(6098), quote.Total)
+	correlationID, err := srvc.PlaceOrder(t.Context(), "u1", "EU")
+	assert.NoError(t, err)
+	cart, err := repo.ListCart(t.Context(), "u1")
+	assert.NoError(t, err)
+	assert.NoError(t, srvc.handleInventoryMsg(t.Context(), inventoryMsg(t, correlationID, structsUFUT.InventoryOrderNotification{
+		ItemsAvailability: []bool{true, true}, ItemsIDs: cart.ItemsID})))
+	p, err := srvc.PlacementStatus(t.Context(), correlationID, "u1")
+	assert.NoError(t, err)
+	assert.Equal(t, structsUFUT.PlacementPlaced, p.Status)
+	assert.Equal(t, "EU", p.Region)
+	assert.Equal(t, quote, p.Quote)
+	detail, err := srvc.OrderDetail(t.Context(), &structsUFUT.OrderRequestRMP{UserID: "u1", OrderID: p.OrderID})
+	assert.NoError(t, err)
+	assert.Equal(t, quote, detail.Quote)
+
+	// shipping is waived from the threshold, the largest line discount wins
+	price := int64(2500)
+	free, err := computeQuote(srvc.pricing, "EU", &structsUFUT.PricedCartRMP{
+		Currency:   "USD",
+		ItemsID:    []string{"lamp"},
+		Quantities: []int{5},
+		UnitPrices: []*int64{&price},
+	}, map[string]structsUFUT.CatalogPriceRMP{"lamp": {Price: price, Currency: "USD", Category: "home"}}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "bulk", free.Lines[0].DiscountName)
+	assert.Equal(t, int64(625), free.LineDiscounts)
+	assert.Zero(t, free.Shipping)
+	assert.Equal(t, free.Subtotal-free.LineDiscounts-free.Promotion+free.Tax, free.Total)
+}
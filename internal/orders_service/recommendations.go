@@ -0,0 +1,134 @@
+package orders_service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+	eventsUFUT "ufut/lib/events"
+	structsUFUT "ufut/lib/structs"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	// DefaultRecommendations is used when recommendations request doesn't specify count
+	DefaultRecommendations = 10
+	// MaxRecommendations limits count of recommendations request
+	MaxRecommendations = 50
+)
+
+func recommendationsCount(count int) int {
+	if count <= 0 {
+		return DefaultRecommendations
+	}
+	return min(count, MaxRecommendations)
+}
+
+func (s *Service) RelatedItems(ctx context.Context, itemID string, count int) (*structsUFUT.RecommendationsRMP, error) {
+	ids, err := s.repo.RelatedItems(ctx, itemID, recommendationsCount(count))
+	if err != nil {
+		return nil, err
+	}
+	return &structsUFUT.RecommendationsRMP{ItemsIDs: ids}, nil
+}
+
+func (s *Service) RecommendedItems(ctx context.Context, userID string, count int) (*structsUFUT.RecommendationsRMP, error) {
+	ids, err := s.repo.RecommendedItems(ctx, userID, recommendationsCount(count))
+	if err != nil {
+		return nil, err
+	}
+	return &structsUFUT.RecommendationsRMP{ItemsIDs: ids}, nil
+}
+
+/*
+Recomputes co-purchase scores right away and then every interval until ctx is cancelled
+*/
+func (s *Service) RunRecommendations(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		start := time.Now()
+		if err := s.repo.RecomputeCoPurchases(ctx); err != nil {
+			log.Printf("recompute co-purchases: %v\n", err)
+		} else {
+			log.Printf("co-purchases recomputed in %v\n", time.Since(start))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+/*
+Tracks catalog statuses, so deleted or out of stock items aren't recommended,
+and prices the cart is quoted with
+*/
+func (s *Service) handleCatalogMsg(ctx context.Context, msg kafka.Message) error {
+	event, err := eventsUFUT.Decode[structsUFUT.ItemDataRSC](msg)
+	if err != nil {
+		log.Printf("skip catalog event: %v\n", err)
+		return nil
+	}
+	switch event.Type {
+	case eventsUFUT.ItemCreated, eventsUFUT.ItemUpdated, eventsUFUT.ItemDeleted:
+		return s.repo.SetCatalogItem(ctx, &event.Payload)
+	}
+	return nil
+}
+
+/*
+Consumes catalog events until ctx is cancelled
+*/
+func (s *Service) ServeCatalogKafka(ctx context.Context, reader *kafka.Reader) error {
+	return serveReader(ctx, reader, s.handleCatalogMsg)
+}
+
+// messageReader is the part of *kafka.Reader consumers use
+type messageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// handleRetryBackoff is the first delay before a failed message is handled again, doubled up to a minute
+var handleRetryBackoff = time.Second
+
+/*
+Handles messages of reader in order and commits each once it's handled.
+A message that fails is retried until it's handled or ctx is cancelled, committing later messages
+would commit it too
+*/
+func serveReader(ctx context.Context, reader messageReader, handle func(context.Context, kafka.Message) error) error {
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				return err
+			}
+			log.Printf("fetch error: %v\n", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		backoff := handleRetryBackoff
+		for {
+			err := handle(ctx, msg)
+			if err == nil {
+				break
+			}
+			log.Printf("handle error, retry in %v: %v\n", backoff, err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, time.Minute)
+		}
+
+		if err := reader.CommitMessages(ctx, msg); err != nil {
+			log.Printf("commit error: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package orders_service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+	"time"
+	sqliteRepoOrders "ufut/internal/sqlite/orders_service"
+	structsUFUT "ufut/lib/structs"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func CreateOrdersService(t *testing.T) (*Service, *sqliteRepoOrders.SQLiteRepo) {
+	dbFilePath := "orders_test.db"
+	db_Orders, err := sql.Open("sqlite3", dbFilePath)
+	if err != nil {
+		t.Fatalf("%v", err.Error())
+	}
+	t.Cleanup(func() {
+		db_Orders.Close()
+		os.Remove(dbFilePath)
+	})
+	repo := sqliteRepoOrders.NewSQLiteRepo(db_Orders)
+	if err := repo.CreateTables(t.Context()); err != nil {
+		t.Fatalf("%v", err.Error())
+	}
+	return NewService(repo), repo
+}
+
+func placeTestOrder(t *testing.T, repo *sqliteRepoOrders.SQLiteRepo, userID string, itemsIDs ...string) string {
+	availability := make([]bool, len(itemsIDs))
+	for i, itemID := range itemsIDs {
+		err := repo.AddToCart(t.Context(), &structsUFUT.ItemRequestRMP{UserID: userID, ItemID: itemID, Quantity: 1})
+		assert.NoError(t, err)
+		availability[i] = true
+	}
+	cart, err := repo.ListCart(t.Context(), userID)
+	assert.NoError(t, err)
+	correlationID := uuid.NewString()
+	assert.NoError(t, repo.CreatePlacement(t.Context(), &structsUFUT.PlacementRMP{
+		CorrelationID: correlationID, UserID: userID, ItemsID: cart.ItemsID, Quantities: cart.Quantities}))
+	p, err := repo.PlaceOrder(t.Context(), correlationID, []string{structsUFUT.SagaReserving}, availability, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, structsUFUT.PlacementPlaced, p.Status)
+	return p.OrderID
+}
+
+func TestService_Recommendations(t *testing.T) {
+	srvc, repo := CreateOrdersService(t)
+	placeTestOrder(t, repo, "u1", "book", "lamp", "pen")
+	placeTestOrder(t, repo, "u2", "book", "lamp")
+	placeTestOrder(t, repo, "u2", "book", "pen", "bag")
+	placeTestOrder(t, repo, "u3", "lamp", "bulb")
+	cancelled := placeTestOrder(t, repo, "u4", "book", "toy")
+	assert.NoError(t, srvc.RemoveOrder(t.Context(), &structsUFUT.OrderRequestRMP{UserID: "u4", OrderID: cancelled}))
+	assert.NoError(t, repo.RecomputeCoPurchases(t.Context()))
+
+	related, err := srvc.RelatedItems(t.Context(), "book", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"lamp", "pen", "bag"}, related.ItemsIDs)
+
+	related, err = srvc.RelatedItems(t.Context(), "book", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"lamp"}, related.ItemsIDs)
+
+	err = repo.AddToCart(t.Context(), &structsUFUT.ItemRequestRMP{UserID: "u5", ItemID: "lamp", Quantity: 1})
+	assert.NoError(t, err)
+	recommended, err := srvc.RecommendedItems(t.Context(), "u5", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"book", "bulb", "pen"}, recommended.ItemsIDs)
+
+	for _, item := range []structsUFUT.ItemDataRSC{
+		{ItemID: "pen", Status: structsUFUT.ItemStatusOutOfStock, Version: 3},
+		{ItemID: "bulb", Status: structsUFUT.ItemStatusDeleted, Version: 2},
+		// stale event doesn't bring the item back
+		{ItemID: "bulb", Status: structsUFUT.ItemStatusAvailable, Version: 1},
+		{ItemID: "bag", Status: structsUFUT.ItemStatusAvailable, Version: 1},
+	} {
+		assert.NoError(t, repo.SetCatalogItem(t.Context(), &item))
+	}
+	related, err = srvc.RelatedItems(t.Context(), "book", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"lamp", "bag"}, related.ItemsIDs)
+	recommended, err = srvc.RecommendedItems(t.Context(), "u5", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"book"}, recommended.ItemsIDs)
+
+	recommended, err = srvc.RecommendedItems(t.Context(), "u1", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bag"}, recommended.ItemsIDs)
+}
+
+// testReader serves msgs once and then blocks until the context is cancelled
+type testReader struct {
+	msgs      []kafka.Message
+	committed []string
+}
+
+func (r *testReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	if len(r.msgs) == 0 {
+		<-ctx.Done()
+		return kafka.Message{}, ctx.Err()
+	}
+	msg := r.msgs[0]
+	r.msgs = r.msgs[1:]
+	return msg, nil
+}
+
+func (r *testReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	for _, msg := range msgs {
+		r.committed = append(r.committed, string(msg.Value))
+	}
+	return nil
+}
+
+func TestServeReader_RetriesFailedMessage(t *testing.T) {
+	handleRetryBackoff = time.Millisecond
+	t.Cleanup(func() { handleRetryBackoff = time.Second })
+	reader := &testReader{msgs: []kafka.Message{{Value: []byte("m1")}, {Value: []byte("m2")}}}
+	ctx, cancel := context.WithCancel(t.Context())
+	var handled []string
+	err := serveReader(ctx, reader, func(ctx context.Context, msg kafka.Message) error {
+		handled = append(handled, string(msg.Value))
+		if len(handled) < 3 {
+			return errors.New("db is locked")
+		}
+		if len(reader.msgs) == 0 {
+			cancel()
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	// m1 is handled until it succeeds, m2 waits for it
+	assert.Equal(t, []string{"m1", "m1", "m1", "m2"}, handled)
+	assert.Equal(t, []string{"m1", "m2"}, reader.committed)
+}
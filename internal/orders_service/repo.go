@@ -3,19 +3,54 @@ package orders_service
 import (
 	"context"
 	structsUFUT "ufut/lib/structs"
+
+	"github.com/segmentio/kafka-go"
 )
 
 type Repository interface {
-	PlaceOrder(ctx context.Context, userID string, availability []bool) error
-	RemoveOrder(ctx context.Context, req *structsUFUT.OrderRequestRMP) error
+	CreatePlacement(ctx context.Context, p *structsUFUT.PlacementRMP, events ...kafka.Message) error
+	Placement(ctx context.Context, correlationID, userID string) (*structsUFUT.PlacementRMP, error)
+	Saga(ctx context.Context, correlationID string) (*structsUFUT.PlacementRMP, error)
+	Sagas(ctx context.Context, req *structsUFUT.SagasRequestRMP) ([]structsUFUT.PlacementRMP, error)
+	TransitSaga(ctx context.Context, correlationID string, t *structsUFUT.SagaTransitionRMP, events ...kafka.Message) (*structsUFUT.PlacementRMP, error)
+	PlaceOrder(ctx context.Context, correlationID string, from []string, availability []bool, quote *structsUFUT.QuoteRMP) (*structsUFUT.PlacementRMP, error)
+	OrderCorrelationID(ctx context.Context, req *structsUFUT.OrderRequestRMP) (string, error)
+	ChangeOrderStatus(ctx context.Context, change *structsUFUT.OrderStatusChangeRMP, events ...kafka.Message) (bool, error)
+	OrderDetail(ctx context.Context, req *structsUFUT.OrderRequestRMP) (*structsUFUT.OrderDetailRMP, error)
+	OrderHistory(ctx context.Context, req *structsUFUT.OrderRequestRMP) ([]structsUFUT.OrderStatusChangeRMP, error)
 	OrderStatus(ctx context.Context, req *structsUFUT.OrderRequestRMP) error
+	OrderOwner(ctx context.Context, orderID string) (string, error)
 	UserOrders(ctx context.Context, req *structsUFUT.OrderRequestRMP) (*structsUFUT.OrdersResponseRMP, error)
 	ItemsIDsByOrderID(ctx context.Context, req *structsUFUT.OrderRequestRMP) (*structsUFUT.ShoppingCartRMP, error)
 
+	ReserveIdempotencyKey(ctx context.Context, rec *structsUFUT.IdempotencyRecordRMP, expiredBefore, abandonedBefore int64) (*structsUFUT.IdempotencyRecordRMP, error)
+	StoreIdempotentResponse(ctx context.Context, rec *structsUFUT.IdempotencyRecordRMP) error
+	ReleaseIdempotencyKey(ctx context.Context, userID, key string) error
+
 	AddToCart(ctx context.Context, req *structsUFUT.ItemRequestRMP) error
 	RemoveFromCart(ctx context.Context, req *structsUFUT.ItemRequestRMP) error
 	IncreaseItemQuantity(ctx context.Context, req *structsUFUT.ItemRequestRMP) error
 	DecreaseItemQuantity(ctx context.Context, req *structsUFUT.ItemRequestRMP) error
 	ListCart(ctx context.Context, userID string) (*structsUFUT.ShoppingCartRMP, error)
 	ClearCart(ctx context.Context, UserID string) error
+
+	CreateCoupon(ctx context.Context, c *structsUFUT.CouponRMP) (bool, error)
+	UpdateCoupon(ctx context.Context, c *structsUFUT.CouponRMP) (bool, error)
+	DeleteCoupon(ctx context.Context, code string) (bool, error)
+	Coupon(ctx context.Context, code string) (*structsUFUT.CouponRMP, error)
+	Coupons(ctx context.Context) ([]structsUFUT.CouponRMP, error)
+	CouponUsage(ctx context.Context, code, userID, exceptCorrelationID string) (int, int, error)
+	RedeemCoupon(ctx context.Context, red *structsUFUT.CouponRedemptionRMP) (bool, error)
+	SetCartCoupon(ctx context.Context, userID, code string) error
+	CartCoupon(ctx context.Context, userID string) (string, error)
+	RemoveCartCoupon(ctx context.Context, userID string) error
+
+	RecomputeCoPurchases(ctx context.Context) error
+	SetCatalogItem(ctx context.Context, item *structsUFUT.ItemDataRSC) error
+	RelatedItems(ctx context.Context, itemID string, count int) ([]string, error)
+	RecommendedItems(ctx context.Context, userID string, count int) ([]string, error)
+
+	CatalogPrices(ctx context.Context, itemsIDs []string) (map[string]structsUFUT.CatalogPriceRMP, error)
+	ExchangeRates(ctx context.Context) (*structsUFUT.ExchangeRatesRSC, error)
+	SetExchangeRates(ctx context.Context, table *structsUFUT.ExchangeRatesRSC) error
 }
@@ -0,0 +1,307 @@
+package orders_service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"time"
+	eventsUFUT "ufut/lib/events"
+	structsUFUT "ufut/lib/structs"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	// DefaultReserveTimeout is how long the saga waits for inventory to reserve the items
+	DefaultReserveTimeout = time.Minute
+	// DefaultPaymentTimeout is how long the saga waits for the payment
+	DefaultPaymentTimeout = 15 * time.Minute
+	// DefaultReleaseTimeout is how long the saga waits for inventory to release the items before it is STUCK
+	DefaultReleaseTimeout = time.Minute
+	// DefaultSagasPerPage is used when Sagas request doesn't specify count
+	DefaultSagasPerPage = 50
+	// MaxSagasPerPage limits count of Sagas request and sagas expired by one pass
+	MaxSagasPerPage = 200
+
+	// PaymentsTopic names the outbox relay writer of payment requests
+	PaymentsTopic = "payments"
+)
+
+var (
+	ErrNotOperator  = errors.New("not allowed to operate orders")
+	ErrSagaFinished = errors.New("saga is finished and can't be retried")
+)
+
+// steps waiting for a reply, they expire once their deadline has passed
+var activeSagaSteps = []string{structsUFUT.SagaReserving, structsUFUT.SagaPaying, structsUFUT.SagaReleasing}
+
+/*
+Timeouts of the saga steps, zero fields use the defaults
+*/
+type SagaTimeouts struct {
+	Reserve time.Duration
+	Payment time.Duration
+	Release time.Duration
+}
+
+func (s *Service) SetSagaTimeouts(timeouts SagaTimeouts) {
+	s.timeouts = timeouts
+}
+
+func (s *Service) sagaTimeouts() SagaTimeouts {
+	t := s.timeouts
+	if t.Reserve == 0 {
+		t.Reserve = DefaultReserveTimeout
+	}
+	if t.Payment == 0 {
+		t.Payment = DefaultPaymentTimeout
+	}
+	if t.Release == 0 {
+		t.Release = DefaultReleaseTimeout
+	}
+	return t
+}
+
+/*
+Enables the payment step of the checkout saga; without it orders are placed once the items are reserved
+*/
+func (s *Service) SetPayments(enabled bool) {
+	s.payments = enabled
+}
+
+/*
+Sets staff IDs allowed to inspect and retry sagas and to fulfil orders; empty allows nobody
+*/
+func (s *Service) SetOperators(ids []string) {
+	s.operators = ids
+}
+
+func (s *Service) isOperator(staffID string) bool {
+	return slices.Contains(s.operators, staffID)
+}
+
+func (s *Service) reserveMessage(correlationID string, cart *structsUFUT.ShoppingCartRMP) (kafka.Message, error) {
+	msg, err := eventsUFUT.NewMessage(eventsUFUT.ReservationRequested, eventsProducer, correlationID, correlationID, cart)
+	msg.Topic = OrdersTopic
+	return msg, err
+}
+
+/*
+Inventory releases what it has reserved for the correlation ID, items are informative only
+*/
+func (s *Service) releaseMessage(correlationID string, items *structsUFUT.ShoppingCartRMP) (kafka.Message, error) {
+	msg, err := eventsUFUT.NewMessage(eventsUFUT.ReleaseRequested, eventsProducer, correlationID, correlationID, items)
+	msg.Topic = OrdersTopic
+	return msg, err
+}
+
+func (s *Service) paymentMessage(p *structsUFUT.PlacementRMP) (kafka.Message, error) {
+	msg, err := eventsUFUT.NewMessage(eventsUFUT.PaymentRequested, eventsProducer, p.CorrelationID, p.CorrelationID,
+		structsUFUT.PaymentRequestRMP{UserID: p.UserID, Amount: p.Total, Currency: p.Currency})
+	msg.Topic = PaymentsTopic
+	return msg, err
+}
+
+func (s *Service) refundMessage(p *structsUFUT.PlacementRMP) (kafka.Message, error) {
+	msg, err := eventsUFUT.NewMessage(eventsUFUT.RefundRequested, eventsProducer, p.CorrelationID, p.CorrelationID,
+		structsUFUT.PaymentRequestRMP{UserID: p.UserID, Amount: p.Total, Currency: p.Currency})
+	msg.Topic = PaymentsTopic
+	return msg, err
+}
+
+/*
+Fails the saga and asks inventory to release the reservation;
+the saga is COMPENSATED once inventory confirms the release
+*/
+func (s *Service) compensate(ctx context.Context, correlationID string, from []string, availability []bool, reason string) (*structsUFUT.PlacementRMP, error) {
+	p, err := s.repo.Saga(ctx, correlationID)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := s.releaseMessage(correlationID, &structsUFUT.ShoppingCartRMP{
+		UserID: p.UserID, ItemsID: p.ItemsID, Quantities: p.Quantities})
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.TransitSaga(ctx, correlationID, &structsUFUT.SagaTransitionRMP{
+		From:              from,
+		Step:              structsUFUT.SagaReleasing,
+		Status:            structsUFUT.PlacementFailed,
+		DeadlineAt:        s.deadline(s.sagaTimeouts().Release),
+		LastError:         reason,
+		ItemsAvailability: availability,
+	}, msg)
+}
+
+/*
+Requests the refund of a payment made after the saga stopped waiting for it and parks the saga STUCK,
+so operators see the refund; the release of the items goes on as before
+*/
+func (s *Service) refundLatePayment(ctx context.Context, p *structsUFUT.PlacementRMP) (*structsUFUT.PlacementRMP, error) {
+	msg, err := s.refundMessage(p)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.TransitSaga(ctx, p.CorrelationID, &structsUFUT.SagaTransitionRMP{
+		From: []string{structsUFUT.SagaReserving, structsUFUT.SagaReleasing, structsUFUT.SagaCompensated,
+			structsUFUT.SagaStuck},
+		Step:      structsUFUT.SagaStuck,
+		LastError: "payment made in step " + p.Step + ", refund requested; " + p.LastError,
+	}, msg)
+}
+
+/*
+Places the order once the payment is made, releases the items if it failed.
+A payment made after the saga failed is refunded
+*/
+func (s *Service) handlePaymentMsg(ctx context.Context, msg kafka.Message) error {
+	event, err := eventsUFUT.Decode[structsUFUT.PaymentResultRMP](msg)
+	if err != nil {
+		log.Printf("skip payment result: %v\n", err)
+		return nil
+	}
+	from := []string{structsUFUT.SagaPaying}
+	var p *structsUFUT.PlacementRMP
+	switch event.Type {
+	case eventsUFUT.PaymentSucceeded:
+		p, err = s.repo.PlaceOrder(ctx, event.CorrelationID, from, nil, nil)
+		if err == nil && p.Step != structsUFUT.SagaDone {
+			p, err = s.refundLatePayment(ctx, p)
+		}
+	case eventsUFUT.PaymentFailed:
+		p, err = s.compensate(ctx, event.CorrelationID, from, nil, "payment failed: "+event.Payload.Reason)
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("checkout saga %s: %s %s\n", p.CorrelationID, p.Status, p.Step)
+	return nil
+}
+
+/*
+Consumes payment results until ctx is cancelled
+*/
+func (s *Service) ServePaymentsKafka(ctx context.Context, reader *kafka.Reader) error {
+	return serveReader(ctx, reader, s.handlePaymentMsg)
+}
+
+/*
+Compensates sagas whose reservation or payment step has timed out,
+sagas whose release has timed out are left STUCK for an operator. Returns the number of expired sagas
+*/
+func (s *Service) ExpireSagas(ctx context.Context) (int, error) {
+	expired, err := s.repo.Sagas(ctx, &structsUFUT.SagasRequestRMP{
+		Steps:         activeSagaSteps,
+		ExpiredBefore: time.Now().Unix() + 1,
+		Count:         MaxSagasPerPage,
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, p := range expired {
+		from := []string{p.Step}
+		switch p.Step {
+		case structsUFUT.SagaReserving:
+			_, err = s.compensate(ctx, p.CorrelationID, from, nil, "reservation timed out")
+		case structsUFUT.SagaPaying:
+			_, err = s.compensate(ctx, p.CorrelationID, from, nil, "payment timed out")
+		case structsUFUT.SagaReleasing:
+			_, err = s.repo.TransitSaga(ctx, p.CorrelationID, &structsUFUT.SagaTransitionRMP{
+				From:      from,
+				Step:      structsUFUT.SagaStuck,
+				LastError: "release timed out after " + p.LastError,
+			})
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(expired), nil
+}
+
+/*
+Expires timed out sagas every interval until ctx is cancelled
+*/
+func (s *Service) RunSagas(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.ExpireSagas(ctx); err != nil {
+				log.Printf("expire checkout sagas: %v\n", err)
+			}
+		}
+	}
+}
+
+/*
+Returns sagas oldest deadline first. Stuck ones are STUCK or have missed their deadline
+*/
+func (s *Service) Sagas(ctx context.Context, staffID string, stuck bool, count int) (*structsUFUT.SagasResponseRMP, error) {
+	if !s.isOperator(staffID) {
+		return nil, ErrNotOperator
+	}
+	if count <= 0 {
+		count = DefaultSagasPerPage
+	}
+	req := &structsUFUT.SagasRequestRMP{Count: min(count, MaxSagasPerPage)}
+	if stuck {
+		req.Steps = []string{structsUFUT.SagaStuck}
+		stuckSagas, err := s.repo.Sagas(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		req.Steps, req.ExpiredBefore = activeSagaSteps, time.Now().Unix()
+		late, err := s.repo.Sagas(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		sagas := append(late, stuckSagas...)
+		return &structsUFUT.SagasResponseRMP{Sagas: sagas[:min(len(sagas), req.Count)]}, nil
+	}
+	sagas, err := s.repo.Sagas(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &structsUFUT.SagasResponseRMP{Sagas: sagas}, nil
+}
+
+/*
+Sends the request of the saga's current step again with a new deadline, a STUCK saga retries the release.
+Inventory and payments handle repeated requests of one correlation ID once
+*/
+func (s *Service) RetrySaga(ctx context.Context, staffID, correlationID string) (*structsUFUT.PlacementRMP, error) {
+	if !s.isOperator(staffID) {
+		return nil, ErrNotOperator
+	}
+	p, err := s.repo.Saga(ctx, correlationID)
+	if err != nil {
+		return nil, err
+	}
+	items := &structsUFUT.ShoppingCartRMP{UserID: p.UserID, ItemsID: p.ItemsID, Quantities: p.Quantities}
+	t := &structsUFUT.SagaTransitionRMP{From: []string{p.Step}, Step: p.Step, LastError: p.LastError, Retry: true}
+	var msg kafka.Message
+	switch p.Step {
+	case structsUFUT.SagaReserving:
+		msg, err = s.reserveMessage(correlationID, items)
+		t.DeadlineAt = s.deadline(s.sagaTimeouts().Reserve)
+	case structsUFUT.SagaPaying:
+		msg, err = s.paymentMessage(p)
+		t.DeadlineAt = s.deadline(s.sagaTimeouts().Payment)
+	case structsUFUT.SagaReleasing, structsUFUT.SagaStuck:
+		msg, err = s.releaseMessage(correlationID, items)
+		t.Step, t.DeadlineAt = structsUFUT.SagaReleasing, s.deadline(s.sagaTimeouts().Release)
+	default:
+		return nil, ErrSagaFinished
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.TransitSaga(ctx, correlationID, t, msg)
+}
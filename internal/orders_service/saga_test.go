@@ -0,0 +1,169 @@
+package orders_service
+
+import (
+	"testing"
+	"time"
+	sqliteOutbox "ufut/internal/sqlite/outbox"
+	eventsUFUT "ufut/lib/events"
+	structsUFUT "ufut/lib/structs"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func paymentMsg(t *testing.T, eventType, correlationID, reason string) kafka.Message {
+	msg, err := eventsUFUT.NewMessage(eventType, "payments_service", correlationID, correlationID,
+		structsUFUT.PaymentResultRMP{Reason: reason})
+	assert.NoError(t, err)
+	return msg
+}
+
+func TestService_CheckoutSaga(t *testing.T) {
+	srvc, repo := CreateOrdersService(t)
+	srvc.SetPayments(true)
+	writer := &testWriter{}
+	relay := sqliteOutbox.NewRelay(repo.DB, map[string]sqliteOutbox.Writer{OrdersTopic: writer, PaymentsTopic: writer})
+	published := func() []string {
+		writer.msgs = nil
+		_, err := relay.RelayPending(t.Context())
+		assert.NoError(t, err)
+		types := []string{}
+		for _, msg := range writer.msgs {
+			meta, err := eventsUFUT.ReadMetadata(msg)
+			assert.NoError(t, err)
+			types = append(types, meta.Type)
+		}
+		return types
+	}
+	for _, item := range []structsUFUT.ItemDataRSC{
+		{ItemID: "book", Status: structsUFUT.ItemStatusAvailable, Version: 1, Price: 1000, Currency: "USD"},
+		{ItemID: "lamp", Status: structsUFUT.ItemStatusAvailable, Version: 1, Price: 2500, Currency: "USD"},
+	} {
+		assert.NoError(t, repo.SetCatalogItem(t.Context(), &item))
+	}
+	fillCart := func(userID string) {
+		for _, item := range []structsUFUT.ItemRequestRMP{
+			{UserID: userID, ItemID: "book", Quantity: 2},
+			{UserID: userID, ItemID: "lamp", Quantity: 1},
+		} {
+			assert.NoError(t, repo.AddToCart(t.Context(), &item))
+		}
+	}
+	reserved := func(correlationID string) {
+		err := srvc.handleInventoryMsg(t.Context(), inventoryMsg(t, correlationID, structsUFUT.InventoryOrderNotification{
+			ItemsAvailability: []bool{true, false}, ItemsIDs: []string{"book", "lamp"}}))
+		assert.NoError(t, err)
+	}
+
+	// payment is requested for the reserved items only, the order is placed once it is made
+	fillCart("u1")
+	c1, err := srvc.PlaceOrder(t.Context(), "u1", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{eventsUFUT.ReservationRequested}, published())
+	reserved(c1)
+	p, err := repo.Saga(t.Context(), c1)
+	assert.NoError(t, err)
+	assert.Equal(t, structsUFUT.SagaPaying, p.Step)
+	assert.Equal(t, int64(2000), p.Total)
+	assert.Equal(t, "USD", p.Currency)
+	assert.Equal(t, []string{eventsUFUT.PaymentRequested}, published())
+	payment, err := eventsUFUT.Decode[structsUFUT.PaymentRequestRMP](writer.msgs[0])
+	assert.NoError(t, err)
+	assert.Equal(t, structsUFUT.PaymentRequestRMP{UserID: "u1", Amount: 2000, Currency: "USD"}, payment.Payload)
+	// a price change while paying doesn't change what the order was sold for
+	setBookPrice := func(version int64, price int) {
+		assert.NoError(t, repo.SetCatalogItem(t.Context(), &structsUFUT.ItemDataRSC{
+			ItemID: "book", Status: structsUFUT.ItemStatusAvailable, Version: version, Price: price, Currency: "USD"}))
+	}
+	setBookPrice(2, 1500)
+	assert.NoError(t, srvc.handlePaymentMsg(t.Context(), paymentMsg(t, eventsUFUT.PaymentSucceeded, c1, "")))
+	setBookPrice(3, 1000)
+	p, err = srvc.PlacementStatus(t.Context(), c1, "u1")
+	assert.NoError(t, err)
+	assert.Equal(t, structsUFUT.PlacementPlaced, p.Status)
+	assert.Equal(t, structsUFUT.SagaDone, p.Step)
+	assert.NotEmpty(t, p.OrderID)
+	assert.Zero(t, p.DeadlineAt)
+	detail, err := srvc.OrderDetail(t.Context(), &structsUFUT.OrderRequestRMP{UserID: "u1", OrderID: p.OrderID})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1000), *detail.Lines[0].UnitPrice)
+	assert.Equal(t, int64(2000), *detail.Lines[0].LineTotal)
+	assert.Equal(t, []structsUFUT.OrderTotalRMP{{Currency: "USD", Amount: 2000}}, detail.Totals)
+	cart, err := repo.ListCart(t.Context(), "u1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"lamp"}, cart.ItemsID)
+
+	// a failed payment releases the reservation and keeps the cart
+	fillCart("u2")
+	c2, err := srvc.PlaceOrder(t.Context(), "u2", "")
+	assert.NoError(t, err)
+	reserved(c2)
+	published()
+	assert.NoError(t, srvc.handlePaymentMsg(t.Context(), paymentMsg(t, eventsUFUT.PaymentFailed, c2, "card declined")))
+	assert.Equal(t, []string{eventsUFUT.ReleaseRequested}, published())
+	// late success of a failed payment doesn't place the order, it is refunded and the saga parked
+	assert.NoError(t, srvc.handlePaymentMsg(t.Context(), paymentMsg(t, eventsUFUT.PaymentSucceeded, c2, "")))
+	p, err = repo.Saga(t.Context(), c2)
+	assert.NoError(t, err)
+	assert.Equal(t, structsUFUT.PlacementFailed, p.Status)
+	assert.Equal(t, structsUFUT.SagaStuck, p.Step)
+	assert.Equal(t, "payment made in step RELEASING, refund requested; payment failed: card declined", p.LastError)
+	assert.Equal(t, []string{eventsUFUT.RefundRequested}, published())
+	refund, err := eventsUFUT.Decode[structsUFUT.PaymentRequestRMP](writer.msgs[0])
+	assert.NoError(t, err)
+	assert.Equal(t, c2, refund.CorrelationID)
+	assert.Equal(t, p.Total, refund.Payload.Amount)
+	assert.Equal(t, p.Currency, refund.Payload.Currency)
+	released, err := eventsUFUT.NewMessage(eventsUFUT.ItemsReleased, "inventory_service", c2, c2, structsUFUT.InventoryOrderNotification{})
+	assert.NoError(t, err)
+	assert.NoError(t, srvc.handleInventoryMsg(t.Context(), released))
+	p, err = repo.Saga(t.Context(), c2)
+	assert.NoError(t, err)
+	assert.Equal(t, structsUFUT.SagaCompensated, p.Step)
+	cart, err = repo.ListCart(t.Context(), "u2")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2, 1}, cart.Quantities)
+
+	// expired steps are compensated, a release that times out leaves the saga STUCK for an operator
+	srvc.SetSagaTimeouts(SagaTimeouts{Reserve: -time.Second, Release: -time.Second})
+	srvc.SetOperators([]string{"op"})
+	c3, err := srvc.PlaceOrder(t.Context(), "u2", "")
+	assert.NoError(t, err)
+	published()
+	expired, err := srvc.ExpireSagas(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, expired)
+	assert.Equal(t, []string{eventsUFUT.ReleaseRequested}, published())
+	expired, err = srvc.ExpireSagas(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, expired)
+	p, err = repo.Saga(t.Context(), c3)
+	assert.NoError(t, err)
+	assert.Equal(t, structsUFUT.SagaStuck, p.Step)
+	assert.Equal(t, "release timed out after reservation timed out", p.LastError)
+
+	_, err = srvc.Sagas(t.Context(), "u1", true, 0)
+	assert.ErrorIs(t, err, ErrNotOperator)
+	stuck, err := srvc.Sagas(t.Context(), "op", true, 0)
+	assert.NoError(t, err)
+	assert.Len(t, stuck.Sagas, 1)
+	assert.Equal(t, c3, stuck.Sagas[0].CorrelationID)
+	all, err := srvc.Sagas(t.Context(), "op", false, 0)
+	assert.NoError(t, err)
+	assert.Len(t, all.Sagas, 3)
+
+	srvc.SetSagaTimeouts(SagaTimeouts{})
+	p, err = srvc.RetrySaga(t.Context(), "op", c3)
+	assert.NoError(t, err)
+	assert.Equal(t, structsUFUT.SagaReleasing, p.Step)
+	assert.Equal(t, 1, p.Retries)
+	assert.Greater(t, p.DeadlineAt, time.Now().Unix())
+	assert.Equal(t, []string{eventsUFUT.ReleaseRequested}, published())
+	stuck, err = srvc.Sagas(t.Context(), "op", true, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, stuck.Sagas)
+	_, err = srvc.RetrySaga(t.Context(), "op", c1)
+	assert.ErrorIs(t, err, ErrSagaFinished)
+	_, err = srvc.RetrySaga(t.Context(), "u1", c3)
+	assert.ErrorIs(t, err, ErrNotOperator)
+}
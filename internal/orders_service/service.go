@@ -2,79 +2,158 @@ package orders_service
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"slices"
+	"sync/atomic"
+	"time"
+	funcsUFUT "ufut/lib/funcs"
 	structsUFUT "ufut/lib/structs"
 
-	"github.com/google/uuid"
 	"github.com/segmentio/kafka-go"
 )
 
+const (
+	// DefaultOrdersPerPage is used when UserOrders request doesn't specify count
+	DefaultOrdersPerPage = 20
+	// MaxOrdersPerPage limits count of UserOrders request
+	MaxOrdersPerPage = 100
+)
+
+var ErrInvalidCartItem = errors.New("cart item needs an itemID and a positive quantity")
+
+// eventsProducer names the service in the metadata of published events
+const eventsProducer = "orders_service"
+
+// OrdersTopic names the outbox relay writer of inventory requests
+const OrdersTopic = "orders"
+
+// OrderEventsTopic names the outbox relay writer of order status changes
+const OrderEventsTopic = "order_events"
+
 type Service struct {
-	repo        Repository
-	kafkaWriter *kafka.Writer
+	repo      Repository
+	currency  string
+	rates     atomic.Pointer[funcsUFUT.ExchangeRates]
+	payments  bool
+	timeouts  SagaTimeouts
+	operators []string
+	pricing   *structsUFUT.PricingRulesRMP
+
+	idempotencyRetention time.Duration
 }
 
-func NewService(repo Repository, kafkaWriter *kafka.Writer) *Service {
-	return &Service{
-		repo:        repo,
-		kafkaWriter: kafkaWriter}
+/*
+Creates the service; events are stored in the outbox of repo and published by its relay
+*/
+func NewService(repo Repository) *Service {
+	return &Service{repo: repo}
 }
 
-func (s *Service) PlaceOrder(ctx context.Context, userID string) error {
-	cart, err := s.ListCart(ctx, userID)
-	if err != nil {
-		return err
-	}
-	trx, err := uuid.NewUUID()
-	if err != nil {
+/*
+Cancels the order of the user and asks inventory to release the reservation of the saga that placed it.
+Orders placed before reservations were tracked by inventory have nothing to release.
+Cancelling a cancelled order does nothing; once the order is out for delivery only operators can cancel it
+*/
+func (s *Service) RemoveOrder(ctx context.Context, req *structsUFUT.OrderRequestRMP) error {
+	if err := s.repo.OrderStatus(ctx, req); err != nil {
 		return err
 	}
-	cart.UserID = trx.String() + ".reserve"
-	jsonData, err := json.Marshal(cart)
-	if err != nil {
-		return err
+	if req.Status == structsUFUT.OrderCancelled {
+		return nil
 	}
-	err = s.kafkaWriter.WriteMessages(ctx, kafka.Message{
-		Value: jsonData,
-	})
-	if err != nil {
-		return err
+	if !slices.Contains(customerCancellableStatuses, req.Status) {
+		return ErrInvalidTransition
 	}
-	return nil
-	// availability := callback(cart.ItemsID)
-	// return s.repo.PlaceOrder(ctx, userID, availability)
+	return s.cancelOrder(ctx, req, req.UserID)
 }
 
-func (s *Service) RemoveOrder(ctx context.Context, req *structsUFUT.OrderRequestRMP) error {
-	items, err := s.repo.ItemsIDsByOrderID(ctx, req)
+/*
+req.Status - current status of the order, read by OrderStatus
+
+Cancels the order on behalf of changedBy. The reservation is released only while the items haven't left,
+items of an order cancelled in delivery are restocked by operators once they are back
+*/
+func (s *Service) cancelOrder(ctx context.Context, req *structsUFUT.OrderRequestRMP, changedBy string) error {
+	correlationID, err := s.repo.OrderCorrelationID(ctx, req)
 	if err != nil {
 		return err
 	}
-	trx, err := uuid.NewUUID()
-	if err != nil {
-		return err
+	var events []kafka.Message
+	if correlationID != "" && slices.Contains(customerCancellableStatuses, req.Status) {
+		items, err := s.repo.ItemsIDsByOrderID(ctx, req)
+		if err != nil {
+			return err
+		}
+		items.UserID = req.UserID
+		msg, err := s.releaseMessage(correlationID, items)
+		if err != nil {
+			return err
+		}
+		events = append(events, msg)
 	}
-	items.UserID = trx.String() + ".cancelReservation"
-	jsonData, err := json.Marshal(items)
-	if err != nil {
-		return err
-	}
-	err = s.kafkaWriter.WriteMessages(ctx, kafka.Message{
-		Value: jsonData,
-	})
-	return nil
-	// return s.repo.RemoveOrder(ctx, req)
+	return s.changeOrderStatus(ctx, req, structsUFUT.OrderCancelled, changedBy, events...)
 }
 
 func (s *Service) OrderStatus(ctx context.Context, req *structsUFUT.OrderRequestRMP) error {
 	return s.repo.OrderStatus(ctx, req)
 }
 
+/*
+Returns the user's order as it was sold, with line totals and the total it was charged;
+orders placed without a quote get a total per currency of their lines
+*/
+func (s *Service) OrderDetail(ctx context.Context, req *structsUFUT.OrderRequestRMP) (*structsUFUT.OrderDetailRMP, error) {
+	order, err := s.repo.OrderDetail(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	order.Totals = []structsUFUT.OrderTotalRMP{}
+	for i := range order.Lines {
+		line := &order.Lines[i]
+		if line.UnitPrice == nil {
+			continue
+		}
+		total := *line.UnitPrice*int64(line.Quantity) - line.Discount + line.Tax
+		line.LineTotal = &total
+		j := slices.IndexFunc(order.Totals, func(t structsUFUT.OrderTotalRMP) bool { return t.Currency == line.Currency })
+		if j < 0 {
+			order.Totals = append(order.Totals, structsUFUT.OrderTotalRMP{Currency: line.Currency})
+			j = len(order.Totals) - 1
+		}
+		order.Totals[j].Amount += total
+	}
+	if req.Currency != "" {
+		currency, err := funcsUFUT.NormalizeCurrency(req.Currency)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.convertOrderLines(order, currency); err != nil {
+			return nil, err
+		}
+		if order.Quote != nil {
+			if order.Quote, err = s.convertQuote(order.Quote, currency); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if order.Quote != nil {
+		order.Totals = []structsUFUT.OrderTotalRMP{{Currency: order.Quote.Currency, Amount: order.Quote.Total}}
+	}
+	return order, nil
+}
+
 func (s *Service) UserOrders(ctx context.Context, req *structsUFUT.OrderRequestRMP) (*structsUFUT.OrdersResponseRMP, error) {
+	if req.Count <= 0 {
+		req.Count = DefaultOrdersPerPage
+	}
+	req.Count = min(req.Count, MaxOrdersPerPage)
 	return s.repo.UserOrders(ctx, req)
 }
 
 func (s *Service) AddToCart(ctx context.Context, req *structsUFUT.ItemRequestRMP) error {
+	if req.ItemID == "" || req.Quantity <= 0 {
+		return ErrInvalidCartItem
+	}
 	return s.repo.AddToCart(ctx, req)
 }
 
@@ -83,10 +162,16 @@ func (s *Service) RemoveFromCart(ctx context.Context, req *structsUFUT.ItemReque
 }
 
 func (s *Service) IncreaseItemQuantity(ctx context.Context, req *structsUFUT.ItemRequestRMP) error {
+	if req.ItemID == "" || req.Quantity <= 0 {
+		return ErrInvalidCartItem
+	}
 	return s.repo.IncreaseItemQuantity(ctx, req)
 }
 
 func (s *Service) DecreaseItemQuantity(ctx context.Context, req *structsUFUT.ItemRequestRMP) error {
+	if req.ItemID == "" || req.Quantity <= 0 {
+		return ErrInvalidCartItem
+	}
 	return s.repo.DecreaseItemQuantity(ctx, req)
 }
 
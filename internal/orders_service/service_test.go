@@ -0,0 +1,111 @@
+package orders_service
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+	sqliteRepoOrders "ufut/internal/sqlite/orders_service"
+	structsUFUT "ufut/lib/structs"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestService_OrderDetail(t *testing.T) {
+	srvc, repo := CreateOrdersService(t)
+	for _, item := range []structsUFUT.ItemDataRSC{
+		{ItemID: "book", SellerID: "s1", Name: "Book", Status: structsUFUT.ItemStatusAvailable, Version: 1, Price: 1000, Currency: "USD"},
+		{ItemID: "lamp", SellerID: "s2", Name: "Lamp", Status: structsUFUT.ItemStatusAvailable, Version: 1, Price: 2500, Currency: "EUR"},
+	} {
+		assert.NoError(t, repo.SetCatalogItem(t.Context(), &item))
+	}
+	orderID := placeTestOrder(t, repo, "u1", "book", "lamp", "pen")
+
+	// the order keeps the prices it was placed with
+	assert.NoError(t, repo.SetCatalogItem(t.Context(), &structsUFUT.ItemDataRSC{
+		ItemID: "book", SellerID: "s1", Name: "Old book", Status: structsUFUT.ItemStatusAvailable, Version: 2, Price: 1500, Currency: "USD"}))
+	order, err := srvc.OrderDetail(t.Context(), &structsUFUT.OrderRequestRMP{UserID: "u1", OrderID: orderID})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), order.OrderNumber)
+	assert.Equal(t, structsUFUT.OrderCreated, order.Status)
+	assert.Len(t, order.Lines, 3)
+	book, lamp, pen := order.Lines[0], order.Lines[1], order.Lines[2]
+	assert.Equal(t, "Book", book.Name)
+	assert.Equal(t, "s1", book.SellerID)
+	assert.Equal(t, int64(1000), *book.UnitPrice)
+	assert.Equal(t, int64(1000), *book.LineTotal)
+	assert.Equal(t, "USD", book.Currency)
+	assert.Equal(t, int64(2500), *lamp.UnitPrice)
+	assert.Equal(t, "EUR", lamp.Currency)
+	assert.Equal(t, "pen", pen.ItemID)
+	assert.Nil(t, pen.UnitPrice)
+	assert.Nil(t, pen.LineTotal)
+	assert.Equal(t, []structsUFUT.OrderTotalRMP{{Currency: "USD", Amount: 1000}, {Currency: "EUR", Amount: 2500}}, order.Totals)
+	assert.Len(t, order.History, 1)
+	assert.NotZero(t, order.CreatedAt)
+	assert.Equal(t, order.History[0].ChangedAt, order.UpdatedAt)
+
+	srvc.SetOperators([]string{"staff1"})
+	assert.NoError(t, srvc.AdvanceOrder(t.Context(), "staff1", &structsUFUT.OrderRequestRMP{
+		OrderID: orderID, Status: structsUFUT.OrderPreparing}))
+	order, err = srvc.OrderDetail(t.Context(), &structsUFUT.OrderRequestRMP{UserID: "u1", OrderID: orderID})
+	assert.NoError(t, err)
+	assert.Equal(t, structsUFUT.OrderPreparing, order.Status)
+	assert.Len(t, order.History, 2)
+
+	// orders of other users are not found
+	_, err = srvc.OrderDetail(t.Context(), &structsUFUT.OrderRequestRMP{UserID: "u2", OrderID: orderID})
+	assert.Error(t, err)
+}
+
+func TestService_MigratedOrders(t *testing.T) {
+	dbFilePath := "orders_migration_test.db"
+	db, err := sql.Open("sqlite3", dbFilePath)
+	if err != nil {
+		t.Fatalf("%v", err.Error())
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(dbFilePath)
+	})
+	// orders numbered per user, lines linked by userID||orderID
+	for _, stmt := range []string{
+		`CREATE TABLE usersOrders (orderID INTEGER NOT NULL, userID TEXT NOT NULL, status TEXT NOT NULL,
+		createdAt DATETIME NOT NULL, PRIMARY KEY(userID, orderID))`,
+		`CREATE TABLE orders (orderID TEXT NOT NULL, itemID TEXT NOT NULL, quantity INTEGER, PRIMARY KEY(orderID, itemID))`,
+		`INSERT INTO usersOrders VALUES (1, 'u1', 'CREATED', '2025-01-01 10:00:00'),
+		(1, 'u2', 'FINISHED', '2025-01-02 10:00:00'), (2, 'u1', 'CANCELLED', '2025-01-03 10:00:00')`,
+		`INSERT INTO orders VALUES ('u11', 'book', 2), ('u21', 'lamp', 1), ('u12', 'pen', 1)`,
+	} {
+		if _, err := db.ExecContext(t.Context(), stmt); err != nil {
+			t.Fatalf("%v", err.Error())
+		}
+	}
+	repo := sqliteRepoOrders.NewSQLiteRepo(db)
+	assert.NoError(t, repo.CreateTables(t.Context()))
+	assert.NoError(t, repo.CreateTables(t.Context()))
+	srvc := NewService(repo)
+
+	orders, err := srvc.UserOrders(t.Context(), &structsUFUT.OrderRequestRMP{UserID: "u1"})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{3, 1}, orders.OrderNumbers)
+	assert.Equal(t, []string{structsUFUT.OrderCancelled, structsUFUT.OrderCreated}, orders.Status)
+	order, err := srvc.OrderDetail(t.Context(), &structsUFUT.OrderRequestRMP{UserID: "u1", OrderID: orders.OrderID[1]})
+	assert.NoError(t, err)
+	assert.Len(t, order.Lines, 1)
+	assert.Equal(t, "book", order.Lines[0].ItemID)
+	assert.Equal(t, 2, order.Lines[0].Quantity)
+	assert.Nil(t, order.Lines[0].UnitPrice)
+	assert.Equal(t, time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC).Unix(), order.CreatedAt)
+	assert.Len(t, order.History, 1)
+
+	owner, err := repo.OrderOwner(t.Context(), orders.OrderID[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "u1", owner)
+
+	// new orders continue the numbering
+	placeTestOrder(t, repo, "u2", "lamp")
+	orders, err = srvc.UserOrders(t.Context(), &structsUFUT.OrderRequestRMP{UserID: "u2"})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{4, 2}, orders.OrderNumbers)
+}
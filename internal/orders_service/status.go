@@ -0,0 +1,130 @@
+package orders_service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+	eventsUFUT "ufut/lib/events"
+	structsUFUT "ufut/lib/structs"
+
+	"github.com/segmentio/kafka-go"
+)
+
+var (
+	ErrUnknownOrderStatus = errors.New("unknown order status")
+	ErrInvalidTransition  = errors.New("order can't change to this status")
+)
+
+// statuses an order may change to from its current one, FINISHED and CANCELLED are final
+var orderStatusTransitions = map[string][]string{
+	structsUFUT.OrderCreated:   {structsUFUT.OrderPreparing, structsUFUT.OrderCancelled},
+	structsUFUT.OrderPreparing: {structsUFUT.OrderDelivery, structsUFUT.OrderCancelled},
+	structsUFUT.OrderDelivery:  {structsUFUT.OrderFinished, structsUFUT.OrderCancelled},
+}
+
+// statuses set by staff, cancelling releases the reserved items unless they are out for delivery
+var fulfilmentStatuses = []string{structsUFUT.OrderPreparing, structsUFUT.OrderDelivery, structsUFUT.OrderFinished,
+	structsUFUT.OrderCancelled}
+
+// statuses users can cancel their orders in, the items are still in stock
+var customerCancellableStatuses = []string{structsUFUT.OrderCreated, structsUFUT.OrderPreparing}
+
+func (s *Service) statusChangedMessage(change *structsUFUT.OrderStatusChangeRMP) (kafka.Message, error) {
+	msg, err := eventsUFUT.NewMessage(eventsUFUT.OrderStatusChanged, eventsProducer, change.OrderID, change.UserID, change)
+	msg.Topic = OrderEventsTopic
+	return msg, err
+}
+
+/*
+req.Status - current status of the order, read by OrderStatus
+
+Moves the order to status "to" if the transition table allows it, records the change in the order timeline
+and publishes it along with events, a FINISHED change carries the sellers of the order. Returns ErrInvalidTransition if the order has changed meanwhile
+*/
+func (s *Service) changeOrderStatus(ctx context.Context, req *structsUFUT.OrderRequestRMP, to, changedBy string, events ...kafka.Message) error {
+	if !slices.Contains(orderStatusTransitions[req.Status], to) {
+		return ErrInvalidTransition
+	}
+	change := &structsUFUT.OrderStatusChangeRMP{
+		UserID:    req.UserID,
+		OrderID:   req.OrderID,
+		From:      req.Status,
+		To:        to,
+		ChangedBy: changedBy,
+		ChangedAt: time.Now().Unix(),
+	}
+	if to == structsUFUT.OrderFinished {
+		// the catalog lets the buyer rate the sellers of a finished order
+		detail, err := s.repo.OrderDetail(ctx, req)
+		if err != nil {
+			return err
+		}
+		for _, line := range detail.Lines {
+			if line.SellerID != "" && !slices.Contains(change.SellerIDs, line.SellerID) {
+				change.SellerIDs = append(change.SellerIDs, line.SellerID)
+			}
+		}
+	}
+	msg, err := s.statusChangedMessage(change)
+	if err != nil {
+		return err
+	}
+	changed, err := s.repo.ChangeOrderStatus(ctx, change, append(events, msg)...)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		return ErrInvalidTransition
+	}
+	req.Status = to
+	return nil
+}
+
+/*
+req:
+
+	UserID	- ignored, filled with the owner of the order
+	OrderID	- must be not null
+	Status	- any("PREPARING", "DELIVERY", "FINISHED", "CANCELLED")
+
+Advances or cancels the order on behalf of the staff member, req.Status is left with the new status
+*/
+func (s *Service) AdvanceOrder(ctx context.Context, staffID string, req *structsUFUT.OrderRequestRMP) error {
+	if !s.isOperator(staffID) {
+		return ErrNotOperator
+	}
+	if !slices.Contains(fulfilmentStatuses, req.Status) {
+		return ErrUnknownOrderStatus
+	}
+	to := req.Status
+	var err error
+	if req.UserID, err = s.repo.OrderOwner(ctx, req.OrderID); err != nil {
+		return err
+	}
+	if err := s.repo.OrderStatus(ctx, req); err != nil {
+		return err
+	}
+	if to == structsUFUT.OrderCancelled {
+		return s.cancelOrder(ctx, req, staffID)
+	}
+	return s.changeOrderStatus(ctx, req, to, staffID)
+}
+
+/*
+Returns the status changes of the order oldest first
+*/
+func (s *Service) OrderHistory(ctx context.Context, staffID, orderID string) (*structsUFUT.OrderHistoryRMP, error) {
+	if !s.isOperator(staffID) {
+		return nil, ErrNotOperator
+	}
+	userID, err := s.repo.OrderOwner(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	history, err := s.repo.OrderHistory(ctx, &structsUFUT.OrderRequestRMP{UserID: userID, OrderID: orderID})
+	if err != nil {
+		return nil, err
+	}
+	return &structsUFUT.OrderHistoryRMP{History: history}, nil
+}
@@ -0,0 +1,103 @@
+package orders_service
+
+import (
+	"testing"
+	sqliteOutbox "ufut/internal/sqlite/outbox"
+	eventsUFUT "ufut/lib/events"
+	structsUFUT "ufut/lib/structs"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestService_OrderStatus(t *testing.T) {
+	srvc, repo := CreateOrdersService(t)
+	writer := &testWriter{}
+	releases := &testWriter{}
+	relay := sqliteOutbox.NewRelay(repo.DB, map[string]sqliteOutbox.Writer{OrderEventsTopic: writer, OrdersTopic: releases})
+	for _, item := range []structsUFUT.ItemDataRSC{
+		{ItemID: "book", SellerID: "s1", Name: "Book", Status: structsUFUT.ItemStatusAvailable, Version: 1, Price: 1000, Currency: "USD"},
+		{ItemID: "lamp", SellerID: "s2", Name: "Lamp", Status: structsUFUT.ItemStatusAvailable, Version: 1, Price: 2500, Currency: "USD"},
+	} {
+		assert.NoError(t, repo.SetCatalogItem(t.Context(), &item))
+	}
+	o1 := placeTestOrder(t, repo, "u1", "book", "lamp")
+	o2 := placeTestOrder(t, repo, "u1", "pen")
+	o3 := placeTestOrder(t, repo, "u1", "mug")
+	srvc.SetOperators([]string{"staff1"})
+	advance := func(orderID string, status string) error {
+		return srvc.AdvanceOrder(t.Context(), "staff1", &structsUFUT.OrderRequestRMP{OrderID: orderID, Status: status})
+	}
+
+	// staff advance the order one step at a time
+	assert.ErrorIs(t, advance(o1, structsUFUT.OrderDelivery), ErrInvalidTransition)
+	assert.ErrorIs(t, advance(o1, structsUFUT.OrderCreated), ErrUnknownOrderStatus)
+	assert.NoError(t, advance(o1, structsUFUT.OrderPreparing))
+	assert.ErrorIs(t, advance(o1, structsUFUT.OrderPreparing), ErrInvalidTransition)
+	assert.NoError(t, advance(o1, structsUFUT.OrderDelivery))
+	assert.NoError(t, advance(o1, structsUFUT.OrderFinished))
+	assert.ErrorIs(t, srvc.RemoveOrder(t.Context(), &structsUFUT.OrderRequestRMP{UserID: "u1", OrderID: o1}), ErrInvalidTransition)
+	assert.Error(t, advance("missing", structsUFUT.OrderPreparing))
+
+	// cancelled orders are final, cancelling twice does nothing
+	assert.NoError(t, srvc.RemoveOrder(t.Context(), &structsUFUT.OrderRequestRMP{UserID: "u1", OrderID: o2}))
+	assert.NoError(t, srvc.RemoveOrder(t.Context(), &structsUFUT.OrderRequestRMP{UserID: "u1", OrderID: o2}))
+	assert.ErrorIs(t, advance(o2, structsUFUT.OrderPreparing), ErrInvalidTransition)
+
+	// out for delivery, only operators cancel the order and its items aren't released
+	assert.NoError(t, advance(o3, structsUFUT.OrderPreparing))
+	assert.NoError(t, advance(o3, structsUFUT.OrderDelivery))
+	assert.ErrorIs(t, srvc.RemoveOrder(t.Context(), &structsUFUT.OrderRequestRMP{UserID: "u1", OrderID: o3}), ErrInvalidTransition)
+	assert.NoError(t, advance(o3, structsUFUT.OrderCancelled))
+	assert.ErrorIs(t, advance(o3, structsUFUT.OrderCancelled), ErrInvalidTransition)
+
+	// every change is in the timeline and published once
+	history, err := srvc.OrderHistory(t.Context(), "staff1", o1)
+	assert.NoError(t, err)
+	steps := [][2]string{}
+	for _, change := range history.History {
+		steps = append(steps, [2]string{change.From, change.To})
+		assert.NotZero(t, change.ChangedAt)
+	}
+	assert.Equal(t, [][2]string{
+		{"", structsUFUT.OrderCreated},
+		{structsUFUT.OrderCreated, structsUFUT.OrderPreparing},
+		{structsUFUT.OrderPreparing, structsUFUT.OrderDelivery},
+		{structsUFUT.OrderDelivery, structsUFUT.OrderFinished},
+	}, steps)
+	assert.Equal(t, "u1", history.History[0].ChangedBy)
+	assert.Equal(t, "staff1", history.History[1].ChangedBy)
+	_, err = srvc.OrderHistory(t.Context(), "staff1", "missing")
+	assert.Error(t, err)
+
+	_, err = relay.RelayPending(t.Context())
+	assert.NoError(t, err)
+	changes := []string{}
+	for _, msg := range writer.msgs {
+		event, err := eventsUFUT.Decode[structsUFUT.OrderStatusChangeRMP](msg)
+		assert.NoError(t, err)
+		assert.Equal(t, eventsUFUT.OrderStatusChanged, event.Type)
+		assert.Equal(t, "u1", string(msg.Key))
+		changes = append(changes, event.Payload.To)
+		// only the finished order names its sellers, they may be rated by the buyer
+		if event.Payload.To == structsUFUT.OrderFinished {
+			assert.Equal(t, []string{"s1", "s2"}, event.Payload.SellerIDs)
+		} else {
+			assert.Empty(t, event.Payload.SellerIDs)
+		}
+	}
+	assert.Equal(t, []string{structsUFUT.OrderPreparing, structsUFUT.OrderDelivery, structsUFUT.OrderFinished,
+		structsUFUT.OrderCancelled, structsUFUT.OrderPreparing, structsUFUT.OrderDelivery, structsUFUT.OrderCancelled}, changes)
+
+	// the cancelled order releases its own items
+	assert.Len(t, releases.msgs, 1)
+	release, err := eventsUFUT.Decode[structsUFUT.ShoppingCartRMP](releases.msgs[0])
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pen"}, release.Payload.ItemsID)
+
+	// only operators fulfil orders, nobody does until they are configured
+	srvc.SetOperators([]string{"staff2"})
+	assert.ErrorIs(t, advance(o1, structsUFUT.OrderFinished), ErrNotOperator)
+	srvc.SetOperators(nil)
+	err = srvc.AdvanceOrder(t.Context(), "staff2", &structsUFUT.OrderRequestRMP{OrderID: o1, Status: structsUFUT.OrderFinished})
+	assert.ErrorIs(t, err, ErrNotOperator)
+}
@@ -0,0 +1,452 @@
+package searchCatalog
+
+import (
+	"context"
+	"errors"
+	"log"
+	"maps"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	eventsUFUT "ufut/lib/events"
+	structsUFUT "ufut/lib/structs"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	SuggestionItem     = "item"
+	SuggestionCategory = "category"
+)
+
+type SuggestConfig struct {
+	// MaxSuggestions bounds the limit a caller may ask for
+	MaxSuggestions int
+	// MaxTrackedQueries bounds memory used by past queries of all locales, least popular ones are dropped,
+	// and the users whose queries are counted at a time
+	MaxTrackedQueries int
+	// MaxQueryLen is the longest query that is recorded
+	MaxQueryLen int
+	// MaxUserQueries is how many different queries of one user are counted per UserQueryWindow,
+	// a user's repeats of a query within the window are counted once
+	MaxUserQueries  int
+	UserQueryWindow time.Duration
+	// RebuildInterval is how often the tries are rebuilt after a change
+	RebuildInterval time.Duration
+	// CategoriesReloadInterval is how often category names are reloaded from the source given to Load
+	CategoriesReloadInterval time.Duration
+	// DefaultLocale is the locale of item names and category names as stored in the catalog
+	DefaultLocale string
+}
+
+var DefaultSuggestConfig = SuggestConfig{
+	MaxSuggestions:           10,
+	MaxTrackedQueries:        10000,
+	MaxQueryLen:              100,
+	MaxUserQueries:           20,
+	UserQueryWindow:          time.Hour,
+	RebuildInterval:          time.Second,
+	CategoriesReloadInterval: time.Minute,
+	DefaultLocale:            "en",
+}
+
+/*
+Source of the initial index, satisfied by catalog_service.Repository
+*/
+type ItemSource interface {
+	Categories(ctx context.Context) ([]string, error)
+	CategoryTranslations(ctx context.Context) ([]structsUFUT.CategoryTranslationRSC, error)
+	ExportItems(ctx context.Context, sellerID string, fn func(item *structsUFUT.ItemDataRSC) error) error
+	ExportItemTranslations(ctx context.Context, fn func(tr *structsUFUT.ItemTranslationRSC) error) error
+}
+
+type tries struct {
+	catalog *trie
+	queries *trie
+}
+
+type localeQuery struct {
+	locale string
+	query  string
+}
+
+// userQueries are the queries of a user counted since the start of the user's window
+type userQueries struct {
+	since   time.Time
+	counted map[localeQuery]bool
+}
+
+/*
+Serves search suggestions from in-memory tries, every locale is indexed separately.
+Changes (catalog events, recorded queries) are collected under mu
+and applied by rebuilding the tries, readers never wait for a rebuild
+*/
+type Suggester struct {
+	cfg   SuggestConfig
+	src   ItemSource
+	tries atomic.Pointer[map[string]*tries]
+
+	mu         sync.Mutex
+	names      map[string]map[string]string // locale -> itemID -> name of available items
+	categories map[string]map[string]string // locale -> category -> display name
+	queries    map[localeQuery]int          // normalized query -> times searched
+	users      map[string]*userQueries      // userID -> queries counted in the user's window
+	dirty      bool
+	now        func() time.Time
+}
+
+func NewSuggester(cfg SuggestConfig) *Suggester {
+	s := &Suggester{
+		cfg:        cfg,
+		names:      map[string]map[string]string{},
+		categories: map[string]map[string]string{},
+		queries:    map[localeQuery]int{},
+		users:      map[string]*userQueries{},
+		now:        time.Now,
+	}
+	s.rebuild()
+	return s
+}
+
+/*
+Replaces the index with all available items and categories of src in every locale;
+src is kept to reload category names
+*/
+func (s *Suggester) Load(ctx context.Context, src ItemSource) error {
+	categories, err := s.loadCategories(ctx, src)
+	if err != nil {
+		return err
+	}
+	names := map[string]map[string]string{s.cfg.DefaultLocale: {}}
+	err = src.ExportItems(ctx, "", func(item *structsUFUT.ItemDataRSC) error {
+		if item.Status == structsUFUT.ItemStatusAvailable {
+			names[s.cfg.DefaultLocale][item.ItemID] = item.Name
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = src.ExportItemTranslations(ctx, func(tr *structsUFUT.ItemTranslationRSC) error {
+		if _, ok := names[s.cfg.DefaultLocale][tr.ItemID]; !ok {
+			return nil
+		}
+		if names[tr.Locale] == nil {
+			names[tr.Locale] = map[string]string{}
+		}
+		names[tr.Locale][tr.ItemID] = tr.Name
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.src = src
+	s.names = names
+	s.categories = categories
+	s.mu.Unlock()
+	s.rebuild()
+	return nil
+}
+
+func (s *Suggester) loadCategories(ctx context.Context, src ItemSource) (map[string]map[string]string, error) {
+	names, err := src.Categories(ctx)
+	if err != nil {
+		return nil, err
+	}
+	translations, err := src.CategoryTranslations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	categories := map[string]map[string]string{s.cfg.DefaultLocale: {}}
+	for _, name := range names {
+		categories[s.cfg.DefaultLocale][name] = name
+	}
+	for _, tr := range translations {
+		if categories[tr.Locale] == nil {
+			categories[tr.Locale] = map[string]string{}
+		}
+		categories[tr.Locale][tr.Category] = tr.DisplayName
+	}
+	return categories, nil
+}
+
+/*
+Reloads category names from the source given to Load, they change without catalog events
+*/
+func (s *Suggester) ReloadCategories(ctx context.Context) error {
+	s.mu.Lock()
+	src := s.src
+	s.mu.Unlock()
+	if src == nil {
+		return nil
+	}
+	categories, err := s.loadCategories(ctx, src)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.categories = categories
+	s.dirty = true
+	return nil
+}
+
+/*
+Indexes the item and its translations if it's available, removes it from the index otherwise
+*/
+func (s *Suggester) SetItem(item *structsUFUT.ItemDataRSC) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, names := range s.names {
+		delete(names, item.ItemID)
+	}
+	if item.Status == structsUFUT.ItemStatusAvailable {
+		s.setName(s.cfg.DefaultLocale, item.ItemID, item.Name)
+		for _, tr := range item.Translations {
+			s.setName(tr.Locale, item.ItemID, tr.Name)
+		}
+	}
+	s.dirty = true
+}
+
+func (s *Suggester) setName(locale, itemID, name string) {
+	if s.names[locale] == nil {
+		s.names[locale] = map[string]string{}
+	}
+	s.names[locale][itemID] = name
+}
+
+/*
+Counts a query the user submitted in the locale, it's suggested to other users of the locale once the tries are rebuilt.
+A user's query counts once per UserQueryWindow, and at most MaxUserQueries queries of the user count in it,
+so nobody can make their own queries popular
+*/
+func (s *Suggester) RecordQuery(query, locale, userID string) {
+	query = normalize(query)
+	if query == "" || len(query) > s.cfg.MaxQueryLen {
+		return
+	}
+	if locale == "" {
+		locale = s.cfg.DefaultLocale
+	}
+	key := localeQuery{locale: locale, query: query}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user := s.userWindow(userID)
+	if user == nil || user.counted[key] || len(user.counted) >= s.cfg.MaxUserQueries {
+		return
+	}
+	user.counted[key] = true
+	if _, ok := s.queries[key]; !ok && len(s.queries) >= s.cfg.MaxTrackedQueries {
+		s.dropLeastPopular()
+	}
+	s.queries[key]++
+	s.dirty = true
+}
+
+/*
+Returns the current window of the user, nil if the windows of MaxTrackedQueries other users are open.
+Called with mu held
+*/
+func (s *Suggester) userWindow(userID string) *userQueries {
+	now := s.now()
+	if user, ok := s.users[userID]; ok && now.Sub(user.since) < s.cfg.UserQueryWindow {
+		return user
+	}
+	delete(s.users, userID)
+	if len(s.users) >= s.cfg.MaxTrackedQueries {
+		for id, user := range s.users {
+			if now.Sub(user.since) >= s.cfg.UserQueryWindow {
+				delete(s.users, id)
+			}
+		}
+		if len(s.users) >= s.cfg.MaxTrackedQueries {
+			return nil
+		}
+	}
+	user := &userQueries{since: now, counted: map[localeQuery]bool{}}
+	s.users[userID] = user
+	return user
+}
+
+/*
+Drops the least popular of the tracked queries, making room for one more. Called with mu held
+*/
+func (s *Suggester) dropLeastPopular() {
+	var least localeQuery
+	leastCount := -1
+	for q, n := range s.queries {
+		// ties go by text, so the same query is dropped whatever the map order
+		if leastCount < 0 || n < leastCount || (n == leastCount && q.query+q.locale < least.query+least.locale) {
+			least, leastCount = q, n
+		}
+	}
+	delete(s.queries, least)
+}
+
+/*
+Returns completions of the prefix from item and category names, and past queries starting with the prefix,
+most popular first. The index of the first of locales that has one is used, the default locale's otherwise
+*/
+func (s *Suggester) Suggest(prefix string, limit int, locales []string) structsUFUT.SuggestResponseRSC {
+	prefix = normalize(prefix)
+	resp := structsUFUT.SuggestResponseRSC{
+		Query:       prefix,
+		Suggestions: []structsUFUT.SuggestionRSC{},
+		Popular:     []string{},
+	}
+	if prefix == "" {
+		return resp
+	}
+	if limit <= 0 || limit > s.cfg.MaxSuggestions {
+		limit = s.cfg.MaxSuggestions
+	}
+	byLocale := *s.tries.Load()
+	t := byLocale[s.cfg.DefaultLocale]
+	for _, locale := range locales {
+		if lt, ok := byLocale[locale]; ok {
+			t = lt
+			break
+		}
+	}
+	for _, e := range t.catalog.complete(prefix, limit) {
+		resp.Suggestions = append(resp.Suggestions, structsUFUT.SuggestionRSC{Text: e.text, Type: e.kind})
+	}
+	for _, e := range t.queries.complete(prefix, limit) {
+		resp.Popular = append(resp.Popular, e.text)
+	}
+	return resp
+}
+
+func (s *Suggester) rebuild() {
+	s.mu.Lock()
+	locales := map[string]bool{s.cfg.DefaultLocale: true}
+	for locale := range s.names {
+		locales[locale] = true
+	}
+	for locale := range s.categories {
+		locales[locale] = true
+	}
+	for key := range s.queries {
+		locales[key.locale] = true
+	}
+	catalogs := map[string]*trieBuilder{}
+	byNames := map[string]map[string]*entry{}
+	for locale := range locales {
+		catalog := newTrieBuilder(s.cfg.MaxSuggestions)
+		// translations override the text in the default locale, untranslated items are found by it
+		names := maps.Clone(s.names[s.cfg.DefaultLocale])
+		maps.Copy(names, s.names[locale])
+		categories := maps.Clone(s.categories[s.cfg.DefaultLocale])
+		maps.Copy(categories, s.categories[locale])
+		// items of the same name are suggested once, weighted by their number
+		byName := map[string]*entry{}
+		for _, name := range names {
+			key := normalize(name)
+			if key == "" {
+				continue
+			}
+			text := strings.Join(strings.Fields(name), " ")
+			e, ok := byName[key]
+			if !ok {
+				e = &entry{text: text, kind: SuggestionItem}
+				byName[key] = e
+			}
+			// names differing in case only are shown the same way whatever the map order
+			e.text = min(e.text, text)
+			e.weight++
+		}
+		for _, category := range categories {
+			// categories go before items of the same prefix
+			e := &entry{text: category, kind: SuggestionCategory, weight: len(names) + 1}
+			for _, key := range wordKeys(normalize(category)) {
+				catalog.insert(key, e)
+			}
+		}
+		catalogs[locale], byNames[locale] = catalog, byName
+	}
+	queries := map[string]*trieBuilder{}
+	for locale := range locales {
+		queries[locale] = newTrieBuilder(s.cfg.MaxSuggestions)
+	}
+	for key, n := range s.queries {
+		queries[key.locale].insert(key.query, &entry{text: key.query, weight: n})
+	}
+	s.dirty = false
+	s.mu.Unlock()
+
+	byLocale := make(map[string]*tries, len(locales))
+	for locale := range locales {
+		for key, e := range byNames[locale] {
+			for _, k := range wordKeys(key) {
+				catalogs[locale].insert(k, e)
+			}
+		}
+		byLocale[locale] = &tries{catalog: catalogs[locale].build(), queries: queries[locale].build()}
+	}
+	s.tries.Store(&byLocale)
+}
+
+/*
+Rebuilds the tries every RebuildInterval if anything changed and reloads category names
+every CategoriesReloadInterval, until ctx is cancelled
+*/
+func (s *Suggester) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.RebuildInterval)
+	defer ticker.Stop()
+	categoriesTicker := time.NewTicker(s.cfg.CategoriesReloadInterval)
+	defer categoriesTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-categoriesTicker.C:
+			if err := s.ReloadCategories(ctx); err != nil {
+				log.Printf("reload suggestion categories: %v\n", err)
+			}
+		case <-ticker.C:
+			s.mu.Lock()
+			dirty := s.dirty
+			s.mu.Unlock()
+			if dirty {
+				s.rebuild()
+			}
+		}
+	}
+}
+
+func (s *Suggester) handleItemEvent(msg kafka.Message) {
+	event, err := eventsUFUT.Decode[structsUFUT.ItemDataRSC](msg)
+	if err != nil {
+		log.Printf("skip catalog event: %v\n", err)
+		return
+	}
+	switch event.Type {
+	case eventsUFUT.ItemCreated, eventsUFUT.ItemUpdated, eventsUFUT.ItemDeleted:
+		s.SetItem(&event.Payload)
+	}
+}
+
+/*
+Consumes catalog events until ctx is cancelled.
+reader must use a consumer group of its own, every instance keeps its own index
+*/
+func (s *Suggester) ServeKafka(ctx context.Context, reader *kafka.Reader) error {
+	for {
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				return err
+			}
+			log.Printf("fetch error: %v\n", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		s.handleItemEvent(msg)
+		if err := reader.CommitMessages(ctx, msg); err != nil {
+			log.Printf("commit error: %v\n", err)
+		}
+	}
+}
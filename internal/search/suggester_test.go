@@ -0,0 +1,171 @@
+package searchCatalog
+
+import (
+	"context"
+	"testing"
+	"time"
+	structsUFUT "ufut/lib/structs"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type staticSource struct {
+	categories           []string
+	categoryTranslations []structsUFUT.CategoryTranslationRSC
+	items                []structsUFUT.ItemDataRSC
+	translations         []structsUFUT.ItemTranslationRSC
+}
+
+func (s *staticSource) Categories(ctx context.Context) ([]string, error) {
+	return s.categories, nil
+}
+
+func (s *staticSource) CategoryTranslations(ctx context.Context) ([]structsUFUT.CategoryTranslationRSC, error) {
+	return s.categoryTranslations, nil
+}
+
+func (s *staticSource) ExportItemTranslations(ctx context.Context, fn func(tr *structsUFUT.ItemTranslationRSC) error) error {
+	for i := range s.translations {
+		if err := fn(&s.translations[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *staticSource) ExportItems(ctx context.Context, sellerID string, fn func(item *structsUFUT.ItemDataRSC) error) error {
+	for i := range s.items {
+		if err := fn(&s.items[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func suggestionTexts(resp structsUFUT.SuggestResponseRSC) []string {
+	texts := []string{}
+	for _, s := range resp.Suggestions {
+		texts = append(texts, s.Type+":"+s.Text)
+	}
+	return texts
+}
+
+func TestSuggester(t *testing.T) {
+	s := NewSuggester(DefaultSuggestConfig)
+	err := s.Load(t.Context(), &staticSource{
+		categories: []string{"books", "home"},
+		items: []structsUFUT.ItemDataRSC{
+			{ItemID: "1", Name: "Blue Lamp", Status: structsUFUT.ItemStatusAvailable},
+			{ItemID: "2", Name: "Old  Book", Status: structsUFUT.ItemStatusAvailable},
+			{ItemID: "3", Name: "old book", Status: structsUFUT.ItemStatusAvailable},
+			{ItemID: "4", Name: "Bowl", Status: structsUFUT.ItemStatusAvailable},
+			{ItemID: "5", Name: "Boots", Status: structsUFUT.ItemStatusDeleted},
+		},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"category:books", "item:Old Book", "item:Blue Lamp", "item:Bowl"},
+		suggestionTexts(s.Suggest("B", 0, nil)))
+	assert.Equal(t, []string{"category:books", "item:Old Book"}, suggestionTexts(s.Suggest(" BOO ", 0, nil)))
+	assert.Equal(t, []string{"item:Old Book"}, suggestionTexts(s.Suggest("old b", 0, nil)))
+	assert.Equal(t, []string{"category:books"}, suggestionTexts(s.Suggest("b", 1, nil)))
+	assert.Empty(t, s.Suggest("", 0, nil).Suggestions)
+	assert.Empty(t, s.Suggest("x", 0, nil).Suggestions)
+
+	s.SetItem(&structsUFUT.ItemDataRSC{ItemID: "5", Name: "Boots", Status: structsUFUT.ItemStatusAvailable})
+	s.SetItem(&structsUFUT.ItemDataRSC{ItemID: "4", Name: "Bowl", Status: structsUFUT.ItemStatusDeleted})
+	for _, user := range []string{"u1", "u2", "u3"} {
+		s.RecordQuery("boots for winter", "", user)
+	}
+	s.RecordQuery("Book shelf", "", "u1")
+	s.RecordQuery("lamp", "", "u1")
+	// changes are seen after a rebuild only
+	assert.Empty(t, s.Suggest("boo", 0, nil).Popular)
+	s.rebuild()
+
+	resp := s.Suggest("boo", 0, nil)
+	assert.Equal(t, []string{"category:books", "item:Old Book", "item:Boots"}, suggestionTexts(resp))
+	assert.Equal(t, []string{"boots for winter", "book shelf"}, resp.Popular)
+}
+
+func TestSuggester_DropsLeastPopularQueries(t *testing.T) {
+	cfg := DefaultSuggestConfig
+	cfg.MaxTrackedQueries = 10
+	s := NewSuggester(cfg)
+	// every query comes in a window of its own
+	clock := time.Now()
+	s.now = func() time.Time {
+		clock = clock.Add(cfg.UserQueryWindow)
+		return clock
+	}
+	for i := range 10 {
+		for range i + 1 {
+			s.RecordQuery(string(rune('a'+i)), "", "u1")
+		}
+	}
+	s.RecordQuery("new", "", "u1")
+	// only the least popular one makes room
+	assert.Len(t, s.queries, cfg.MaxTrackedQueries)
+	assert.NotContains(t, s.queries, localeQuery{"en", "a"})
+	assert.Contains(t, s.queries, localeQuery{"en", "b"})
+	assert.Contains(t, s.queries, localeQuery{"en", "j"})
+	assert.Equal(t, 1, s.queries[localeQuery{"en", "new"}])
+}
+
+func TestSuggester_UserQueries(t *testing.T) {
+	cfg := DefaultSuggestConfig
+	cfg.MaxUserQueries = 2
+	s := NewSuggester(cfg)
+	clock := time.Now()
+	s.now = func() time.Time { return clock }
+
+	// repeats count once, and a user's queries count up to the limit of the window
+	for range 5 {
+		s.RecordQuery("boots", "", "u1")
+	}
+	s.RecordQuery("lamp", "", "u1")
+	s.RecordQuery("bowl", "", "u1")
+	s.RecordQuery("boots", "", "u2")
+	assert.Equal(t, map[localeQuery]int{{"en", "boots"}: 2, {"en", "lamp"}: 1}, s.queries)
+
+	// a new window counts them again
+	clock = clock.Add(cfg.UserQueryWindow)
+	s.RecordQuery("boots", "", "u1")
+	s.RecordQuery("bowl", "", "u1")
+	assert.Equal(t, map[localeQuery]int{{"en", "boots"}: 3, {"en", "lamp"}: 1, {"en", "bowl"}: 1}, s.queries)
+}
+
+func TestSuggester_Locales(t *testing.T) {
+	s := NewSuggester(DefaultSuggestConfig)
+	err := s.Load(t.Context(), &staticSource{
+		categories:           []string{"books"},
+		categoryTranslations: []structsUFUT.CategoryTranslationRSC{{Category: "books", Locale: "de", DisplayName: "Bücher"}},
+		items: []structsUFUT.ItemDataRSC{
+			{ItemID: "1", Name: "Blue Lamp", Status: structsUFUT.ItemStatusAvailable},
+			{ItemID: "2", Name: "Old Book", Status: structsUFUT.ItemStatusAvailable},
+			{ItemID: "3", Name: "Bucket", Status: structsUFUT.ItemStatusDeleted},
+		},
+		translations: []structsUFUT.ItemTranslationRSC{
+			{ItemID: "1", Locale: "de", Name: "Blaue Lampe"},
+			{ItemID: "3", Locale: "de", Name: "Bucheimer"},
+		},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"category:Bücher"}, suggestionTexts(s.Suggest("büch", 0, []string{"de-AT", "de"})))
+	assert.Empty(t, s.Suggest("büch", 0, []string{"fr"}).Suggestions)
+	// untranslated items are found by their name in the catalog locale, deleted ones not at all
+	assert.Equal(t, []string{"category:Bücher", "item:Blaue Lampe", "item:Old Book"}, suggestionTexts(s.Suggest("b", 0, []string{"de"})))
+	assert.Equal(t, []string{"item:Old Book"}, suggestionTexts(s.Suggest("old", 0, []string{"de"})))
+	assert.Equal(t, []string{"item:Blue Lamp"}, suggestionTexts(s.Suggest("lamp", 0, []string{"fr"})))
+
+	s.SetItem(&structsUFUT.ItemDataRSC{ItemID: "1", Name: "Blue Lamp", Status: structsUFUT.ItemStatusAvailable,
+		Translations: []structsUFUT.ItemTranslationRSC{{Locale: "fr", Name: "Lampe bleue"}}})
+	s.RecordQuery("lampe de bureau", "fr", "u1")
+	s.rebuild()
+	assert.Empty(t, s.Suggest("lampe", 0, []string{"de"}).Suggestions)
+	resp := s.Suggest("lampe", 0, []string{"fr"})
+	assert.Equal(t, []string{"item:Lampe bleue"}, suggestionTexts(resp))
+	assert.Equal(t, []string{"lampe de bureau"}, resp.Popular)
+	assert.Empty(t, s.Suggest("lampe", 0, nil).Popular)
+}
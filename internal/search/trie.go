@@ -0,0 +1,116 @@
+package searchCatalog
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+type entry struct {
+	text   string
+	kind   string
+	weight int
+}
+
+type trieNode struct {
+	children map[rune]*trieNode
+	// entries whose key ends at this node
+	own []*entry
+	// best entries of the whole subtree, computed once when the trie is built
+	top []*entry
+}
+
+/*
+Immutable prefix tree, completions of a prefix are precomputed
+so a lookup costs only the walk down the prefix
+*/
+type trie struct {
+	root *trieNode
+}
+
+type trieBuilder struct {
+	root  *trieNode
+	limit int
+}
+
+func newTrieBuilder(limit int) *trieBuilder {
+	return &trieBuilder{root: &trieNode{}, limit: limit}
+}
+
+func (b *trieBuilder) insert(key string, e *entry) {
+	node := b.root
+	for _, r := range key {
+		if node.children == nil {
+			node.children = map[rune]*trieNode{}
+		}
+		next, ok := node.children[r]
+		if !ok {
+			next = &trieNode{}
+			node.children[r] = next
+		}
+		node = next
+	}
+	if !slices.Contains(node.own, e) {
+		node.own = append(node.own, e)
+	}
+}
+
+func (b *trieBuilder) build() *trie {
+	b.computeTop(b.root)
+	return &trie{root: b.root}
+}
+
+func (b *trieBuilder) computeTop(node *trieNode) {
+	candidates := slices.Clone(node.own)
+	for _, child := range node.children {
+		b.computeTop(child)
+		candidates = append(candidates, child.top...)
+	}
+	slices.SortFunc(candidates, compareEntries)
+	// the same entry is reachable through several keys (every word of a name)
+	candidates = slices.Compact(candidates)
+	node.top = candidates[:min(len(candidates), b.limit)]
+}
+
+func compareEntries(a, b *entry) int {
+	if c := cmp.Compare(b.weight, a.weight); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(a.text, b.text); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.kind, b.kind)
+}
+
+/*
+Returns at most limit best entries whose key starts with prefix
+*/
+func (t *trie) complete(prefix string, limit int) []*entry {
+	node := t.root
+	for _, r := range prefix {
+		node = node.children[r]
+		if node == nil {
+			return nil
+		}
+	}
+	return node.top[:min(len(node.top), limit)]
+}
+
+/*
+Lowercases text and collapses whitespace
+*/
+func normalize(text string) string {
+	return strings.Join(strings.Fields(strings.ToLower(text)), " ")
+}
+
+/*
+Returns the keys text is found by: the whole text and every suffix starting at a word
+*/
+func wordKeys(text string) []string {
+	words := strings.Fields(text)
+	keys := make([]string, 0, len(words))
+	for i := range words {
+		keys = append(keys, strings.Join(words[i:], " "))
+	}
+	return keys
+}
@@ -0,0 +1,98 @@
+package sqliteRepoCatalog
+
+import (
+	"context"
+	"time"
+	funcsUFUT "ufut/lib/funcs"
+	structsUFUT "ufut/lib/structs"
+)
+
+/*
+resp: stored exchange rate table, Reference is empty if no rates were set yet
+*/
+func (r *SQLiteRepo) ExchangeRates(ctx context.Context) (*structsUFUT.ExchangeRatesRSC, error) {
+	rows, err := r.DB.QueryContext(ctx,
+		`SELECT currency, rate, isReference, updatedAt FROM exchange_rates ORDER BY currency`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	table := &structsUFUT.ExchangeRatesRSC{Rates: []structsUFUT.ExchangeRateRSC{}}
+	for rows.Next() {
+		var rate structsUFUT.ExchangeRateRSC
+		var isReference bool
+		var updatedAt int64
+		if err := rows.Scan(&rate.Currency, &rate.Rate, &isReference, &updatedAt); err != nil {
+			return nil, err
+		}
+		if isReference {
+			table.Reference = rate.Currency
+		}
+		if t := unixTime(updatedAt); t.After(table.UpdatedAt) {
+			table.UpdatedAt = t
+		}
+		table.Rates = append(table.Rates, rate)
+	}
+	return table, rows.Err()
+}
+
+/*
+req: validated table, see funcsUFUT.NewExchangeRates
+
+Replaces the whole table in a single transaction with the reference prices of all items, sets table.UpdatedAt
+*/
+func (r *SQLiteRepo) SetExchangeRates(ctx context.Context, table *structsUFUT.ExchangeRatesRSC) error {
+	rates, err := funcsUFUT.NewExchangeRates(table)
+	if err != nil {
+		return err
+	}
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM exchange_rates`); err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO exchange_rates (currency, rate, referenceFactor, isReference, updatedAt)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(currency) DO UPDATE SET
+			rate=excluded.rate,
+			referenceFactor=excluded.referenceFactor,
+			isReference=excluded.isReference,
+			updatedAt=excluded.updatedAt;`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	now := time.Now().UTC().Truncate(time.Second)
+	insert := func(code, rate string) error {
+		factor, err := rates.ReferenceFactor(code)
+		if err != nil {
+			return err
+		}
+		_, err = stmt.ExecContext(ctx, code, rate, factor, code == rates.Reference(), now.Unix())
+		return err
+	}
+	if err := insert(rates.Reference(), "1"); err != nil {
+		return err
+	}
+	for _, rate := range table.Rates {
+		code, _ := funcsUFUT.NormalizeCurrency(rate.Currency)
+		if code == rates.Reference() {
+			continue
+		}
+		if err := insert(code, rate.Rate); err != nil {
+			return err
+		}
+	}
+	if err := refreshRefPrices(ctx, tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	table.UpdatedAt = now
+	return nil
+}
@@ -28,6 +28,31 @@ func (r *SQLiteRepo) Close() error {
 	return r.DB.Close()
 }
 
+/*
+Adds column to the table created by an older version of CreateTables
+*/
+func (r *SQLiteRepo) addColumnIfNotExists(ctx context.Context, table, column, decl string) error {
+	rows, err := r.DB.QueryContext(ctx, `SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = r.DB.ExecContext(ctx, `ALTER TABLE `+table+` ADD COLUMN `+column+` `+decl)
+	return err
+}
+
 /*
 Creates necessary tables if they do not exist
 */
@@ -41,7 +66,7 @@ func (r *SQLiteRepo) CreateTables(ctx context.Context) error {
 			description TEXT,
 			price INTEGER NOT NULL,
 			category TEXT NOT NULL,
-			status TEXT NOT NULL DEFAULT 'available',
+			status TEXT NOT NULL DEFAULT 'available'
 			);`)
 		// quantity INTEGER NOT NULL DEFAULT 0,
 		if err != nil {
@@ -72,18 +97,250 @@ func (r *SQLiteRepo) CreateTables(ctx context.Context) error {
 		}
 	}
 	{
-		q, err := r.DB.QueryContext(ctx,
-			`SELECT * FROM showcase_categories;`)
+		_, err := r.DB.ExecContext(ctx,
+			`CREATE TABLE IF NOT EXISTS showcase_item_images (
+			imageID TEXT PRIMARY KEY,
+			itemID TEXT NOT NULL,
+			position INTEGER NOT NULL,
+			contentType TEXT NOT NULL,
+			createdAt DATETIME NOT NULL
+			);`)
+		if err != nil {
+			return err
+		}
+	}
+	{
+		_, err := r.DB.ExecContext(ctx,
+			`CREATE INDEX IF NOT EXISTS showcase_item_images_itemID
+			ON showcase_item_images (itemID, position);`)
+		if err != nil {
+			return err
+		}
+	}
+	if err := r.addColumnIfNotExists(ctx, "showcase_items", "sku", "TEXT"); err != nil {
+		return err
+	}
+	// version is bumped and updatedAt (unix seconds) is set on every change of the item
+	if err := r.addColumnIfNotExists(ctx, "showcase_items", "version", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+	if err := r.addColumnIfNotExists(ctx, "showcase_items", "updatedAt", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	{
+		_, err := r.DB.ExecContext(ctx,
+			`CREATE UNIQUE INDEX IF NOT EXISTS showcase_items_seller_sku
+			ON showcase_items (sellerID, sku);`)
+		if err != nil {
+			return err
+		}
+	}
+	{
+		_, err := r.DB.ExecContext(ctx,
+			`CREATE TABLE IF NOT EXISTS showcase_moderation (
+			itemID TEXT NOT NULL,
+			moderatorID TEXT NOT NULL,
+			decision TEXT NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			decidedAt DATETIME NOT NULL
+			);`)
 		if err != nil {
-			_, err := r.DB.ExecContext(ctx,
-				`INSERT INTO showcase_categories (categoryName)
-				VALUES ('books'), ('electronics'), ('clothing'), ('home'), ('toys'), ('18+')
-				ON CONFLICT(categoryName) DO NOTHING;`)
-			if err != nil {
-				return err
-			}
+			return err
+		}
+	}
+	{
+		_, err := r.DB.ExecContext(ctx,
+			`CREATE TABLE IF NOT EXISTS showcase_item_status_history (
+			itemID TEXT NOT NULL,
+			fromStatus TEXT NOT NULL,
+			toStatus TEXT NOT NULL,
+			actorID TEXT NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			changedAt DATETIME NOT NULL
+			);`)
+		if err != nil {
+			return err
+		}
+	}
+	{
+		_, err := r.DB.ExecContext(ctx,
+			`CREATE INDEX IF NOT EXISTS showcase_item_status_history_itemID
+			ON showcase_item_status_history (itemID);`)
+		if err != nil {
+			return err
+		}
+	}
+	// prices stored before currencies were introduced are taken as USD
+	if err := r.addColumnIfNotExists(ctx, "showcase_items", "currency", "TEXT NOT NULL DEFAULT 'USD'"); err != nil {
+		return err
+	}
+	{
+		_, err := r.DB.ExecContext(ctx,
+			`CREATE TABLE IF NOT EXISTS exchange_rates (
+			currency TEXT PRIMARY KEY,
+			rate TEXT NOT NULL,
+			referenceFactor REAL NOT NULL,
+			isReference INTEGER NOT NULL DEFAULT 0,
+			updatedAt INTEGER NOT NULL
+			);`)
+		if err != nil {
+			return err
+		}
+	}
+	{
+		_, err := r.DB.ExecContext(ctx,
+			`CREATE TABLE IF NOT EXISTS showcase_item_prices (
+			priceID INTEGER PRIMARY KEY AUTOINCREMENT,
+			itemID TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			price INTEGER NOT NULL,
+			startsAt INTEGER NOT NULL,
+			endsAt INTEGER,
+			createdBy TEXT NOT NULL,
+			createdAt INTEGER NOT NULL
+			);`)
+		if err != nil {
+			return err
+		}
+	}
+	{
+		// point up to which price transitions were claimed, one row shared by every instance
+		_, err := r.DB.ExecContext(ctx,
+			`CREATE TABLE IF NOT EXISTS showcase_price_transitions (
+			id INTEGER PRIMARY KEY CHECK (id = 1),
+			processedUntil INTEGER NOT NULL
+			);`)
+		if err != nil {
+			return err
+		}
+	}
+	{
+		_, err := r.DB.ExecContext(ctx,
+			`INSERT INTO showcase_price_transitions (id, processedUntil)
+			VALUES (1, unixepoch())
+			ON CONFLICT(id) DO NOTHING;`)
+		if err != nil {
+			return err
+		}
+	}
+	{
+		_, err := r.DB.ExecContext(ctx,
+			`CREATE INDEX IF NOT EXISTS showcase_item_prices_itemID
+			ON showcase_item_prices (itemID, startsAt);`)
+		if err != nil {
+			return err
+		}
+	}
+	{
+		_, err := r.DB.ExecContext(ctx,
+			`CREATE TABLE IF NOT EXISTS showcase_item_translations (
+			itemID TEXT NOT NULL,
+			locale TEXT NOT NULL,
+			name TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			updatedBy TEXT NOT NULL,
+			updatedAt INTEGER NOT NULL,
+			PRIMARY KEY(itemID, locale)
+			);`)
+		if err != nil {
+			return err
+		}
+	}
+	{
+		_, err := r.DB.ExecContext(ctx,
+			`CREATE TABLE IF NOT EXISTS showcase_category_translations (
+			categoryName TEXT NOT NULL,
+			locale TEXT NOT NULL,
+			displayName TEXT NOT NULL,
+			updatedAt INTEGER NOT NULL,
+			PRIMARY KEY(categoryName, locale)
+			);`)
+		if err != nil {
+			return err
+		}
+	}
+	// the view is recreated so changes of its definition apply to existing databases
+	{
+		_, err := r.DB.ExecContext(ctx, `DROP VIEW IF EXISTS showcase_items_priced;`)
+		if err != nil {
+			return err
+		}
+	}
+	{
+		_, err := r.DB.ExecContext(ctx, `CREATE VIEW showcase_items_priced AS `+pricedItemsQuery)
+		if err != nil {
+			return err
+		}
+	}
+	// the listing is sorted and paged on the stored reference price, which the view can't index
+	if err := r.addColumnIfNotExists(ctx, "showcase_items", "refPrice", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	for _, index := range []string{
+		`CREATE INDEX IF NOT EXISTS showcase_items_listing ON showcase_items (status, refPrice, itemID);`,
+		`CREATE INDEX IF NOT EXISTS showcase_items_category_listing ON showcase_items (status, category, refPrice, itemID);`,
+	} {
+		if _, err := r.DB.ExecContext(ctx, index); err != nil {
+			return err
+		}
+	}
+	// catches up with prices that started or ended while the service was down
+	if err := r.RefreshItemPrices(ctx, nil); err != nil {
+		return err
+	}
+	{
+		_, err := r.DB.ExecContext(ctx,
+			`CREATE INDEX IF NOT EXISTS showcase_items_seller_status
+			ON showcase_items (sellerID, status);`)
+		if err != nil {
+			return err
+		}
+	}
+	{
+		_, err := r.DB.ExecContext(ctx,
+			`CREATE TABLE IF NOT EXISTS showcase_sellers (
+			sellerID TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			updatedAt DATETIME NOT NULL
+			);`)
+		if err != nil {
+			return err
+		}
+	}
+	{
+		_, err := r.DB.ExecContext(ctx,
+			`CREATE TABLE IF NOT EXISTS showcase_seller_ratings (
+			sellerID TEXT NOT NULL,
+			userID TEXT NOT NULL,
+			rating INTEGER NOT NULL,
+			ratedAt DATETIME NOT NULL,
+			PRIMARY KEY (sellerID, userID)
+			);`)
+		if err != nil {
+			return err
+		}
+	}
+	{
+		// users with a finished order from the seller, only they may rate it
+		_, err := r.DB.ExecContext(ctx,
+			`CREATE TABLE IF NOT EXISTS showcase_seller_customers (
+			sellerID TEXT NOT NULL,
+			userID TEXT NOT NULL,
+			PRIMARY KEY (sellerID, userID)
+			);`)
+		if err != nil {
+			return err
+		}
+	}
+	{
+		_, err := r.DB.ExecContext(ctx,
+			`INSERT INTO showcase_categories (categoryName)
+			VALUES ('books'), ('electronics'), ('clothing'), ('home'), ('toys'), ('18+')
+			ON CONFLICT(categoryName) DO NOTHING;`)
+		if err != nil {
+			return err
 		}
-		defer q.Close()
 	}
 	return nil
 }
@@ -0,0 +1,120 @@
+package sqliteRepoCatalog
+
+import (
+	"context"
+	structsUFUT "ufut/lib/structs"
+)
+
+/*
+img:
+
+	ImageID:		always
+	ItemID:			always
+	SellerID:		always (must own the item)
+	Position:		filled, placed after the item's last image
+	ContentType:		always
+
+Returns ErrItemNotFound if the seller has no such item
+*/
+func (r *SQLiteRepo) AddItemImage(ctx context.Context, img *structsUFUT.ItemImageRSC) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO showcase_item_images (imageID, itemID, position, contentType, createdAt)
+		SELECT ?, itemID,
+			(SELECT COALESCE(MAX(position), -1) + 1 FROM showcase_item_images WHERE itemID=?),
+			?, CURRENT_TIMESTAMP
+		FROM showcase_items WHERE itemID=? AND sellerID=?;`,
+		img.ImageID, img.ItemID, img.ContentType, img.ItemID, img.SellerID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrItemNotFound
+	}
+	// images are part of the item's representation
+	_, err = tx.ExecContext(ctx,
+		`UPDATE showcase_items SET version=version+1, updatedAt=unixepoch() WHERE itemID=?`, img.ItemID)
+	if err != nil {
+		return err
+	}
+	err = tx.QueryRowContext(ctx,
+		`SELECT position FROM showcase_item_images WHERE imageID=?`, img.ImageID).Scan(&img.Position)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+/*
+Returns images of the item ordered by position
+*/
+func (r *SQLiteRepo) ItemImages(ctx context.Context, itemID string) ([]structsUFUT.ItemImageRSC, error) {
+	rows, err := r.DB.QueryContext(ctx,
+		`SELECT imageID, itemID, position, contentType
+		FROM showcase_item_images WHERE itemID=? ORDER BY position`, itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var images []structsUFUT.ItemImageRSC
+	for rows.Next() {
+		var img structsUFUT.ItemImageRSC
+		if err := rows.Scan(&img.ImageID, &img.ItemID, &img.Position, &img.ContentType); err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+	return images, rows.Err()
+}
+
+/*
+img:
+
+	ImageID:		always
+	ItemID:			filled
+	Position:		filled
+	ContentType:		filled
+*/
+func (r *SQLiteRepo) ItemImage(ctx context.Context, img *structsUFUT.ItemImageRSC) error {
+	return r.DB.QueryRowContext(ctx,
+		`SELECT itemID, position, contentType FROM showcase_item_images WHERE imageID=?`,
+		img.ImageID).Scan(&img.ItemID, &img.Position, &img.ContentType)
+}
+
+/*
+Returns images of the given items grouped by itemID, each group ordered by position
+*/
+func (r *SQLiteRepo) ImagesByItemIDs(ctx context.Context, itemsIDs []string) (map[string][]structsUFUT.ItemImageRSC, error) {
+	images := make(map[string][]structsUFUT.ItemImageRSC, len(itemsIDs))
+	if len(itemsIDs) == 0 {
+		return images, nil
+	}
+	args := make([]any, len(itemsIDs))
+	for i, id := range itemsIDs {
+		args[i] = id
+	}
+	rows, err := r.DB.QueryContext(ctx,
+		`SELECT imageID, itemID, position, contentType
+		FROM showcase_item_images WHERE itemID IN (`+placeholders(len(itemsIDs))+`)
+		ORDER BY itemID, position`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var img structsUFUT.ItemImageRSC
+		if err := rows.Scan(&img.ImageID, &img.ItemID, &img.Position, &img.ContentType); err != nil {
+			return nil, err
+		}
+		images[img.ItemID] = append(images[img.ItemID], img)
+	}
+	return images, rows.Err()
+}
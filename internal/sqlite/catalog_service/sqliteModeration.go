@@ -0,0 +1,118 @@
+package sqliteRepoCatalog
+
+import (
+	"context"
+	"errors"
+	funcsUFUT "ufut/lib/funcs"
+	structsUFUT "ufut/lib/structs"
+)
+
+var (
+	ErrItemNotPending = errors.New("item is not pending review")
+)
+
+/*
+req:
+
+	Count:	always (page size)
+	Cursor:	optional, NextCursor of the previous page
+
+resp:
+
+	Items:		items pending review, oldest change first
+	NextCursor:	token of the next page, empty on the last page
+*/
+func (r *SQLiteRepo) ModerationQueue(ctx context.Context, req *structsUFUT.ModerationQueueRequestRSC) (*structsUFUT.ModerationQueueResponseRSC, error) {
+	query := `SELECT ` + itemColumns + ` FROM showcase_items_priced WHERE status=?`
+	args := []any{structsUFUT.ItemStatusPendingReview}
+	if req.Cursor != "" {
+		c, err := funcsUFUT.DecodeCursor(req.Cursor, "asc")
+		if err != nil {
+			return nil, err
+		}
+		query += ` AND (updatedAt, itemID) > (?, ?)`
+		args = append(args, c.SortKey, c.ID)
+	}
+	query += ` ORDER BY updatedAt ASC, itemID ASC LIMIT ?`
+	args = append(args, req.Count+1)
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	resp := &structsUFUT.ModerationQueueResponseRSC{Items: []structsUFUT.ItemDataRSC{}}
+	for rows.Next() {
+		var item structsUFUT.ItemDataRSC
+		if err := scanItem(rows, &item); err != nil {
+			return nil, err
+		}
+		if len(resp.Items) == req.Count {
+			last := resp.Items[len(resp.Items)-1]
+			resp.NextCursor = funcsUFUT.EncodeCursor(funcsUFUT.Cursor{
+				SortKey: last.UpdatedAt.Unix(),
+				ID:      last.ItemID,
+				Order:   "asc",
+			})
+			break
+		}
+		resp.Items = append(resp.Items, item)
+	}
+	return resp, rows.Err()
+}
+
+/*
+decision:
+
+	ItemID:		always
+	ModeratorID:	always
+	Decision:	always, ModerationApproved or ModerationRejected
+	Reason:		optional
+	DecidedAt:	filled
+
+Moves pending item to "available" (approved) or back to "draft" (rejected),
+records the decision and the status transition. Returns ErrItemNotPending if the item isn't pending review
+*/
+func (r *SQLiteRepo) ModerateItem(ctx context.Context, decision *structsUFUT.ModerationDecisionRSC) error {
+	status := structsUFUT.ItemStatusDraft
+	if decision.Decision == structsUFUT.ModerationApproved {
+		status = structsUFUT.ItemStatusAvailable
+	}
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx,
+		`UPDATE showcase_items SET status=?, version=version+1, updatedAt=unixepoch()
+		WHERE itemID=? AND status=?`,
+		status, decision.ItemID, structsUFUT.ItemStatusPendingReview)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrItemNotPending
+	}
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO showcase_moderation (itemID, moderatorID, decision, reason, decidedAt)
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+		RETURNING decidedAt`,
+		decision.ItemID, decision.ModeratorID, decision.Decision, decision.Reason).Scan(&decision.DecidedAt)
+	if err != nil {
+		return err
+	}
+	err = insertStatusChange(ctx, tx, &structsUFUT.ItemStatusChangeRSC{
+		ItemID:     decision.ItemID,
+		FromStatus: structsUFUT.ItemStatusPendingReview,
+		ToStatus:   status,
+		ActorID:    decision.ModeratorID,
+		Reason:     decision.Reason,
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,286 @@
+package sqliteRepoCatalog
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+	structsUFUT "ufut/lib/structs"
+)
+
+var (
+	ErrPriceNotFound = errors.New("scheduled price not found")
+)
+
+/*
+Resolves prices at the time of the read:
+
+	price:		active sale price, otherwise regularPrice
+	regularPrice:	latest regular entry that has started, otherwise showcase_items.price
+	saleEndsAt:	end of the active sale, NULL if there is none
+	refPrice:	price in the reference currency, for ordering items of different currencies;
+			price itself if the currency has no exchange rate. The listing sorts on the copy
+			stored in showcase_items.refPrice, see refreshRefPrices
+	updatedAt:	also moved forward when a price entry starts or ends
+*/
+const pricedItemsQuery = `
+SELECT t.itemID, t.sellerID, t.sku, t.name, t.description, t.category, t.status, t.version, t.currency,
+	t.price,
+	t.regularPrice,
+	t.saleEndsAt,
+	COALESCE((
+		SELECT CAST(ROUND(t.price * er.referenceFactor) AS INTEGER) FROM exchange_rates er WHERE er.currency = t.currency
+	), t.price) AS refPrice,
+	t.updatedAt
+FROM (
+	SELECT itemID, sellerID, sku, name, description, category, status, version, currency,
+		COALESCE(salePrice, regularPrice) AS price,
+		regularPrice,
+		saleEndsAt,
+		MAX(updatedAt, COALESCE(priceChangedAt, 0)) AS updatedAt
+	FROM (
+		SELECT i.*,
+			COALESCE((
+				SELECT p.price FROM showcase_item_prices p
+				WHERE p.itemID = i.itemID AND p.kind = 'regular' AND p.startsAt <= unixepoch()
+				ORDER BY p.startsAt DESC, p.priceID DESC LIMIT 1
+			), i.price) AS regularPrice,
+			(
+				SELECT p.price FROM showcase_item_prices p
+				WHERE p.itemID = i.itemID AND p.kind = 'sale' AND p.startsAt <= unixepoch() AND p.endsAt > unixepoch()
+				ORDER BY p.startsAt DESC, p.priceID DESC LIMIT 1
+			) AS salePrice,
+			(
+				SELECT p.endsAt FROM showcase_item_prices p
+				WHERE p.itemID = i.itemID AND p.kind = 'sale' AND p.startsAt <= unixepoch() AND p.endsAt > unixepoch()
+				ORDER BY p.startsAt DESC, p.priceID DESC LIMIT 1
+			) AS saleEndsAt,
+			(
+				SELECT MAX(CASE WHEN p.endsAt <= unixepoch() THEN p.endsAt ELSE p.startsAt END)
+				FROM showcase_item_prices p
+				WHERE p.itemID = i.itemID AND p.startsAt <= unixepoch()
+			) AS priceChangedAt
+		FROM showcase_items i
+	)
+) t`
+
+/*
+Stores refPrice and updatedAt of pricedItemsQuery in showcase_items for the items, all items if none are given.
+Called with every change of prices or exchange rates; entries starting or ending later are applied
+by ClaimPriceTransitions
+*/
+func refreshRefPrices(ctx context.Context, tx *sql.Tx, itemIDs ...string) error {
+	query := `UPDATE showcase_items SET refPrice=p.refPrice, updatedAt=p.updatedAt
+		FROM showcase_items_priced p
+		WHERE p.itemID=showcase_items.itemID`
+	args := make([]any, 0, len(itemIDs))
+	if len(itemIDs) > 0 {
+		query += ` AND showcase_items.itemID IN (` + placeholders(len(itemIDs)) + `)`
+		for _, id := range itemIDs {
+			args = append(args, id)
+		}
+	}
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+/*
+Brings the stored reference prices of the items up to date, e.g. once their scheduled prices started or ended
+*/
+func (r *SQLiteRepo) RefreshItemPrices(ctx context.Context, itemIDs []string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := refreshRefPrices(ctx, tx, itemIDs...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+/*
+Records a regular price entry starting now unless the item's current regular price already equals price
+*/
+func insertRegularPrice(ctx context.Context, tx *sql.Tx, itemID string, price int, createdBy string) error {
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO showcase_item_prices (itemID, kind, price, startsAt, createdBy, createdAt)
+		SELECT ?, 'regular', ?, unixepoch(), ?, unixepoch()
+		WHERE NOT EXISTS (
+			SELECT 1 FROM showcase_items_priced WHERE itemID=? AND regularPrice=?
+		) OR NOT EXISTS (
+			SELECT 1 FROM showcase_item_prices WHERE itemID=?
+		)`,
+		itemID, price, createdBy, itemID, price, itemID)
+	return err
+}
+
+/*
+entry:
+
+	ItemID, Kind, Price, StartsAt, CreatedBy:	always
+	EndsAt:						always for sales, ignored for regular prices
+	PriceID, CreatedAt:				filled
+
+Stores the price entry and bumps the item's version.
+Returns ErrItemNotFound if entry.CreatedBy isn't the item's seller
+*/
+func (r *SQLiteRepo) AddItemPrice(ctx context.Context, entry *structsUFUT.ItemPriceRSC) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx,
+		`UPDATE showcase_items SET version=version+1, updatedAt=unixepoch()
+		WHERE itemID=? AND sellerID=?`, entry.ItemID, entry.CreatedBy)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrItemNotFound
+	}
+	var endsAt sql.NullInt64
+	if entry.Kind == structsUFUT.PriceKindSale && entry.EndsAt != nil {
+		endsAt = sql.NullInt64{Int64: entry.EndsAt.Unix(), Valid: true}
+	}
+	var createdAt int64
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO showcase_item_prices (itemID, kind, price, startsAt, endsAt, createdBy, createdAt)
+		VALUES (?, ?, ?, ?, ?, ?, unixepoch())
+		RETURNING priceID, createdAt`,
+		entry.ItemID, entry.Kind, entry.Price, entry.StartsAt.Unix(), endsAt, entry.CreatedBy).
+		Scan(&entry.PriceID, &createdAt)
+	if err != nil {
+		return err
+	}
+	if err := refreshRefPrices(ctx, tx, entry.ItemID); err != nil {
+		return err
+	}
+	entry.CreatedAt = unixTime(createdAt)
+	return tx.Commit()
+}
+
+/*
+Removes a price entry that hasn't started yet and bumps the item's version.
+Returns ErrPriceNotFound if there is no such future entry of the seller's item
+*/
+func (r *SQLiteRepo) CancelItemPrice(ctx context.Context, itemID string, priceID int64, sellerID string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx,
+		`DELETE FROM showcase_item_prices
+		WHERE priceID=? AND itemID=? AND startsAt > unixepoch()
+			AND itemID IN (SELECT itemID FROM showcase_items WHERE sellerID=?)`,
+		priceID, itemID, sellerID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrPriceNotFound
+	}
+	_, err = tx.ExecContext(ctx,
+		`UPDATE showcase_items SET version=version+1, updatedAt=unixepoch() WHERE itemID=?`, itemID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+/*
+Returns price entries of the item ordered by start,
+entries that haven't started yet are skipped unless withScheduled
+*/
+func (r *SQLiteRepo) ItemPriceHistory(ctx context.Context, itemID string, withScheduled bool) ([]structsUFUT.ItemPriceRSC, error) {
+	rows, err := r.DB.QueryContext(ctx,
+		`SELECT p.priceID, p.itemID, p.kind, p.price, i.currency, p.startsAt, p.endsAt, p.createdBy, p.createdAt
+		FROM showcase_item_prices p
+		JOIN showcase_items i ON i.itemID = p.itemID
+		WHERE p.itemID=? AND (? OR p.startsAt <= unixepoch())
+		ORDER BY p.startsAt, p.priceID`, itemID, withScheduled)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	history := []structsUFUT.ItemPriceRSC{}
+	for rows.Next() {
+		var entry structsUFUT.ItemPriceRSC
+		var startsAt, createdAt int64
+		var endsAt sql.NullInt64
+		err := rows.Scan(&entry.PriceID, &entry.ItemID, &entry.Kind, &entry.Price, &entry.Currency,
+			&startsAt, &endsAt, &entry.CreatedBy, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+		entry.StartsAt = unixTime(startsAt)
+		entry.CreatedAt = unixTime(createdAt)
+		if endsAt.Valid {
+			t := unixTime(endsAt.Int64)
+			entry.EndsAt = &t
+		}
+		history = append(history, entry)
+	}
+	return history, rows.Err()
+}
+
+/*
+Returns IDs of items whose effective price changed since the previous claim up to until, because a price entry
+started or ended, and brings their stored reference prices up to date. The claimed point is stored with them,
+so each transition is returned once, to one caller, across restarts and instances
+*/
+func (r *SQLiteRepo) ClaimPriceTransitions(ctx context.Context, until time.Time) ([]string, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	var after int64
+	if err := tx.QueryRowContext(ctx,
+		`SELECT processedUntil FROM showcase_price_transitions WHERE id=1`).Scan(&after); err != nil {
+		return nil, err
+	}
+	if until.Unix() <= after {
+		return nil, nil
+	}
+	res, err := tx.ExecContext(ctx,
+		`UPDATE showcase_price_transitions SET processedUntil=? WHERE id=1 AND processedUntil=?`, until.Unix(), after)
+	if err != nil {
+		return nil, err
+	}
+	// another instance has claimed them first
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return nil, err
+	}
+	rows, err := tx.QueryContext(ctx,
+		`SELECT DISTINCT itemID FROM showcase_item_prices
+		WHERE (startsAt > ? AND startsAt <= ?) OR (endsAt > ? AND endsAt <= ?)`,
+		after, until.Unix(), after, until.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) > 0 {
+		if err := refreshRefPrices(ctx, tx, ids...); err != nil {
+			return nil, err
+		}
+	}
+	return ids, tx.Commit()
+}
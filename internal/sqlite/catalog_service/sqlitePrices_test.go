@@ -0,0 +1,128 @@
+package sqliteRepoCatalog
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	structsUFUT "ufut/lib/structs"
+
+	"github.com/stretchr/testify/assert"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func createTestRepo(t *testing.T) *SQLiteRepo {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "catalog_test.db"))
+	if err != nil {
+		t.Fatalf("%v", err.Error())
+	}
+	t.Cleanup(func() { db.Close() })
+	repo := NewSQLiteRepo(db)
+	if err := repo.CreateTables(t.Context()); err != nil {
+		t.Fatalf("%v", err.Error())
+	}
+	return repo
+}
+
+func listing(t *testing.T, repo *SQLiteRepo, req structsUFUT.ItemsRequestRSC) []string {
+	req.Count = 10
+	resp, err := repo.ItemsByParams(t.Context(), &req)
+	assert.NoError(t, err)
+	return resp.ItemsIDs
+}
+
+func TestSQLiteRepo_ListingRefPrice(t *testing.T) {
+	repo := createTestRepo(t)
+	for _, item := range []structsUFUT.ItemDataRSC{
+		{ItemID: "usd", SellerID: "s1", Name: "book", Price: 1000, Currency: "USD", Category: "books"},
+		{ItemID: "eur", SellerID: "s1", Name: "book", Price: 950, Currency: "EUR", Category: "books"},
+	} {
+		item.Status = structsUFUT.ItemStatusAvailable
+		assert.NoError(t, repo.CreateItem(t.Context(), &item))
+	}
+	// without rates prices are compared as they are
+	assert.Equal(t, []string{"eur", "usd"}, listing(t, repo, structsUFUT.ItemsRequestRSC{OrderBy: "asc"}))
+
+	// a rate change reorders the stored reference prices
+	assert.NoError(t, repo.SetExchangeRates(t.Context(), &structsUFUT.ExchangeRatesRSC{
+		Reference: "USD",
+		Rates:     []structsUFUT.ExchangeRateRSC{{Currency: "USD", Rate: "1"}, {Currency: "EUR", Rate: "0.9"}},
+	}))
+	assert.Equal(t, []string{"usd", "eur"}, listing(t, repo, structsUFUT.ItemsRequestRSC{OrderBy: "asc"}))
+
+	// a scheduled price moves the item once it has started and the item is refreshed,
+	// two hours pass by shifting the item's prices back
+	assert.NoError(t, repo.AddItemPrice(t.Context(), &structsUFUT.ItemPriceRSC{
+		ItemID: "usd", Kind: structsUFUT.PriceKindRegular, Price: 1100, StartsAt: time.Now().Add(time.Hour), CreatedBy: "s1"}))
+	assert.Equal(t, []string{"usd", "eur"}, listing(t, repo, structsUFUT.ItemsRequestRSC{OrderBy: "asc"}))
+	_, err := repo.DB.ExecContext(t.Context(), `UPDATE showcase_item_prices SET startsAt=startsAt-7200 WHERE itemID='usd'`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"usd", "eur"}, listing(t, repo, structsUFUT.ItemsRequestRSC{OrderBy: "asc"}))
+	assert.NoError(t, repo.RefreshItemPrices(t.Context(), []string{"usd"}))
+	assert.Equal(t, []string{"eur", "usd"}, listing(t, repo, structsUFUT.ItemsRequestRSC{OrderBy: "asc"}))
+}
+
+func TestSQLiteRepo_ListingUsesIndex(t *testing.T) {
+	repo := createTestRepo(t)
+	for _, query := range []string{
+		`SELECT itemID FROM showcase_items WHERE status IN (?) AND (refPrice, itemID) > (?, ?)
+		ORDER BY refPrice ASC, itemID ASC LIMIT 11`,
+		`SELECT itemID FROM showcase_items WHERE status IN (?) AND category=? AND (refPrice, itemID) < (?, ?)
+		ORDER BY refPrice DESC, itemID DESC LIMIT 11`,
+	} {
+		rows, err := repo.DB.QueryContext(t.Context(), `EXPLAIN QUERY PLAN `+query, "available", "books", 0, "")
+		assert.NoError(t, err)
+		var plan []string
+		for rows.Next() {
+			var id, parent, unused int
+			var detail string
+			assert.NoError(t, rows.Scan(&id, &parent, &unused, &detail))
+			plan = append(plan, detail)
+		}
+		assert.NoError(t, rows.Close())
+		text := strings.Join(plan, "\n")
+		assert.Contains(t, text, "INDEX showcase_items_")
+		assert.NotContains(t, text, "TEMP B-TREE", "pages are read in index order, without sorting")
+	}
+}
+
+func TestSQLiteRepo_ClaimPriceTransitions(t *testing.T) {
+	repo := createTestRepo(t)
+	for _, item := range []structsUFUT.ItemDataRSC{
+		{ItemID: "a", SellerID: "s1", Name: "book", Price: 1000, Currency: "USD", Category: "books"},
+		{ItemID: "b", SellerID: "s1", Name: "book", Price: 800, Currency: "USD", Category: "books"},
+	} {
+		item.Status = structsUFUT.ItemStatusAvailable
+		assert.NoError(t, repo.CreateItem(t.Context(), &item))
+	}
+	endsAt := time.Now().Add(2 * time.Hour)
+	assert.NoError(t, repo.AddItemPrice(t.Context(), &structsUFUT.ItemPriceRSC{
+		ItemID: "a", Kind: structsUFUT.PriceKindSale, Price: 500, CreatedBy: "s1",
+		StartsAt: time.Now().Add(time.Hour), EndsAt: &endsAt}))
+	// the previous claim was an hour ago, after the regular prices, and the sale has started since
+	_, err := repo.DB.ExecContext(t.Context(), `UPDATE showcase_price_transitions SET processedUntil=unixepoch()-3600`)
+	assert.NoError(t, err)
+	_, err = repo.DB.ExecContext(t.Context(), `UPDATE showcase_item_prices SET startsAt=startsAt-7200 WHERE kind='regular'`)
+	assert.NoError(t, err)
+	_, err = repo.DB.ExecContext(t.Context(), `UPDATE showcase_item_prices SET startsAt=unixepoch()-60 WHERE kind='sale'`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, listing(t, repo, structsUFUT.ItemsRequestRSC{OrderBy: "desc"}))
+
+	// the item is claimed once, and moved in the listing
+	now := time.Now()
+	ids, err := repo.ClaimPriceTransitions(t.Context(), now)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, ids)
+	assert.Equal(t, []string{"b", "a"}, listing(t, repo, structsUFUT.ItemsRequestRSC{OrderBy: "desc"}))
+	for _, until := range []time.Time{now, now.Add(-time.Minute), now.Add(time.Minute)} {
+		ids, err = repo.ClaimPriceTransitions(t.Context(), until)
+		assert.NoError(t, err)
+		assert.Empty(t, ids)
+	}
+	var processedUntil int64
+	assert.NoError(t, repo.DB.QueryRowContext(t.Context(),
+		`SELECT processedUntil FROM showcase_price_transitions`).Scan(&processedUntil))
+	assert.Equal(t, now.Add(time.Minute).Unix(), processedUntil)
+}
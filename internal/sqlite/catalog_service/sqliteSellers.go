@@ -0,0 +1,110 @@
+package sqliteRepoCatalog
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	structsUFUT "ufut/lib/structs"
+)
+
+var (
+	ErrSellerNotFound = errors.New("seller not found")
+)
+
+/*
+req:
+
+	SellerID: always
+
+resp:
+
+	Name, Description, UpdatedAt: filled from the profile
+	Rating, RatingCount: average of users' ratings and their number
+*/
+func (r *SQLiteRepo) SellerProfile(ctx context.Context, req *structsUFUT.SellerProfileRSC) error {
+	err := r.DB.QueryRowContext(ctx,
+		`SELECT s.name, s.description, s.updatedAt,
+			COALESCE(AVG(sr.rating), 0), COUNT(sr.rating)
+		FROM showcase_sellers s
+		LEFT JOIN showcase_seller_ratings sr ON sr.sellerID = s.sellerID
+		WHERE s.sellerID=?
+		GROUP BY s.sellerID`, req.SellerID).
+		Scan(&req.Name, &req.Description, &req.UpdatedAt, &req.Rating, &req.RatingCount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrSellerNotFound
+	}
+	return err
+}
+
+/*
+profile:
+
+	SellerID, Name, Description: always
+	Rating, RatingCount: ignored
+
+Creates or replaces the seller's profile
+*/
+func (r *SQLiteRepo) UpsertSellerProfile(ctx context.Context, profile *structsUFUT.SellerProfileRSC) error {
+	_, err := r.DB.ExecContext(ctx,
+		`INSERT INTO showcase_sellers (sellerID, name, description, updatedAt)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(sellerID) DO UPDATE SET
+			name=excluded.name,
+			description=excluded.description,
+			updatedAt=excluded.updatedAt`,
+		profile.SellerID, profile.Name, profile.Description)
+	return err
+}
+
+/*
+Stores the user's rating of the seller, replacing the user's previous rating.
+Returns ErrSellerNotFound if the seller has no profile
+*/
+func (r *SQLiteRepo) RateSeller(ctx context.Context, rating *structsUFUT.SellerRatingRSC) error {
+	res, err := r.DB.ExecContext(ctx,
+		`INSERT INTO showcase_seller_ratings (sellerID, userID, rating, ratedAt)
+		SELECT sellerID, ?, ?, CURRENT_TIMESTAMP FROM showcase_sellers WHERE sellerID=?
+		ON CONFLICT(sellerID, userID) DO UPDATE SET
+			rating=excluded.rating,
+			ratedAt=excluded.ratedAt`,
+		rating.UserID, rating.Rating, rating.SellerID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrSellerNotFound
+	}
+	return nil
+}
+
+/*
+Records that the user has a finished order from each of the sellers, recording it again does nothing
+*/
+func (r *SQLiteRepo) AddSellerCustomer(ctx context.Context, userID string, sellerIDs []string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, sellerID := range sellerIDs {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO showcase_seller_customers (sellerID, userID) VALUES (?, ?)
+			ON CONFLICT(sellerID, userID) DO NOTHING`, sellerID, userID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *SQLiteRepo) IsSellerCustomer(ctx context.Context, sellerID, userID string) (bool, error) {
+	var ok bool
+	err := r.DB.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM showcase_seller_customers WHERE sellerID=? AND userID=?)`,
+		sellerID, userID).Scan(&ok)
+	return ok, err
+}
@@ -2,24 +2,183 @@ package sqliteRepoCatalog
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	structsUFUT "ufut/lib/structs"
 )
 
+/*
+Inserts the item and records its initial status and price in the history tables,
+item.SellerID is recorded as the actor
+*/
 func (r *SQLiteRepo) CreateItem(ctx context.Context, item *structsUFUT.ItemDataRSC) error {
-	_, err := r.DB.ExecContext(ctx, `
-		INSERT INTO showcase_items (itemID, sellerID, name, description, price, category, status)
-		VALUES (?, ?, ?, ?, ?,?,?,?);`,
-		item.ItemID, item.SellerID, item.Name, item.Description, item.Price, item.Category, item.Status)
-	return err
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO showcase_items (itemID, sellerID, sku, name, description, price, currency, category, status, version, updatedAt)
+		VALUES (?, ?, NULLIF(?, ''), ?, ?, ?, ?, ?, ?, 1, unixepoch());`,
+		item.ItemID, item.SellerID, item.SKU, item.Name, item.Description, item.Price, item.Currency, item.Category, item.Status)
+	if err != nil {
+		return err
+	}
+	err = insertStatusChange(ctx, tx, &structsUFUT.ItemStatusChangeRSC{
+		ItemID:   item.ItemID,
+		ToStatus: item.Status,
+		ActorID:  item.SellerID,
+	})
+	if err != nil {
+		return err
+	}
+	if err := insertRegularPrice(ctx, tx, item.ItemID, item.Price, item.SellerID); err != nil {
+		return err
+	}
+	if err := refreshRefPrices(ctx, tx, item.ItemID); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (r *SQLiteRepo) DeleteItem(ctx context.Context, item *structsUFUT.ItemDataRSC) error {
-	_, err := r.DB.ExecContext(ctx,
-		`UPDATE showcase_items SET status='deleted' WHERE itemID=? AND category=?;`,
-		item.ItemID, item.Category)
-	return err
+/*
+Returns itemIDs of the seller's items keyed by SKU; unknown SKUs are skipped
+*/
+func (r *SQLiteRepo) ItemIDsBySKUs(ctx context.Context, sellerID string, skus []string) (map[string]string, error) {
+	ids := make(map[string]string, len(skus))
+	if len(skus) == 0 {
+		return ids, nil
+	}
+	args := make([]any, 0, len(skus)+1)
+	args = append(args, sellerID)
+	for _, sku := range skus {
+		args = append(args, sku)
+	}
+	rows, err := r.DB.QueryContext(ctx,
+		`SELECT sku, itemID FROM showcase_items
+		WHERE sellerID=? AND sku IN (`+placeholders(len(skus))+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sku, itemID string
+		if err := rows.Scan(&sku, &itemID); err != nil {
+			return nil, err
+		}
+		ids[sku] = itemID
+	}
+	return ids, rows.Err()
 }
 
 /*
-update quantity
+items:
+
+	ItemID:			used only when a new item is inserted
+	SellerID, SKU:		always (identify the item)
+	Status:			used only when a new item is inserted
+	other fields:		always (new values)
+
+Inserts or updates all items in a single transaction, approved items whose name, description
+or category changed go back to pending_review.
+Initial status of inserted items, status changes and changed prices are recorded in the history tables
 */
+func (r *SQLiteRepo) UpsertItemsBySKU(ctx context.Context, items []structsUFUT.ItemDataRSC) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO showcase_items (itemID, sellerID, sku, name, description, price, currency, category, status, version, updatedAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 1, unixepoch())
+		ON CONFLICT(sellerID, sku) DO UPDATE SET
+			name=excluded.name,
+			description=excluded.description,
+			price=excluded.price,
+			currency=excluded.currency,
+			category=excluded.category,
+			status=CASE WHEN status IN (?, ?) AND (name IS NOT excluded.name
+				OR description IS NOT excluded.description OR category IS NOT excluded.category)
+				THEN ? ELSE status END,
+			version=version+1,
+			updatedAt=unixepoch()
+		RETURNING itemID, status;`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, item := range items {
+		var fromStatus string
+		err := tx.QueryRowContext(ctx,
+			`SELECT status FROM showcase_items WHERE sellerID=? AND sku=?`, item.SellerID, item.SKU).Scan(&fromStatus)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		var itemID, status string
+		err = stmt.QueryRowContext(ctx,
+			item.ItemID, item.SellerID, item.SKU, item.Name, item.Description, item.Price, item.Currency, item.Category, item.Status,
+			structsUFUT.ItemStatusAvailable, structsUFUT.ItemStatusOutOfStock, structsUFUT.ItemStatusPendingReview).Scan(&itemID, &status)
+		if err != nil {
+			return err
+		}
+		if err := insertRegularPrice(ctx, tx, itemID, item.Price, item.SellerID); err != nil {
+			return err
+		}
+		if err := refreshRefPrices(ctx, tx, itemID); err != nil {
+			return err
+		}
+		if status == fromStatus {
+			// existing item was updated, its status is unchanged
+			continue
+		}
+		reason := ""
+		if fromStatus != "" {
+			reason = "content changed by import"
+		}
+		err = insertStatusChange(ctx, tx, &structsUFUT.ItemStatusChangeRSC{
+			ItemID:     itemID,
+			FromStatus: fromStatus,
+			ToStatus:   status,
+			ActorID:    item.SellerID,
+			Reason:     reason,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+/*
+Calls fn for every item of the seller (of all sellers if sellerID is empty)
+ordered by itemID, stops at the first error returned by fn
+*/
+func (r *SQLiteRepo) ExportItems(ctx context.Context, sellerID string, fn func(item *structsUFUT.ItemDataRSC) error) error {
+	query := `SELECT ` + itemColumns + ` FROM showcase_items_priced`
+	var args []any
+	if sellerID != "" {
+		query += ` WHERE sellerID=?`
+		args = append(args, sellerID)
+	}
+	query += ` ORDER BY itemID`
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item structsUFUT.ItemDataRSC
+		if err := scanItem(rows, &item); err != nil {
+			return err
+		}
+		// exported price is the regular one, so a re-import doesn't make a sale price permanent
+		if item.SaleEndsAt != nil {
+			item.Price, item.RegularPrice, item.SaleEndsAt = item.RegularPrice, 0, nil
+		}
+		if err := fn(&item); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
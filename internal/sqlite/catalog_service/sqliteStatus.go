@@ -0,0 +1,87 @@
+package sqliteRepoCatalog
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	structsUFUT "ufut/lib/structs"
+)
+
+var (
+	ErrStatusConflict = errors.New("item status was changed concurrently")
+)
+
+/*
+change:
+
+	ItemID:		always
+	FromStatus:	always (status the item is expected to have)
+	ToStatus:	always
+	ActorID:	always
+	Reason:		optional
+	ChangedAt:	filled
+
+Moves the item to ToStatus only if it still has FromStatus and records the transition.
+Returns ErrStatusConflict if the item's status isn't FromStatus
+*/
+func (r *SQLiteRepo) ChangeItemStatus(ctx context.Context, change *structsUFUT.ItemStatusChangeRSC) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx,
+		`UPDATE showcase_items SET status=?, version=version+1, updatedAt=unixepoch()
+		WHERE itemID=? AND status=?`,
+		change.ToStatus, change.ItemID, change.FromStatus)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrStatusConflict
+	}
+	if err := insertStatusChange(ctx, tx, change); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+/*
+Records the transition and fills change.ChangedAt
+*/
+func insertStatusChange(ctx context.Context, tx *sql.Tx, change *structsUFUT.ItemStatusChangeRSC) error {
+	return tx.QueryRowContext(ctx,
+		`INSERT INTO showcase_item_status_history (itemID, fromStatus, toStatus, actorID, reason, changedAt)
+		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		RETURNING changedAt`,
+		change.ItemID, change.FromStatus, change.ToStatus, change.ActorID, change.Reason).Scan(&change.ChangedAt)
+}
+
+/*
+Returns all status transitions of the item, oldest first
+*/
+func (r *SQLiteRepo) ItemStatusHistory(ctx context.Context, itemID string) ([]structsUFUT.ItemStatusChangeRSC, error) {
+	rows, err := r.DB.QueryContext(ctx,
+		`SELECT itemID, fromStatus, toStatus, actorID, reason, changedAt
+		FROM showcase_item_status_history
+		WHERE itemID=?
+		ORDER BY rowid`, itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	history := []structsUFUT.ItemStatusChangeRSC{}
+	for rows.Next() {
+		var change structsUFUT.ItemStatusChangeRSC
+		err := rows.Scan(&change.ItemID, &change.FromStatus, &change.ToStatus, &change.ActorID, &change.Reason, &change.ChangedAt)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, change)
+	}
+	return history, rows.Err()
+}
@@ -0,0 +1,261 @@
+package sqliteRepoCatalog
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	structsUFUT "ufut/lib/structs"
+)
+
+var (
+	ErrTranslationNotFound = errors.New("translation not found")
+	ErrCategoryNotFound    = errors.New("category not found")
+)
+
+/*
+Returns translations of the items keyed by itemID, each ordered by locale
+*/
+func (r *SQLiteRepo) ItemTranslations(ctx context.Context, itemsIDs []string) (map[string][]structsUFUT.ItemTranslationRSC, error) {
+	translations := make(map[string][]structsUFUT.ItemTranslationRSC, len(itemsIDs))
+	if len(itemsIDs) == 0 {
+		return translations, nil
+	}
+	args := make([]any, len(itemsIDs))
+	for i, id := range itemsIDs {
+		args[i] = id
+	}
+	rows, err := r.DB.QueryContext(ctx,
+		`SELECT itemID, locale, name, description, updatedBy, updatedAt FROM showcase_item_translations
+		WHERE itemID IN (`+placeholders(len(itemsIDs))+`)
+		ORDER BY itemID, locale`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		tr, err := scanItemTranslation(rows)
+		if err != nil {
+			return nil, err
+		}
+		translations[tr.ItemID] = append(translations[tr.ItemID], tr)
+	}
+	return translations, rows.Err()
+}
+
+/*
+Calls fn for every item translation ordered by itemID, stops at the first error returned by fn
+*/
+func (r *SQLiteRepo) ExportItemTranslations(ctx context.Context, fn func(tr *structsUFUT.ItemTranslationRSC) error) error {
+	rows, err := r.DB.QueryContext(ctx,
+		`SELECT itemID, locale, name, description, updatedBy, updatedAt FROM showcase_item_translations
+		ORDER BY itemID, locale`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		tr, err := scanItemTranslation(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(&tr); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func scanItemTranslation(row rowScanner) (structsUFUT.ItemTranslationRSC, error) {
+	var tr structsUFUT.ItemTranslationRSC
+	var updatedAt int64
+	err := row.Scan(&tr.ItemID, &tr.Locale, &tr.Name, &tr.Description, &tr.UpdatedBy, &updatedAt)
+	tr.UpdatedAt = unixTime(updatedAt)
+	return tr, err
+}
+
+/*
+req:
+
+	ItemID, Locale:		always (identify the translation)
+	Name, Description:	always (new values)
+	UpdatedBy:		always, the item's seller
+	UpdatedAt:		set on success
+
+Inserts or replaces the translation and bumps the item's version, an approved item goes back to pending_review
+if the translation changed. ErrItemNotFound if the item isn't the seller's
+*/
+func (r *SQLiteRepo) UpsertItemTranslation(ctx context.Context, tr *structsUFUT.ItemTranslationRSC) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := bumpSellerItem(ctx, tx, tr.ItemID, tr.UpdatedBy); err != nil {
+		return err
+	}
+	var unchanged bool
+	err = tx.QueryRowContext(ctx,
+		`SELECT EXISTS (
+			SELECT 1 FROM showcase_item_translations WHERE itemID=? AND locale=? AND name=? AND description=?
+		)`, tr.ItemID, tr.Locale, tr.Name, tr.Description).Scan(&unchanged)
+	if err != nil {
+		return err
+	}
+	if !unchanged {
+		if err := returnToReview(ctx, tx, tr.ItemID, tr.UpdatedBy, "translation changed"); err != nil {
+			return err
+		}
+	}
+	var updatedAt int64
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO showcase_item_translations (itemID, locale, name, description, updatedBy, updatedAt)
+		VALUES (?, ?, ?, ?, ?, unixepoch())
+		ON CONFLICT(itemID, locale) DO UPDATE SET
+			name=excluded.name,
+			description=excluded.description,
+			updatedBy=excluded.updatedBy,
+			updatedAt=excluded.updatedAt
+		RETURNING updatedAt`,
+		tr.ItemID, tr.Locale, tr.Name, tr.Description, tr.UpdatedBy).Scan(&updatedAt)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	tr.UpdatedAt = unixTime(updatedAt)
+	return nil
+}
+
+/*
+Removes the translation of the seller's item and bumps the item's version
+*/
+func (r *SQLiteRepo) DeleteItemTranslation(ctx context.Context, itemID, locale, sellerID string) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := bumpSellerItem(ctx, tx, itemID, sellerID); err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx,
+		`DELETE FROM showcase_item_translations WHERE itemID=? AND locale=?`, itemID, locale)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrTranslationNotFound
+	}
+	return tx.Commit()
+}
+
+/*
+Bumps version of the seller's item, ErrItemNotFound if there is no such item of the seller
+*/
+func bumpSellerItem(ctx context.Context, tx *sql.Tx, itemID, sellerID string) error {
+	res, err := tx.ExecContext(ctx,
+		`UPDATE showcase_items SET version=version+1, updatedAt=unixepoch()
+		WHERE itemID=? AND sellerID=?`, itemID, sellerID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrItemNotFound
+	}
+	return nil
+}
+
+/*
+Moves an approved (available or out of stock) item back to pending_review and records the transition,
+items in other statuses are left as they are
+*/
+func returnToReview(ctx context.Context, tx *sql.Tx, itemID, actorID, reason string) error {
+	var fromStatus string
+	err := tx.QueryRowContext(ctx,
+		`SELECT status FROM showcase_items WHERE itemID=? AND status IN (?, ?)`,
+		itemID, structsUFUT.ItemStatusAvailable, structsUFUT.ItemStatusOutOfStock).Scan(&fromStatus)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		`UPDATE showcase_items SET status=? WHERE itemID=?`, structsUFUT.ItemStatusPendingReview, itemID)
+	if err != nil {
+		return err
+	}
+	return insertStatusChange(ctx, tx, &structsUFUT.ItemStatusChangeRSC{
+		ItemID:     itemID,
+		FromStatus: fromStatus,
+		ToStatus:   structsUFUT.ItemStatusPendingReview,
+		ActorID:    actorID,
+		Reason:     reason,
+	})
+}
+
+/*
+Returns display names of categories in all locales ordered by category and locale
+*/
+func (r *SQLiteRepo) CategoryTranslations(ctx context.Context) ([]structsUFUT.CategoryTranslationRSC, error) {
+	rows, err := r.DB.QueryContext(ctx,
+		`SELECT categoryName, locale, displayName, updatedAt FROM showcase_category_translations
+		ORDER BY categoryName, locale`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	translations := []structsUFUT.CategoryTranslationRSC{}
+	for rows.Next() {
+		var tr structsUFUT.CategoryTranslationRSC
+		var updatedAt int64
+		if err := rows.Scan(&tr.Category, &tr.Locale, &tr.DisplayName, &updatedAt); err != nil {
+			return nil, err
+		}
+		tr.UpdatedAt = unixTime(updatedAt)
+		translations = append(translations, tr)
+	}
+	return translations, rows.Err()
+}
+
+/*
+Inserts or replaces the display name of the category in the locale, ErrCategoryNotFound for unknown categories
+*/
+func (r *SQLiteRepo) UpsertCategoryTranslation(ctx context.Context, tr *structsUFUT.CategoryTranslationRSC) error {
+	var updatedAt int64
+	err := r.DB.QueryRowContext(ctx,
+		`INSERT INTO showcase_category_translations (categoryName, locale, displayName, updatedAt)
+		SELECT categoryName, ?, ?, unixepoch() FROM showcase_categories WHERE categoryName=?
+		ON CONFLICT(categoryName, locale) DO UPDATE SET
+			displayName=excluded.displayName,
+			updatedAt=excluded.updatedAt
+		RETURNING updatedAt`,
+		tr.Locale, tr.DisplayName, tr.Category).Scan(&updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrCategoryNotFound
+	}
+	if err != nil {
+		return err
+	}
+	tr.UpdatedAt = unixTime(updatedAt)
+	return nil
+}
+
+func (r *SQLiteRepo) DeleteCategoryTranslation(ctx context.Context, category, locale string) error {
+	res, err := r.DB.ExecContext(ctx,
+		`DELETE FROM showcase_category_translations WHERE categoryName=? AND locale=?`, category, locale)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrTranslationNotFound
+	}
+	return nil
+}
@@ -2,12 +2,17 @@ package sqliteRepoCatalog
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"strings"
+	"time"
+	funcsUFUT "ufut/lib/funcs"
 	structsUFUT "ufut/lib/structs"
 )
 
 var (
-	ErrSoldOut = errors.New("item is sold out")
+	ErrSoldOut      = errors.New("item is sold out")
+	ErrItemNotFound = errors.New("item not found")
 )
 
 /*
@@ -34,37 +39,144 @@ func (r *SQLiteRepo) Categories(ctx context.Context) ([]string, error) {
 /*
 req:
 
-	Category: always (specifies which category to search in)
+	Category: optional (specifies which category to search in, all categories if empty)
 	Price: TODO
-	StartIndex: optional, 0 if not provided (offset from begging)
-	Count: optional, 10 if not provided (number of items in response)
+	OrderBy sorts by price converted to the reference currency, stored in showcase_items.refPrice
+	StartIndex: optional, ignored if Cursor is provided (offset from begging)
+	Count: always (number of items in response)
 	OrderBy: "asc" or "desc". optional, "desc" if not provided. (specifies order)
+	Cursor: optional, NextCursor of the previous page
+	SellerID: optional (lists only this seller's items)
+	Statuses: optional (lists items with any of these statuses, only available items if empty)
 
 resp:
 
 	ItemsID: array of <string>ItemID
+	Versions: array of item versions, parallel to ItemsID
+	LastModified: latest UpdatedAt of the listed items
+	NextCursor: token of the next page, empty on the last page
 */
 func (r *SQLiteRepo) ItemsByParams(ctx context.Context, req *structsUFUT.ItemsRequestRSC) (structsUFUT.ItemsResponseRSC, error) {
 	var resp structsUFUT.ItemsResponseRSC
-	query := `SELECT itemID FROM showcase_items WHERE category=? LIMIT ? OFFSET ? ORDER BY `
+	order := "desc"
 	if req.OrderBy == "asc" {
-		query += "price ASC"
+		order = "asc"
+	}
+	statuses := req.Statuses
+	if len(statuses) == 0 {
+		statuses = []string{structsUFUT.ItemStatusAvailable}
+	}
+	query := `SELECT itemID, refPrice, version, updatedAt FROM showcase_items
+		WHERE status IN (` + placeholders(len(statuses)) + `)`
+	args := make([]any, 0, len(statuses)+6)
+	for _, status := range statuses {
+		args = append(args, status)
+	}
+	if req.Category != "" {
+		query += ` AND category=?`
+		args = append(args, req.Category)
+	}
+	if req.SellerID != "" {
+		query += ` AND sellerID=?`
+		args = append(args, req.SellerID)
+	}
+	if req.Cursor != "" {
+		c, err := funcsUFUT.DecodeCursor(req.Cursor, order)
+		if err != nil {
+			return resp, err
+		}
+		if order == "asc" {
+			query += ` AND (refPrice, itemID) > (?, ?)`
+		} else {
+			query += ` AND (refPrice, itemID) < (?, ?)`
+		}
+		args = append(args, c.SortKey, c.ID)
+	}
+	if order == "asc" {
+		query += ` ORDER BY refPrice ASC, itemID ASC`
 	} else {
-		query += "price DESC"
+		query += ` ORDER BY refPrice DESC, itemID DESC`
 	}
-	rows, err := r.DB.QueryContext(ctx, query, req.Category, req.Count, req.StartIndex)
+	// one extra row tells whether there is a next page
+	query += ` LIMIT ?`
+	args = append(args, req.Count+1)
+	if req.Cursor == "" && req.StartIndex > 0 {
+		query += ` OFFSET ?`
+		args = append(args, req.StartIndex)
+	}
+	rows, err := r.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return resp, err
 	}
 	defer rows.Close()
+	var lastPrice int64
 	for rows.Next() {
 		var itemID string
-		if err := rows.Scan(&itemID); err != nil {
+		var price, version, updatedAt int64
+		if err := rows.Scan(&itemID, &price, &version, &updatedAt); err != nil {
 			return resp, err
 		}
+		if len(resp.ItemsIDs) == req.Count {
+			resp.NextCursor = funcsUFUT.EncodeCursor(funcsUFUT.Cursor{
+				SortKey: lastPrice,
+				ID:      resp.ItemsIDs[len(resp.ItemsIDs)-1],
+				Order:   order,
+			})
+			break
+		}
 		resp.ItemsIDs = append(resp.ItemsIDs, itemID)
+		resp.Versions = append(resp.Versions, version)
+		if t := unixTime(updatedAt); t.After(resp.LastModified) {
+			resp.LastModified = t
+		}
+		lastPrice = price
 	}
-	return resp, nil
+	return resp, rows.Err()
+}
+
+// itemColumns are read from showcase_items_priced, see pricedItemsQuery
+const itemColumns = `itemID, sellerID, COALESCE(sku, ''), name, description, price, category, status, version, updatedAt,
+	regularPrice, saleEndsAt, currency`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanItem(row rowScanner, item *structsUFUT.ItemDataRSC) error {
+	var updatedAt int64
+	var regularPrice int
+	var saleEndsAt sql.NullInt64
+	err := row.Scan(
+		&item.ItemID,
+		&item.SellerID,
+		&item.SKU,
+		&item.Name,
+		&item.Description,
+		&item.Price,
+		&item.Category,
+		&item.Status,
+		&item.Version,
+		&updatedAt,
+		&regularPrice,
+		&saleEndsAt,
+		&item.Currency)
+	item.UpdatedAt = unixTime(updatedAt)
+	item.RegularPrice, item.SaleEndsAt = 0, nil
+	if saleEndsAt.Valid {
+		t := unixTime(saleEndsAt.Int64)
+		item.RegularPrice, item.SaleEndsAt = regularPrice, &t
+	}
+	return err
+}
+
+/*
+Converts unix seconds stored in the database; 0 (rows older than the column) gives zero time
+*/
+func unixTime(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0).UTC()
 }
 
 /*
@@ -72,33 +184,80 @@ req:
 
 	ItemID:			always (identifies the exact item)
 	SellerID:		ignored
+	SKU:			ignored
 	Name:			ignored
 	Description:		ignored
 	Price:			ignored
-	Category:		ignored
+	Currency:		ignored
+	Category:		optional (if provided, item must belong to it)
 	Status:			ignored
+	Version:		ignored
+	UpdatedAt:		ignored
 
 resp:
 
 	ItemID:			not changed
 	SellerID:		item's "SellerID"
+	SKU:			item's "SKU"
 	Name:			item's "Name"
 	Description:		item's "Description"
 	Price:			item's "Price"
+	Currency:		item's "Currency"
 	Category:		item's "Category"
 	Status:			item's "Status"
+	Version:		item's "Version"
+	UpdatedAt:		item's "UpdatedAt"
 */
 func (r *SQLiteRepo) ItemByItemID(ctx context.Context, req *structsUFUT.ItemDataRSC) error {
-	q_res := r.DB.QueryRowContext(ctx,
-		`SELECT * FROM showcase_items WHERE itemID=? AND category=?`, req.ItemID, req.Category)
-	return q_res.Scan(
-		&req.ItemID,
-		&req.SellerID,
-		&req.Name,
-		&req.Description,
-		&req.Price,
-		&req.Category,
-		&req.Status)
+	query := `SELECT ` + itemColumns + ` FROM showcase_items_priced WHERE itemID=?`
+	args := []any{req.ItemID}
+	if req.Category != "" {
+		query += ` AND category=?`
+		args = append(args, req.Category)
+	}
+	return scanItem(r.DB.QueryRowContext(ctx, query, args...), req)
+}
+
+/*
+req:
+
+	itemsIDs: array of <string>ItemID
+
+resp:
+
+	found items in unspecified order; missing IDs are skipped
+*/
+func (r *SQLiteRepo) ItemsByItemIDs(ctx context.Context, itemsIDs []string) ([]structsUFUT.ItemDataRSC, error) {
+	if len(itemsIDs) == 0 {
+		return nil, nil
+	}
+	args := make([]any, len(itemsIDs))
+	for i, id := range itemsIDs {
+		args[i] = id
+	}
+	rows, err := r.DB.QueryContext(ctx,
+		`SELECT `+itemColumns+` FROM showcase_items_priced WHERE itemID IN (`+placeholders(len(itemsIDs))+`)`,
+		args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []structsUFUT.ItemDataRSC
+	for rows.Next() {
+		var item structsUFUT.ItemDataRSC
+		if err := scanItem(rows, &item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+/*
+Returns "?,?,...,?" with n placeholders
+*/
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
 }
 
 // func (r *SQLiteRepo) ReserveItem(ctx context.Context, itemsID []string) []bool {
@@ -3,6 +3,7 @@ package sqliteRepoInventory
 import (
 	"context"
 	"database/sql"
+	sqliteOutbox "ufut/internal/sqlite/outbox"
 )
 
 type SQLiteRepo struct {
@@ -39,5 +40,22 @@ func (r *SQLiteRepo) CreateTables(ctx context.Context) error {
 			return err
 		}
 	}
+	{
+		_, err := r.DB.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS reservations (
+		correlationID TEXT PRIMARY KEY,
+		itemsID TEXT NOT NULL,
+		quantities TEXT NOT NULL,
+		availability TEXT NOT NULL,
+		status TEXT NOT NULL,
+		updatedAt INTEGER NOT NULL
+		);`)
+		if err != nil {
+			return err
+		}
+	}
+	if err := sqliteOutbox.CreateTable(ctx, r.DB); err != nil {
+		return err
+	}
 	return nil
 }
@@ -2,7 +2,17 @@ package sqliteRepoInventory
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
+	sqliteOutbox "ufut/internal/sqlite/outbox"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	ReservationReserved = "RESERVED"
+	ReservationReleased = "RELEASED"
 )
 
 var (
@@ -11,28 +21,166 @@ var (
 	ErrItemNotEnough = errors.New("item's quantity is not enough")
 )
 
-func (r *SQLiteRepo) ReserveItems(ctx context.Context, itemsIDs []string, quantities []int) ([]bool, error) {
+/*
+Reserves every item that has enough quantity for the correlation ID, the rest are left untouched.
+result builds the message announcing the availability; it is stored in the outbox
+in the transaction of the reservation. A repeated request doesn't reserve again,
+its result is stored again with the availability of the first one
+*/
+func (r *SQLiteRepo) ReserveItems(ctx context.Context, correlationID string, itemsIDs []string, quantities []int,
+	result func(availability []bool) (kafka.Message, error)) ([]bool, error) {
 	if len(itemsIDs) == 0 {
 		return nil, ErrItemNotFound
 	}
-	availabilities := make([]bool, len(itemsIDs))
-	for i, item := range itemsIDs {
-		_, err := r.DecreaseItemQuantity(ctx, item, quantities[i])
-		if err == nil {
-			availabilities[i] = true
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	availabilities, found, err := reservation(ctx, tx, correlationID)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		availabilities = make([]bool, len(itemsIDs))
+		for i, item := range itemsIDs {
+			if i >= len(quantities) || quantities[i] < 1 {
+				continue
+			}
+			res, err := tx.ExecContext(ctx, `
+			UPDATE itemsQuantities
+			SET quantity = quantity - ?
+			WHERE itemID = ?
+			AND quantity >= ?`, quantities[i], item, quantities[i])
+			if err != nil {
+				return nil, err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return nil, err
+			}
+			availabilities[i] = n == 1
+		}
+		if err := storeReservation(ctx, tx, correlationID, itemsIDs, quantities, availabilities, ReservationReserved); err != nil {
+			return nil, err
 		}
 	}
+	msg, err := result(availabilities)
+	if err != nil {
+		return nil, err
+	}
+	if err := sqliteOutbox.Enqueue(ctx, tx, msg); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
 	return availabilities, nil
 }
 
-func (r *SQLiteRepo) CancelItemReservation(ctx context.Context, itemsIDs []string, quantities []int) error {
-	if len(itemsIDs) == 0 {
-		return ErrItemNotFound
+/*
+Returns the reserved items of the correlation ID to stock once; events are stored in the outbox
+in the same transaction, also when there is nothing to release.
+Releasing before the reservation request has arrived leaves nothing to reserve for it
+*/
+func (r *SQLiteRepo) CancelItemReservation(ctx context.Context, correlationID string, events ...kafka.Message) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
 	}
-	for i, item := range itemsIDs {
-		r.IncreaseItemQuantity(ctx, item, quantities[i])
+	defer tx.Rollback()
+	var itemsJSON, quantitiesJSON, availabilityJSON, status string
+	err = tx.QueryRowContext(ctx, `
+	SELECT itemsID, quantities, availability, status
+	FROM reservations
+	WHERE correlationID = ?`, correlationID).Scan(&itemsJSON, &quantitiesJSON, &availabilityJSON, &status)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		if err := storeReservation(ctx, tx, correlationID, []string{}, []int{}, []bool{}, ReservationReleased); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	case status == ReservationReserved:
+		var itemsIDs []string
+		var quantities []int
+		var availability []bool
+		for _, v := range []struct {
+			data string
+			dst  any
+		}{{itemsJSON, &itemsIDs}, {quantitiesJSON, &quantities}, {availabilityJSON, &availability}} {
+			if err := json.Unmarshal([]byte(v.data), v.dst); err != nil {
+				return err
+			}
+		}
+		for i, item := range itemsIDs {
+			if !availability[i] {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, `
+			UPDATE itemsQuantities
+			SET quantity = quantity + ?
+			WHERE itemID = ?`, quantities[i], item); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `
+		UPDATE reservations
+		SET status = ?, updatedAt = unixepoch()
+		WHERE correlationID = ?`, ReservationReleased, correlationID); err != nil {
+			return err
+		}
+	}
+	if err := sqliteOutbox.Enqueue(ctx, tx, events...); err != nil {
+		return err
 	}
-	return nil
+	return tx.Commit()
+}
+
+func reservation(ctx context.Context, tx *sql.Tx, correlationID string) ([]bool, bool, error) {
+	var availabilityJSON string
+	err := tx.QueryRowContext(ctx, `
+	SELECT availability FROM reservations WHERE correlationID = ?`, correlationID).Scan(&availabilityJSON)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var availability []bool
+	if err := json.Unmarshal([]byte(availabilityJSON), &availability); err != nil {
+		return nil, false, err
+	}
+	return availability, true, nil
+}
+
+func storeReservation(ctx context.Context, tx *sql.Tx, correlationID string, itemsIDs []string, quantities []int, availability []bool, status string) error {
+	data := make([]string, 3)
+	for i, v := range []any{itemsIDs, quantities, availability} {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		data[i] = string(b)
+	}
+	_, err := tx.ExecContext(ctx, `
+	INSERT INTO reservations (correlationID, itemsID, quantities, availability, status, updatedAt)
+	VALUES (?, ?, ?, ?, ?, unixepoch())`, correlationID, data[0], data[1], data[2], status)
+	return err
+}
+
+/*
+Creates stock row with zero quantity for the new item; existing rows are kept
+*/
+func (r *SQLiteRepo) CreateItem(ctx context.Context, itemID string) error {
+	if itemID == "" {
+		return ErrInvalidValue
+	}
+	_, err := r.DB.ExecContext(ctx, `
+	INSERT INTO itemsQuantities (itemID, quantity)
+	VALUES (?, 0)
+	ON CONFLICT(itemID) DO NOTHING`, itemID)
+	return err
 }
 
 func (r *SQLiteRepo) IncreaseItemQuantity(ctx context.Context, itemID string, n int) (int, error) {
@@ -55,36 +203,24 @@ func (r *SQLiteRepo) DecreaseItemQuantity(ctx context.Context, itemID string, n
 	if n < 1 {
 		return 0, ErrInvalidValue
 	}
-	tx, err := r.DB.BeginTx(ctx, nil)
-	if err != nil {
-		return 0, err
-	}
-	defer tx.Rollback()
-	var cur int
-	{
-		res := r.DB.QueryRowContext(ctx, `
-		SELECT itemID
-		FROM itemsQuantities
-		WHERE itemID = ?
-		FOR UPDATE`, itemID)
-		if err := res.Scan(&cur); err != nil {
-			return 0, ErrItemNotFound
-		}
-	}
+	// single conditional update, so concurrent reservations can't take the quantity below zero
+	res := r.DB.QueryRowContext(ctx, `
+	UPDATE itemsQuantities
+	SET quantity = quantity - ?
+	WHERE itemID = ?
+	AND quantity >= ?
+	RETURNING quantity`, n, itemID, n)
 	var q int
-	{
-		res := r.DB.QueryRowContext(ctx, `
-		UPDATE itemsQuantities
-		SET quantity = quantity - ?
-		WHERE itemID = ?
-		AND quantity >= ?
-		RETURNING quantity`, n, itemID, n)
-		if err := res.Scan(&q); err != nil {
-			return 0, ErrItemNotEnough
+	if err := res.Scan(&q); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return 0, err
 		}
-	}
-	if err := tx.Commit(); err != nil {
-		return 0, err
+		var cur int
+		if err := r.DB.QueryRowContext(ctx,
+			`SELECT quantity FROM itemsQuantities WHERE itemID = ?`, itemID).Scan(&cur); err != nil {
+			return 0, ErrItemNotFound
+		}
+		return 0, ErrItemNotEnough
 	}
 	return q, nil
 }
@@ -0,0 +1,113 @@
+package sqliteRepoInventory
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func createTestRepo(t *testing.T) *SQLiteRepo {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "inventory_test.db"))
+	if err != nil {
+		t.Fatalf("%v", err.Error())
+	}
+	t.Cleanup(func() { db.Close() })
+	repo := NewSQLiteRepo(db)
+	if err := repo.CreateTables(t.Context()); err != nil {
+		t.Fatalf("%v", err.Error())
+	}
+	return repo
+}
+
+func stock(t *testing.T, repo *SQLiteRepo, itemID string) int {
+	var q int
+	assert.NoError(t, repo.DB.QueryRowContext(t.Context(),
+		`SELECT quantity FROM itemsQuantities WHERE itemID = ?`, itemID).Scan(&q))
+	return q
+}
+
+func outboxRows(t *testing.T, repo *SQLiteRepo) int {
+	var n int
+	assert.NoError(t, repo.DB.QueryRowContext(t.Context(), `SELECT COUNT(*) FROM outbox`).Scan(&n))
+	return n
+}
+
+func TestSQLiteRepo_ReserveItemsOnce(t *testing.T) {
+	repo := createTestRepo(t)
+	for itemID, quantity := range map[string]int{"book": 3, "lamp": 1} {
+		assert.NoError(t, repo.CreateItem(t.Context(), itemID))
+		_, err := repo.IncreaseItemQuantity(t.Context(), itemID, quantity)
+		assert.NoError(t, err)
+	}
+	var results [][]bool
+	result := func(availability []bool) (kafka.Message, error) {
+		results = append(results, availability)
+		return kafka.Message{Topic: "inventory", Value: []byte("reserved")}, nil
+	}
+
+	availability, err := repo.ReserveItems(t.Context(), "c1", []string{"book", "lamp"}, []int{2, 2}, result)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{true, false}, availability)
+	assert.Equal(t, 1, stock(t, repo, "book"))
+	assert.Equal(t, 1, stock(t, repo, "lamp"))
+
+	// a redelivered request gets the first answer again and takes nothing more,
+	// even if the stock would now give a different one
+	_, err = repo.IncreaseItemQuantity(t.Context(), "lamp", 5)
+	assert.NoError(t, err)
+	availability, err = repo.ReserveItems(t.Context(), "c1", []string{"book", "lamp"}, []int{2, 2}, result)
+	assert.NoError(t, err)
+	assert.Equal(t, []bool{true, false}, availability)
+	assert.Equal(t, 1, stock(t, repo, "book"))
+	assert.Equal(t, 6, stock(t, repo, "lamp"))
+	assert.Equal(t, [][]bool{{true, false}, {true, false}}, results)
+	assert.Equal(t, 2, outboxRows(t, repo))
+
+	// only the reserved items go back, once
+	assert.NoError(t, repo.CancelItemReservation(t.Context(), "c1"))
+	assert.NoError(t, repo.CancelItemReservation(t.Context(), "c1"))
+	assert.Equal(t, 3, stock(t, repo, "book"))
+	assert.Equal(t, 6, stock(t, repo, "lamp"))
+
+	// a failed result rolls the reservation back
+	errResult := errors.New("result failed")
+	_, err = repo.ReserveItems(t.Context(), "c2", []string{"book"}, []int{1}, func([]bool) (kafka.Message, error) {
+		return kafka.Message{}, errResult
+	})
+	assert.ErrorIs(t, err, errResult)
+	assert.Equal(t, 3, stock(t, repo, "book"))
+	_, err = repo.ReserveItems(t.Context(), "c2", []string{}, []int{}, result)
+	assert.ErrorIs(t, err, ErrItemNotFound)
+}
+
+func TestSQLiteRepo_ReleaseBeforeReserve(t *testing.T) {
+	repo := createTestRepo(t)
+	assert.NoError(t, repo.CreateItem(t.Context(), "book"))
+	_, err := repo.IncreaseItemQuantity(t.Context(), "book", 2)
+	assert.NoError(t, err)
+
+	// the release overtook the reservation request: it is stored as a tombstone with its events
+	released := kafka.Message{Topic: "inventory", Value: []byte("released")}
+	assert.NoError(t, repo.CancelItemReservation(t.Context(), "c1", released))
+	assert.Equal(t, 1, outboxRows(t, repo))
+	assert.Equal(t, 2, stock(t, repo, "book"))
+
+	// the late request reserves nothing, so nothing is left reserved for a cancelled order
+	availability, err := repo.ReserveItems(t.Context(), "c1", []string{"book"}, []int{1},
+		func(availability []bool) (kafka.Message, error) {
+			return kafka.Message{Topic: "inventory", Value: []byte("reserved")}, nil
+		})
+	assert.NoError(t, err)
+	assert.NotContains(t, availability, true)
+	assert.Equal(t, 2, stock(t, repo, "book"))
+
+	// releasing again gives nothing back
+	assert.NoError(t, repo.CancelItemReservation(t.Context(), "c1"))
+	assert.Equal(t, 2, stock(t, repo, "book"))
+}
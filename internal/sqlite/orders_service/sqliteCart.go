@@ -2,6 +2,7 @@ package sqliteRepoMarketplace
 
 import (
 	"context"
+	"database/sql"
 	structsUFUT "ufut/lib/structs"
 )
 
@@ -15,28 +16,13 @@ req:
 Adds item to user's shopping cart, or increases quantity if already present
 */
 func (r *SQLiteRepo) AddToCart(ctx context.Context, req *structsUFUT.ItemRequestRMP) error {
-	t, err := r.quantityOfItemInCart(ctx, req)
-	if err != nil {
-		_, err := r.DB.ExecContext(ctx,
-			`INSERT INTO shopping_cart
-			(userID, itemID, quantity)
-			VALUES (?,?,?)`,
-			req.UserID, req.ItemID, req.Quantity)
-		if err != nil {
-			return err
-		}
-	} else {
-		t += req.Quantity
-		_, err := r.DB.ExecContext(ctx,
-			`UPDATE shopping_cart
-			SET quantity=?
-			WHERE userID=? AND itemID=?`,
-			t, req.UserID, req.ItemID)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
+	_, err := r.DB.ExecContext(ctx,
+		`INSERT INTO shopping_cart
+		(userID, itemID, quantity)
+		VALUES (?,?,?)
+		ON CONFLICT(userID, itemID) DO UPDATE SET quantity=quantity+excluded.quantity`,
+		req.UserID, req.ItemID, req.Quantity)
+	return err
 }
 
 /*
@@ -46,23 +32,17 @@ req:
 	ItemID  - uuid (16 bytes)
 	Quantity - ignored
 
-Removes item from user's shopping cart
+Removes item from user's shopping cart, sql.ErrNoRows if it isn't there
 */
 func (r *SQLiteRepo) RemoveFromCart(ctx context.Context, req *structsUFUT.ItemRequestRMP) error {
-	{
-		_, err := r.quantityOfItemInCart(ctx, req)
-		if err != nil {
-			return err
-		}
-	}
-	_, err := r.DB.ExecContext(ctx,
+	res, err := r.DB.ExecContext(ctx,
 		`DELETE FROM shopping_cart
 		WHERE userID=? AND itemID=?`,
 		req.UserID, req.ItemID)
 	if err != nil {
 		return err
 	}
-	return nil
+	return affectedOrNoRows(res)
 }
 
 /*
@@ -72,23 +52,18 @@ req:
 	ItemID  - uuid (16 bytes)
 	Quantity - int, quantity to increase
 
-Increases quantity of the item in user's shopping cart
+Increases quantity of the item in user's shopping cart, sql.ErrNoRows if it isn't there
 */
 func (r *SQLiteRepo) IncreaseItemQuantity(ctx context.Context, req *structsUFUT.ItemRequestRMP) error {
-	t, err := r.quantityOfItemInCart(ctx, req)
-	if err != nil {
-		return err
-	}
-	t += req.Quantity
-	_, err = r.DB.ExecContext(ctx,
+	res, err := r.DB.ExecContext(ctx,
 		`UPDATE shopping_cart
-		SET quantity=?
+		SET quantity=quantity+?
 		WHERE userID=? AND itemID=?`,
-		t, req.UserID, req.ItemID)
+		req.Quantity, req.UserID, req.ItemID)
 	if err != nil {
 		return err
 	}
-	return nil
+	return affectedOrNoRows(res)
 }
 
 /*
@@ -98,33 +73,42 @@ req:
 	ItemID  - uuid (16 bytes)
 	Quantity - int, quantity to decrease
 
-Decreases quantity of the item in user's shopping cart
+Decreases quantity of the item in user's shopping cart, the item is removed once none is left.
+sql.ErrNoRows if it isn't there
 */
 func (r *SQLiteRepo) DecreaseItemQuantity(ctx context.Context, req *structsUFUT.ItemRequestRMP) error {
-	t, err := r.quantityOfItemInCart(ctx, req)
+	tx, err := r.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	t -= req.Quantity
-	if t == 0 {
-		_, err := r.DB.ExecContext(ctx,
-			`DELETE FROM shopping_cart
-			WHERE userID=? AND itemID=?`,
-			req.UserID, req.ItemID)
-		if err != nil {
-			return err
-		}
-		return nil
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx,
+		`UPDATE shopping_cart
+		SET quantity=quantity-?
+		WHERE userID=? AND itemID=?`,
+		req.Quantity, req.UserID, req.ItemID)
+	if err != nil {
+		return err
 	}
-	{
-		_, err := r.DB.ExecContext(ctx,
-			`UPDATE shopping_cart
-			SET quantity=?
-			WHERE userID=? AND itemID=?`,
-			t, req.UserID, req.ItemID)
-		if err != nil {
-			return err
-		}
+	if err := affectedOrNoRows(res); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM shopping_cart
+		WHERE userID=? AND itemID=? AND quantity<=0`,
+		req.UserID, req.ItemID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func affectedOrNoRows(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
 	}
 	return nil
 }
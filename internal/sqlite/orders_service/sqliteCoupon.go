@@ -0,0 +1,267 @@
+package sqliteRepoMarketplace
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	structsUFUT "ufut/lib/structs"
+)
+
+const couponColumns = `code, percentBps, amount, minSubtotal, perUserLimit, globalLimit, startsAt, endsAt,
+	categories, sellerIDs,
+	(SELECT COUNT(*) FROM coupon_redemptions cr WHERE cr.code = coupons.code AND cr.releasedAt IS NULL),
+	createdAt, updatedAt`
+
+func scanCoupon(row interface{ Scan(...any) error }) (*structsUFUT.CouponRMP, error) {
+	var c structsUFUT.CouponRMP
+	var startsAt, endsAt sql.NullInt64
+	var categories, sellerIDs string
+	if err := row.Scan(&c.Code, &c.PercentBps, &c.Amount, &c.MinSubtotal, &c.PerUserLimit, &c.GlobalLimit,
+		&startsAt, &endsAt, &categories, &sellerIDs, &c.Redemptions, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		return nil, err
+	}
+	c.StartsAt, c.EndsAt = startsAt.Int64, endsAt.Int64
+	if err := json.Unmarshal([]byte(categories), &c.Categories); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(sellerIDs), &c.SellerIDs); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// couponArgs returns the stored restrictions and validity window of the coupon
+func couponArgs(c *structsUFUT.CouponRMP) (categories, sellerIDs string, startsAt, endsAt sql.NullInt64, err error) {
+	data, err := json.Marshal(append([]string{}, c.Categories...))
+	if err != nil {
+		return
+	}
+	categories = string(data)
+	if data, err = json.Marshal(append([]string{}, c.SellerIDs...)); err != nil {
+		return
+	}
+	sellerIDs = string(data)
+	startsAt = sql.NullInt64{Int64: c.StartsAt, Valid: c.StartsAt != 0}
+	endsAt = sql.NullInt64{Int64: c.EndsAt, Valid: c.EndsAt != 0}
+	return
+}
+
+/*
+req:
+
+	Code			- must be not null, unique
+	Redemptions		- ignored
+
+Creates the coupon, returns false if the code is taken
+*/
+func (r *SQLiteRepo) CreateCoupon(ctx context.Context, c *structsUFUT.CouponRMP) (bool, error) {
+	categories, sellerIDs, startsAt, endsAt, err := couponArgs(c)
+	if err != nil {
+		return false, err
+	}
+	q_row_res := r.DB.QueryRowContext(ctx,
+		`INSERT INTO coupons
+		(code, percentBps, amount, minSubtotal, perUserLimit, globalLimit, startsAt, endsAt, categories, sellerIDs,
+		createdAt, updatedAt)
+		VALUES (?,?,?,?,?,?,?,?,?,?,unixepoch(),unixepoch())
+		ON CONFLICT(code) DO NOTHING
+		RETURNING createdAt, updatedAt`,
+		c.Code, c.PercentBps, c.Amount, c.MinSubtotal, c.PerUserLimit, c.GlobalLimit, startsAt, endsAt,
+		categories, sellerIDs)
+	if err := q_row_res.Scan(&c.CreatedAt, &c.UpdatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	c.Redemptions = 0
+	return true, nil
+}
+
+/*
+req:
+
+	Code			- must be not null
+	Redemptions		- ignored
+
+Replaces the terms of the coupon, redemptions made so far keep counting against the new limits.
+Returns false if there is no such coupon
+*/
+func (r *SQLiteRepo) UpdateCoupon(ctx context.Context, c *structsUFUT.CouponRMP) (bool, error) {
+	categories, sellerIDs, startsAt, endsAt, err := couponArgs(c)
+	if err != nil {
+		return false, err
+	}
+	res, err := r.DB.ExecContext(ctx,
+		`UPDATE coupons
+		SET percentBps=?, amount=?, minSubtotal=?, perUserLimit=?, globalLimit=?, startsAt=?, endsAt=?,
+		categories=?, sellerIDs=?, updatedAt=unixepoch()
+		WHERE code=?`,
+		c.PercentBps, c.Amount, c.MinSubtotal, c.PerUserLimit, c.GlobalLimit, startsAt, endsAt,
+		categories, sellerIDs, c.Code)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	stored, err := r.Coupon(ctx, c.Code)
+	if err != nil {
+		return false, err
+	}
+	*c = *stored
+	return true, nil
+}
+
+/*
+Deletes the coupon and takes it off the carts it was applied to; redemptions are kept.
+Returns false if there is no such coupon
+*/
+func (r *SQLiteRepo) DeleteCoupon(ctx context.Context, code string) (bool, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `DELETE FROM coupons WHERE code=?`, code)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM cart_coupons WHERE code=?`, code); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+/*
+Returns the coupon with the count of its active redemptions, sql.ErrNoRows if there is no such coupon
+*/
+func (r *SQLiteRepo) Coupon(ctx context.Context, code string) (*structsUFUT.CouponRMP, error) {
+	return scanCoupon(r.DB.QueryRowContext(ctx,
+		`SELECT `+couponColumns+` FROM coupons WHERE code=?`, code))
+}
+
+/*
+Returns all coupons ordered by code
+*/
+func (r *SQLiteRepo) Coupons(ctx context.Context) ([]structsUFUT.CouponRMP, error) {
+	rows, err := r.DB.QueryContext(ctx, `SELECT `+couponColumns+` FROM coupons ORDER BY code`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ret := []structsUFUT.CouponRMP{}
+	for rows.Next() {
+		c, err := scanCoupon(rows)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, *c)
+	}
+	return ret, rows.Err()
+}
+
+/*
+Returns active redemptions of the coupon in total and by the user,
+the redemption of exceptCorrelationID (if any) is not counted
+*/
+func (r *SQLiteRepo) CouponUsage(ctx context.Context, code, userID, exceptCorrelationID string) (int, int, error) {
+	var total, byUser int
+	err := r.DB.QueryRowContext(ctx,
+		`SELECT COUNT(*), COUNT(CASE WHEN userID=? THEN 1 END)
+		FROM coupon_redemptions
+		WHERE code=? AND releasedAt IS NULL AND correlationID<>?`,
+		userID, code, exceptCorrelationID).Scan(&total, &byUser)
+	return total, byUser, err
+}
+
+/*
+req:
+
+	CorrelationID	- saga in RESERVING step
+	UserID			- must be not null
+	Code			- must be not null
+
+Redeems the coupon for the saga if it is valid now and within its limits. The check and the redemption are
+one statement, so concurrent checkouts can't redeem more than the limits allow.
+Returns false if the coupon can't be redeemed; a saga that has already redeemed the coupon gets true
+*/
+func (r *SQLiteRepo) RedeemCoupon(ctx context.Context, red *structsUFUT.CouponRedemptionRMP) (bool, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO coupon_redemptions (correlationID, code, userID, redeemedAt)
+		SELECT ?, c.code, ?, unixepoch()
+		FROM coupons c
+		WHERE c.code=?
+		AND (c.startsAt IS NULL OR c.startsAt <= unixepoch())
+		AND (c.endsAt IS NULL OR c.endsAt > unixepoch())
+		AND (c.globalLimit = 0 OR c.globalLimit > (
+			SELECT COUNT(*) FROM coupon_redemptions cr WHERE cr.code=c.code AND cr.releasedAt IS NULL))
+		AND (c.perUserLimit = 0 OR c.perUserLimit > (
+			SELECT COUNT(*) FROM coupon_redemptions cr WHERE cr.code=c.code AND cr.userID=? AND cr.releasedAt IS NULL))
+		AND EXISTS (SELECT 1 FROM order_placements p WHERE p.correlationID=? AND p.step=?)
+		ON CONFLICT(correlationID) DO NOTHING`,
+		red.CorrelationID, red.UserID, red.Code, red.UserID, red.CorrelationID, structsUFUT.SagaReserving)
+	if err != nil {
+		return false, err
+	}
+	var redeemed bool
+	err = tx.QueryRowContext(ctx,
+		`SELECT EXISTS (
+			SELECT 1 FROM coupon_redemptions WHERE correlationID=? AND code=? AND releasedAt IS NULL
+		)`, red.CorrelationID, red.Code).Scan(&redeemed)
+	if err != nil {
+		return false, err
+	}
+	return redeemed, tx.Commit()
+}
+
+/*
+Releases the redemption of the saga, so it no longer counts against the limits of the coupon
+*/
+func (r *SQLiteRepo) releaseCoupon(ctx context.Context, tx *sql.Tx, correlationID string) error {
+	_, err := tx.ExecContext(ctx,
+		`UPDATE coupon_redemptions SET releasedAt=unixepoch()
+		WHERE correlationID=? AND releasedAt IS NULL`, correlationID)
+	return err
+}
+
+/*
+Applies the coupon to the user's cart, replacing the one applied before
+*/
+func (r *SQLiteRepo) SetCartCoupon(ctx context.Context, userID, code string) error {
+	_, err := r.DB.ExecContext(ctx,
+		`INSERT INTO cart_coupons (userID, code, appliedAt) VALUES (?,?,unixepoch())
+		ON CONFLICT(userID) DO UPDATE SET code=excluded.code, appliedAt=excluded.appliedAt`,
+		userID, code)
+	return err
+}
+
+/*
+Returns the code of the coupon applied to the user's cart, empty if there is none
+*/
+func (r *SQLiteRepo) CartCoupon(ctx context.Context, userID string) (string, error) {
+	var code string
+	err := r.DB.QueryRowContext(ctx,
+		`SELECT code FROM cart_coupons WHERE userID=?`, userID).Scan(&code)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+	return code, nil
+}
+
+/*
+Takes the coupon off the user's cart, a cart without one is left as it is
+*/
+func (r *SQLiteRepo) RemoveCartCoupon(ctx context.Context, userID string) error {
+	_, err := r.DB.ExecContext(ctx, `DELETE FROM cart_coupons WHERE userID=?`, userID)
+	return err
+}
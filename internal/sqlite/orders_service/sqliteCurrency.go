@@ -0,0 +1,101 @@
+package sqliteRepoMarketplace
+
+import (
+	"context"
+	"strings"
+	"time"
+	structsUFUT "ufut/lib/structs"
+)
+
+/*
+Returns prices of the items known from catalog events; items without a known price are left out
+*/
+func (r *SQLiteRepo) CatalogPrices(ctx context.Context, itemsIDs []string) (map[string]structsUFUT.CatalogPriceRMP, error) {
+	prices := make(map[string]structsUFUT.CatalogPriceRMP, len(itemsIDs))
+	if len(itemsIDs) == 0 {
+		return prices, nil
+	}
+	args := make([]any, len(itemsIDs))
+	for i, id := range itemsIDs {
+		args[i] = id
+	}
+	rows, err := r.DB.QueryContext(ctx,
+		`SELECT itemID, price, currency, COALESCE(category, ''), COALESCE(sellerID, '') FROM catalog_items
+		WHERE price IS NOT NULL AND currency IS NOT NULL
+		AND itemID IN (`+strings.TrimSuffix(strings.Repeat("?,", len(itemsIDs)), ",")+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var itemID string
+		var price structsUFUT.CatalogPriceRMP
+		if err := rows.Scan(&itemID, &price.Price, &price.Currency, &price.Category, &price.SellerID); err != nil {
+			return nil, err
+		}
+		prices[itemID] = price
+	}
+	return prices, rows.Err()
+}
+
+/*
+resp: stored exchange rate table, Reference is empty if no rates were received yet
+*/
+func (r *SQLiteRepo) ExchangeRates(ctx context.Context) (*structsUFUT.ExchangeRatesRSC, error) {
+	rows, err := r.DB.QueryContext(ctx,
+		`SELECT currency, rate, isReference, updatedAt FROM exchange_rates ORDER BY currency`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	table := &structsUFUT.ExchangeRatesRSC{Rates: []structsUFUT.ExchangeRateRSC{}}
+	for rows.Next() {
+		var rate structsUFUT.ExchangeRateRSC
+		var isReference bool
+		var updatedAt int64
+		if err := rows.Scan(&rate.Currency, &rate.Rate, &isReference, &updatedAt); err != nil {
+			return nil, err
+		}
+		if isReference {
+			table.Reference = rate.Currency
+		}
+		if t := time.Unix(updatedAt, 0).UTC(); t.After(table.UpdatedAt) {
+			table.UpdatedAt = t
+		}
+		table.Rates = append(table.Rates, rate)
+	}
+	return table, rows.Err()
+}
+
+/*
+req: table validated by funcsUFUT.NewExchangeRates
+
+Replaces the whole table with the snapshot, snapshots older than the stored one are ignored
+*/
+func (r *SQLiteRepo) SetExchangeRates(ctx context.Context, table *structsUFUT.ExchangeRatesRSC) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var stored int64
+	err = tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(updatedAt), 0) FROM exchange_rates`).Scan(&stored)
+	if err != nil {
+		return err
+	}
+	if table.UpdatedAt.Unix() < stored {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM exchange_rates`); err != nil {
+		return err
+	}
+	for _, rate := range table.Rates {
+		_, err := tx.ExecContext(ctx,
+			`INSERT OR REPLACE INTO exchange_rates (currency, rate, isReference, updatedAt) VALUES (?, ?, ?, ?)`,
+			rate.Currency, rate.Rate, rate.Currency == table.Reference, table.UpdatedAt.Unix())
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -3,7 +3,10 @@ package sqliteRepoMarketplace
 import (
 	"context"
 	"database/sql"
-	structsUFUT "ufut/lib/structs"
+	"strconv"
+	sqliteOutbox "ufut/internal/sqlite/outbox"
+
+	"github.com/google/uuid"
 )
 
 type SQLiteRepo struct {
@@ -27,20 +30,107 @@ func (r *SQLiteRepo) Close() error {
 }
 
 /*
-req:
-
-	UserID  - uuid (16 bytes)
-	ItemID  - uuid (16 bytes)
-	Quantity - ignored
+Adds column to the table created by an older version of CreateTables
+*/
+func (r *SQLiteRepo) addColumnIfNotExists(ctx context.Context, table, column, decl string) error {
+	rows, err := r.DB.QueryContext(ctx, `SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = r.DB.ExecContext(ctx, `ALTER TABLE `+table+` ADD COLUMN `+column+` `+decl)
+	return err
+}
 
-Returns quantity of the item in user's shopping cart
+/*
+Moves orders of the usersOrders table created by an older version of CreateTables to user_orders.
+Their orderIDs were numbers of the user's orders, lines were linked by userID||orderID;
+they get UUIDv7 IDs and order numbers in the order they were created, their lines, placements and timelines follow
 */
-func (r *SQLiteRepo) quantityOfItemInCart(ctx context.Context, req *structsUFUT.ItemRequestRMP) (int, error) {
-	q_res := r.DB.QueryRowContext(ctx,
-		`SELECT quantity FROM shopping_cart WHERE userID=? AND itemID=?`, req.UserID, req.ItemID)
-	var t int
-	err := q_res.Scan(&t)
-	return t, err
+func (r *SQLiteRepo) migrateUsersOrders(ctx context.Context) error {
+	var exists int
+	if err := r.DB.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='usersOrders'`).Scan(&exists); err != nil {
+		return err
+	}
+	if exists == 0 {
+		return nil
+	}
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	type oldOrder struct {
+		userID    string
+		orderID   int
+		status    string
+		createdAt int64
+	}
+	var old []oldOrder
+	{
+		q_res, err := tx.QueryContext(ctx,
+			`SELECT userID, orderID, status, COALESCE(unixepoch(createdAt), unixepoch())
+			FROM usersOrders
+			ORDER BY createdAt, rowid`)
+		if err != nil {
+			return err
+		}
+		for q_res.Next() {
+			var o oldOrder
+			if err := q_res.Scan(&o.userID, &o.orderID, &o.status, &o.createdAt); err != nil {
+				q_res.Close()
+				return err
+			}
+			old = append(old, o)
+		}
+		q_res.Close()
+		if err := q_res.Err(); err != nil {
+			return err
+		}
+	}
+	var number int64
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(orderNumber), 0) FROM user_orders`).Scan(&number); err != nil {
+		return err
+	}
+	for _, o := range old {
+		id, err := uuid.NewV7()
+		if err != nil {
+			return err
+		}
+		number++
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO user_orders (orderID, orderNumber, userID, status, createdAt) VALUES (?,?,?,?,?)`,
+			id.String(), number, o.userID, o.status, o.createdAt); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE orders SET orderID=? WHERE orderID=?`, id.String(), o.userID+strconv.Itoa(o.orderID)); err != nil {
+			return err
+		}
+		for _, table := range []string{"order_placements", "order_status_history"} {
+			if _, err := tx.ExecContext(ctx,
+				`UPDATE `+table+` SET orderID=? WHERE userID=? AND orderID=?`, id.String(), o.userID, o.orderID); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DROP TABLE usersOrders`); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 /*
@@ -73,16 +163,249 @@ func (r *SQLiteRepo) CreateTables(ctx context.Context) error {
 	}
 	{
 		_, err := r.DB.ExecContext(ctx,
-			`CREATE TABLE IF NOT EXISTS usersOrders (
-			orderID INTEGER NOT NULL,
+			`CREATE TABLE IF NOT EXISTS user_orders (
+			orderID TEXT PRIMARY KEY,
+			orderNumber INTEGER NOT NULL UNIQUE,
+			userID TEXT NOT NULL,
+			status TEXT NOT NULL,
+			createdAt INTEGER NOT NULL
+			);`)
+		if err != nil {
+			return err
+		}
+	}
+	{
+		_, err := r.DB.ExecContext(ctx,
+			`CREATE INDEX IF NOT EXISTS user_orders_user ON user_orders(userID, orderNumber)`)
+		if err != nil {
+			return err
+		}
+	}
+	{
+		_, err := r.DB.ExecContext(ctx,
+			`CREATE TABLE IF NOT EXISTS order_status_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			userID TEXT NOT NULL,
+			orderID TEXT NOT NULL,
+			fromStatus TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL,
+			changedBy TEXT NOT NULL,
+			changedAt INTEGER NOT NULL
+			);`)
+		if err != nil {
+			return err
+		}
+	}
+	{
+		_, err := r.DB.ExecContext(ctx,
+			`CREATE INDEX IF NOT EXISTS order_status_history_order ON order_status_history(userID, orderID)`)
+		if err != nil {
+			return err
+		}
+	}
+	{
+		_, err := r.DB.ExecContext(ctx,
+			`CREATE TABLE IF NOT EXISTS item_copurchases (
+			itemID TEXT NOT NULL,
+			relatedItemID TEXT NOT NULL,
+			score INTEGER NOT NULL,
+			PRIMARY KEY(itemID, relatedItemID)
+			);`)
+		if err != nil {
+			return err
+		}
+	}
+	{
+		_, err := r.DB.ExecContext(ctx,
+			`CREATE TABLE IF NOT EXISTS catalog_items (
+			itemID TEXT PRIMARY KEY,
+			status TEXT NOT NULL,
+			version INTEGER NOT NULL
+			);`)
+		if err != nil {
+			return err
+		}
+	}
+	// prices are known only for items seen in catalog events since they were added
+	if err := r.addColumnIfNotExists(ctx, "catalog_items", "price", "INTEGER"); err != nil {
+		return err
+	}
+	if err := r.addColumnIfNotExists(ctx, "catalog_items", "currency", "TEXT"); err != nil {
+		return err
+	}
+	for _, col := range []string{"name", "sellerID", "category"} {
+		if err := r.addColumnIfNotExists(ctx, "catalog_items", col, "TEXT"); err != nil {
+			return err
+		}
+	}
+	// snapshot of the line when the order was placed; lines of older orders are left without one,
+	// current catalog data would misstate what was sold
+	for _, col := range [][2]string{
+		{"name", "TEXT"}, {"sellerID", "TEXT"}, {"unitPrice", "INTEGER"}, {"currency", "TEXT"},
+		{"discount", "INTEGER"}, {"tax", "INTEGER"},
+	} {
+		if err := r.addColumnIfNotExists(ctx, "orders", col[0], col[1]); err != nil {
+			return err
+		}
+	}
+	{
+		_, err := r.DB.ExecContext(ctx,
+			`CREATE TABLE IF NOT EXISTS exchange_rates (
+			currency TEXT PRIMARY KEY,
+			rate TEXT NOT NULL,
+			isReference INTEGER NOT NULL DEFAULT 0,
+			updatedAt INTEGER NOT NULL
+			);`)
+		if err != nil {
+			return err
+		}
+	}
+	{
+		_, err := r.DB.ExecContext(ctx,
+			`CREATE TABLE IF NOT EXISTS order_placements (
+			correlationID TEXT PRIMARY KEY,
 			userID TEXT NOT NULL,
 			status TEXT NOT NULL,
-			createdAt DATETIME NOT NULL,
-			PRIMARY KEY(userID, orderID)
+			orderID TEXT,
+			itemsID TEXT NOT NULL,
+			quantities TEXT NOT NULL,
+			availability TEXT,
+			createdAt INTEGER NOT NULL,
+			updatedAt INTEGER NOT NULL
+			);`)
+		if err != nil {
+			return err
+		}
+	}
+	// checkout saga state of the placement; placements created before the saga are finished,
+	// pending ones expire right away and get their reservation released
+	for _, col := range [][2]string{
+		{"step", "TEXT"}, {"deadlineAt", "INTEGER"}, {"retries", "INTEGER NOT NULL DEFAULT 0"},
+		{"lastError", "TEXT"}, {"total", "INTEGER"}, {"currency", "TEXT"},
+		{"region", "TEXT NOT NULL DEFAULT ''"}, {"quote", "TEXT"}, {"couponCode", "TEXT"},
+	} {
+		if err := r.addColumnIfNotExists(ctx, "order_placements", col[0], col[1]); err != nil {
+			return err
+		}
+	}
+	{
+		_, err := r.DB.ExecContext(ctx,
+			`UPDATE order_placements
+			SET step = CASE status WHEN 'PLACED' THEN 'DONE' WHEN 'FAILED' THEN 'COMPENSATED' ELSE 'RESERVING' END,
+			deadlineAt = CASE status WHEN 'PENDING' THEN unixepoch() END
+			WHERE step IS NULL`)
+		if err != nil {
+			return err
+		}
+	}
+	{
+		_, err := r.DB.ExecContext(ctx,
+			`CREATE INDEX IF NOT EXISTS order_placements_deadline ON order_placements(deadlineAt) WHERE deadlineAt IS NOT NULL`)
+		if err != nil {
+			return err
+		}
+	}
+	{
+		_, err := r.DB.ExecContext(ctx,
+			`CREATE TABLE IF NOT EXISTS idempotency_keys (
+			userID TEXT NOT NULL,
+			idemKey TEXT NOT NULL,
+			requestHash TEXT NOT NULL,
+			status INTEGER NOT NULL DEFAULT 0,
+			contentType TEXT NOT NULL DEFAULT '',
+			body BLOB,
+			createdAt INTEGER NOT NULL,
+			PRIMARY KEY(userID, idemKey)
+			);`)
+		if err != nil {
+			return err
+		}
+	}
+	{
+		_, err := r.DB.ExecContext(ctx,
+			`CREATE INDEX IF NOT EXISTS idempotency_keys_created ON idempotency_keys(createdAt)`)
+		if err != nil {
+			return err
+		}
+	}
+	// checkout breakdown the order was placed with, orders placed before it was kept have none
+	for _, col := range [][2]string{
+		{"region", "TEXT"}, {"currency", "TEXT"}, {"total", "INTEGER"}, {"quote", "TEXT"},
+	} {
+		if err := r.addColumnIfNotExists(ctx, "user_orders", col[0], col[1]); err != nil {
+			return err
+		}
+	}
+	if err := r.migrateUsersOrders(ctx); err != nil {
+		return err
+	}
+	// timelines of orders placed before they were recorded start with the current status
+	{
+		_, err := r.DB.ExecContext(ctx,
+			`INSERT INTO order_status_history (userID, orderID, status, changedBy, changedAt)
+			SELECT userID, orderID, status, userID, createdAt
+			FROM user_orders uo
+			WHERE NOT EXISTS (
+				SELECT 1 FROM order_status_history h WHERE h.orderID=uo.orderID
+			)`)
+		if err != nil {
+			return err
+		}
+	}
+	{
+		_, err := r.DB.ExecContext(ctx,
+			`CREATE TABLE IF NOT EXISTS coupons (
+			code TEXT PRIMARY KEY,
+			percentBps INTEGER NOT NULL DEFAULT 0,
+			amount INTEGER NOT NULL DEFAULT 0,
+			minSubtotal INTEGER NOT NULL DEFAULT 0,
+			perUserLimit INTEGER NOT NULL DEFAULT 0,
+			globalLimit INTEGER NOT NULL DEFAULT 0,
+			startsAt INTEGER,
+			endsAt INTEGER,
+			categories TEXT NOT NULL DEFAULT '[]',
+			sellerIDs TEXT NOT NULL DEFAULT '[]',
+			createdAt INTEGER NOT NULL,
+			updatedAt INTEGER NOT NULL
 			);`)
 		if err != nil {
 			return err
 		}
 	}
+	{
+		_, err := r.DB.ExecContext(ctx,
+			`CREATE TABLE IF NOT EXISTS cart_coupons (
+			userID TEXT PRIMARY KEY,
+			code TEXT NOT NULL,
+			appliedAt INTEGER NOT NULL
+			);`)
+		if err != nil {
+			return err
+		}
+	}
+	// one redemption per checkout saga, released ones no longer count against the limits
+	{
+		_, err := r.DB.ExecContext(ctx,
+			`CREATE TABLE IF NOT EXISTS coupon_redemptions (
+			correlationID TEXT PRIMARY KEY,
+			code TEXT NOT NULL,
+			userID TEXT NOT NULL,
+			redeemedAt INTEGER NOT NULL,
+			releasedAt INTEGER
+			);`)
+		if err != nil {
+			return err
+		}
+	}
+	{
+		_, err := r.DB.ExecContext(ctx,
+			`CREATE INDEX IF NOT EXISTS coupon_redemptions_code ON coupon_redemptions(code, userID) WHERE releasedAt IS NULL`)
+		if err != nil {
+			return err
+		}
+	}
+	if err := sqliteOutbox.CreateTable(ctx, r.DB); err != nil {
+		return err
+	}
 	return nil
 }
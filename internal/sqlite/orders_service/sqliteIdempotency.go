@@ -0,0 +1,70 @@
+package sqliteRepoMarketplace
+
+import (
+	"context"
+	structsUFUT "ufut/lib/structs"
+)
+
+/*
+rec:
+
+	UserID, Key	- must be not null
+	RequestHash	- fingerprint of the request
+
+Keys created before expiredBefore (unix seconds) are dropped first, so are keys of requests
+without a stored response created before abandonedBefore, their handler has died.
+Takes the key of the user for the request and returns nil, or returns the record of the request
+that has already taken it; the caller compares its RequestHash
+*/
+func (r *SQLiteRepo) ReserveIdempotencyKey(ctx context.Context, rec *structsUFUT.IdempotencyRecordRMP, expiredBefore, abandonedBefore int64) (*structsUFUT.IdempotencyRecordRMP, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM idempotency_keys
+		WHERE createdAt < ? OR (status=0 AND createdAt < ?)`, expiredBefore, abandonedBefore); err != nil {
+		return nil, err
+	}
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO idempotency_keys (userID, idemKey, requestHash, createdAt)
+		VALUES (?,?,?,unixepoch())
+		ON CONFLICT(userID, idemKey) DO NOTHING`, rec.UserID, rec.Key, rec.RequestHash)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 1 {
+		return nil, tx.Commit()
+	}
+	stored := &structsUFUT.IdempotencyRecordRMP{UserID: rec.UserID, Key: rec.Key}
+	q_res := tx.QueryRowContext(ctx,
+		`SELECT requestHash, status, contentType, COALESCE(body, x''), createdAt
+		FROM idempotency_keys WHERE userID=? AND idemKey=?`, rec.UserID, rec.Key)
+	if err := q_res.Scan(&stored.RequestHash, &stored.Status, &stored.ContentType, &stored.Body, &stored.CreatedAt); err != nil {
+		return nil, err
+	}
+	return stored, tx.Commit()
+}
+
+/*
+Stores the response of the request holding the key, retries replay it
+*/
+func (r *SQLiteRepo) StoreIdempotentResponse(ctx context.Context, rec *structsUFUT.IdempotencyRecordRMP) error {
+	_, err := r.DB.ExecContext(ctx,
+		`UPDATE idempotency_keys
+		SET status=?, contentType=?, body=?
+		WHERE userID=? AND idemKey=?`, rec.Status, rec.ContentType, rec.Body, rec.UserID, rec.Key)
+	return err
+}
+
+/*
+Frees the key, so the request can be retried with it
+*/
+func (r *SQLiteRepo) ReleaseIdempotencyKey(ctx context.Context, userID, key string) error {
+	_, err := r.DB.ExecContext(ctx,
+		`DELETE FROM idempotency_keys WHERE userID=? AND idemKey=?`, userID, key)
+	return err
+}
@@ -3,72 +3,155 @@ package sqliteRepoMarketplace
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
-	"strconv"
+	"slices"
+	"time"
+	sqliteOutbox "ufut/internal/sqlite/outbox"
+	funcsUFUT "ufut/lib/funcs"
 	structsUFUT "ufut/lib/structs"
-)
 
-var (
-	ErrOrderAlreadyFinished = errors.New("order is already finished")
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
 )
 
 /*
-userID - uuid (16 bytes)
-Takes data from shopping cart, places order and clears user's shopping cart
+req:
+
+	correlationID	- placement created by CreatePlacement
+	from			- steps the saga may be in
+	availability	- parallel to the placement's cart snapshot; nil uses the stored availability
+	quote			- checkout breakdown of the available items; nil uses the stored quote
+
+Places the order for the available items of the saga and removes them from user's shopping cart,
+unavailable items are left out of the order and stay in the cart. The order keeps the quote as it is,
+the coupon redeemed by the saga is taken off the cart. Placement is FAILED if none of the items is available. Returns the placement;
+sagas in other steps are returned unchanged, so a redelivered reply doesn't place the order twice
 */
-func (r *SQLiteRepo) PlaceOrder(ctx context.Context, userID string, availability []bool) error {
-	q_row_res := r.DB.QueryRowContext(ctx,
-		`SELECT MAX(orderID)
-		FROM usersOrders
-		WHERE userID=?`, userID)
-	var maxID int
-	q_row_res.Scan(&maxID)
-	maxID++
-	q_res, err := r.DB.QueryContext(ctx,
-		`SELECT itemID, quantity
-		FROM shopping_cart
-		WHERE userID=?`, userID)
+func (r *SQLiteRepo) PlaceOrder(ctx context.Context, correlationID string, from []string, availability []bool, quote *structsUFUT.QuoteRMP) (*structsUFUT.PlacementRMP, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer q_res.Close()
-	{
-		_, err := r.DB.ExecContext(ctx,
-			`INSERT INTO usersOrders
-			(orderID, userID, status, createdAt)
-			VALUES (?,?,"CREATED", CURRENT_TIMESTAMP)`,
-			maxID, userID)
+	defer tx.Rollback()
+	p, err := r.lockedSaga(ctx, tx, correlationID)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(from, p.Step) {
+		return p, nil
+	}
+	if availability == nil {
+		availability = p.ItemsAvailability
+	}
+	p.ItemsAvailability = make([]bool, len(p.ItemsID))
+	copy(p.ItemsAvailability, availability)
+	p.DeadlineAt, p.LastError = 0, ""
+	if quote != nil {
+		p.Quote = quote
+	}
+	if slices.Contains(p.ItemsAvailability, true) {
+		id, err := uuid.NewV7()
 		if err != nil {
-			return err
+			return nil, err
+		}
+		orderID := id.String()
+		// the number is taken by the insert, so concurrent checkouts can't get the same one
+		var quoteData, currency sql.NullString
+		var total sql.NullInt64
+		if p.Quote != nil {
+			data, err := json.Marshal(p.Quote)
+			if err != nil {
+				return nil, err
+			}
+			quoteData = sql.NullString{String: string(data), Valid: true}
+			currency = sql.NullString{String: p.Quote.Currency, Valid: true}
+			total = sql.NullInt64{Int64: p.Quote.Total, Valid: true}
+			p.Total, p.Currency = p.Quote.Total, p.Quote.Currency
+		}
+		q_row_res := tx.QueryRowContext(ctx,
+			`INSERT INTO user_orders
+			(orderID, orderNumber, userID, status, region, currency, total, quote, createdAt)
+			SELECT ?, COALESCE(MAX(orderNumber), 0)+1, ?, ?, ?, ?, ?, ?, unixepoch()
+			FROM user_orders
+			RETURNING orderNumber`,
+			orderID, p.UserID, structsUFUT.OrderCreated, p.Region, currency, total, quoteData)
+		if err := q_row_res.Scan(&p.OrderNumber); err != nil {
+			return nil, err
+		}
+		if err := r.addOrderHistory(ctx, tx, &structsUFUT.OrderStatusChangeRMP{
+			UserID: p.UserID, OrderID: orderID, To: structsUFUT.OrderCreated,
+			ChangedBy: p.UserID, ChangedAt: time.Now().Unix()}); err != nil {
+			return nil, err
+		}
+		quoted := map[string]structsUFUT.QuoteLineRMP{}
+		if p.Quote != nil {
+			for _, line := range p.Quote.Lines {
+				quoted[line.ItemID] = line
+			}
+		}
+		for i, itemID := range p.ItemsID {
+			if !p.ItemsAvailability[i] {
+				continue
+			}
+			// later catalog changes must not alter the order; the line is sold as quoted,
+			// only lines of sagas without a quote take the price from the catalog
+			if line, ok := quoted[itemID]; ok {
+				_, err = tx.ExecContext(ctx,
+					`INSERT INTO orders
+					(orderID, itemID, quantity, name, sellerID, unitPrice, currency, discount, tax)
+					SELECT ?, ?, ?, ci.name, ci.sellerID, ?, ?, ?, ?
+					FROM (SELECT ? AS itemID) i
+					LEFT JOIN catalog_items ci ON ci.itemID = i.itemID`,
+					orderID, itemID, p.Quantities[i], line.UnitPrice, p.Quote.Currency,
+					line.Discount+line.Promotion+line.Coupon, line.Tax, itemID)
+			} else {
+				_, err = tx.ExecContext(ctx,
+					`INSERT INTO orders
+					(orderID, itemID, quantity, name, sellerID, unitPrice, currency)
+					SELECT ?, ?, ?, ci.name, ci.sellerID, ci.price, ci.currency
+					FROM (SELECT ? AS itemID) i
+					LEFT JOIN catalog_items ci ON ci.itemID = i.itemID`,
+					orderID, itemID, p.Quantities[i], itemID)
+			}
+			if err != nil {
+				return nil, err
+			}
+			// items added to the cart after the order was placed stay there
+			if _, err := tx.ExecContext(ctx,
+				`UPDATE shopping_cart
+				SET quantity=quantity-?
+				WHERE userID=? AND itemID=?`,
+				p.Quantities[i], p.UserID, itemID); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := tx.ExecContext(ctx,
+			`DELETE FROM shopping_cart WHERE userID=? AND quantity<=0`, p.UserID); err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx,
+			`DELETE FROM cart_coupons
+			WHERE userID=? AND code IN (
+				SELECT code FROM coupon_redemptions WHERE correlationID=? AND releasedAt IS NULL
+			)`, p.UserID, correlationID); err != nil {
+			return nil, err
+		}
+		p.OrderID = orderID
+		p.Status, p.Step = structsUFUT.PlacementPlaced, structsUFUT.SagaDone
+	} else {
+		p.Status, p.Step = structsUFUT.PlacementFailed, structsUFUT.SagaCompensated
+		if err := r.releaseCoupon(ctx, tx, correlationID); err != nil {
+			return nil, err
 		}
 	}
-	i := -1
-	for q_res.Next() {
-		i++
-		if !availability[i] {
-			continue
-		}
-		var (
-			ItemID   string
-			Quantity string
-		)
-		q_res.Scan(&ItemID, &Quantity)
-		orderID := userID + strconv.Itoa(maxID)
-		_, errEx := r.DB.ExecContext(ctx,
-			`INSERT INTO orders
-			(orderID, itemID, quantity)
-			VALUES (?,?,?)`,
-			orderID, ItemID, Quantity)
-		if errEx != nil {
-			return errEx
-		}
-	}
-	_, errDel := r.DB.ExecContext(ctx,
-		`DELETE FROM shopping_cart WHERE userID=?`, userID)
-	if errDel != nil {
-		return errDel
+	if err := r.storeSaga(ctx, tx, p); err != nil {
+		return nil, err
 	}
-	return nil
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return p, nil
 }
 
 /*
@@ -76,26 +159,111 @@ req:
 
 	UserID	- must be not null
 	OrderID	- must be not null
-	Status	- ignored
 
-F checks whether the order is finished; if it isn’t, F cancels it
+Returns the correlation ID of the saga that placed the order, empty for orders placed without one
 */
-func (r *SQLiteRepo) RemoveOrder(ctx context.Context, req *structsUFUT.OrderRequestRMP) error {
+func (r *SQLiteRepo) OrderCorrelationID(ctx context.Context, req *structsUFUT.OrderRequestRMP) (string, error) {
 	q_res := r.DB.QueryRowContext(ctx,
-		`SELECT status FROM usersOrders WHERE orderID=? AND userID=?`, req.OrderID, req.UserID)
-	var stts string
-	if err := q_res.Scan(&stts); err != nil {
-		return err
+		`SELECT correlationID FROM order_placements WHERE userID=? AND orderID=?`, req.UserID, req.OrderID)
+	var correlationID string
+	if err := q_res.Scan(&correlationID); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
 	}
-	if stts != "FINISHED" {
-		_, err := r.DB.ExecContext(ctx,
-			`UPDATE usersOrders
-			SET status="CANCELLED"
-			WHERE orderID=? AND userID=?`, req.OrderID, req.UserID)
-		return err
-	} else {
-		return ErrOrderAlreadyFinished
+	return correlationID, nil
+}
+
+/*
+change:
+
+	UserID, OrderID	- must be not null
+	From			- status the order must be in
+	To				- new status
+	ChangedBy		- user or staff member who made the change
+	ChangedAt		- unix seconds
+
+events - stored in the outbox with the change
+
+Moves the order from status From to To and appends the change to its timeline,
+a CANCELLED order releases the coupon redemption of the saga that placed it.
+Returns false and changes nothing if the order isn't in status From, e.g. it was changed concurrently
+*/
+func (r *SQLiteRepo) ChangeOrderStatus(ctx context.Context, change *structsUFUT.OrderStatusChangeRMP, events ...kafka.Message) (bool, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx,
+		`UPDATE user_orders
+		SET status=?
+		WHERE orderID=? AND userID=? AND status=?`, change.To, change.OrderID, change.UserID, change.From)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
 	}
+	if err := r.addOrderHistory(ctx, tx, change); err != nil {
+		return false, err
+	}
+	if change.To == structsUFUT.OrderCancelled {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE coupon_redemptions SET releasedAt=unixepoch()
+			WHERE releasedAt IS NULL AND correlationID IN (
+				SELECT correlationID FROM order_placements WHERE orderID=?
+			)`, change.OrderID); err != nil {
+			return false, err
+		}
+	}
+	if err := sqliteOutbox.Enqueue(ctx, tx, events...); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (r *SQLiteRepo) addOrderHistory(ctx context.Context, tx *sql.Tx, change *structsUFUT.OrderStatusChangeRMP) error {
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO order_status_history
+		(userID, orderID, fromStatus, status, changedBy, changedAt)
+		VALUES (?,?,?,?,?,?)`,
+		change.UserID, change.OrderID, change.From, change.To, change.ChangedBy, change.ChangedAt)
+	return err
+}
+
+/*
+req:
+
+	UserID	- must be not null
+	OrderID	- must be not null
+	Status	- ignored
+
+Returns the timeline of the order oldest first, sql.ErrNoRows if the user has no such order
+*/
+func (r *SQLiteRepo) OrderHistory(ctx context.Context, req *structsUFUT.OrderRequestRMP) ([]structsUFUT.OrderStatusChangeRMP, error) {
+	q_res, err := r.DB.QueryContext(ctx,
+		`SELECT fromStatus, status, changedBy, changedAt
+		FROM order_status_history
+		WHERE userID=? AND orderID=?
+		ORDER BY id`, req.UserID, req.OrderID)
+	if err != nil {
+		return nil, err
+	}
+	defer q_res.Close()
+	history := []structsUFUT.OrderStatusChangeRMP{}
+	for q_res.Next() {
+		change := structsUFUT.OrderStatusChangeRMP{UserID: req.UserID, OrderID: req.OrderID}
+		if err := q_res.Scan(&change.From, &change.To, &change.ChangedBy, &change.ChangedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, change)
+	}
+	if err := q_res.Err(); err != nil {
+		return nil, err
+	}
+	if len(history) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return history, nil
 }
 
 /*
@@ -109,7 +277,7 @@ Checks the status of the order
 */
 func (r *SQLiteRepo) OrderStatus(ctx context.Context, req *structsUFUT.OrderRequestRMP) error {
 	q_res := r.DB.QueryRowContext(ctx,
-		`SELECT status FROM usersOrders WHERE orderID=? AND userID=?`, req.OrderID, req.UserID)
+		`SELECT status FROM user_orders WHERE orderID=? AND userID=?`, req.OrderID, req.UserID)
 	var stts string
 	if err := q_res.Scan(&stts); err != nil {
 		return err
@@ -118,55 +286,155 @@ func (r *SQLiteRepo) OrderStatus(ctx context.Context, req *structsUFUT.OrderRequ
 	return nil
 }
 
+/*
+Returns the user who placed the order, sql.ErrNoRows if there is no such order
+*/
+func (r *SQLiteRepo) OrderOwner(ctx context.Context, orderID string) (string, error) {
+	q_res := r.DB.QueryRowContext(ctx,
+		`SELECT userID FROM user_orders WHERE orderID=?`, orderID)
+	var userID string
+	err := q_res.Scan(&userID)
+	return userID, err
+}
+
+/*
+req:
+
+	UserID	- must be not null
+	OrderID	- must be not null
+	Status	- ignored
+
+Returns the order with its line snapshots and timeline, line totals are left to the caller.
+sql.ErrNoRows if the user has no such order
+*/
+func (r *SQLiteRepo) OrderDetail(ctx context.Context, req *structsUFUT.OrderRequestRMP) (*structsUFUT.OrderDetailRMP, error) {
+	order := &structsUFUT.OrderDetailRMP{OrderID: req.OrderID, Lines: []structsUFUT.OrderLineRMP{}}
+	q_row_res := r.DB.QueryRowContext(ctx,
+		`SELECT orderNumber, status, quote, createdAt FROM user_orders WHERE orderID=? AND userID=?`,
+		req.OrderID, req.UserID)
+	var quote sql.NullString
+	if err := q_row_res.Scan(&order.OrderNumber, &order.Status, &quote, &order.CreatedAt); err != nil {
+		return nil, err
+	}
+	if quote.Valid {
+		if err := json.Unmarshal([]byte(quote.String), &order.Quote); err != nil {
+			return nil, err
+		}
+	}
+	q_res, err := r.DB.QueryContext(ctx,
+		`SELECT itemID, quantity, COALESCE(name, ''), COALESCE(sellerID, ''), unitPrice, COALESCE(currency, ''),
+		COALESCE(discount, 0), COALESCE(tax, 0)
+		FROM orders
+		WHERE orderID=?
+		ORDER BY itemID`, req.OrderID)
+	if err != nil {
+		return nil, err
+	}
+	defer q_res.Close()
+	for q_res.Next() {
+		var line structsUFUT.OrderLineRMP
+		var unitPrice sql.NullInt64
+		if err := q_res.Scan(&line.ItemID, &line.Quantity, &line.Name, &line.SellerID, &unitPrice, &line.Currency,
+			&line.Discount, &line.Tax); err != nil {
+			return nil, err
+		}
+		if unitPrice.Valid && line.Currency != "" {
+			line.UnitPrice = &unitPrice.Int64
+		}
+		order.Lines = append(order.Lines, line)
+	}
+	if err := q_res.Err(); err != nil {
+		return nil, err
+	}
+	if order.History, err = r.OrderHistory(ctx, req); err != nil {
+		return nil, err
+	}
+	order.UpdatedAt = order.History[len(order.History)-1].ChangedAt
+	return order, nil
+}
+
 /*
 req:
 
 	UserID	- must be not null
 	OrderID - ignored
 	Status	- optional; if provided, only orders with this status will be returned
+	Cursor	- optional; NextCursor of the previous page
+	Count	- must be positive; page size
 
-Returns all orders of the user, otherwise filtered by status if provided
+Returns orders of the user newest first, otherwise filtered by status if provided
 */
 func (r *SQLiteRepo) UserOrders(ctx context.Context, req *structsUFUT.OrderRequestRMP) (*structsUFUT.OrdersResponseRMP, error) {
-	query := `SELECT orderID, status FROM usersOrders WHERE userID=?`
-	var q_res *sql.Rows
-	var err error
+	query := `SELECT orderID, orderNumber, status FROM user_orders WHERE userID=?`
+	args := []any{req.UserID}
 	if req.Status != "" {
 		query += ` AND status=?`
-		q_res, err = r.DB.QueryContext(ctx, query, req.UserID, req.Status)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		q_res, err = r.DB.QueryContext(ctx, query, req.UserID)
+		args = append(args, req.Status)
+	}
+	if req.Cursor != "" {
+		c, err := funcsUFUT.DecodeCursor(req.Cursor, "desc")
 		if err != nil {
 			return nil, err
 		}
+		query += ` AND orderNumber<?`
+		args = append(args, c.SortKey)
 	}
+	query += ` ORDER BY orderNumber DESC LIMIT ?`
+	args = append(args, req.Count+1)
+	q_res, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer q_res.Close()
 	ret := structsUFUT.OrdersResponseRMP{}
 	for q_res.Next() {
-		var orderID int
-		var status string
-		q_res.Scan(&orderID, &status)
+		var orderID, status string
+		var number int64
+		if err := q_res.Scan(&orderID, &number, &status); err != nil {
+			return nil, err
+		}
+		if len(ret.OrderID) == req.Count {
+			ret.NextCursor = funcsUFUT.EncodeCursor(funcsUFUT.Cursor{
+				SortKey: ret.OrderNumbers[len(ret.OrderNumbers)-1],
+				Order:   "desc",
+			})
+			break
+		}
 		ret.OrderID = append(ret.OrderID, orderID)
+		ret.OrderNumbers = append(ret.OrderNumbers, number)
 		ret.Status = append(ret.Status, status)
 	}
-	return &ret, nil
+	return &ret, q_res.Err()
 }
 
+/*
+req:
+
+	UserID	- must be not null
+	OrderID	- must be not null
+	Status	- ignored
+
+Returns items and quantities of the user's order
+*/
 func (r *SQLiteRepo) ItemsIDsByOrderID(ctx context.Context, req *structsUFUT.OrderRequestRMP) (*structsUFUT.ShoppingCartRMP, error) {
 	res, err := r.DB.QueryContext(ctx,
-		`SELECT itemID, quantity FROM orders WHERE orderID=?`, strconv.Itoa(req.OrderID)+req.UserID)
+		`SELECT o.itemID, o.quantity FROM orders o
+		JOIN user_orders uo ON uo.orderID = o.orderID
+		WHERE o.orderID=? AND uo.userID=?
+		ORDER BY o.itemID`, req.OrderID, req.UserID)
 	if err != nil {
 		return nil, err
 	}
-	items := structsUFUT.ShoppingCartRMP{}
+	defer res.Close()
+	items := structsUFUT.ShoppingCartRMP{UserID: req.UserID}
 	for res.Next() {
 		var itemID string
 		var quantity int
-		res.Scan(&itemID, &quantity)
+		if err := res.Scan(&itemID, &quantity); err != nil {
+			return nil, err
+		}
 		items.ItemsID = append(items.ItemsID, itemID)
 		items.Quantities = append(items.Quantities, quantity)
 	}
-	return &items, nil
+	return &items, res.Err()
 }
@@ -0,0 +1,269 @@
+package sqliteRepoMarketplace
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	sqliteOutbox "ufut/internal/sqlite/outbox"
+	structsUFUT "ufut/lib/structs"
+
+	"github.com/segmentio/kafka-go"
+)
+
+var (
+	ErrPlacementNotFound = errors.New("placement not found")
+	ErrEmptyCart         = errors.New("shopping cart is empty")
+)
+
+/*
+req:
+
+	CorrelationID	- must be not null, unique
+	UserID			- must be not null
+	ItemsID			- snapshot of the cart sent to inventory, must be not empty
+	Quantities		- parallel to ItemsID
+	DeadlineAt		- unix seconds the reservation result is awaited until
+	Region			- region the order is quoted for
+	CouponCode		- optional, coupon the order is quoted with
+
+events - reservation request, stored in the outbox with the placement
+
+Starts the checkout saga in RESERVING step, so the reservation result can be matched with the cart it was made for
+*/
+func (r *SQLiteRepo) CreatePlacement(ctx context.Context, p *structsUFUT.PlacementRMP, events ...kafka.Message) error {
+	if len(p.ItemsID) == 0 {
+		return ErrEmptyCart
+	}
+	itemsID, err := json.Marshal(p.ItemsID)
+	if err != nil {
+		return err
+	}
+	quantities, err := json.Marshal(p.Quantities)
+	if err != nil {
+		return err
+	}
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO order_placements
+		(correlationID, userID, status, itemsID, quantities, step, deadlineAt, region, couponCode, createdAt, updatedAt)
+		VALUES (?,?,?,?,?,?,?,?,?,unixepoch(),unixepoch())`,
+		p.CorrelationID, p.UserID, structsUFUT.PlacementPending, string(itemsID), string(quantities),
+		structsUFUT.SagaReserving, p.DeadlineAt, p.Region, sql.NullString{String: p.CouponCode, Valid: p.CouponCode != ""})
+	if err != nil {
+		return err
+	}
+	if err := sqliteOutbox.Enqueue(ctx, tx, events...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+/*
+req:
+
+	correlationID	- must be not null
+	userID			- must be not null, placements of other users are not found
+
+Returns the placement with its current status
+*/
+func (r *SQLiteRepo) Placement(ctx context.Context, correlationID, userID string) (*structsUFUT.PlacementRMP, error) {
+	p, err := scanPlacement(r.DB.QueryRowContext(ctx,
+		`SELECT `+placementColumns+` FROM order_placements WHERE correlationID=? AND userID=?`,
+		correlationID, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPlacementNotFound
+	}
+	return p, err
+}
+
+/*
+Returns the saga of any user
+*/
+func (r *SQLiteRepo) Saga(ctx context.Context, correlationID string) (*structsUFUT.PlacementRMP, error) {
+	p, err := scanPlacement(r.DB.QueryRowContext(ctx,
+		`SELECT `+placementColumns+` FROM order_placements WHERE correlationID=?`, correlationID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPlacementNotFound
+	}
+	return p, err
+}
+
+/*
+req:
+
+	Steps			- optional, only sagas in these steps
+	ExpiredBefore	- optional, only sagas with a deadline before it
+	Count			- must be positive
+
+Returns sagas oldest deadline first, sagas without a deadline last
+*/
+func (r *SQLiteRepo) Sagas(ctx context.Context, req *structsUFUT.SagasRequestRMP) ([]structsUFUT.PlacementRMP, error) {
+	query := `SELECT ` + placementColumns + ` FROM order_placements WHERE 1=1`
+	var args []any
+	if len(req.Steps) > 0 {
+		query += ` AND step IN (?` + strings.Repeat(`,?`, len(req.Steps)-1) + `)`
+		for _, step := range req.Steps {
+			args = append(args, step)
+		}
+	}
+	if req.ExpiredBefore > 0 {
+		query += ` AND deadlineAt IS NOT NULL AND deadlineAt < ?`
+		args = append(args, req.ExpiredBefore)
+	}
+	query += ` ORDER BY deadlineAt IS NULL, deadlineAt, correlationID LIMIT ?`
+	args = append(args, req.Count)
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ret := []structsUFUT.PlacementRMP{}
+	for rows.Next() {
+		p, err := scanPlacement(rows)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, *p)
+	}
+	return ret, rows.Err()
+}
+
+/*
+Moves the saga to the next step and stores events of that step in the outbox, both in one transaction.
+Sagas in steps other than t.From are returned unchanged,
+so a redelivered or late reply doesn't move the saga twice. A FAILED saga releases its coupon redemption
+*/
+func (r *SQLiteRepo) TransitSaga(ctx context.Context, correlationID string, t *structsUFUT.SagaTransitionRMP, events ...kafka.Message) (*structsUFUT.PlacementRMP, error) {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	p, err := r.lockedSaga(ctx, tx, correlationID)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(t.From, p.Step) {
+		return p, nil
+	}
+	p.Step = t.Step
+	if t.Status != "" {
+		p.Status = t.Status
+	}
+	if t.ItemsAvailability != nil {
+		p.ItemsAvailability = t.ItemsAvailability
+	}
+	if t.Currency != "" {
+		p.Total, p.Currency = t.Total, t.Currency
+	}
+	if t.Quote != nil {
+		p.Quote = t.Quote
+	}
+	if t.Retry {
+		p.Retries++
+	}
+	p.DeadlineAt, p.LastError = t.DeadlineAt, t.LastError
+	if err := r.storeSaga(ctx, tx, p); err != nil {
+		return nil, err
+	}
+	if p.Status == structsUFUT.PlacementFailed {
+		if err := r.releaseCoupon(ctx, tx, correlationID); err != nil {
+			return nil, err
+		}
+	}
+	if err := sqliteOutbox.Enqueue(ctx, tx, events...); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+/*
+Reads the saga in the transaction that is going to change it
+*/
+func (r *SQLiteRepo) lockedSaga(ctx context.Context, tx *sql.Tx, correlationID string) (*structsUFUT.PlacementRMP, error) {
+	p, err := scanPlacement(tx.QueryRowContext(ctx,
+		`SELECT `+placementColumns+` FROM order_placements WHERE correlationID=?`, correlationID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPlacementNotFound
+	}
+	return p, err
+}
+
+func (r *SQLiteRepo) storeSaga(ctx context.Context, tx *sql.Tx, p *structsUFUT.PlacementRMP) error {
+	var availability sql.NullString
+	if p.ItemsAvailability != nil {
+		data, err := json.Marshal(p.ItemsAvailability)
+		if err != nil {
+			return err
+		}
+		availability = sql.NullString{String: string(data), Valid: true}
+	}
+	var quote sql.NullString
+	if p.Quote != nil {
+		data, err := json.Marshal(p.Quote)
+		if err != nil {
+			return err
+		}
+		quote = sql.NullString{String: string(data), Valid: true}
+	}
+	res := tx.QueryRowContext(ctx,
+		`UPDATE order_placements
+		SET status=?, orderID=?, availability=?, step=?, deadlineAt=?, retries=?, lastError=?,
+		total=?, currency=?, quote=?, updatedAt=unixepoch()
+		WHERE correlationID=?
+		RETURNING updatedAt`,
+		p.Status, sql.NullString{String: p.OrderID, Valid: p.OrderID != ""}, availability, p.Step,
+		sql.NullInt64{Int64: p.DeadlineAt, Valid: p.DeadlineAt != 0}, p.Retries,
+		sql.NullString{String: p.LastError, Valid: p.LastError != ""},
+		sql.NullInt64{Int64: p.Total, Valid: p.Currency != ""}, sql.NullString{String: p.Currency, Valid: p.Currency != ""},
+		quote, p.CorrelationID)
+	return res.Scan(&p.UpdatedAt)
+}
+
+const placementColumns = `correlationID, userID, status, orderID,
+	(SELECT uo.orderNumber FROM user_orders uo WHERE uo.orderID = order_placements.orderID),
+	itemsID, quantities, availability, step, deadlineAt, retries, lastError, total, currency, region, couponCode, quote,
+	createdAt, updatedAt`
+
+func scanPlacement(row interface{ Scan(...any) error }) (*structsUFUT.PlacementRMP, error) {
+	var p structsUFUT.PlacementRMP
+	var orderNumber, deadlineAt, total sql.NullInt64
+	var itemsID, quantities string
+	var orderID, availability, lastError, currency, couponCode, quote sql.NullString
+	if err := row.Scan(&p.CorrelationID, &p.UserID, &p.Status, &orderID, &orderNumber, &itemsID, &quantities,
+		&availability, &p.Step, &deadlineAt, &p.Retries, &lastError, &total, &currency, &p.Region, &couponCode, &quote,
+		&p.CreatedAt, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	p.CouponCode = couponCode.String
+	p.OrderID, p.OrderNumber = orderID.String, orderNumber.Int64
+	p.DeadlineAt, p.LastError = deadlineAt.Int64, lastError.String
+	p.Total, p.Currency = total.Int64, currency.String
+	if err := json.Unmarshal([]byte(itemsID), &p.ItemsID); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(quantities), &p.Quantities); err != nil {
+		return nil, err
+	}
+	if availability.Valid {
+		if err := json.Unmarshal([]byte(availability.String), &p.ItemsAvailability); err != nil {
+			return nil, err
+		}
+	}
+	if quote.Valid {
+		if err := json.Unmarshal([]byte(quote.String), &p.Quote); err != nil {
+			return nil, err
+		}
+	}
+	return &p, nil
+}
@@ -0,0 +1,113 @@
+package sqliteRepoMarketplace
+
+import (
+	"context"
+	"database/sql"
+	structsUFUT "ufut/lib/structs"
+)
+
+// items known to be unpurchasable; items never seen in catalog events are recommended
+const recommendableItem = `NOT EXISTS (
+	SELECT 1 FROM catalog_items ci WHERE ci.itemID = c.relatedItemID AND ci.status != '` + structsUFUT.ItemStatusAvailable + `')`
+
+/*
+Recomputes item_copurchases from scratch: score of (itemID, relatedItemID)
+is the number of not cancelled orders containing both items
+*/
+func (r *SQLiteRepo) RecomputeCoPurchases(ctx context.Context) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM item_copurchases`); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO item_copurchases (itemID, relatedItemID, score)
+		SELECT a.itemID, b.itemID, COUNT(DISTINCT a.orderID)
+		FROM orders a
+		JOIN orders b ON b.orderID = a.orderID AND b.itemID != a.itemID
+		JOIN user_orders uo ON a.orderID = uo.orderID
+		WHERE uo.status != 'CANCELLED'
+		GROUP BY a.itemID, b.itemID`)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+/*
+Remembers the catalog status, name, seller, category and effective price of the item,
+older versions than the stored one are ignored. Orders snapshot them when they are placed
+*/
+func (r *SQLiteRepo) SetCatalogItem(ctx context.Context, item *structsUFUT.ItemDataRSC) error {
+	_, err := r.DB.ExecContext(ctx,
+		`INSERT INTO catalog_items (itemID, status, version, price, currency, name, sellerID, category)
+		VALUES (?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''))
+		ON CONFLICT(itemID) DO UPDATE SET
+			status=excluded.status,
+			version=excluded.version,
+			price=excluded.price,
+			currency=excluded.currency,
+			name=COALESCE(excluded.name, catalog_items.name),
+			sellerID=COALESCE(excluded.sellerID, catalog_items.sellerID),
+			category=COALESCE(excluded.category, catalog_items.category)
+		WHERE excluded.version >= catalog_items.version`,
+		item.ItemID, item.Status, item.Version, item.Price, item.Currency, item.Name, item.SellerID, item.Category)
+	return err
+}
+
+/*
+Returns up to count items most often bought together with the item, best first
+*/
+func (r *SQLiteRepo) RelatedItems(ctx context.Context, itemID string, count int) ([]string, error) {
+	rows, err := r.DB.QueryContext(ctx,
+		`SELECT c.relatedItemID FROM item_copurchases c
+		WHERE c.itemID=? AND `+recommendableItem+`
+		ORDER BY c.score DESC, c.relatedItemID
+		LIMIT ?`, itemID, count)
+	if err != nil {
+		return nil, err
+	}
+	return scanItemIDs(rows)
+}
+
+/*
+Returns up to count items bought together with the items the user ordered or has in the cart,
+scores of all such items are summed; items the user already has are skipped
+*/
+func (r *SQLiteRepo) RecommendedItems(ctx context.Context, userID string, count int) ([]string, error) {
+	rows, err := r.DB.QueryContext(ctx,
+		`WITH seeds AS (
+			SELECT itemID FROM shopping_cart WHERE userID=?
+			UNION
+			SELECT o.itemID FROM orders o
+			JOIN user_orders uo ON o.orderID = uo.orderID
+			WHERE uo.userID=? AND uo.status != 'CANCELLED'
+		)
+		SELECT c.relatedItemID FROM item_copurchases c
+		WHERE c.itemID IN (SELECT itemID FROM seeds)
+			AND c.relatedItemID NOT IN (SELECT itemID FROM seeds)
+			AND `+recommendableItem+`
+		GROUP BY c.relatedItemID
+		ORDER BY SUM(c.score) DESC, c.relatedItemID
+		LIMIT ?`, userID, userID, count)
+	if err != nil {
+		return nil, err
+	}
+	return scanItemIDs(rows)
+}
+
+func scanItemIDs(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
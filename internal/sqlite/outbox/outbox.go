@@ -0,0 +1,274 @@
+package sqliteOutbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+var (
+	ErrMissingTopic = errors.New("outbox message must name its topic")
+	ErrNoWriter     = errors.New("no writer for outbox topic")
+)
+
+const (
+	// DefaultBatchSize limits rows of a topic published by one relay pass
+	DefaultBatchSize = 100
+	// DefaultMaxBackoff limits the delay between attempts of a failing row
+	DefaultMaxBackoff = 5 * time.Minute
+	// DefaultRetention is how long sent rows are kept
+	DefaultRetention = 24 * time.Hour
+)
+
+/*
+Writer publishes messages to one topic; *kafka.Writer with Topic set satisfies it
+*/
+type Writer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+/*
+Creates the outbox table if it does not exist
+*/
+func CreateTable(ctx context.Context, db *sql.DB) error {
+	{
+		_, err := db.ExecContext(ctx,
+			`CREATE TABLE IF NOT EXISTS outbox (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			topic TEXT NOT NULL,
+			msgKey BLOB,
+			value BLOB,
+			headers TEXT NOT NULL,
+			createdAt INTEGER NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			nextAttemptAt INTEGER NOT NULL,
+			lastError TEXT,
+			sentAt INTEGER
+			);`)
+		if err != nil {
+			return err
+		}
+	}
+	{
+		_, err := db.ExecContext(ctx,
+			`CREATE INDEX IF NOT EXISTS outbox_pending ON outbox(id) WHERE sentAt IS NULL`)
+		if err != nil {
+			return err
+		}
+	}
+	{
+		_, err := db.ExecContext(ctx,
+			`CREATE INDEX IF NOT EXISTS outbox_pending_topic ON outbox(topic, id) WHERE sentAt IS NULL`)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+Stores messages in the transaction of the change they announce, so they are published
+only if the change is committed. msg.Topic names the relay writer the message goes to
+*/
+func Enqueue(ctx context.Context, tx *sql.Tx, msgs ...kafka.Message) error {
+	for _, msg := range msgs {
+		if msg.Topic == "" {
+			return ErrMissingTopic
+		}
+		headers, err := json.Marshal(msg.Headers)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO outbox
+			(topic, msgKey, value, headers, createdAt, nextAttemptAt)
+			VALUES (?,?,?,?,unixepoch(),unixepoch())`,
+			msg.Topic, msg.Key, msg.Value, string(headers))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+Relay publishes pending outbox rows and marks them sent.
+Rows of one topic are published in the order they were stored; a failing row is retried
+with exponential backoff and holds back the later rows of its topic.
+Delivery is at least once, consumers skip redelivered events by their event ID
+*/
+type Relay struct {
+	db         *sql.DB
+	writers    map[string]Writer
+	BatchSize  int
+	MaxBackoff time.Duration
+	Retention  time.Duration
+}
+
+/*
+Creates relay for the outbox table of db, writers are keyed by the topic names rows are stored with
+*/
+func NewRelay(db *sql.DB, writers map[string]Writer) *Relay {
+	return &Relay{
+		db:         db,
+		writers:    writers,
+		BatchSize:  DefaultBatchSize,
+		MaxBackoff: DefaultMaxBackoff,
+		Retention:  DefaultRetention,
+	}
+}
+
+type outboxRow struct {
+	id       int64
+	topic    string
+	attempts int
+	msg      kafka.Message
+}
+
+/*
+Loads the oldest BatchSize pending rows of every topic. Topics with a row waiting for its next attempt
+are left out whole, so neither a failing topic nor its backlog holds back the others
+*/
+func (r *Relay) pending(ctx context.Context, now int64) ([]outboxRow, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, topic, msgKey, value, headers, attempts FROM (
+			SELECT *, ROW_NUMBER() OVER (PARTITION BY topic ORDER BY id) AS n
+			FROM outbox
+			WHERE sentAt IS NULL AND topic NOT IN (
+				SELECT topic FROM outbox WHERE sentAt IS NULL AND nextAttemptAt > ?))
+		WHERE n <= ?
+		ORDER BY id`, now, r.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ret []outboxRow
+	for rows.Next() {
+		var row outboxRow
+		var headers string
+		if err := rows.Scan(&row.id, &row.topic, &row.msg.Key, &row.msg.Value, &headers,
+			&row.attempts); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(headers), &row.msg.Headers); err != nil {
+			return nil, err
+		}
+		ret = append(ret, row)
+	}
+	return ret, rows.Err()
+}
+
+/*
+Publishes one batch of pending rows of every topic, returns the number of rows sent
+*/
+func (r *Relay) RelayPending(ctx context.Context) (int, error) {
+	now := time.Now().Unix()
+	rows, err := r.pending(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+	batches := map[string][]outboxRow{}
+	var topics []string
+	for _, row := range rows {
+		if _, ok := batches[row.topic]; !ok {
+			topics = append(topics, row.topic)
+		}
+		batches[row.topic] = append(batches[row.topic], row)
+	}
+	sent := 0
+	for _, topic := range topics {
+		batch := batches[topic]
+		msgs := make([]kafka.Message, len(batch))
+		for i, row := range batch {
+			msgs[i] = row.msg
+		}
+		writer, ok := r.writers[topic]
+		err := ErrNoWriter
+		if ok {
+			err = writer.WriteMessages(ctx, msgs...)
+		}
+		if err != nil {
+			log.Printf("outbox: failed publish %d messages to %s: %v\n", len(batch), topic, err)
+			if err := r.markFailed(ctx, batch, err); err != nil {
+				return sent, err
+			}
+			continue
+		}
+		if err := r.markSent(ctx, batch); err != nil {
+			return sent, err
+		}
+		sent += len(batch)
+	}
+	if _, err := r.db.ExecContext(ctx,
+		`DELETE FROM outbox WHERE sentAt < ?`, now-int64(r.Retention.Seconds())); err != nil {
+		return sent, err
+	}
+	return sent, nil
+}
+
+func (r *Relay) markSent(ctx context.Context, batch []outboxRow) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, row := range batch {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE outbox SET sentAt=unixepoch(), attempts=attempts+1, lastError=NULL WHERE id=?`, row.id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+/*
+Postpones the next attempt of the batch by 1s, 2s, 4s... up to MaxBackoff
+*/
+func (r *Relay) markFailed(ctx context.Context, batch []outboxRow, cause error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, row := range batch {
+		backoff := r.MaxBackoff
+		if row.attempts < 30 {
+			backoff = min(time.Duration(1<<row.attempts)*time.Second, r.MaxBackoff)
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE outbox
+			SET attempts=attempts+1, lastError=?, nextAttemptAt=unixepoch()+?
+			WHERE id=?`, cause.Error(), int64(backoff.Seconds()), row.id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+/*
+Publishes pending rows every interval until ctx is cancelled;
+a pass that sent a full batch is followed by the next one right away
+*/
+func (r *Relay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		sent, err := r.RelayPending(ctx)
+		if err != nil {
+			log.Printf("outbox: relay failed: %v\n", err)
+		}
+		if err == nil && sent >= r.BatchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package sqliteOutbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type testWriter struct {
+	err  error
+	sent []string
+}
+
+func (w *testWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if w.err != nil {
+		return w.err
+	}
+	for _, msg := range msgs {
+		w.sent = append(w.sent, string(msg.Value))
+	}
+	return nil
+}
+
+func createTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "outbox_test.db"))
+	if err != nil {
+		t.Fatalf("%v", err.Error())
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := CreateTable(t.Context(), db); err != nil {
+		t.Fatalf("%v", err.Error())
+	}
+	return db
+}
+
+func enqueue(t *testing.T, db *sql.DB, topic string, values ...string) {
+	tx, err := db.BeginTx(t.Context(), nil)
+	assert.NoError(t, err)
+	defer tx.Rollback()
+	for _, v := range values {
+		assert.NoError(t, Enqueue(t.Context(), tx, kafka.Message{Topic: topic, Value: []byte(v)}))
+	}
+	assert.NoError(t, tx.Commit())
+}
+
+// retryNow makes the failed rows of the topic due
+func retryNow(t *testing.T, db *sql.DB, topic string) {
+	_, err := db.ExecContext(t.Context(), `UPDATE outbox SET nextAttemptAt=0 WHERE topic=? AND sentAt IS NULL`, topic)
+	assert.NoError(t, err)
+}
+
+func TestEnqueue(t *testing.T) {
+	db := createTestDB(t)
+	tx, err := db.BeginTx(t.Context(), nil)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, Enqueue(t.Context(), tx, kafka.Message{Value: []byte("x")}), ErrMissingTopic)
+	assert.NoError(t, Enqueue(t.Context(), tx, kafka.Message{Topic: "a", Value: []byte("x")}))
+	// rolled back with the change it announces
+	assert.NoError(t, tx.Rollback())
+	sent, err := NewRelay(db, map[string]Writer{"a": &testWriter{}}).RelayPending(t.Context())
+	assert.NoError(t, err)
+	assert.Zero(t, sent)
+}
+
+func TestRelay_Backoff(t *testing.T) {
+	db := createTestDB(t)
+	w := &testWriter{err: errors.New("broker down")}
+	relay := NewRelay(db, map[string]Writer{"a": w})
+	relay.MaxBackoff = 3 * time.Second
+	enqueue(t, db, "a", "a1")
+	enqueue(t, db, "b", "b1")
+
+	row := func(value string) (attempts int, delay int64, lastError sql.NullString) {
+		assert.NoError(t, db.QueryRowContext(t.Context(),
+			`SELECT attempts, nextAttemptAt-unixepoch(), lastError FROM outbox WHERE CAST(value AS TEXT)=?`, value).
+			Scan(&attempts, &delay, &lastError))
+		return
+	}
+	// 1s, 2s, 4s... capped by MaxBackoff
+	for i, want := range []int64{1, 2, 3, 3} {
+		retryNow(t, db, "a")
+		retryNow(t, db, "b")
+		sent, err := relay.RelayPending(t.Context())
+		assert.NoError(t, err)
+		assert.Zero(t, sent)
+		attempts, delay, lastError := row("a1")
+		assert.Equal(t, i+1, attempts)
+		assert.InDelta(t, want, delay, 1)
+		assert.Equal(t, "broker down", lastError.String)
+	}
+	// a topic without a writer is retried the same way
+	_, _, lastError := row("b1")
+	assert.Equal(t, ErrNoWriter.Error(), lastError.String)
+
+	w.err = nil
+	retryNow(t, db, "a")
+	sent, err := relay.RelayPending(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, []string{"a1"}, w.sent)
+	attempts, _, lastError := row("a1")
+	assert.Equal(t, 5, attempts)
+	assert.False(t, lastError.Valid)
+}
+
+func TestRelay_TopicBlocking(t *testing.T) {
+	db := createTestDB(t)
+	a, b := &testWriter{err: errors.New("broker down")}, &testWriter{}
+	relay := NewRelay(db, map[string]Writer{"a": a, "b": b})
+	enqueue(t, db, "a", "a1")
+	enqueue(t, db, "b", "b1")
+	enqueue(t, db, "a", "a2")
+
+	sent, err := relay.RelayPending(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, []string{"b1"}, b.sent)
+
+	// the waiting rows of "a" hold back its later rows, other topics go on
+	a.err = nil
+	_, err = db.ExecContext(t.Context(), `UPDATE outbox SET nextAttemptAt=unixepoch()+60 WHERE topic='a'`)
+	assert.NoError(t, err)
+	enqueue(t, db, "a", "a3")
+	enqueue(t, db, "b", "b2")
+	sent, err = relay.RelayPending(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Empty(t, a.sent)
+	assert.Equal(t, []string{"b1", "b2"}, b.sent)
+
+	// once due, the topic is published in the order rows were stored
+	retryNow(t, db, "a")
+	sent, err = relay.RelayPending(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, sent)
+	assert.Equal(t, []string{"a1", "a2", "a3"}, a.sent)
+
+	// batches are limited, the rest waits for the next pass
+	relay.BatchSize = 2
+	enqueue(t, db, "b", "b3", "b4", "b5")
+	sent, err = relay.RelayPending(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, sent)
+	sent, err = relay.RelayPending(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, []string{"b1", "b2", "b3", "b4", "b5"}, b.sent)
+}
+
+func TestRelay_Retention(t *testing.T) {
+	db := createTestDB(t)
+	a := &testWriter{}
+	relay := NewRelay(db, map[string]Writer{"a": a})
+	relay.Retention = time.Hour
+	enqueue(t, db, "a", "old", "recent")
+	sent, err := relay.RelayPending(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, sent)
+	_, err = db.ExecContext(t.Context(), `UPDATE outbox SET sentAt=unixepoch()-7200 WHERE CAST(value AS TEXT)='old'`)
+	assert.NoError(t, err)
+	enqueue(t, db, "c", "pending")
+
+	// sent rows older than the retention are deleted, pending ones are kept whatever their age
+	_, err = db.ExecContext(t.Context(), `UPDATE outbox SET createdAt=unixepoch()-7200 WHERE CAST(value AS TEXT)='pending'`)
+	assert.NoError(t, err)
+	_, err = relay.RelayPending(t.Context())
+	assert.NoError(t, err)
+	rows, err := db.QueryContext(t.Context(), `SELECT value FROM outbox ORDER BY id`)
+	assert.NoError(t, err)
+	defer rows.Close()
+	values := []string{}
+	for rows.Next() {
+		var v string
+		assert.NoError(t, rows.Scan(&v))
+		values = append(values, v)
+	}
+	assert.NoError(t, rows.Err())
+	assert.Equal(t, []string{"recent", "pending"}, values)
+}
+
+func TestRelay_FailingTopicBacklog(t *testing.T) {
+	db := createTestDB(t)
+	a, b := &testWriter{err: errors.New("broker down")}, &testWriter{}
+	relay := NewRelay(db, map[string]Writer{"a": a, "b": b})
+	relay.BatchSize = 2
+	enqueue(t, db, "a", "a1", "a2", "a3", "a4")
+	enqueue(t, db, "b", "b1")
+
+	// the backlog of the failing topic doesn't fill the batch of the healthy one
+	sent, err := relay.RelayPending(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, []string{"b1"}, b.sent)
+
+	// while "a" waits for its next attempt, "b" gets full batches
+	enqueue(t, db, "b", "b2", "b3", "b4")
+	sent, err = relay.RelayPending(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, sent)
+	assert.Equal(t, []string{"b1", "b2", "b3"}, b.sent)
+	var waiting int
+	assert.NoError(t, db.QueryRowContext(t.Context(),
+		`SELECT COUNT(*) FROM outbox WHERE topic='a' AND attempts=1 AND sentAt IS NULL`).Scan(&waiting))
+	assert.Equal(t, 2, waiting, "only the first batch of the failing topic was attempted")
+}
@@ -0,0 +1,230 @@
+package eventsUFUT
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+)
+
+var (
+	ErrMissingMetadata          = errors.New("event metadata header missing")
+	ErrUnknownEventType         = errors.New("unknown event type")
+	ErrUnsupportedSchemaVersion = errors.New("unsupported event schema version")
+)
+
+// Event types, payloads are listed next to each group
+const (
+	// structsUFUT.ItemDataRSC, topic catalog_events, keyed by itemID
+	ItemCreated = "item.created"
+	ItemUpdated = "item.updated"
+	ItemDeleted = "item.deleted"
+
+	// structsUFUT.ExchangeRatesRSC, topic exchange_rates, keyed by reference currency
+	ExchangeRatesUpdated = "exchange_rates.updated"
+
+	// structsUFUT.ModerationNotification, topic notifications, keyed by sellerID
+	ItemModerated = "seller.item_moderated"
+
+	// structsUFUT.ShoppingCartRMP, topic order_process, keyed by correlation ID
+	ReservationRequested = "order.reservation_requested"
+	ReleaseRequested     = "order.release_requested"
+
+	// structsUFUT.OrderStatusChangeRMP, topic order_events, keyed by userID
+	OrderStatusChanged = "order.status_changed"
+
+	// structsUFUT.InventoryOrderNotification, topic notifications, keyed by correlation ID
+	ItemsReserved = "inventory.items_reserved"
+	ItemsReleased = "inventory.items_released"
+
+	// structsUFUT.PaymentRequestRMP, topic payments, keyed by correlation ID
+	PaymentRequested = "payment.requested"
+	// payment of the correlation ID made after the saga gave up on it, same payload as the request
+	RefundRequested = "payment.refund_requested"
+
+	// structsUFUT.PaymentResultRMP, topic payment_results, keyed by correlation ID
+	PaymentSucceeded = "payment.succeeded"
+	PaymentFailed    = "payment.failed"
+)
+
+/*
+Schema version of every event type, bumped on incompatible changes of the payload.
+Producers stamp it and consumers reject other versions, so both sides read the same table
+*/
+var schemaVersions = map[string]int{
+	// version 1 wrapped the item into a JSON envelope
+	ItemCreated: 2,
+	ItemUpdated: 2,
+	ItemDeleted: 2,
+
+	ExchangeRatesUpdated: 1,
+	ItemModerated:        1,
+	ReservationRequested: 1,
+	ReleaseRequested:     1,
+	ItemsReserved:        1,
+	ItemsReleased:        1,
+	PaymentRequested:     1,
+	RefundRequested:      1,
+	PaymentSucceeded:     1,
+	PaymentFailed:        1,
+
+	// version 1 identified the order by its per-user number
+	OrderStatusChanged: 2,
+}
+
+// Kafka headers carrying the metadata, the message value is the payload only
+const (
+	HeaderEventType     = "eventType"
+	HeaderSchemaVersion = "schemaVersion"
+	HeaderEventID       = "eventID"
+	HeaderCorrelationID = "correlationID"
+	HeaderProducer      = "producer"
+	HeaderOccurredAt    = "occurredAt"
+)
+
+/*
+Metadata of the event.
+CorrelationID ties events of one business flow (e.g. placement of an order) together, empty if there is none
+*/
+type Metadata struct {
+	Type          string
+	SchemaVersion int
+	EventID       string
+	CorrelationID string
+	Producer      string
+	OccurredAt    time.Time
+}
+
+type Envelope[T any] struct {
+	Metadata
+	Payload T
+}
+
+/*
+Returns the current schema version of the event type, 0 for unknown types
+*/
+func SchemaVersion(eventType string) int {
+	return schemaVersions[eventType]
+}
+
+/*
+Creates the event with a new time-ordered event ID and the current schema version of its type
+*/
+func New[T any](eventType, producer, correlationID string, payload T) (*Envelope[T], error) {
+	version := SchemaVersion(eventType)
+	if version == 0 {
+		return nil, errors.Join(ErrUnknownEventType, errors.New(eventType))
+	}
+	uid, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope[T]{
+		Metadata: Metadata{
+			Type:          eventType,
+			SchemaVersion: version,
+			EventID:       uid.String(),
+			CorrelationID: correlationID,
+			Producer:      producer,
+			OccurredAt:    time.Now().UTC(),
+		},
+		Payload: payload,
+	}, nil
+}
+
+/*
+Builds Kafka message of the event; messages with equal keys keep their order
+*/
+func (e *Envelope[T]) Message(key string) (kafka.Message, error) {
+	jsonData, err := json.Marshal(e.Payload)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	headers := []kafka.Header{
+		{Key: HeaderEventType, Value: []byte(e.Type)},
+		{Key: HeaderSchemaVersion, Value: []byte(strconv.Itoa(e.SchemaVersion))},
+		{Key: HeaderEventID, Value: []byte(e.EventID)},
+		{Key: HeaderProducer, Value: []byte(e.Producer)},
+		{Key: HeaderOccurredAt, Value: []byte(e.OccurredAt.Format(time.RFC3339Nano))},
+	}
+	if e.CorrelationID != "" {
+		headers = append(headers, kafka.Header{Key: HeaderCorrelationID, Value: []byte(e.CorrelationID)})
+	}
+	return kafka.Message{
+		Key:     []byte(key),
+		Value:   jsonData,
+		Headers: headers,
+	}, nil
+}
+
+/*
+Creates the event and builds its Kafka message in one step
+*/
+func NewMessage[T any](eventType, producer, correlationID, key string, payload T) (kafka.Message, error) {
+	event, err := New(eventType, producer, correlationID, payload)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	return event.Message(key)
+}
+
+/*
+Reads the metadata from message headers. Messages without type, version or ID,
+of unknown types or of versions other than the current one are rejected
+*/
+func ReadMetadata(msg kafka.Message) (Metadata, error) {
+	var meta Metadata
+	var version, occurredAt string
+	for _, h := range msg.Headers {
+		switch h.Key {
+		case HeaderEventType:
+			meta.Type = string(h.Value)
+		case HeaderSchemaVersion:
+			version = string(h.Value)
+		case HeaderEventID:
+			meta.EventID = string(h.Value)
+		case HeaderCorrelationID:
+			meta.CorrelationID = string(h.Value)
+		case HeaderProducer:
+			meta.Producer = string(h.Value)
+		case HeaderOccurredAt:
+			occurredAt = string(h.Value)
+		}
+	}
+	if meta.Type == "" || version == "" || meta.EventID == "" {
+		return meta, ErrMissingMetadata
+	}
+	current := SchemaVersion(meta.Type)
+	if current == 0 {
+		return meta, errors.Join(ErrUnknownEventType, errors.New(meta.Type))
+	}
+	v, err := strconv.Atoi(version)
+	if err != nil || v != current {
+		return meta, errors.Join(ErrUnsupportedSchemaVersion, errors.New(meta.Type+" v"+version))
+	}
+	meta.SchemaVersion = v
+	if occurredAt != "" {
+		if t, err := time.Parse(time.RFC3339Nano, occurredAt); err == nil {
+			meta.OccurredAt = t
+		}
+	}
+	return meta, nil
+}
+
+/*
+Decodes the event of the message; see ReadMetadata for rejected messages
+*/
+func Decode[T any](msg kafka.Message) (*Envelope[T], error) {
+	meta, err := ReadMetadata(msg)
+	if err != nil {
+		return nil, err
+	}
+	event := &Envelope[T]{Metadata: meta}
+	if err := json.Unmarshal(msg.Value, &event.Payload); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
@@ -0,0 +1,45 @@
+package eventsUFUT
+
+import (
+	"strconv"
+	"testing"
+	structsUFUT "ufut/lib/structs"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvelope(t *testing.T) {
+	cart := structsUFUT.ShoppingCartRMP{UserID: "u1", ItemsID: []string{"book"}, Quantities: []int{2}}
+	msg, err := NewMessage(ReservationRequested, "orders_service", "c1", "c1", cart)
+	assert.NoError(t, err)
+	assert.Equal(t, "c1", string(msg.Key))
+	assert.JSONEq(t, `{"userID":"u1","itemsID":["book"],"quantities":[2]}`, string(msg.Value))
+
+	event, err := Decode[structsUFUT.ShoppingCartRMP](msg)
+	assert.NoError(t, err)
+	assert.Equal(t, ReservationRequested, event.Type)
+	assert.Equal(t, 1, event.SchemaVersion)
+	assert.Equal(t, "c1", event.CorrelationID)
+	assert.Equal(t, "orders_service", event.Producer)
+	assert.NotEmpty(t, event.EventID)
+	assert.False(t, event.OccurredAt.IsZero())
+	assert.Equal(t, cart, event.Payload)
+
+	_, err = New("order.unknown", "orders_service", "", cart)
+	assert.ErrorIs(t, err, ErrUnknownEventType)
+
+	_, err = Decode[structsUFUT.ShoppingCartRMP](kafka.Message{Value: msg.Value})
+	assert.ErrorIs(t, err, ErrMissingMetadata)
+
+	old := msg
+	old.Headers = nil
+	for _, h := range msg.Headers {
+		if h.Key == HeaderSchemaVersion {
+			h.Value = []byte(strconv.Itoa(SchemaVersion(ReservationRequested) + 1))
+		}
+		old.Headers = append(old.Headers, h)
+	}
+	_, err = ReadMetadata(old)
+	assert.ErrorIs(t, err, ErrUnsupportedSchemaVersion)
+}
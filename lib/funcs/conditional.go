@@ -0,0 +1,65 @@
+package funcsUFUT
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+/*
+Builds strong ETag from the given parts
+*/
+func ETagOf(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+/*
+Sets ETag and Last-Modified headers (empty etag and zero lastModified are skipped)
+and answers the conditional GET. Returns true if 304 Not Modified was written
+and the handler must not write the body.
+If-Modified-Since is only consulted when If-None-Match is absent
+*/
+func CheckNotModified(w http.ResponseWriter, r *http.Request, etag string, lastModified time.Time) bool {
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if etag != "" && etagMatches(inm, etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		t, err := http.ParseTime(ims)
+		if err == nil && !lastModified.Truncate(time.Second).After(t) {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Weak comparison of If-None-Match list against etag, as RFC 9110 requires for GET
+*/
+func etagMatches(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
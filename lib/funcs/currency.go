@@ -0,0 +1,156 @@
+package funcsUFUT
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	structsUFUT "ufut/lib/structs"
+)
+
+var (
+	ErrUnknownCurrency = errors.New("unknown currency")
+	ErrNoExchangeRate  = errors.New("no exchange rate for currency")
+	ErrInvalidRate     = errors.New("exchange rate must be a positive decimal number")
+)
+
+// number of minor units digits of ISO 4217 currencies
+var currencyExponents = map[string]int{
+	"AED": 2, "ARS": 2, "AUD": 2, "BHD": 3, "BRL": 2, "CAD": 2, "CHF": 2, "CLP": 0,
+	"CNY": 2, "CZK": 2, "DKK": 2, "EUR": 2, "GBP": 2, "HKD": 2, "HUF": 2, "IDR": 2,
+	"ILS": 2, "INR": 2, "ISK": 0, "JOD": 3, "JPY": 0, "KRW": 0, "KWD": 3, "KZT": 2,
+	"MXN": 2, "MYR": 2, "NOK": 2, "NZD": 2, "OMR": 3, "PHP": 2, "PLN": 2, "RON": 2,
+	"RUB": 2, "SAR": 2, "SEK": 2, "SGD": 2, "THB": 2, "TRY": 2, "TWD": 2, "UAH": 2,
+	"USD": 2, "VND": 0, "ZAR": 2,
+}
+
+/*
+Returns the upper-cased ISO 4217 code, or ErrUnknownCurrency
+*/
+func NormalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if _, ok := currencyExponents[code]; !ok {
+		return "", ErrUnknownCurrency
+	}
+	return code, nil
+}
+
+/*
+Returns the number of minor unit digits of the currency (2 for USD, 0 for JPY)
+*/
+func CurrencyExponent(code string) (int, bool) {
+	exp, ok := currencyExponents[code]
+	return exp, ok
+}
+
+/*
+Immutable exchange rate table, every rate is relative to the reference currency
+*/
+type ExchangeRates struct {
+	reference string
+	rates     map[string]*big.Rat
+}
+
+/*
+Validates the table; the reference currency always has rate 1
+*/
+func NewExchangeRates(table *structsUFUT.ExchangeRatesRSC) (*ExchangeRates, error) {
+	reference, err := NormalizeCurrency(table.Reference)
+	if err != nil {
+		return nil, err
+	}
+	r := &ExchangeRates{
+		reference: reference,
+		rates:     map[string]*big.Rat{reference: big.NewRat(1, 1)},
+	}
+	for _, rate := range table.Rates {
+		code, err := NormalizeCurrency(rate.Currency)
+		if err != nil {
+			return nil, errors.Join(err, errors.New(rate.Currency))
+		}
+		v, ok := new(big.Rat).SetString(strings.TrimSpace(rate.Rate))
+		if !ok || v.Sign() <= 0 {
+			return nil, errors.Join(ErrInvalidRate, errors.New(rate.Currency))
+		}
+		if code == reference && v.Cmp(big.NewRat(1, 1)) != 0 {
+			return nil, errors.Join(ErrInvalidRate, errors.New("reference currency must have rate 1"))
+		}
+		r.rates[code] = v
+	}
+	return r, nil
+}
+
+func (r *ExchangeRates) Reference() string {
+	return r.reference
+}
+
+/*
+Converts amount in minor units of from into minor units of to.
+The conversion is exact and rounded once, half to even, to the minor unit of to;
+callers convert unit prices and multiply afterwards, so line and order totals
+always add up to the converted unit prices shown
+*/
+func (r *ExchangeRates) Convert(amount int64, from, to string) (int64, error) {
+	fromExp, ok := currencyExponents[from]
+	if !ok {
+		return 0, ErrUnknownCurrency
+	}
+	toExp, ok := currencyExponents[to]
+	if !ok {
+		return 0, ErrUnknownCurrency
+	}
+	if from == to {
+		return amount, nil
+	}
+	fromRate, ok := r.rates[from]
+	if !ok {
+		return 0, ErrNoExchangeRate
+	}
+	toRate, ok := r.rates[to]
+	if !ok {
+		return 0, ErrNoExchangeRate
+	}
+	// amount / 10^fromExp / fromRate * toRate * 10^toExp
+	v := new(big.Rat).SetInt64(amount)
+	v.Mul(v, toRate)
+	v.Quo(v, fromRate)
+	v.Mul(v, new(big.Rat).SetFrac(pow10(toExp), pow10(fromExp)))
+	return roundHalfEven(v), nil
+}
+
+/*
+Returns the factor converting minor units of the currency into minor units of the reference currency,
+approximate and meant for ordering amounts of different currencies only
+*/
+func (r *ExchangeRates) ReferenceFactor(code string) (float64, error) {
+	exp, ok := currencyExponents[code]
+	if !ok {
+		return 0, ErrUnknownCurrency
+	}
+	rate, ok := r.rates[code]
+	if !ok {
+		return 0, ErrNoExchangeRate
+	}
+	v := new(big.Rat).SetFrac(pow10(currencyExponents[r.reference]), pow10(exp))
+	v.Quo(v, rate)
+	f, _ := v.Float64()
+	return f, nil
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+func roundHalfEven(v *big.Rat) int64 {
+	q, m := new(big.Int).QuoRem(v.Num(), v.Denom(), new(big.Int))
+	// q is truncated towards zero, compare twice the remainder with the denominator
+	m.Abs(m).Mul(m, big.NewInt(2))
+	switch c := m.Cmp(v.Denom()); {
+	case c > 0, c == 0 && q.Bit(0) == 1:
+		if v.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q.Int64()
+}
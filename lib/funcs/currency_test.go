@@ -0,0 +1,54 @@
+package funcsUFUT
+
+import (
+	"testing"
+	structsUFUT "ufut/lib/structs"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExchangeRates_Convert(t *testing.T) {
+	rates, err := NewExchangeRates(&structsUFUT.ExchangeRatesRSC{
+		Reference: "usd",
+		Rates: []structsUFUT.ExchangeRateRSC{
+			{Currency: "EUR", Rate: "0.5"},
+			{Currency: "JPY", Rate: "150"},
+			{Currency: "KWD", Rate: "0.3"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "USD", rates.Reference())
+
+	cases := []struct {
+		amount   int64
+		from, to string
+		want     int64
+	}{
+		{1999, "USD", "USD", 1999},
+		{1999, "USD", "EUR", 1000}, // 9.995 -> 10.00, half to even
+		{1997, "USD", "EUR", 998},  // 9.985 -> 9.98, half to even
+		{-1999, "USD", "EUR", -1000},
+		{1999, "USD", "JPY", 2998}, // 2998.5 -> 2998
+		{1001, "USD", "JPY", 1502}, // 1501.5 -> 1502
+		{1000, "EUR", "USD", 2000},
+		{150, "JPY", "EUR", 50},
+		{1000, "USD", "KWD", 3000},
+	}
+	for _, c := range cases {
+		got, err := rates.Convert(c.amount, c.from, c.to)
+		assert.NoError(t, err)
+		assert.Equal(t, c.want, got, "%d %s -> %s", c.amount, c.from, c.to)
+	}
+
+	_, err = rates.Convert(100, "USD", "GBP")
+	assert.ErrorIs(t, err, ErrNoExchangeRate)
+	_, err = rates.Convert(100, "USD", "XXX")
+	assert.ErrorIs(t, err, ErrUnknownCurrency)
+
+	_, err = NewExchangeRates(&structsUFUT.ExchangeRatesRSC{Reference: "USD",
+		Rates: []structsUFUT.ExchangeRateRSC{{Currency: "EUR", Rate: "-1"}}})
+	assert.ErrorIs(t, err, ErrInvalidRate)
+	_, err = NewExchangeRates(&structsUFUT.ExchangeRatesRSC{Reference: "USD",
+		Rates: []structsUFUT.ExchangeRateRSC{{Currency: "USD", Rate: "2"}}})
+	assert.ErrorIs(t, err, ErrInvalidRate)
+}
@@ -0,0 +1,50 @@
+package funcsUFUT
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+/*
+Cursor points right after the last row of a keyset-paginated listing.
+SortKey is the value of the column the listing is ordered by,
+ID breaks ties between rows with equal SortKey,
+Order is the direction the cursor was issued for ("asc" or "desc")
+*/
+type Cursor struct {
+	SortKey int64  `json:"k"`
+	ID      string `json:"id"`
+	Order   string `json:"o"`
+}
+
+/*
+Encodes cursor into an opaque URL-safe token
+*/
+func EncodeCursor(c Cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+/*
+Decodes token produced by EncodeCursor.
+order must match the direction the cursor was issued for
+*/
+func DecodeCursor(token, order string) (Cursor, error) {
+	var c Cursor
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	if c.Order != order {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
@@ -0,0 +1,133 @@
+package funcsUFUT
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidLocale = errors.New("locale must be a language tag like en, pt-BR or zh-Hant-TW")
+)
+
+// MaxAcceptLanguages bounds the number of Accept-Language entries taken into account
+const MaxAcceptLanguages = 10
+
+/*
+Validates a BCP 47 language tag of the form language[-Script][-REGION]
+and returns it in canonical case: "PT-br" becomes "pt-BR", "zh-hant" becomes "zh-Hant"
+*/
+func NormalizeLocale(tag string) (string, error) {
+	parts := strings.Split(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"), "-")
+	if len(parts) > 3 || !isLetters(parts[0]) || len(parts[0]) < 2 || len(parts[0]) > 3 {
+		return "", ErrInvalidLocale
+	}
+	res := []string{strings.ToLower(parts[0])}
+	rest := parts[1:]
+	if len(rest) > 0 && len(rest[0]) == 4 && isLetters(rest[0]) {
+		res = append(res, strings.ToUpper(rest[0][:1])+strings.ToLower(rest[0][1:]))
+		rest = rest[1:]
+	}
+	if len(rest) > 0 {
+		region := rest[0]
+		switch {
+		case len(region) == 2 && isLetters(region):
+			res = append(res, strings.ToUpper(region))
+		case len(region) == 3 && isDigits(region):
+			res = append(res, region)
+		default:
+			return "", ErrInvalidLocale
+		}
+		rest = rest[1:]
+	}
+	if len(rest) > 0 {
+		return "", ErrInvalidLocale
+	}
+	return strings.Join(res, "-"), nil
+}
+
+/*
+Returns locales of the Accept-Language header ordered by preference;
+invalid entries, "*" and entries with q=0 are skipped
+*/
+func ParseAcceptLanguage(header string) []string {
+	type weighted struct {
+		locale string
+		q      float64
+	}
+	var entries []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		locale, err := NormalizeLocale(tag)
+		if err != nil || q <= 0 {
+			continue
+		}
+		entries = append(entries, weighted{locale: locale, q: q})
+		if len(entries) == MaxAcceptLanguages {
+			break
+		}
+	}
+	// stable, so entries of equal weight keep the client's order
+	slices.SortStableFunc(entries, func(a, b weighted) int {
+		return cmp.Compare(b.q, a.q)
+	})
+	locales := make([]string, 0, len(entries))
+	for _, e := range entries {
+		locales = append(locales, e.locale)
+	}
+	return locales
+}
+
+/*
+Returns the lookup order for the preferred locales: every locale is followed by its
+less specific forms ("zh-Hant-TW", "zh-Hant", "zh"), defaultLocale comes last.
+Duplicates are dropped
+*/
+func LocaleFallbacks(preferred []string, defaultLocale string) []string {
+	var chain []string
+	add := func(locale string) {
+		if !slices.Contains(chain, locale) {
+			chain = append(chain, locale)
+		}
+	}
+	for _, locale := range preferred {
+		for {
+			add(locale)
+			i := strings.LastIndex(locale, "-")
+			if i < 0 {
+				break
+			}
+			locale = locale[:i]
+		}
+	}
+	add(defaultLocale)
+	return chain
+}
+
+func isLetters(s string) bool {
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
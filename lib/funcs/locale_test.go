@@ -0,0 +1,36 @@
+package funcsUFUT
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeLocale(t *testing.T) {
+	for tag, want := range map[string]string{
+		"en":         "en",
+		"PT-br":      "pt-BR",
+		"zh_hant_tw": "zh-Hant-TW",
+		"es-419":     "es-419",
+	} {
+		got, err := NormalizeLocale(tag)
+		assert.NoError(t, err, tag)
+		assert.Equal(t, want, got)
+	}
+	for _, tag := range []string{"", "e", "english", "en-USA", "en-US-x", "*", "1a"} {
+		_, err := NormalizeLocale(tag)
+		assert.ErrorIs(t, err, ErrInvalidLocale, tag)
+	}
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	assert.Equal(t, []string{"fr-CA", "fr", "en-US", "de"},
+		ParseAcceptLanguage("fr-CA, de;q=0.5, *;q=0.1, fr;q=0.9, bad tag, en-US;q=0.9, it;q=0"))
+	assert.Empty(t, ParseAcceptLanguage(""))
+}
+
+func TestLocaleFallbacks(t *testing.T) {
+	assert.Equal(t, []string{"zh-Hant-TW", "zh-Hant", "zh", "en"}, LocaleFallbacks([]string{"zh-Hant-TW", "zh"}, "en"))
+	assert.Equal(t, []string{"pt-BR", "pt", "en-GB", "en"}, LocaleFallbacks([]string{"pt-BR", "en-GB"}, "en"))
+	assert.Equal(t, []string{"en"}, LocaleFallbacks(nil, "en"))
+}
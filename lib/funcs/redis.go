@@ -0,0 +1,25 @@
+package funcsUFUT
+
+import (
+	"context"
+	structsUFUT "ufut/lib/structs"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func NewRedisClient(ctx context.Context, cfg *structsUFUT.RedisConfig) (*redis.Client, error) {
+	db := redis.NewClient(&redis.Options{
+		Addr:         cfg.Addr,
+		Password:     cfg.Password,
+		DB:           cfg.DB,
+		Username:     cfg.User,
+		MaxRetries:   cfg.MaxRetries,
+		DialTimeout:  cfg.DialTimeout,
+		ReadTimeout:  cfg.Timeout,
+		WriteTimeout: cfg.Timeout,
+	})
+	if err := db.Ping(ctx).Err(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
@@ -1,22 +1,178 @@
 package structsUFUT
 
+import "time"
+
+const (
+	ItemStatusDraft         = "draft"
+	ItemStatusPendingReview = "pending_review"
+	ItemStatusAvailable     = "available"
+	ItemStatusOutOfStock    = "out_of_stock"
+	ItemStatusArchived      = "archived"
+	ItemStatusDeleted       = "deleted"
+)
+
 type ItemsRequestRSC struct {
 	Category   string `json:"category"`
 	Price      int    `json:"price"`
 	StartIndex int    `json:"startIndex"`
 	Count      int    `json:"count"`
 	OrderBy    string `json:"orderBy"`
+	Cursor     string `json:"cursor"`
+	SellerID   string `json:"sellerID"`
+	// Statuses limits the listing to these statuses, only available items are listed if empty
+	Statuses []string `json:"statuses"`
 }
 type ItemsResponseRSC struct {
-	ItemsIDs []string `json:"itemsID"`
+	ItemsIDs     []string  `json:"itemsID"`
+	Versions     []int64   `json:"versions"`
+	LastModified time.Time `json:"lastModified"`
+	NextCursor   string    `json:"next_cursor"`
 }
 
 type ItemDataRSC struct {
 	ItemID      string `json:"itemID"`
 	SellerID    string `json:"sellerID"`
+	SKU         string `json:"sku"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
-	Price       int    `json:"price"`
-	Category    string `json:"category"`
-	Status      string `json:"status"`
+	// prices are in minor units of Currency (ISO 4217), Price is the effective price at the time of the read;
+	// RegularPrice and SaleEndsAt are set only while a sale price is in effect
+	Price        int        `json:"price"`
+	Currency     string     `json:"currency"`
+	RegularPrice int        `json:"regularPrice,omitempty"`
+	SaleEndsAt   *time.Time `json:"saleEndsAt,omitempty"`
+	Category     string     `json:"category"`
+	Status       string     `json:"status"`
+	Images       []string   `json:"images"`
+	Version      int64      `json:"version"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+	// Locale of Name and Description and CategoryName (display name of Category) are set on localized reads
+	Locale       string `json:"locale,omitempty"`
+	CategoryName string `json:"categoryName,omitempty"`
+	// Translations are set in item events only
+	Translations []ItemTranslationRSC `json:"translations,omitempty"`
+}
+
+type ItemTranslationRSC struct {
+	ItemID      string    `json:"itemID"`
+	Locale      string    `json:"locale"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	UpdatedBy   string    `json:"updatedBy"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+type CategoryTranslationRSC struct {
+	Category    string    `json:"category"`
+	Locale      string    `json:"locale"`
+	DisplayName string    `json:"displayName"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+const (
+	// PriceKindRegular replaces the item's price from StartsAt on
+	PriceKindRegular = "regular"
+	// PriceKindSale overrides the regular price from StartsAt until EndsAt
+	PriceKindSale = "sale"
+)
+
+type ItemPriceRSC struct {
+	PriceID   int64      `json:"priceID"`
+	ItemID    string     `json:"itemID"`
+	Kind      string     `json:"kind"`
+	Price     int        `json:"price"`
+	Currency  string     `json:"currency"`
+	StartsAt  time.Time  `json:"startsAt"`
+	EndsAt    *time.Time `json:"endsAt,omitempty"`
+	CreatedBy string     `json:"createdBy"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+type ItemsBatchRequestRSC struct {
+	ItemsIDs []string `json:"itemsID"`
+}
+
+type ItemsBatchResponseRSC struct {
+	Items    []ItemDataRSC `json:"items"`
+	NotFound []string      `json:"notFound"`
+}
+
+type ItemImageRSC struct {
+	ImageID     string `json:"imageID"`
+	ItemID      string `json:"itemID"`
+	SellerID    string `json:"sellerID"`
+	Position    int    `json:"position"`
+	ContentType string `json:"contentType"`
+}
+
+type ImportRowErrorRSC struct {
+	Row   int    `json:"row"`
+	SKU   string `json:"sku"`
+	Error string `json:"error"`
+}
+
+type ImportReportRSC struct {
+	DryRun  bool                `json:"dryRun"`
+	Rows    int                 `json:"rows"`
+	Created int                 `json:"created"`
+	Updated int                 `json:"updated"`
+	Errors  []ImportRowErrorRSC `json:"errors"`
+}
+
+const (
+	ModerationApproved = "approved"
+	ModerationRejected = "rejected"
+)
+
+type ModerationDecisionRSC struct {
+	ItemID      string    `json:"itemID"`
+	ModeratorID string    `json:"moderatorID"`
+	Decision    string    `json:"decision"`
+	Reason      string    `json:"reason"`
+	DecidedAt   time.Time `json:"decidedAt"`
+}
+
+type ItemStatusChangeRSC struct {
+	ItemID     string    `json:"itemID"`
+	FromStatus string    `json:"fromStatus"`
+	ToStatus   string    `json:"toStatus"`
+	ActorID    string    `json:"actorID"`
+	Reason     string    `json:"reason,omitempty"`
+	ChangedAt  time.Time `json:"changedAt"`
+}
+
+type ModerationQueueRequestRSC struct {
+	Count  int    `json:"count"`
+	Cursor string `json:"cursor"`
+}
+
+type ModerationQueueResponseRSC struct {
+	Items      []ItemDataRSC `json:"items"`
+	NextCursor string        `json:"next_cursor"`
+}
+
+type SellerProfileRSC struct {
+	SellerID    string    `json:"sellerID"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Rating      float64   `json:"rating"`
+	RatingCount int       `json:"ratingCount"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+type SellerRatingRSC struct {
+	SellerID string `json:"sellerID"`
+	UserID   string `json:"userID"`
+	Rating   int    `json:"rating"`
+}
+
+type SuggestionRSC struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+type SuggestResponseRSC struct {
+	Query       string          `json:"query"`
+	Suggestions []SuggestionRSC `json:"suggestions"`
+	Popular     []string        `json:"popular"`
 }
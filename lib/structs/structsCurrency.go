@@ -0,0 +1,15 @@
+package structsUFUT
+
+import "time"
+
+type ExchangeRateRSC struct {
+	Currency string `json:"currency"`
+	// Rate is a decimal number of Currency major units per one major unit of the reference currency
+	Rate string `json:"rate"`
+}
+
+type ExchangeRatesRSC struct {
+	Reference string            `json:"reference"`
+	Rates     []ExchangeRateRSC `json:"rates"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+}
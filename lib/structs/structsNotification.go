@@ -1,7 +1,18 @@
 package structsUFUT
 
+/*
+Result of the reservation request, ItemsAvailability is parallel to ItemsIDs
+and empty when the reservation is released
+*/
 type InventoryOrderNotification struct {
-	Action            string   `json:"action"`
 	ItemsAvailability []bool   `json:"itemsAvailability"`
 	ItemsIDs          []string `json:"itemsIDs"`
 }
+
+type ModerationNotification struct {
+	Action   string `json:"action"`
+	SellerID string `json:"sellerID"`
+	ItemID   string `json:"itemID"`
+	Decision string `json:"decision"`
+	Reason   string `json:"reason"`
+}
@@ -1,14 +1,91 @@
 package structsUFUT
 
+/*
+OrderID is the UUIDv7 of the order, people are shown its OrderNumber
+*/
 type OrderRequestRMP struct {
-	OrderID int    `json:"orderID"`
-	UserID  string `json:"userID"`
-	Status  string `json:"status"`
+	OrderID  string `json:"orderID"`
+	UserID   string `json:"userID"`
+	Status   string `json:"status"`
+	Cursor   string `json:"cursor"`
+	Count    int    `json:"count"`
+	Currency string `json:"currency"`
+}
+
+// Statuses of an order, the orders service validates the transitions between them
+const (
+	OrderCreated   = "CREATED"
+	OrderPreparing = "PREPARING"
+	OrderDelivery  = "DELIVERY"
+	OrderFinished  = "FINISHED"
+	OrderCancelled = "CANCELLED"
+)
+
+/*
+Status change of an order, an entry of its timeline and the payload of order.status_changed events.
+From is empty for the entry of the created order; ChangedBy is the user or staff member who made the change
+*/
+type OrderStatusChangeRMP struct {
+	UserID    string `json:"userID"`
+	OrderID   string `json:"orderID"`
+	From      string `json:"from,omitempty"`
+	To        string `json:"to"`
+	ChangedBy string `json:"changedBy"`
+	ChangedAt int64  `json:"changedAt"`
+	// sellers of the order's lines, set when the order is FINISHED
+	SellerIDs []string `json:"sellerIDs,omitempty"`
+}
+
+type OrderHistoryRMP struct {
+	History []OrderStatusChangeRMP `json:"history"`
+}
+
+/*
+Line of an order as it was sold, name, seller and price are snapshots taken when the order was placed.
+UnitPrice and LineTotal are in minor units of Currency, null for items whose price wasn't known then.
+Discount (line discount, promotion and coupon) and Tax are the line's share of the quote the order was placed with,
+LineTotal = UnitPrice * Quantity - Discount + Tax
+*/
+type OrderLineRMP struct {
+	ItemID    string `json:"itemID"`
+	Name      string `json:"name"`
+	SellerID  string `json:"sellerID"`
+	Quantity  int    `json:"quantity"`
+	UnitPrice *int64 `json:"unitPrice"`
+	Discount  int64  `json:"discount"`
+	Tax       int64  `json:"tax"`
+	LineTotal *int64 `json:"lineTotal"`
+	Currency  string `json:"currency"`
+}
+
+type OrderTotalRMP struct {
+	Currency string `json:"currency"`
+	Amount   int64  `json:"amount"`
+}
+
+/*
+Order with its lines and timeline. Totals is the total of Quote, shipping included;
+orders placed without a quote sum their priced lines, one total per currency of the lines.
+Quote is the checkout breakdown the order was placed with, nil for orders placed before it was kept;
+CreatedAt and UpdatedAt (last status change) are unix seconds
+*/
+type OrderDetailRMP struct {
+	OrderID     string                 `json:"orderID"`
+	OrderNumber int64                  `json:"orderNumber"`
+	Status      string                 `json:"status"`
+	Lines       []OrderLineRMP         `json:"lines"`
+	Totals      []OrderTotalRMP        `json:"totals"`
+	Quote       *QuoteRMP              `json:"quote,omitempty"`
+	History     []OrderStatusChangeRMP `json:"history"`
+	CreatedAt   int64                  `json:"createdAt"`
+	UpdatedAt   int64                  `json:"updatedAt"`
 }
 
 type OrdersResponseRMP struct {
-	OrderID []int    `json:"ordersID"`
-	Status  []string `json:"statuses"`
+	OrderID      []string `json:"ordersID"`
+	OrderNumbers []int64  `json:"orderNumbers"`
+	Status       []string `json:"statuses"`
+	NextCursor   string   `json:"next_cursor"`
 }
 
 type ItemRequestRMP struct {
@@ -22,3 +99,255 @@ type ShoppingCartRMP struct {
 	ItemsID    []string `json:"itemsID"`
 	Quantities []int    `json:"quantities"`
 }
+
+/*
+Cart with prices converted into Currency, amounts are in its minor units.
+UnitPrices and LineTotals are parallel to ItemsID, null for items without a known price;
+Total sums the priced lines only
+*/
+type PricedCartRMP struct {
+	ItemsID    []string `json:"itemsID"`
+	Quantities []int    `json:"quantities"`
+	Currency   string   `json:"currency"`
+	UnitPrices []*int64 `json:"unitPrices"`
+	LineTotals []*int64 `json:"lineTotals"`
+	Total      int64    `json:"total"`
+}
+
+type CatalogPriceRMP struct {
+	Price    int64
+	Currency string
+	Category string
+	SellerID string
+}
+
+/*
+Rules of the checkout totals, amounts are in minor units of the service currency and rates in basis points.
+Regions are looked up by the region of the quote, the "" region applies to regions that aren't listed
+*/
+type PricingRulesRMP struct {
+	Regions       map[string]RegionRulesRMP `json:"regions"`
+	LineDiscounts []LineDiscountRuleRMP     `json:"lineDiscounts"`
+	Promotions    []PromotionRuleRMP        `json:"promotions"`
+}
+
+/*
+ShippingFee is charged unless the discounted merchandise reaches FreeShippingFrom (0 never waives it).
+TaxRates are per category, the "" category applies to other categories and to shipping
+*/
+type RegionRulesRMP struct {
+	ShippingFee      int64            `json:"shippingFee"`
+	FreeShippingFrom int64            `json:"freeShippingFrom"`
+	TaxRates         map[string]int64 `json:"taxRates"`
+}
+
+/*
+Discount of lines of Category ("" for any) bought at least MinQuantity times in Region ("" for any).
+A line gets the largest of the discounts it qualifies for
+*/
+type LineDiscountRuleRMP struct {
+	Name        string `json:"name"`
+	Category    string `json:"category"`
+	Region      string `json:"region"`
+	MinQuantity int    `json:"minQuantity"`
+	PercentBps  int64  `json:"percentBps"`
+}
+
+/*
+Order discount of PercentBps of the discounted merchandise plus Amount, once it reaches MinSubtotal in Region ("" for any).
+An order gets the largest of the promotions it qualifies for
+*/
+type PromotionRuleRMP struct {
+	Name        string `json:"name"`
+	Region      string `json:"region"`
+	MinSubtotal int64  `json:"minSubtotal"`
+	PercentBps  int64  `json:"percentBps"`
+	Amount      int64  `json:"amount"`
+}
+
+/*
+Line of a quote. Subtotal is UnitPrice times Quantity, Discount is its line discount, Promotion and Coupon its shares
+of the order discounts; Tax is charged on the rest, Total adds it
+*/
+type QuoteLineRMP struct {
+	ItemID       string `json:"itemID"`
+	Category     string `json:"category"`
+	SellerID     string `json:"sellerID,omitempty"`
+	Quantity     int    `json:"quantity"`
+	UnitPrice    int64  `json:"unitPrice"`
+	Subtotal     int64  `json:"subtotal"`
+	Discount     int64  `json:"discount"`
+	DiscountName string `json:"discountName,omitempty"`
+	Promotion    int64  `json:"promotion"`
+	Coupon       int64  `json:"coupon"`
+	TaxRateBps   int64  `json:"taxRateBps"`
+	Tax          int64  `json:"tax"`
+	Total        int64  `json:"total"`
+}
+
+/*
+Breakdown of the checkout totals in minor units of Currency:
+Total = Subtotal - LineDiscounts - Promotion - Coupon + Shipping + ShippingTax + Tax, Tax covers the lines only.
+Items without a known price are listed in UnpricedItems and left out.
+CouponError tells why the coupon of CouponCode gives no discount
+*/
+type QuoteRMP struct {
+	Region        string         `json:"region"`
+	Currency      string         `json:"currency"`
+	Lines         []QuoteLineRMP `json:"lines"`
+	UnpricedItems []string       `json:"unpricedItems"`
+	Subtotal      int64          `json:"subtotal"`
+	LineDiscounts int64          `json:"lineDiscounts"`
+	Promotion     int64          `json:"promotion"`
+	PromotionName string         `json:"promotionName,omitempty"`
+	CouponCode    string         `json:"couponCode,omitempty"`
+	Coupon        int64          `json:"coupon"`
+	CouponError   string         `json:"couponError,omitempty"`
+	Shipping      int64          `json:"shipping"`
+	ShippingTax   int64          `json:"shippingTax"`
+	Tax           int64          `json:"tax"`
+	Total         int64          `json:"total"`
+}
+
+/*
+Promo code of PercentBps of the eligible merchandise plus Amount, in minor units of the service currency.
+Eligible are lines of Categories and SellerIDs (empty for any) after line discounts and the promotion,
+they must reach MinSubtotal. Limits count redemptions of orders that aren't cancelled, 0 is unlimited.
+The code is valid from StartsAt until EndsAt (unix seconds, 0 for no bound); Redemptions is read only
+*/
+type CouponRMP struct {
+	Code         string   `json:"code"`
+	PercentBps   int64    `json:"percentBps"`
+	Amount       int64    `json:"amount"`
+	MinSubtotal  int64    `json:"minSubtotal"`
+	PerUserLimit int      `json:"perUserLimit"`
+	GlobalLimit  int      `json:"globalLimit"`
+	StartsAt     int64    `json:"startsAt"`
+	EndsAt       int64    `json:"endsAt"`
+	Categories   []string `json:"categories"`
+	SellerIDs    []string `json:"sellerIDs"`
+	Redemptions  int      `json:"redemptions"`
+	CreatedAt    int64    `json:"createdAt"`
+	UpdatedAt    int64    `json:"updatedAt"`
+}
+
+type CouponsRMP struct {
+	Coupons []CouponRMP `json:"coupons"`
+}
+
+/*
+Use of a coupon by the checkout saga of CorrelationID
+*/
+type CouponRedemptionRMP struct {
+	CorrelationID string
+	UserID        string
+	Code          string
+}
+
+type RecommendationsRMP struct {
+	ItemsIDs []string `json:"itemsID"`
+}
+
+const (
+	PlacementPending = "PENDING"
+	PlacementPlaced  = "PLACED"
+	PlacementFailed  = "FAILED"
+)
+
+// Steps of the checkout saga, the first three are waiting for a reply and have a deadline
+const (
+	SagaReserving   = "RESERVING"
+	SagaPaying      = "PAYING"
+	SagaReleasing   = "RELEASING"
+	SagaStuck       = "STUCK"
+	SagaDone        = "DONE"
+	SagaCompensated = "COMPENSATED"
+)
+
+/*
+Order placement tracked by the correlation ID returned to the client, it is the state of the checkout saga.
+OrderID and OrderNumber are set once the order is PLACED; ItemsAvailability is parallel to ItemsID
+and empty until inventory has answered. Quote of the reserved items is computed for Region and CouponCode
+once inventory has answered, its Total in minor units of Currency is what the payment is requested for
+*/
+type PlacementRMP struct {
+	CorrelationID     string    `json:"correlationID"`
+	UserID            string    `json:"userID"`
+	Status            string    `json:"status"`
+	OrderID           string    `json:"orderID,omitempty"`
+	OrderNumber       int64     `json:"orderNumber,omitempty"`
+	ItemsID           []string  `json:"itemsID"`
+	Quantities        []int     `json:"quantities"`
+	ItemsAvailability []bool    `json:"itemsAvailability,omitempty"`
+	Step              string    `json:"step"`
+	DeadlineAt        int64     `json:"deadlineAt,omitempty"`
+	Retries           int       `json:"retries"`
+	LastError         string    `json:"lastError,omitempty"`
+	Total             int64     `json:"total,omitempty"`
+	Currency          string    `json:"currency,omitempty"`
+	Region            string    `json:"region"`
+	CouponCode        string    `json:"couponCode,omitempty"`
+	Quote             *QuoteRMP `json:"quote,omitempty"`
+	CreatedAt         int64     `json:"createdAt"`
+	UpdatedAt         int64     `json:"updatedAt"`
+}
+
+/*
+Moves the saga to Step if it is in one of the From steps.
+Empty Status, nil ItemsAvailability and nil Quote keep the stored values, DeadlineAt 0 clears the deadline
+*/
+type SagaTransitionRMP struct {
+	From              []string
+	Step              string
+	Status            string
+	DeadlineAt        int64
+	LastError         string
+	ItemsAvailability []bool
+	Total             int64
+	Currency          string
+	Quote             *QuoteRMP
+	Retry             bool
+}
+
+/*
+Steps - optional, only sagas in these steps
+ExpiredBefore - optional, only sagas with a deadline before it
+Count - page size
+*/
+type SagasRequestRMP struct {
+	Steps         []string
+	ExpiredBefore int64
+	Count         int
+}
+
+type SagasResponseRMP struct {
+	Sagas []PlacementRMP `json:"sagas"`
+}
+
+/*
+Payment of the reserved items, Amount is in minor units of Currency.
+Payment services must treat requests with the same correlation ID as one payment
+*/
+type PaymentRequestRMP struct {
+	UserID   string `json:"userID"`
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+type PaymentResultRMP struct {
+	Reason string `json:"reason"`
+}
+
+/*
+Response stored under an Idempotency-Key of the user. RequestHash fingerprints the request the key was first used with;
+Status is 0 while that request is being handled. CreatedAt is unix seconds
+*/
+type IdempotencyRecordRMP struct {
+	UserID      string
+	Key         string
+	RequestHash string
+	Status      int
+	ContentType string
+	Body        []byte
+	CreatedAt   int64
+}